@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/pquerna/otp/totp"
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/config"
+	"github.com/trasta298/kasaneha/backend/internal/openapi"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// testServer runs the API router against a disposable database and the fake AI provider
+type testServer struct {
+	t    *testing.T
+	db   *repository.Database
+	url  string
+	spec routers.Router
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db := pgtest.New(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	taxonomy, err := ai.LookupEmotionTaxonomy("")
+	if err != nil {
+		t.Fatalf("LookupEmotionTaxonomy: %v", err)
+	}
+	aiClient := ai.NewClientWithProvider(ai.NewFakeProvider(), ai.FakeProviderModel, ai.Options{}, logger)
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}
+
+	api, err := newAPI(cfg, db, aiClient, taxonomy, logger)
+	if err != nil {
+		t.Fatalf("newAPI: %v", err)
+	}
+	server := httptest.NewServer(api.router)
+	t.Cleanup(server.Close)
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	spec, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	return &testServer{t: t, db: db, url: server.URL + "/api/v1", spec: spec}
+}
+
+// do sends a request, checks the status code and that the response matches openapi.yaml,
+// and decodes the JSON response into out unless it is nil. It returns the response headers.
+func (s *testServer) do(method, path, token string, body interface{}, wantStatus int, out interface{}) http.Header {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, s.url+path, reader)
+	if err != nil {
+		s.t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode != wantStatus {
+		s.t.Fatalf("%s %s = %d, want %d: %s", method, path, resp.StatusCode, wantStatus, respBody)
+	}
+	s.validateResponse(req, resp, respBody)
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			s.t.Fatalf("failed to decode response of %s %s: %v: %s", method, path, err, respBody)
+		}
+	}
+	return resp.Header
+}
+
+// validateResponse checks a response against the operation openapi.yaml documents for its request
+func (s *testServer) validateResponse(req *http.Request, resp *http.Response, body []byte) {
+	s.t.Helper()
+
+	route, pathParams, err := s.spec.FindRoute(req)
+	if err != nil {
+		s.t.Fatalf("%s %s is not in openapi.yaml: %v", req.Method, req.URL.Path, err)
+	}
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status:  resp.StatusCode,
+		Header:  resp.Header,
+		Body:    io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+	})
+	if err != nil {
+		s.t.Fatalf("response of %s %s does not match openapi.yaml: %v: %s", req.Method, req.URL.Path, err, body)
+	}
+}
+
+// register creates a user and returns its token
+func (s *testServer) register(username string) string {
+	s.t.Helper()
+
+	var response types.LoginResponse
+	s.do(http.MethodPost, "/auth/register", "", types.RegisterRequest{Username: username, Password: pgtest.Password}, http.StatusCreated, &response)
+	if response.Token == "" {
+		s.t.Fatalf("register returned no token")
+	}
+	return response.Token
+}
+
+// waitForAnalysis polls for the analysis a completed session gets in the background
+func (s *testServer) waitForAnalysis(sessionID string) {
+	s.t.Helper()
+
+	analyses := repository.NewAnalysisRepository(s.db)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		analysis, err := analyses.GetAnalysisBySessionID(context.Background(), sessionID)
+		if err != nil {
+			s.t.Fatalf("GetAnalysisBySessionID: %v", err)
+		}
+		if analysis != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.t.Fatalf("session %s was not analyzed", sessionID)
+}
+
+func TestHealth(t *testing.T) {
+	s := newTestServer(t)
+	s.do(http.MethodGet, "/health", "", nil, http.StatusOK, nil)
+}
+
+func TestAuth(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	s.do(http.MethodPost, "/auth/register", "", types.RegisterRequest{Username: "alice", Password: pgtest.Password}, http.StatusConflict, nil)
+	s.do(http.MethodPost, "/auth/register", "", types.RegisterRequest{Username: "al", Password: pgtest.Password}, http.StatusBadRequest, nil)
+
+	var login types.LoginResponse
+	s.do(http.MethodPost, "/auth/login", "", types.LoginRequest{Username: "alice", Password: pgtest.Password}, http.StatusOK, &login)
+	if login.Token == "" || login.User.Username != "alice" {
+		t.Errorf("login = %+v", login)
+	}
+	s.do(http.MethodPost, "/auth/login", "", types.LoginRequest{Username: "alice", Password: "wrong-password"}, http.StatusUnauthorized, nil)
+
+	var me types.User
+	s.do(http.MethodGet, "/auth/me", token, nil, http.StatusOK, &me)
+	if me.Username != "alice" {
+		t.Errorf("me = %+v, want alice", me)
+	}
+	s.do(http.MethodGet, "/auth/me", "", nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/auth/me", "not-a-token", nil, http.StatusUnauthorized, nil)
+}
+
+func TestMFA(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	var enrollment types.MFAEnrollment
+	s.do(http.MethodPost, "/auth/mfa/enroll", token, nil, http.StatusOK, &enrollment)
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	var recovery types.RecoveryCodesResponse
+	s.do(http.MethodPost, "/auth/mfa/verify", token, types.MFACodeRequest{Code: code}, http.StatusOK, &recovery)
+
+	var status types.MFAStatus
+	s.do(http.MethodGet, "/auth/mfa", token, nil, http.StatusOK, &status)
+	if !status.Enabled || status.RecoveryCodesRemaining != len(recovery.RecoveryCodes) {
+		t.Errorf("status = %+v, want enabled with %d recovery codes", status, len(recovery.RecoveryCodes))
+	}
+
+	var challenge types.MFAChallengeResponse
+	s.do(http.MethodPost, "/auth/login", "", types.LoginRequest{Username: "alice", Password: pgtest.Password}, http.StatusOK, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("login = %+v, want an MFA challenge", challenge)
+	}
+
+	// The challenge token is not an access token
+	s.do(http.MethodGet, "/auth/me", challenge.MFAToken, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/auth/login/mfa", "", types.MFALoginRequest{MFAToken: token, Code: recovery.RecoveryCodes[0]}, http.StatusUnauthorized, nil)
+
+	s.do(http.MethodPost, "/auth/login/mfa", "", types.MFALoginRequest{MFAToken: challenge.MFAToken, Code: "000000"}, http.StatusUnauthorized, nil)
+	var login types.LoginResponse
+	s.do(http.MethodPost, "/auth/login/mfa", "", types.MFALoginRequest{MFAToken: challenge.MFAToken, Code: recovery.RecoveryCodes[0]}, http.StatusOK, &login)
+	if login.Token == "" || login.User.Username != "alice" {
+		t.Errorf("login = %+v", login)
+	}
+
+	// The challenge token works only once
+	s.do(http.MethodPost, "/auth/login/mfa", "", types.MFALoginRequest{MFAToken: challenge.MFAToken, Code: recovery.RecoveryCodes[2]}, http.StatusUnauthorized, nil)
+
+	s.do(http.MethodPost, "/auth/mfa/disable", login.Token, types.MFACodeRequest{Code: recovery.RecoveryCodes[1]}, http.StatusOK, nil)
+	s.do(http.MethodPost, "/auth/login", "", types.LoginRequest{Username: "alice", Password: pgtest.Password}, http.StatusOK, &login)
+	if login.Token == "" {
+		t.Errorf("login after disabling MFA = %+v, want a token", login)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	// Tokens issued in the same second as the change are revoked too
+	s.do(http.MethodPut, "/auth/password", token, types.ChangePasswordRequest{CurrentPassword: "wrong-password", NewPassword: "new-password"}, http.StatusBadRequest, nil)
+	var login types.LoginResponse
+	s.do(http.MethodPut, "/auth/password", token, types.ChangePasswordRequest{CurrentPassword: pgtest.Password, NewPassword: "new-password"}, http.StatusOK, &login)
+
+	// Only tokens issued after the change are accepted
+	s.do(http.MethodGet, "/auth/me", token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/auth/me", login.Token, nil, http.StatusOK, nil)
+	s.do(http.MethodPost, "/auth/login", "", types.LoginRequest{Username: "alice", Password: "new-password"}, http.StatusOK, nil)
+
+	// Without SMTP or a mail directory, reset links cannot be sent
+	s.do(http.MethodPost, "/auth/password/reset-request", "", types.PasswordResetRequest{Email: "alice@example.com"}, http.StatusServiceUnavailable, nil)
+	s.do(http.MethodPost, "/auth/password/reset", "", types.PasswordResetConfirmRequest{Token: "not-a-token", NewPassword: "other-password"}, http.StatusBadRequest, nil)
+}
+
+func TestDiaryFlow(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+	otherToken := s.register("bob")
+
+	var today struct {
+		Session        types.ChatSession `json:"session"`
+		InitialMessage *types.Message    `json:"initial_message"`
+	}
+	s.do(http.MethodGet, "/sessions/today", token, nil, http.StatusOK, &today)
+	if today.Session.Status != types.SessionStatusActive || today.InitialMessage == nil || today.InitialMessage.Sender != types.SenderAI {
+		t.Fatalf("today = %+v, want an active session with a greeting", today)
+	}
+	sessionID := today.Session.ID
+
+	var again struct {
+		Session        types.ChatSession `json:"session"`
+		InitialMessage *types.Message    `json:"initial_message"`
+	}
+	s.do(http.MethodGet, "/sessions/today", token, nil, http.StatusOK, &again)
+	if again.Session.ID != sessionID || again.InitialMessage != nil {
+		t.Errorf("second visit = %+v, want the same session without a new greeting", again)
+	}
+
+	messagesPath := "/sessions/" + sessionID + "/messages"
+	for _, content := range []string{"朝から会議続きで疲れた", "でも帰りに友達とご飯に行けて楽しかった"} {
+		var sent types.SendMessageResponse
+		s.do(http.MethodPost, messagesPath, token, types.SendMessageRequest{Content: content}, http.StatusOK, &sent)
+		if sent.ReplyFailed || sent.UserMessage.Content != content || sent.AIResponse.Sender != types.SenderAI {
+			t.Errorf("send %q = %+v", content, sent)
+		}
+	}
+	s.do(http.MethodPost, messagesPath, token, types.SendMessageRequest{Content: ""}, http.StatusBadRequest, nil)
+
+	var history struct {
+		Messages []types.Message `json:"messages"`
+	}
+	s.do(http.MethodGet, messagesPath, token, nil, http.StatusOK, &history)
+	if len(history.Messages) != 5 {
+		t.Errorf("got %d messages, want the greeting and two exchanges", len(history.Messages))
+	}
+
+	// Another user cannot see or write to the session
+	s.do(http.MethodGet, messagesPath, otherToken, nil, http.StatusNotFound, nil)
+	s.do(http.MethodPost, messagesPath, otherToken, types.SendMessageRequest{Content: "こんにちは"}, http.StatusNotFound, nil)
+	s.do(http.MethodPut, "/sessions/"+sessionID+"/complete", otherToken, nil, http.StatusNotFound, nil)
+
+	s.do(http.MethodPut, "/sessions/"+sessionID+"/complete", token, nil, http.StatusOK, nil)
+	s.do(http.MethodPut, "/sessions/"+sessionID+"/complete", token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodPost, messagesPath, token, types.SendMessageRequest{Content: "まだ話したい"}, http.StatusBadRequest, nil)
+
+	s.waitForAnalysis(sessionID)
+
+	var analysis types.AnalysisResponse
+	s.do(http.MethodGet, "/sessions/"+sessionID+"/analysis", token, nil, http.StatusOK, &analysis)
+	if analysis.Analysis == nil || analysis.Analysis.SessionID != sessionID || analysis.Analysis.Summary == "" {
+		t.Fatalf("analysis = %+v", analysis.Analysis)
+	}
+	s.do(http.MethodGet, "/sessions/"+sessionID+"/analysis", otherToken, nil, http.StatusNotFound, nil)
+
+	var sessions types.SessionsResponse
+	s.do(http.MethodGet, "/sessions", token, nil, http.StatusOK, &sessions)
+	if len(sessions.Sessions) != 1 || !sessions.Sessions[0].HasAnalysis || sessions.Sessions[0].Status != types.SessionStatusCompleted {
+		t.Errorf("sessions = %+v, want the completed and analyzed session", sessions.Sessions)
+	}
+
+	now := timeutil.NowJST()
+	var calendar types.CalendarResponse
+	s.do(http.MethodGet, fmt.Sprintf("/calendar/%d/%d", now.Year(), int(now.Month())), token, nil, http.StatusOK, &calendar)
+	var found bool
+	for _, day := range calendar.MonthData.Days {
+		if day.Date == timeutil.TodayJST() && day.HasSession {
+			found = true
+			if day.TensionScore == nil || *day.TensionScore != analysis.Analysis.TensionScore {
+				t.Errorf("calendar score = %v, want %d", day.TensionScore, analysis.Analysis.TensionScore)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("calendar = %+v, want today's session", calendar.MonthData.Days)
+	}
+
+	var scores types.TensionScoresResponse
+	s.do(http.MethodGet, "/analysis/scores?days=7", token, nil, http.StatusOK, &scores)
+	if len(scores.Scores) != 1 || scores.Scores[0].SessionID != sessionID {
+		t.Errorf("scores = %+v, want today's score", scores.Scores)
+	}
+}
+
+func TestCreateSessionForDate(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	var created struct {
+		Session types.ChatSession `json:"session"`
+	}
+	s.do(http.MethodPost, "/sessions", token, types.CreateSessionRequest{Date: "2024-03-10"}, http.StatusCreated, &created)
+	if created.Session.ID == "" {
+		t.Fatalf("created = %+v", created)
+	}
+	s.do(http.MethodPost, "/sessions", token, types.CreateSessionRequest{Date: "2024-03-10"}, http.StatusConflict, nil)
+	s.do(http.MethodPost, "/sessions", token, types.CreateSessionRequest{Date: "10/03/2024"}, http.StatusBadRequest, nil)
+
+	var sessions types.SessionsResponse
+	s.do(http.MethodGet, "/sessions?year=2024&month=3", token, nil, http.StatusOK, &sessions)
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].Date != "2024-03-10" {
+		t.Errorf("March sessions = %+v", sessions.Sessions)
+	}
+	s.do(http.MethodGet, "/sessions?year=2024&month=4", token, nil, http.StatusOK, &sessions)
+	if len(sessions.Sessions) != 0 {
+		t.Errorf("April sessions = %+v, want none", sessions.Sessions)
+	}
+}
+
+func TestSessionPagination(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	for _, date := range []string{"2024-03-10", "2024-03-11", "2024-03-12"} {
+		s.do(http.MethodPost, "/sessions", token, types.CreateSessionRequest{Date: date}, http.StatusCreated, nil)
+	}
+
+	var first types.SessionsResponse
+	header := s.do(http.MethodGet, "/sessions?limit=2&sort=date&include_total=true", token, nil, http.StatusOK, &first)
+	if len(first.Sessions) != 2 || first.Sessions[0].Date != "2024-03-10" || !first.Pagination.HasMore || first.Pagination.NextCursor == nil {
+		t.Fatalf("first page = %+v", first)
+	}
+	if first.Pagination.Total == nil || *first.Pagination.Total != 3 {
+		t.Errorf("total = %v, want 3", first.Pagination.Total)
+	}
+
+	link := header.Get("Link")
+	wantLink := fmt.Sprintf(`<%s?cursor=%s&include_total=true&limit=2&sort=date>; rel="next"`, "/api/v1/sessions", *first.Pagination.NextCursor)
+	if link != wantLink {
+		t.Fatalf("Link = %q, want %q", link, wantLink)
+	}
+
+	var second types.SessionsResponse
+	header = s.do(http.MethodGet, "/sessions?limit=2&sort=date&cursor="+*first.Pagination.NextCursor, token, nil, http.StatusOK, &second)
+	if len(second.Sessions) != 1 || second.Sessions[0].Date != "2024-03-12" || second.Pagination.HasMore || second.Pagination.NextCursor != nil {
+		t.Errorf("second page = %+v, want the last session", second)
+	}
+	if header.Get("Link") != "" || second.Pagination.Total != nil {
+		t.Errorf("last page has a Link header %q or a total %v", header.Get("Link"), second.Pagination.Total)
+	}
+
+	// Cursors only work with the sort order they were issued for
+	s.do(http.MethodGet, "/sessions?sort=-date&cursor="+*first.Pagination.NextCursor, token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, "/sessions?cursor=not-a-cursor", token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, "/sessions?sort=tension_score", token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, "/sessions?min_tension=high", token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, "/sessions?from=2024-03-12&to=2024-03-10", token, nil, http.StatusBadRequest, nil)
+
+	var completed types.SessionsResponse
+	s.do(http.MethodGet, "/sessions?status=completed&has_analysis=false", token, nil, http.StatusOK, &completed)
+	if len(completed.Sessions) != 0 {
+		t.Errorf("completed sessions = %+v, want none", completed.Sessions)
+	}
+
+	var analyses types.AnalysesResponse
+	s.do(http.MethodGet, "/analysis/history?sort=-tension_score", token, nil, http.StatusOK, &analyses)
+	if analyses.Analyses == nil || len(analyses.Analyses) != 0 || analyses.Pagination.HasMore {
+		t.Errorf("analysis history = %+v, want an empty page", analyses)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+	otherToken := s.register("bob")
+
+	var webhook types.Webhook
+	s.do(http.MethodPost, "/webhooks", token, types.CreateWebhookRequest{
+		URL:    "https://hooks.example.com/kasaneha",
+		Events: []string{types.WebhookEventSessionCompleted},
+	}, http.StatusCreated, &webhook)
+	if webhook.ID == "" || webhook.Secret == "" {
+		t.Fatalf("created webhook = %+v, want its secret", webhook)
+	}
+	for _, url := range []string{"ftp://example.com", "http://hooks.example.com/kasaneha", "https://127.0.0.1/hook", "https://169.254.169.254/latest/meta-data"} {
+		s.do(http.MethodPost, "/webhooks", token, types.CreateWebhookRequest{URL: url, Events: []string{types.WebhookEventSessionCompleted}}, http.StatusBadRequest, nil)
+	}
+
+	var webhooks types.WebhooksResponse
+	s.do(http.MethodGet, "/webhooks", token, nil, http.StatusOK, &webhooks)
+	if len(webhooks.Webhooks) != 1 || webhooks.Webhooks[0].Secret != "" {
+		t.Errorf("webhooks = %+v, want one without its secret", webhooks.Webhooks)
+	}
+	s.do(http.MethodGet, "/webhooks", otherToken, nil, http.StatusOK, &webhooks)
+	if len(webhooks.Webhooks) != 0 {
+		t.Errorf("another user sees webhooks: %+v", webhooks.Webhooks)
+	}
+	s.do(http.MethodDelete, "/webhooks/"+webhook.ID, otherToken, nil, http.StatusNotFound, nil)
+
+	// Completing a session queues a delivery
+	var today struct {
+		Session types.ChatSession `json:"session"`
+	}
+	s.do(http.MethodGet, "/sessions/today", token, nil, http.StatusOK, &today)
+	s.do(http.MethodPost, "/sessions/"+today.Session.ID+"/messages", token, types.SendMessageRequest{Content: "散歩した"}, http.StatusOK, nil)
+	s.do(http.MethodPut, "/sessions/"+today.Session.ID+"/complete", token, nil, http.StatusOK, nil)
+
+	var deliveries types.WebhookDeliveriesResponse
+	deadline := time.Now().Add(10 * time.Second)
+	for len(deliveries.Deliveries) == 0 && time.Now().Before(deadline) {
+		s.do(http.MethodGet, "/webhooks/"+webhook.ID+"/deliveries", token, nil, http.StatusOK, &deliveries)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].EventType != types.WebhookEventSessionCompleted || deliveries.Deliveries[0].Status != types.WebhookDeliveryPending {
+		t.Errorf("deliveries = %+v, want a pending session.completed delivery", deliveries.Deliveries)
+	}
+	s.waitForAnalysis(today.Session.ID)
+
+	s.do(http.MethodDelete, "/webhooks/"+webhook.ID, token, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, "/webhooks", token, nil, http.StatusOK, &webhooks)
+	if len(webhooks.Webhooks) != 0 {
+		t.Errorf("webhooks after delete = %+v", webhooks.Webhooks)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+	otherToken := s.register("bob")
+
+	var me types.User
+	s.do(http.MethodGet, "/auth/me", token, nil, http.StatusOK, &me)
+	notification, err := repository.NewAlertRepository(s.db).CreateNotification(context.Background(), me.ID, "alert.low_score", "低め", "低い日が続いています", nil)
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+
+	var notifications types.NotificationsResponse
+	s.do(http.MethodGet, "/notifications", token, nil, http.StatusOK, &notifications)
+	if len(notifications.Notifications) != 1 || notifications.UnreadCount != 1 {
+		t.Fatalf("notifications = %+v", notifications)
+	}
+
+	s.do(http.MethodPut, "/notifications/"+notification.ID+"/read", otherToken, nil, http.StatusNotFound, nil)
+	s.do(http.MethodPut, "/notifications/"+notification.ID+"/read", token, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, "/notifications?unread=true", token, nil, http.StatusOK, &notifications)
+	if len(notifications.Notifications) != 0 || notifications.UnreadCount != 0 {
+		t.Errorf("unread notifications after reading = %+v", notifications)
+	}
+
+	var settings types.AlertSettings
+	s.do(http.MethodGet, "/alerts/settings", token, nil, http.StatusOK, &settings)
+	if !settings.Enabled {
+		t.Errorf("default alert settings = %+v, want enabled", settings)
+	}
+}
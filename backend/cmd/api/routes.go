@@ -0,0 +1,302 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/alert"
+	"github.com/trasta298/kasaneha/backend/internal/annotator"
+	"github.com/trasta298/kasaneha/backend/internal/config"
+	"github.com/trasta298/kasaneha/backend/internal/handler"
+	"github.com/trasta298/kasaneha/backend/internal/metrics"
+	customMiddleware "github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/openapi"
+	"github.com/trasta298/kasaneha/backend/internal/ratelimit"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
+)
+
+// api is the API server's object graph: the router and what main runs in the background
+type api struct {
+	sessionRepo     *repository.SessionRepository
+	reminderService *service.ReminderService
+	webhookService  *service.WebhookService
+	router          http.Handler
+}
+
+// newAPI wires the repositories, services and handlers on db and sets up the router
+func newAPI(cfg *config.Config, db *repository.Database, aiClient *ai.Client, emotionTaxonomy *ai.EmotionTaxonomy, logger *slog.Logger) (*api, error) {
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	messageRepo := repository.NewMessageRepository(db)
+	analysisRepo := repository.NewAnalysisRepository(db)
+	entityRepo := repository.NewEntityRepository(db)
+	alertRepo := repository.NewAlertRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	usageRepo := repository.NewUsageRepository(db)
+	securityRepo := repository.NewSecurityRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	resetRepo := repository.NewPasswordResetRepository(db)
+	txManager := repository.NewTxManager(db)
+
+	// Initialize services
+	authService := service.NewAuthService(userRepo, securityRepo, mfaRepo, resetRepo, service.LoginPolicy{
+		LockoutThreshold: cfg.Login.LockoutThreshold,
+		LockoutDuration:  cfg.Login.LockoutDuration,
+		IPMaxFailures:    cfg.Login.IPMaxFailures,
+		IPWindow:         cfg.Login.IPWindow,
+		PasswordResetTTL: cfg.Login.PasswordResetTTL,
+	}, logger)
+	usageService := service.NewUsageService(usageRepo, userRepo, int64(cfg.AI.DailyTokenQuota), int64(cfg.AI.MonthlyTokenQuota), logger)
+	aiClient.SetUsageRecorder(usageService)
+	chatService := service.NewChatService(txManager, sessionRepo, messageRepo, userRepo, aiClient, annotator.NewLexiconAnnotator(), logger)
+	analysisService := service.NewAnalysisService(txManager, analysisRepo, sessionRepo, messageRepo, userRepo, aiClient, emotionTaxonomy, logger)
+	entityService := service.NewEntityService(entityRepo, aiClient)
+	alertService := service.NewAlertService(alertRepo, analysisService, alert.NewEngine(), logger)
+	webhookService := service.NewWebhookService(webhookRepo, logger)
+	notifiers := newNotifierRegistry(cfg)
+	reminderService := service.NewReminderService(reminderRepo, sessionRepo, userRepo, notifiers, cfg.Notify.VAPIDPublicKey, cfg.Notify.AppURL, logger)
+
+	// Set circular dependency after initialization
+	chatService.SetAnalysisService(analysisService)
+	analysisService.SetEntityService(entityService)
+	analysisService.SetAlertService(alertService)
+	chatService.SetAlertService(alertService)
+	chatService.SetWebhookService(webhookService)
+	analysisService.SetWebhookService(webhookService)
+	alertService.SetWebhookService(webhookService)
+	chatService.SetUsageService(usageService)
+	analysisService.SetUsageService(usageService)
+	if mailer, ok := notifiers.Get(notify.ChannelEmail); ok {
+		authService.SetMailer(mailer, cfg.Notify.AppURL)
+	}
+
+	// Initialize middlewares
+	authMiddleware := customMiddleware.NewAuthMiddleware(cfg.JWT.Secret)
+	spec, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+	requestValidator, err := customMiddleware.NewRequestValidator(spec)
+	if err != nil {
+		return nil, err
+	}
+	specHandler, err := openapi.Handler(spec)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitStore, err := newRateLimitStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter := customMiddleware.NewRateLimiter(rateLimitStore)
+	authLimit, err := ratelimit.ParseLimit(cfg.RateLimit.Auth)
+	if err != nil {
+		return nil, err
+	}
+	chatLimit, err := ratelimit.ParseLimit(cfg.RateLimit.Chat)
+	if err != nil {
+		return nil, err
+	}
+	analysisLimit, err := ratelimit.ParseLimit(cfg.RateLimit.Analysis)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxies, err := customMiddleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize handlers
+	authHandler := handler.NewAuthHandler(userRepo, authService, authMiddleware)
+	chatHandler := handler.NewChatHandler(chatService)
+	analysisHandler := handler.NewAnalysisHandler(analysisService)
+	entityHandler := handler.NewEntityHandler(entityService)
+	alertHandler := handler.NewAlertHandler(alertService)
+	reminderHandler := handler.NewReminderHandler(reminderService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	usageHandler := handler.NewUsageHandler(usageService)
+
+	// Setup router
+	r := chi.NewRouter()
+
+	// Global middlewares
+	r.Use(middleware.RequestID)
+	r.Use(customMiddleware.RealIP(trustedProxies))
+	r.Use(tracing.Middleware)
+	r.Use(customMiddleware.Logger(logger))
+	r.Use(metrics.Middleware)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.Timeout(60 * time.Second))
+
+	// CORS configuration
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins: []string{
+			"http://localhost:4321",
+			"http://localhost:3000",
+			"http://frontend:4321",
+			"http://127.0.0.1:4321",
+			"https://kasaneha.trasta.dev",
+		}, // Astro dev server + container network
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	// The metrics reveal traffic and usage, so they are only served to a scraper holding the token
+	if cfg.Metrics.Token != "" {
+		r.Handle("/metrics", metrics.Handler(cfg.Metrics.Token))
+	} else {
+		logger.Warn("METRICS_TOKEN is not set; /metrics is disabled")
+	}
+
+	// Routes
+	r.Route("/api/v1", func(r chi.Router) {
+		// Public routes
+		r.Route("/auth", func(r chi.Router) {
+			r.Use(rateLimiter.PerIP("auth", authLimit))
+			r.Use(requestValidator.ValidateRequest)
+
+			r.Post("/register", authHandler.Register)
+			r.Post("/login", authHandler.Login)
+			r.Post("/login/mfa", authHandler.LoginMFA)
+			r.Post("/password/reset-request", authHandler.RequestPasswordReset)
+			r.Post("/password/reset", authHandler.ResetPassword)
+		})
+
+		// Health check
+		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+		})
+
+		// API specification
+		r.Get("/openapi.json", specHandler)
+
+		// Protected routes
+		r.Group(func(r chi.Router) {
+			r.Use(authMiddleware.AuthenticateUser)
+			r.Use(requestValidator.ValidateRequest)
+			r.Use(customMiddleware.RejectRevokedTokens(userRepo.GetPasswordChangedAt))
+
+			// User routes
+			r.Get("/auth/me", authHandler.Me)
+			r.With(rateLimiter.PerUser("password", authLimit)).Put("/auth/password", authHandler.ChangePassword)
+			r.Get("/auth/security-events", authHandler.GetSecurityEvents)
+
+			// Two-factor authentication routes
+			r.Route("/auth/mfa", func(r chi.Router) {
+				r.Get("/", authHandler.GetMFAStatus)
+
+				// Routes that check a TOTP or recovery code
+				r.Group(func(r chi.Router) {
+					r.Use(rateLimiter.PerUser("mfa", authLimit))
+
+					r.Post("/enroll", authHandler.EnrollMFA)
+					r.Post("/verify", authHandler.VerifyMFA)
+					r.Post("/disable", authHandler.DisableMFA)
+					r.Post("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+				})
+			})
+
+			// Chat session routes
+			r.Route("/sessions", func(r chi.Router) {
+				r.Get("/today", chatHandler.GetTodaySession)
+				r.Post("/", chatHandler.CreateSession)
+				r.Get("/", chatHandler.GetUserSessions)
+
+				r.Route("/{sessionId}", func(r chi.Router) {
+					r.Get("/messages", chatHandler.GetSessionMessages)
+					r.Put("/complete", chatHandler.CompleteSession)
+					r.Get("/stats", chatHandler.GetSessionStats)
+					r.Get("/mood", chatHandler.GetSessionMoodCurve)
+
+					// Routes that call Gemini
+					r.With(rateLimiter.PerUser("chat", chatLimit)).Post("/messages", chatHandler.SendMessage)
+					r.With(rateLimiter.PerUser("chat", chatLimit)).Post("/messages/{messageId}/retry", chatHandler.RetryReply)
+					r.With(rateLimiter.PerUser("analysis", analysisLimit)).Get("/analysis", analysisHandler.GetSessionAnalysis)
+					r.With(rateLimiter.PerUser("analysis", analysisLimit)).Post("/analysis", analysisHandler.TriggerSessionAnalysis)
+				})
+			})
+
+			// Analysis routes
+			r.Route("/analysis", func(r chi.Router) {
+				r.Get("/scores", analysisHandler.GetTensionScores)
+				r.Get("/insights", analysisHandler.GetAnalysisInsights)
+				r.Get("/history", analysisHandler.GetUserAnalyses)
+				r.Get("/emotions", analysisHandler.GetEmotionTrend)
+			})
+
+			// Entity routes
+			r.Route("/entities", func(r chi.Router) {
+				r.Get("/", entityHandler.GetEntities)
+				r.Get("/{entityId}", entityHandler.GetEntity)
+				r.Put("/{entityId}", entityHandler.RenameEntity)
+				r.Post("/{entityId}/merge", entityHandler.MergeEntities)
+			})
+
+			// Alert and notification routes
+			r.Route("/alerts", func(r chi.Router) {
+				r.Get("/settings", alertHandler.GetAlertSettings)
+				r.Put("/settings", alertHandler.UpdateAlertSettings)
+			})
+			r.Route("/notifications", func(r chi.Router) {
+				r.Get("/", alertHandler.GetNotifications)
+				r.Put("/{notificationId}/read", alertHandler.MarkNotificationRead)
+			})
+
+			// Reminder routes
+			r.Route("/reminders", func(r chi.Router) {
+				r.Get("/settings", reminderHandler.GetReminderSettings)
+				r.Put("/settings", reminderHandler.UpdateReminderSettings)
+				r.Post("/push-subscriptions", reminderHandler.SubscribePush)
+				r.Delete("/push-subscriptions", reminderHandler.UnsubscribePush)
+			})
+
+			// Outbound webhook routes
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Get("/", webhookHandler.GetWebhooks)
+				r.Post("/", webhookHandler.CreateWebhook)
+				r.Put("/{webhookId}", webhookHandler.UpdateWebhook)
+				r.Delete("/{webhookId}", webhookHandler.DeleteWebhook)
+				r.Get("/{webhookId}/deliveries", webhookHandler.GetDeliveries)
+				r.Post("/{webhookId}/deliveries/{deliveryId}/redeliver", webhookHandler.RedeliverDelivery)
+			})
+
+			// AI usage routes
+			r.Get("/usage", usageHandler.GetUsage)
+
+			// Admin routes
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(customMiddleware.RequireAdmin(usageService.IsAdmin))
+
+				r.Get("/usage", usageHandler.GetUsageReport)
+				r.Put("/usage/users/{userId}/quota", usageHandler.UpdateQuota)
+				r.Post("/users/{userId}/unlock", authHandler.UnlockUser)
+			})
+
+			// Calendar routes
+			r.Route("/calendar", func(r chi.Router) {
+				r.Get("/{year}/{month}", analysisHandler.GetCalendarData)
+			})
+		})
+	})
+
+	return &api{
+		sessionRepo:     sessionRepo,
+		reminderService: reminderService,
+		webhookService:  webhookService,
+		router:          r,
+	}, nil
+}
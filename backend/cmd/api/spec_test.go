@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/config"
+	customMiddleware "github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/openapi"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// newRouterWithoutDatabase sets up the router on a database that is never connected; only
+// requests rejected before reaching a repository can be served. configure may adjust the config.
+func newRouterWithoutDatabase(t *testing.T, configure ...func(*config.Config)) http.Handler {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	taxonomy, err := ai.LookupEmotionTaxonomy("")
+	if err != nil {
+		t.Fatalf("LookupEmotionTaxonomy: %v", err)
+	}
+	aiClient := ai.NewClientWithProvider(ai.NewFakeProvider(), ai.FakeProviderModel, ai.Options{}, logger)
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	api, err := newAPI(cfg, &repository.Database{}, aiClient, taxonomy, logger)
+	if err != nil {
+		t.Fatalf("newAPI: %v", err)
+	}
+	return api.router
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	router := newRouterWithoutDatabase(t).(chi.Routes)
+
+	var routes []string
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path, ok := strings.CutPrefix(route, "/api/v1")
+		if !ok {
+			return nil
+		}
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+		routes = append(routes, method+" "+path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chi.Walk: %v", err)
+	}
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var documented []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	for _, route := range routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("%s is not in openapi.yaml", route)
+		}
+	}
+	for _, operation := range documented {
+		if !slices.Contains(routes, operation) {
+			t.Errorf("%s is in openapi.yaml but has no handler", operation)
+		}
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	server := httptest.NewServer(newRouterWithoutDatabase(t))
+	t.Cleanup(server.Close)
+
+	token, err := customMiddleware.NewAuthMiddleware("test-secret").GenerateToken("00000000-0000-0000-0000-000000000001", "alice", nil)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	sessionPath := "/sessions/00000000-0000-0000-0000-000000000002"
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantFields []types.FieldError
+	}{
+		{
+			name:       "short username and password",
+			method:     http.MethodPost,
+			path:       "/auth/register",
+			body:       `{"username":"al","password":"123"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "username", In: "body"}, {Field: "password", In: "body"}},
+		},
+		{
+			name:       "invalid email",
+			method:     http.MethodPost,
+			path:       "/auth/register",
+			body:       `{"username":"alice","password":"password","email":"alice"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "email", In: "body"}},
+		},
+		{
+			name:       "missing password",
+			method:     http.MethodPost,
+			path:       "/auth/login",
+			body:       `{"username":"alice"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "password", In: "body"}},
+		},
+		{
+			name:       "malformed JSON",
+			method:     http.MethodPost,
+			path:       "/auth/login",
+			body:       `{"username":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "INVALID_REQUEST",
+		},
+		{
+			name:       "authentication comes first",
+			method:     http.MethodPost,
+			path:       sessionPath + "/messages",
+			body:       `{"content":""}`,
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "UNAUTHORIZED",
+		},
+		{
+			name:       "empty message",
+			method:     http.MethodPost,
+			path:       sessionPath + "/messages",
+			token:      token,
+			body:       `{"content":""}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "content", In: "body"}},
+		},
+		{
+			name:       "message longer than 2000 characters",
+			method:     http.MethodPost,
+			path:       sessionPath + "/messages",
+			token:      token,
+			body:       `{"content":"` + strings.Repeat("あ", 2001) + `"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "content", In: "body"}},
+		},
+		{
+			name:       "session ID is not a UUID",
+			method:     http.MethodGet,
+			path:       "/sessions/today-ish/messages",
+			token:      token,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "sessionId", In: "path"}},
+		},
+		{
+			name:       "query parameters out of range",
+			method:     http.MethodGet,
+			path:       "/sessions?limit=500&min_tension=high",
+			token:      token,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "limit", In: "query"}, {Field: "min_tension", In: "query"}},
+		},
+		{
+			name:       "nested body field",
+			method:     http.MethodPost,
+			path:       "/reminders/push-subscriptions",
+			token:      token,
+			body:       `{"endpoint":"https://push.example.com/1","keys":{"p256dh":"key"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "keys.auth", In: "body"}},
+		},
+		{
+			name:       "alert threshold out of range",
+			method:     http.MethodPut,
+			path:       "/alerts/settings",
+			token:      token,
+			body:       `{"decline_days":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "VALIDATION_ERROR",
+			wantFields: []types.FieldError{{Field: "decline_days", In: "body"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, server.URL+"/api/v1"+tt.path, body)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+			}
+			defer resp.Body.Close()
+
+			var response struct {
+				Error struct {
+					Code    string             `json:"code"`
+					Details []types.FieldError `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus || response.Error.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d %s", resp.StatusCode, response.Error.Code, tt.wantStatus, tt.wantCode)
+			}
+
+			if len(response.Error.Details) != len(tt.wantFields) {
+				t.Fatalf("details = %+v, want %+v", response.Error.Details, tt.wantFields)
+			}
+			for _, want := range tt.wantFields {
+				found := slices.ContainsFunc(response.Error.Details, func(got types.FieldError) bool {
+					return got.Field == want.Field && got.In == want.In && got.Message != ""
+				})
+				if !found {
+					t.Errorf("details = %+v, want an error for %s in %s", response.Error.Details, want.Field, want.In)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorMessagesFollowAcceptLanguage(t *testing.T) {
+	server := httptest.NewServer(newRouterWithoutDatabase(t))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		acceptLanguage string
+		wantMessage    string
+	}{
+		{acceptLanguage: "", wantMessage: "User not authenticated"},
+		{acceptLanguage: "ja", wantMessage: "認証されていません"},
+		{acceptLanguage: "ja-JP,ja;q=0.9,en;q=0.8", wantMessage: "認証されていません"},
+		{acceptLanguage: "en-US,ja;q=0.5", wantMessage: "User not authenticated"},
+		{acceptLanguage: "fr", wantMessage: "User not authenticated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/auth/me", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /auth/me: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var response types.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.StatusCode != http.StatusUnauthorized || response.Error.Code != "UNAUTHORIZED" {
+				t.Fatalf("got %d %s, want 401 UNAUTHORIZED", resp.StatusCode, response.Error.Code)
+			}
+			if response.Error.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", response.Error.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	server := httptest.NewServer(newRouterWithoutDatabase(t, func(cfg *config.Config) {
+		cfg.RateLimit.Auth = "2/1m"
+	}))
+	t.Cleanup(server.Close)
+
+	// Invalid bodies are rejected before the database, but still count against the limit
+	login := func() *http.Response {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/api/v1/auth/login", "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("POST /auth/login: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		resp := login()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("request %d: status = %d, want 400", i+1, resp.StatusCode)
+		}
+		if resp.Header.Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 2", i+1, resp.Header.Get("X-RateLimit-Limit"))
+		}
+	}
+
+	resp := login()
+	var response types.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || response.Error.Code != "RATE_LIMIT_EXCEEDED" {
+		t.Fatalf("got %d %s, want 429 RATE_LIMIT_EXCEEDED", resp.StatusCode, response.Error.Code)
+	}
+	if resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("Retry-After = %q, want 30", resp.Header.Get("Retry-After"))
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", resp.Header.Get("X-RateLimit-Remaining"))
+	}
+}
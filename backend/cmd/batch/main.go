@@ -5,17 +5,25 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
 
+	"github.com/prometheus/client_golang/prometheus/push"
 	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/alert"
 	"github.com/trasta298/kasaneha/backend/internal/config"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/metrics"
 	"github.com/trasta298/kasaneha/backend/internal/repository"
 	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
 )
 
 func main() {
 	// Define command line flags
 	minMessages := flag.Int("min-messages", 2, "Minimum number of messages required for analysis")
 	dryRun := flag.Bool("dry-run", false, "Show sessions that would be analyzed without actually running analysis")
+	evaluateAlerts := flag.Bool("alerts", true, "Evaluate mood alert rules for all users after the analysis (detects missed days)")
 	flag.Parse()
 
 	// Load configuration
@@ -24,10 +32,33 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Setup logger
+	logger := logging.New(logging.Config{
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+		Redact: cfg.Log.Redact,
+	}, os.Stdout)
+	slog.SetDefault(logger)
+
+	// Setup tracing; the batch reports as its own service unless OTEL_SERVICE_NAME is set
+	serviceName := cfg.Tracing.ServiceName
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		serviceName = "kasaneha-batch"
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		ServiceName: serviceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal(logger, "Failed to setup tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database
 	db, err := repository.NewDatabase(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal(logger, "Failed to connect to database", err)
 	}
 	defer db.Close()
 
@@ -36,21 +67,51 @@ func main() {
 	messageRepo := repository.NewMessageRepository(db)
 	analysisRepo := repository.NewAnalysisRepository(db)
 	userRepo := repository.NewUserRepository(db)
+	entityRepo := repository.NewEntityRepository(db)
+	alertRepo := repository.NewAlertRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	usageRepo := repository.NewUsageRepository(db)
+	txManager := repository.NewTxManager(db)
 
 	// Initialize AI client
-	aiClient, err := ai.NewClient(cfg.AI.GeminiAPIKey, cfg.AI.Model)
+	aiClient, err := ai.NewClient(cfg.AI.GeminiAPIKey, cfg.AI.Model, ai.Options{
+		Timeouts:         cfg.AI.Timeouts,
+		DefaultTimeout:   cfg.AI.Timeout,
+		MaxRetries:       cfg.AI.MaxRetries,
+		BreakerThreshold: cfg.AI.BreakerThreshold,
+		BreakerCooldown:  cfg.AI.BreakerCooldown,
+	}, logger)
+	if err != nil {
+		fatal(logger, "Failed to initialize AI client", err)
+	}
+
+	emotionTaxonomy, err := ai.LookupEmotionTaxonomy(cfg.AI.EmotionTaxonomy)
 	if err != nil {
-		log.Fatalf("Failed to initialize AI client: %v", err)
+		fatal(logger, "Invalid emotion taxonomy", err)
 	}
 
 	// Initialize analysis service
 	analysisService := service.NewAnalysisService(
+		txManager,
 		analysisRepo,
 		sessionRepo,
 		messageRepo,
 		userRepo,
 		aiClient,
+		emotionTaxonomy,
+		logger,
 	)
+	analysisService.SetEntityService(service.NewEntityService(entityRepo, aiClient))
+	alertService := service.NewAlertService(alertRepo, analysisService, alert.NewEngine(), logger)
+	analysisService.SetAlertService(alertService)
+	webhookService := service.NewWebhookService(webhookRepo, logger)
+	analysisService.SetWebhookService(webhookService)
+	alertService.SetWebhookService(webhookService)
+
+	// Record token usage; analyses of users over their quota are deferred to a later run
+	usageService := service.NewUsageService(usageRepo, userRepo, int64(cfg.AI.DailyTokenQuota), int64(cfg.AI.MonthlyTokenQuota), logger)
+	aiClient.SetUsageRecorder(usageService)
+	analysisService.SetUsageService(usageService)
 
 	ctx := context.Background()
 
@@ -59,8 +120,13 @@ func main() {
 		fmt.Printf("DRY RUN: Finding active sessions with at least %d messages...\n", *minMessages)
 		sessions, err := sessionRepo.GetActiveSessionsWithMinMessages(ctx, *minMessages)
 		if err != nil {
-			log.Fatalf("Failed to get active sessions: %v", err)
+			fatal(logger, "Failed to get active sessions", err)
 		}
+		deferred, err := sessionRepo.GetUnanalyzedCompletedSessions(ctx, *minMessages)
+		if err != nil {
+			fatal(logger, "Failed to get unanalyzed completed sessions", err)
+		}
+		sessions = append(sessions, deferred...)
 
 		if len(sessions) == 0 {
 			fmt.Println("No active sessions found that need analysis.")
@@ -69,8 +135,8 @@ func main() {
 
 		fmt.Printf("Found %d sessions that would be analyzed:\n", len(sessions))
 		for _, session := range sessions {
-			fmt.Printf("- Session %s (User: %s, Messages: %d, Date: %s)\n",
-				session.ID, session.UserID, session.MessageCount, session.Date)
+			fmt.Printf("- Session %s (User: %s, Messages: %d, Date: %s, Status: %s)\n",
+				session.ID, session.UserID, session.MessageCount, session.Date, session.Status)
 		}
 
 		fmt.Printf("\nRun without --dry-run to actually perform the analysis.\n")
@@ -78,12 +144,52 @@ func main() {
 	}
 
 	// Actual batch analysis
-	fmt.Printf("Starting batch analysis for active sessions with at least %d messages...\n", *minMessages)
-
 	err = analysisService.BatchAnalyzeActiveSessions(ctx, *minMessages)
+	metrics.RecordBatchJob("analysis", err)
+	if err != nil {
+		pushMetrics(cfg, logger)
+		fatal(logger, "Batch analysis failed", err)
+	}
+
+	if *evaluateAlerts {
+		logger.Info("Evaluating mood alerts")
+		created, err := alertService.EvaluateAllUsers(ctx)
+		metrics.RecordBatchJob("alerts", err)
+		if err != nil {
+			pushMetrics(cfg, logger)
+			fatal(logger, "Alert evaluation failed", err)
+		}
+		logger.Info("Alert evaluation completed", slog.Int("notifications", created))
+	}
+
+	// Make the first delivery attempt for queued webhook events; the API server retries failures
+	delivered, err := webhookService.DeliverDue(ctx)
 	if err != nil {
-		log.Fatalf("Batch analysis failed: %v", err)
+		logger.Error("Webhook delivery failed", logging.Err(err))
 	}
+	logger.Info("Webhook delivery completed", slog.Int("delivered", delivered))
 
-	fmt.Println("Batch analysis completed successfully!")
+	pushMetrics(cfg, logger)
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+// pushMetrics sends this run's batch metrics to the Pushgateway, if one is configured
+func pushMetrics(cfg *config.Config, logger *slog.Logger) {
+	if cfg.Metrics.PushgatewayURL == "" {
+		return
+	}
+
+	err := push.New(cfg.Metrics.PushgatewayURL, "kasaneha_batch").
+		Collector(metrics.BatchJobs).
+		Collector(metrics.BatchSessions).
+		Collector(metrics.BatchLastRun).
+		Push()
+	if err != nil {
+		logger.Error("Failed to push metrics", logging.Err(err))
+	}
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Case is an anonymized golden conversation and what a good analysis and reply look like
+type Case struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	UserName    string `json:"user_name"`
+	Date        string `json:"date"`
+	TimeOfDay   string `json:"time_of_day"`
+	// History is the tension score history passed to CalculateTensionScore
+	History  string    `json:"history"`
+	Messages []Message `json:"messages"`
+	Expect   Expect    `json:"expect"`
+}
+
+// Message is a conversation turn; IDs are assigned in order (m1, m2, ...) so that evidence can be checked
+type Message struct {
+	Sender  string `json:"sender"`
+	Content string `json:"content"`
+}
+
+// Expect holds the expected ranges and rubric checks of a case; omitted checks are not run
+type Expect struct {
+	Emotion *EmotionExpect `json:"emotion,omitempty"`
+	Tension *TensionExpect `json:"tension,omitempty"`
+	Reply   *ReplyExpect   `json:"reply,omitempty"`
+}
+
+// EmotionExpect checks AnalyzeEmotion output
+type EmotionExpect struct {
+	// PrimaryIn lists acceptable primary emotions
+	PrimaryIn []string `json:"primary_in,omitempty"`
+	// Scores bounds individual emotion scores
+	Scores        map[string]Range `json:"scores,omitempty"`
+	MinConfidence *float64         `json:"min_confidence,omitempty"`
+	// Evidence requires at least one detail citing a user message of the conversation
+	Evidence bool `json:"evidence,omitempty"`
+}
+
+// TensionExpect checks CalculateTensionScore output
+type TensionExpect struct {
+	Score    *Range `json:"score,omitempty"`
+	Relative *Range `json:"relative,omitempty"`
+}
+
+// ReplyExpect checks the reply to the last user message
+type ReplyExpect struct {
+	MaxChars int `json:"max_chars,omitempty"`
+	// Question requires the reply to ask the user something
+	Question bool `json:"question,omitempty"`
+	// MentionsAny requires the reply to pick up at least one of these words
+	MentionsAny []string `json:"mentions_any,omitempty"`
+	// Forbidden phrases must not appear, e.g. dismissive advice
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+// Range is an inclusive range; a missing bound is open
+type Range struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Contains reports whether value is within the range
+func (r Range) Contains(value float64) bool {
+	return (r.Min == nil || value >= *r.Min) && (r.Max == nil || value <= *r.Max)
+}
+
+func (r Range) String() string {
+	switch {
+	case r.Min != nil && r.Max != nil:
+		return fmt.Sprintf("%g..%g", *r.Min, *r.Max)
+	case r.Min != nil:
+		return fmt.Sprintf(">= %g", *r.Min)
+	case r.Max != nil:
+		return fmt.Sprintf("<= %g", *r.Max)
+	default:
+		return "any"
+	}
+}
+
+// loadCorpus reads every *.json case in dir, ordered by ID
+func loadCorpus(dir string) ([]Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", dir)
+	}
+
+	cases := make([]Case, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid case %s: %w", path, err)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("duplicate case id %q in %s", c.ID, path)
+		}
+		seen[c.ID] = true
+		cases = append(cases, c)
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].ID < cases[j].ID })
+	return cases, nil
+}
+
+func (c *Case) validate() error {
+	if c.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if c.lastUserMessage() < 0 {
+		return fmt.Errorf("at least one user message is required")
+	}
+	for _, msg := range c.Messages {
+		if msg.Sender != "user" && msg.Sender != "ai" {
+			return fmt.Errorf("unknown sender %q", msg.Sender)
+		}
+	}
+	return nil
+}
+
+// lastUserMessage returns the index of the message the reply is generated for
+func (c *Case) lastUserMessage() int {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Sender == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+func messageID(i int) string {
+	return fmt.Sprintf("m%d", i+1)
+}
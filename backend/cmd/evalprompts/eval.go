@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"google.golang.org/genai"
+)
+
+// CaseResult holds the outputs of a case and the outcome of its checks
+type CaseResult struct {
+	ID      string                   `json:"id"`
+	Checks  []CheckResult            `json:"checks"`
+	Errors  []string                 `json:"errors,omitempty"`
+	Emotion *ai.EmotionAnalysis      `json:"emotion,omitempty"`
+	Tension *ai.TensionScoreAnalysis `json:"tension,omitempty"`
+	Reply   string                   `json:"reply,omitempty"`
+}
+
+// CheckResult is the outcome of one expected range or rubric check
+type CheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// evaluator replays cases through the AI client
+type evaluator struct {
+	client   *ai.Client
+	taxonomy *ai.EmotionTaxonomy
+}
+
+// run replays a case through AnalyzeEmotion, CalculateTensionScore and GenerateResponse and checks the outputs.
+// A failed call is recorded as an error and fails the checks that depend on it.
+func (e *evaluator) run(ctx context.Context, c Case) CaseResult {
+	result := CaseResult{ID: c.ID, Checks: []CheckResult{}}
+
+	conversation := make([]ai.Message, 0, len(c.Messages))
+	for i, msg := range c.Messages {
+		conversation = append(conversation, ai.Message{ID: messageID(i), Content: msg.Content, Sender: msg.Sender})
+	}
+
+	emotion, err := e.client.AnalyzeEmotion(ctx, conversation, e.taxonomy)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	result.Emotion = emotion
+	if c.Expect.Emotion != nil {
+		result.Checks = append(result.Checks, e.checkEmotion(c, emotion, c.Expect.Emotion)...)
+	}
+
+	if emotion != nil {
+		history := c.History
+		if history == "" {
+			history = "ユーザーの履歴データがありません。"
+		}
+		tension, err := e.client.CalculateTensionScore(ctx, emotion, history)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		result.Tension = tension
+	}
+	if c.Expect.Tension != nil {
+		result.Checks = append(result.Checks, checkTension(result.Tension, c.Expect.Tension)...)
+	}
+
+	last := c.lastUserMessage()
+	reply, err := e.client.GenerateResponse(ctx, ai.ConversationRequest{
+		UserMessage:         c.Messages[last].Content,
+		ConversationHistory: conversation[:last],
+		Date:                c.Date,
+		TimeOfDay:           c.TimeOfDay,
+		UserName:            c.UserName,
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	} else {
+		result.Reply = reply.Content
+	}
+	if c.Expect.Reply != nil {
+		result.Checks = append(result.Checks, checkReply(result.Reply, err == nil, c.Expect.Reply)...)
+	}
+
+	return result
+}
+
+func (e *evaluator) checkEmotion(c Case, emotion *ai.EmotionAnalysis, expect *EmotionExpect) []CheckResult {
+	var checks []CheckResult
+	missing := emotion == nil
+
+	if len(expect.PrimaryIn) > 0 {
+		check := CheckResult{Name: "emotion.primary", Detail: "want one of " + strings.Join(expect.PrimaryIn, ", ")}
+		if !missing {
+			check.Passed = contains(expect.PrimaryIn, emotion.PrimaryEmotion)
+			check.Detail = fmt.Sprintf("got %s, %s", emotion.PrimaryEmotion, check.Detail)
+		}
+		checks = append(checks, check)
+	}
+
+	names := make([]string, 0, len(expect.Scores))
+	for name := range expect.Scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Expectations written for another taxonomy do not apply
+		if !e.taxonomy.Has(name) {
+			continue
+		}
+		want := expect.Scores[name]
+		check := CheckResult{Name: "emotion.score." + name, Detail: "want " + want.String()}
+		if !missing {
+			score := emotion.Emotions[name]
+			check.Passed = want.Contains(score)
+			check.Detail = fmt.Sprintf("got %.2f, %s", score, check.Detail)
+		}
+		checks = append(checks, check)
+	}
+
+	if expect.MinConfidence != nil {
+		check := CheckResult{Name: "emotion.confidence", Detail: fmt.Sprintf("want >= %.2f", *expect.MinConfidence)}
+		if !missing {
+			check.Passed = emotion.Confidence >= *expect.MinConfidence
+			check.Detail = fmt.Sprintf("got %.2f, %s", emotion.Confidence, check.Detail)
+		}
+		checks = append(checks, check)
+	}
+
+	if expect.Evidence {
+		check := CheckResult{Name: "emotion.evidence", Detail: "want a detail citing a user message"}
+		if !missing {
+			check.Passed = citesUserMessage(c, emotion)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func checkTension(tension *ai.TensionScoreAnalysis, expect *TensionExpect) []CheckResult {
+	var checks []CheckResult
+	if expect.Score != nil {
+		check := CheckResult{Name: "tension.score", Detail: "want " + expect.Score.String()}
+		if tension != nil {
+			check.Passed = expect.Score.Contains(float64(tension.TensionScore))
+			check.Detail = fmt.Sprintf("got %d, %s", tension.TensionScore, check.Detail)
+		}
+		checks = append(checks, check)
+	}
+	if expect.Relative != nil {
+		check := CheckResult{Name: "tension.relative", Detail: "want " + expect.Relative.String()}
+		if tension != nil {
+			check.Passed = expect.Relative.Contains(float64(tension.RelativeScore))
+			check.Detail = fmt.Sprintf("got %d, %s", tension.RelativeScore, check.Detail)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func checkReply(reply string, ok bool, expect *ReplyExpect) []CheckResult {
+	checks := []CheckResult{{Name: "reply.present", Passed: ok && strings.TrimSpace(reply) != ""}}
+
+	if expect.MaxChars > 0 {
+		length := utf8.RuneCountInString(reply)
+		checks = append(checks, CheckResult{
+			Name:   "reply.length",
+			Passed: ok && length <= expect.MaxChars,
+			Detail: fmt.Sprintf("got %d chars, want <= %d", length, expect.MaxChars),
+		})
+	}
+	if expect.Question {
+		checks = append(checks, CheckResult{
+			Name:   "reply.question",
+			Passed: ok && (strings.Contains(reply, "？") || strings.Contains(reply, "?")),
+		})
+	}
+	if len(expect.MentionsAny) > 0 {
+		mentioned := false
+		for _, word := range expect.MentionsAny {
+			mentioned = mentioned || strings.Contains(reply, word)
+		}
+		checks = append(checks, CheckResult{
+			Name:   "reply.mentions",
+			Passed: ok && mentioned,
+			Detail: "want one of " + strings.Join(expect.MentionsAny, ", "),
+		})
+	}
+	if len(expect.Forbidden) > 0 {
+		var found []string
+		for _, phrase := range expect.Forbidden {
+			if strings.Contains(reply, phrase) {
+				found = append(found, phrase)
+			}
+		}
+		check := CheckResult{Name: "reply.forbidden", Passed: ok && len(found) == 0}
+		if len(found) > 0 {
+			check.Detail = "contains " + strings.Join(found, ", ")
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// citesUserMessage reports whether any emotion detail points at a user message of the case
+func citesUserMessage(c Case, emotion *ai.EmotionAnalysis) bool {
+	for _, detail := range emotion.Details {
+		for _, evidence := range detail.Evidence {
+			for i, msg := range c.Messages {
+				if msg.Sender == "user" && evidence.MessageID == messageID(i) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// configRecorder records the generation settings sent to the provider (temperature, token limits, schemas),
+// which the prompt fingerprint does not cover
+type configRecorder struct {
+	ai.Provider
+	mu      sync.Mutex
+	configs map[string]bool
+}
+
+func newConfigRecorder(provider ai.Provider) *configRecorder {
+	return &configRecorder{Provider: provider, configs: make(map[string]bool)}
+}
+
+// GenerateContent implements ai.Provider
+func (p *configRecorder) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	if encoded, err := json.Marshal(config); err == nil {
+		p.mu.Lock()
+		p.configs[string(encoded)] = true
+		p.mu.Unlock()
+	}
+	return p.Provider.GenerateContent(ctx, model, contents, config)
+}
+
+// fingerprint identifies the prompt version of a run: the prompt templates and every generation setting seen
+func (p *configRecorder) fingerprint(promptFingerprint string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	configs := make([]string, 0, len(p.configs))
+	for config := range p.configs {
+		configs = append(configs, config)
+	}
+	sort.Strings(configs)
+
+	hash := sha256.New()
+	hash.Write([]byte(promptFingerprint))
+	for _, config := range configs {
+		hash.Write([]byte{0})
+		hash.Write([]byte(config))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// usageCounter sums the tokens of every call
+type usageCounter struct {
+	mu     sync.Mutex
+	tokens int64
+	calls  int
+}
+
+// RecordUsage implements ai.UsageRecorder
+func (u *usageCounter) RecordUsage(ctx context.Context, usage ai.Usage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls++
+	u.tokens += int64(usage.PromptTokens + usage.OutputTokens + usage.ThoughtsTokens)
+}
@@ -0,0 +1,152 @@
+// Command evalprompts replays golden conversations through the AI client and scores the outputs,
+// so that prompt and model changes can be compared before they ship.
+//
+//	go run ./cmd/evalprompts -label new-prompt -out new.json -compare baseline.json
+//
+// With -provider fake no Gemini calls are made; CI uses it to check that prompts, parsing and validation still work.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/config"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+	"google.golang.org/genai"
+)
+
+func main() {
+	corpusDir := flag.String("corpus", "evals/golden", "Directory of golden conversation cases (*.json)")
+	providerName := flag.String("provider", "gemini", "AI provider: gemini or fake")
+	model := flag.String("model", "", "Gemini model (default: GEMINI_MODEL)")
+	taxonomyName := flag.String("taxonomy", "", "Emotion taxonomy (default: EMOTION_TAXONOMY)")
+	label := flag.String("label", "", "Name of this run in the report (default: the prompt fingerprint)")
+	out := flag.String("out", "", "Write the JSON report to this file")
+	compare := flag.String("compare", "", "Compare with a JSON report from an earlier run")
+	maxRegressions := flag.Int("max-regressions", -1, "Exit with an error if more checks than this regress against -compare (-1 disables)")
+	minScore := flag.Float64("min-score", 0, "Exit with an error if the share of passed checks is lower (0-1)")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// The report goes to stdout, so logs go to stderr
+	logger := logging.New(logging.Config{Level: "warn", Format: "text", Redact: cfg.Log.Redact}, os.Stderr)
+	slog.SetDefault(logger)
+
+	cases, err := loadCorpus(*corpusDir)
+	if err != nil {
+		fatal(logger, "Failed to load corpus", err)
+	}
+
+	taxonomy, err := ai.LookupEmotionTaxonomy(firstNonEmpty(*taxonomyName, cfg.AI.EmotionTaxonomy))
+	if err != nil {
+		fatal(logger, "Invalid emotion taxonomy", err)
+	}
+
+	var provider ai.Provider
+	switch *providerName {
+	case "gemini":
+		if cfg.AI.GeminiAPIKey == "" {
+			fatal(logger, "GEMINI_API_KEY is required for the gemini provider", nil)
+		}
+		client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+			APIKey:  cfg.AI.GeminiAPIKey,
+			Backend: genai.BackendGeminiAPI,
+		})
+		if err != nil {
+			fatal(logger, "Failed to create Gemini client", err)
+		}
+		provider = client.Models
+		*model = firstNonEmpty(*model, cfg.AI.Model)
+	case "fake":
+		provider = ai.NewFakeProvider()
+		*model = firstNonEmpty(*model, ai.FakeProviderModel)
+	default:
+		fatal(logger, "Unknown provider "+*providerName, nil)
+	}
+
+	configs := newConfigRecorder(provider)
+	usage := &usageCounter{}
+	client := ai.NewClientWithProvider(configs, *model, ai.Options{
+		Timeouts:         cfg.AI.Timeouts,
+		DefaultTimeout:   cfg.AI.Timeout,
+		MaxRetries:       cfg.AI.MaxRetries,
+		BreakerThreshold: cfg.AI.BreakerThreshold,
+		BreakerCooldown:  cfg.AI.BreakerCooldown,
+	}, logger)
+	client.SetUsageRecorder(usage)
+
+	evaluator := &evaluator{client: client, taxonomy: taxonomy}
+	report := &Report{
+		Provider:    *providerName,
+		Model:       *model,
+		Taxonomy:    taxonomy.Name,
+		GeneratedAt: timeutil.NowJST(),
+	}
+	for _, c := range cases {
+		logger.Info("Evaluating case", slog.String("case", c.ID))
+		report.Cases = append(report.Cases, evaluator.run(context.Background(), c))
+	}
+	report.PromptFingerprint = configs.fingerprint(client.PromptFingerprint(taxonomy))
+	report.Label = firstNonEmpty(*label, report.PromptFingerprint)
+	report.Calls = usage.calls
+	report.Tokens = usage.tokens
+	report.summarize()
+
+	if *out != "" {
+		if err := saveReport(*out, report); err != nil {
+			fatal(logger, "Failed to write report", err)
+		}
+	}
+
+	var baseline *Report
+	var comparison *Comparison
+	if *compare != "" {
+		baseline, err = loadReport(*compare)
+		if err != nil {
+			fatal(logger, "Failed to load baseline report", err)
+		}
+		result := compareReports(baseline, report)
+		comparison = &result
+	}
+
+	writeMarkdown(os.Stdout, report, baseline, comparison)
+
+	if report.Score < *minScore {
+		fmt.Fprintf(os.Stderr, "score %.3f is below -min-score %.3f\n", report.Score, *minScore)
+		os.Exit(1)
+	}
+	if comparison != nil && *maxRegressions >= 0 && len(comparison.Regressions) > *maxRegressions {
+		fmt.Fprintf(os.Stderr, "%d checks regressed (allowed: %d)\n", len(comparison.Regressions), *maxRegressions)
+		os.Exit(1)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fatal logs an error and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, logging.Err(err))
+	} else {
+		logger.Error(msg)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Report is the result of one evaluation run; saved reports are compared against later runs
+type Report struct {
+	// Label names the run, e.g. a prompt change or model under test
+	Label             string       `json:"label"`
+	Provider          string       `json:"provider"`
+	Model             string       `json:"model"`
+	Taxonomy          string       `json:"taxonomy"`
+	PromptFingerprint string       `json:"prompt_fingerprint"`
+	GeneratedAt       time.Time    `json:"generated_at"`
+	Score             float64      `json:"score"`
+	Passed            int          `json:"passed"`
+	Total             int          `json:"total"`
+	Errors            int          `json:"errors"`
+	Calls             int          `json:"calls"`
+	Tokens            int64        `json:"tokens"`
+	Cases             []CaseResult `json:"cases"`
+}
+
+// summarize fills in the totals from the case results
+func (r *Report) summarize() {
+	r.Passed, r.Total, r.Errors = 0, 0, 0
+	for _, c := range r.Cases {
+		passed, total := c.tally()
+		r.Passed += passed
+		r.Total += total
+		r.Errors += len(c.Errors)
+	}
+	r.Score = ratio(r.Passed, r.Total)
+}
+
+// tally counts the passed and total checks of a case
+func (c CaseResult) tally() (passed, total int) {
+	for _, check := range c.Checks {
+		if check.Passed {
+			passed++
+		}
+	}
+	return passed, len(c.Checks)
+}
+
+func ratio(passed, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(passed) / float64(total)
+}
+
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+func saveReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Comparison lists the checks whose outcome changed between a baseline and the current run
+type Comparison struct {
+	Regressions  []string
+	Improvements []string
+	// Missing lists checks of the baseline that the current run no longer has
+	Missing []string
+}
+
+func compareReports(baseline, current *Report) Comparison {
+	var comparison Comparison
+
+	baselineChecks := make(map[string]bool)
+	for _, c := range baseline.Cases {
+		for _, check := range c.Checks {
+			baselineChecks[c.ID+" "+check.Name] = check.Passed
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range current.Cases {
+		for _, check := range c.Checks {
+			key := c.ID + " " + check.Name
+			seen[key] = true
+			passed, ok := baselineChecks[key]
+			switch {
+			case !ok:
+			case passed && !check.Passed:
+				comparison.Regressions = append(comparison.Regressions, key)
+			case !passed && check.Passed:
+				comparison.Improvements = append(comparison.Improvements, key)
+			}
+		}
+	}
+	for _, c := range baseline.Cases {
+		for _, check := range c.Checks {
+			if key := c.ID + " " + check.Name; !seen[key] {
+				comparison.Missing = append(comparison.Missing, key)
+			}
+		}
+	}
+
+	return comparison
+}
+
+// writeMarkdown renders the run, and its comparison with the baseline if given, as a Markdown report
+func writeMarkdown(w io.Writer, current, baseline *Report, comparison *Comparison) {
+	fmt.Fprintf(w, "# Prompt evaluation: %s\n\n", current.Label)
+
+	fmt.Fprintln(w, "| | current |"+baselineCell(baseline, " baseline |"))
+	fmt.Fprintln(w, "|---|---|"+baselineCell(baseline, "---|"))
+	row := func(name string, value func(*Report) string) {
+		line := fmt.Sprintf("| %s | %s |", name, value(current))
+		if baseline != nil {
+			line += fmt.Sprintf(" %s |", value(baseline))
+		}
+		fmt.Fprintln(w, line)
+	}
+	row("label", func(r *Report) string { return r.Label })
+	row("provider / model", func(r *Report) string { return r.Provider + " / " + r.Model })
+	row("taxonomy", func(r *Report) string { return r.Taxonomy })
+	row("prompt fingerprint", func(r *Report) string { return "`" + r.PromptFingerprint + "`" })
+	row("score", func(r *Report) string { return fmt.Sprintf("%.1f%% (%d/%d)", r.Score*100, r.Passed, r.Total) })
+	row("errors", func(r *Report) string { return fmt.Sprint(r.Errors) })
+	row("tokens (calls)", func(r *Report) string { return fmt.Sprintf("%d (%d)", r.Tokens, r.Calls) })
+	fmt.Fprintln(w)
+
+	baselineCases := make(map[string]CaseResult)
+	if baseline != nil {
+		for _, c := range baseline.Cases {
+			baselineCases[c.ID] = c
+		}
+	}
+
+	fmt.Fprintln(w, "## Cases")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| case | checks |"+baselineCell(baseline, " baseline |")+" failed |")
+	fmt.Fprintln(w, "|---|---|"+baselineCell(baseline, "---|")+"---|")
+	for _, c := range current.Cases {
+		passed, total := c.tally()
+		line := fmt.Sprintf("| %s | %d/%d |", c.ID, passed, total)
+		if baseline != nil {
+			if before, ok := baselineCases[c.ID]; ok {
+				passed, total := before.tally()
+				line += fmt.Sprintf(" %d/%d |", passed, total)
+			} else {
+				line += " - |"
+			}
+		}
+		var failed []string
+		for _, check := range c.Checks {
+			if !check.Passed {
+				failed = append(failed, describeCheck(check))
+			}
+		}
+		for _, err := range c.Errors {
+			failed = append(failed, "error: "+err)
+		}
+		line += " " + escapeCell(strings.Join(failed, "<br>")) + " |"
+		fmt.Fprintln(w, line)
+	}
+
+	if comparison != nil {
+		writeList(w, "Regressions", comparison.Regressions)
+		writeList(w, "Improvements", comparison.Improvements)
+		writeList(w, "Checks no longer run", comparison.Missing)
+	}
+}
+
+func baselineCell(baseline *Report, cell string) string {
+	if baseline == nil {
+		return ""
+	}
+	return cell
+}
+
+func describeCheck(check CheckResult) string {
+	if check.Detail == "" {
+		return check.Name
+	}
+	return check.Name + " (" + check.Detail + ")"
+}
+
+func writeList(w io.Writer, title string, items []string) {
+	fmt.Fprintf(w, "\n## %s (%d)\n\n", title, len(items))
+	for _, item := range items {
+		fmt.Fprintf(w, "- %s\n", item)
+	}
+}
+
+func escapeCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+}
@@ -3,22 +3,42 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/metrics"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/genai"
 )
 
 // Client wraps the Gemini AI client
 type Client struct {
-	client *genai.Client
-	model  string
+	provider Provider
+	model    string
+	opts     Options
+	breaker  *breaker
+	logger   *slog.Logger
+	usage    UsageRecorder
 }
 
+// structuredOutputRepairs is how many times the model is re-prompted after unusable structured output
+const structuredOutputRepairs = 1
+
+// Brief reply settings used when a user is over their AI quota
+const (
+	briefHistoryMessages = 6
+	briefMaxOutputTokens = 150
+)
+
 // NewClient creates a new AI client
-func NewClient(apiKey, model string) (*Client, error) {
-	fmt.Println("DEBUG: NewClient called with apiKey:", apiKey, "and model:", model)
+func NewClient(apiKey, model string, opts Options, logger *slog.Logger) (*Client, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("GEMINI_API_KEY is required")
 	}
@@ -31,10 +51,24 @@ func NewClient(apiKey, model string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 
+	return NewClientWithProvider(client.Models, model, opts, logger), nil
+}
+
+// NewClientWithProvider creates an AI client that generates content with the given provider, e.g. a FakeProvider
+func NewClientWithProvider(provider Provider, model string, opts Options, logger *slog.Logger) *Client {
+	opts = opts.withDefaults()
 	return &Client{
-		client: client,
-		model:  model,
-	}, nil
+		provider: provider,
+		model:    model,
+		opts:     opts,
+		breaker:  newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		logger:   logger,
+	}
+}
+
+// SetUsageRecorder sets where the token usage of every Gemini call is recorded
+func (c *Client) SetUsageRecorder(usage UsageRecorder) {
+	c.usage = usage
 }
 
 // ConversationRequest represents a request for conversation generation
@@ -44,6 +78,8 @@ type ConversationRequest struct {
 	Date                string    `json:"date"`
 	TimeOfDay           string    `json:"time_of_day"`
 	UserName            string    `json:"user_name"`
+	// Brief asks for a short reply with less history, e.g. when the user is over their AI quota
+	Brief bool `json:"brief,omitempty"`
 }
 
 // ConversationResponse represents a response from conversation generation
@@ -54,18 +90,41 @@ type ConversationResponse struct {
 
 // Message represents a message in conversation history
 type Message struct {
+	ID      string `json:"id,omitempty"`
 	Content string `json:"content"`
 	Sender  string `json:"sender"`
 }
 
 // EmotionAnalysis represents the result of emotion analysis
 type EmotionAnalysis struct {
+	Taxonomy       string             `json:"taxonomy"`
 	PrimaryEmotion string             `json:"primary_emotion"`
 	Emotions       map[string]float64 `json:"emotions"`
+	Details        []EmotionDetail    `json:"details"`
+	Trajectory     *EmotionTrajectory `json:"trajectory,omitempty"`
 	Confidence     float64            `json:"confidence"`
 	Explanation    string             `json:"explanation"`
 }
 
+// EmotionDetail represents the intensity of a single emotion and the messages supporting it
+type EmotionDetail struct {
+	Emotion   string            `json:"emotion"`
+	Intensity float64           `json:"intensity"`
+	Evidence  []EmotionEvidence `json:"evidence"`
+}
+
+// EmotionEvidence points to the message an emotion was inferred from
+type EmotionEvidence struct {
+	MessageID string `json:"message_id"`
+	Quote     string `json:"quote"`
+}
+
+// EmotionTrajectory represents how emotions shifted from the start to the end of a session
+type EmotionTrajectory struct {
+	Start map[string]float64 `json:"start"`
+	End   map[string]float64 `json:"end"`
+}
+
 // TensionScoreAnalysis represents the result of tension score analysis
 type TensionScoreAnalysis struct {
 	TensionScore  int      `json:"tension_score"`
@@ -74,6 +133,18 @@ type TensionScoreAnalysis struct {
 	KeyFactors    []string `json:"key_factors"`
 }
 
+// EntityExtraction represents the entities mentioned in a conversation
+type EntityExtraction struct {
+	Entities []ExtractedEntity `json:"entities"`
+}
+
+// ExtractedEntity represents a person, place, activity or project mentioned by the user
+type ExtractedEntity struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Mentions int    `json:"mentions"`
+}
+
 // Helper function to convert float to *float32
 func float32Ptr(f float64) *float32 {
 	result := float32(f)
@@ -86,6 +157,174 @@ func int32Ptr(i int) *int32 {
 	return &result
 }
 
+// generateContent calls Gemini in a span and records latency, errors and token usage under the calling method's name.
+// Each attempt is bounded by the method's timeout, retryable failures are retried with jittered backoff
+// while the context's call budget lasts, and no call is made while the circuit breaker is open.
+func (c *Client) generateContent(ctx context.Context, method string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	ctx, span := tracing.Start(ctx, "gemini "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", "gemini"),
+			attribute.String("gen_ai.operation.name", method),
+			attribute.String("gen_ai.request.model", c.model),
+		),
+	)
+	defer span.End()
+
+	// Checked before the breaker, which would take a refused call for a rejected request
+	if !takeCall(ctx) {
+		tracing.RecordError(span, ErrCallBudgetExhausted)
+		return nil, ErrCallBudgetExhausted
+	}
+	if !c.breaker.allow() {
+		tracing.RecordError(span, ErrCircuitOpen)
+		c.logger.WarnContext(ctx, "Gemini call skipped while the circuit breaker is open", slog.String("method", method))
+		return nil, ErrCircuitOpen
+	}
+
+	var response *genai.GenerateContentResponse
+	var err error
+	for attempt := 0; ; attempt++ {
+		response, err = c.attempt(ctx, method, attempt, contents, config)
+		if err == nil || !isRetryable(err) || attempt >= c.opts.MaxRetries || ctx.Err() != nil || !takeCall(ctx) {
+			break
+		}
+
+		delay := c.opts.retryDelay(attempt)
+		metrics.AddAIRetry(method)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.Int64("delay_ms", delay.Milliseconds()),
+		))
+		if sleep(ctx, delay) != nil {
+			break
+		}
+	}
+	c.breaker.record(err)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.UsageMetadata != nil {
+		usage := response.UsageMetadata
+		metrics.AddAITokens(method, usage.PromptTokenCount, usage.CandidatesTokenCount, usage.ThoughtsTokenCount)
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", int(usage.PromptTokenCount)),
+			attribute.Int("gen_ai.usage.output_tokens", int(usage.CandidatesTokenCount)),
+			attribute.Int("gen_ai.usage.thoughts_tokens", int(usage.ThoughtsTokenCount)),
+		)
+		if c.usage != nil {
+			userID, sessionID := usageScopeFrom(ctx)
+			c.usage.RecordUsage(ctx, Usage{
+				UserID:         userID,
+				SessionID:      sessionID,
+				Operation:      method,
+				Model:          c.model,
+				PromptTokens:   int(usage.PromptTokenCount),
+				OutputTokens:   int(usage.CandidatesTokenCount),
+				ThoughtsTokens: int(usage.ThoughtsTokenCount),
+			})
+		}
+	}
+	if response.ModelVersion != "" {
+		span.SetAttributes(attribute.String("gen_ai.response.model", response.ModelVersion))
+	}
+
+	return response, nil
+}
+
+// generateStructured requests JSON output and hands its text to parse, which returns the repairs it made.
+// If the output cannot be used, the model is shown the problems and asked once more, if the call budget
+// allows, before an OutputError is returned.
+func (c *Client) generateStructured(ctx context.Context, method, prompt string, config *genai.GenerateContentConfig, parse func(text string) ([]string, error)) error {
+	contents := []*genai.Content{
+		{
+			Parts: []*genai.Part{{Text: prompt}},
+			Role:  "user",
+		},
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := c.generateContent(ctx, method, contents, config)
+		if err != nil {
+			return err
+		}
+
+		var repairs []string
+		text := responseText(response)
+		if text == "" {
+			err = emptyOutputError(response)
+		} else {
+			repairs, err = parse(text)
+		}
+
+		var outputErr *OutputError
+		if !errors.As(err, &outputErr) {
+			if err == nil && len(repairs) > 0 {
+				c.logger.WarnContext(ctx, "Repaired Gemini structured output",
+					slog.String("method", method),
+					slog.Any("repairs", repairs),
+				)
+			}
+			return err
+		}
+
+		outputErr.Operation = method
+		metrics.AddAIInvalidOutput(method)
+		c.logger.WarnContext(ctx, "Unusable Gemini structured output",
+			slog.String("method", method),
+			slog.Int("attempt", attempt+1),
+			logging.Err(outputErr),
+		)
+		if attempt >= structuredOutputRepairs || !HasCallBudget(ctx) {
+			return outputErr
+		}
+
+		// Show the model what it got wrong; an empty response is simply requested again
+		if text != "" {
+			contents = append(contents,
+				&genai.Content{Parts: []*genai.Part{{Text: text}}, Role: "model"},
+				&genai.Content{Parts: []*genai.Part{{Text: buildRepairPrompt(outputErr.Problems)}}, Role: "user"},
+			)
+		}
+	}
+}
+
+// attempt makes a single Gemini call bounded by the method's timeout
+func (c *Client) attempt(ctx context.Context, method string, attempt int, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout(method))
+	defer cancel()
+
+	start := time.Now()
+	response, err := c.provider.GenerateContent(ctx, c.model, contents, config)
+	duration := time.Since(start)
+	metrics.ObserveAICall(method, duration, err)
+
+	if err != nil {
+		c.logger.WarnContext(ctx, "Gemini call failed",
+			slog.String("method", method),
+			slog.String("model", c.model),
+			slog.Int("attempt", attempt+1),
+			slog.Int64("duration", duration.Milliseconds()),
+			logging.Err(err),
+		)
+	} else if response.UsageMetadata != nil {
+		usage := response.UsageMetadata
+		c.logger.DebugContext(ctx, "Gemini call completed",
+			slog.String("method", method),
+			slog.String("model", c.model),
+			slog.Int("attempt", attempt+1),
+			slog.Int64("duration", duration.Milliseconds()),
+			slog.Int("input_tokens", int(usage.PromptTokenCount)),
+			slog.Int("output_tokens", int(usage.CandidatesTokenCount)),
+			slog.Int("thoughts_tokens", int(usage.ThoughtsTokenCount)),
+		)
+	}
+
+	return response, err
+}
+
 // GenerateResponse generates an AI response for a conversation
 func (c *Client) GenerateResponse(ctx context.Context, req ConversationRequest) (*ConversationResponse, error) {
 	systemPrompt := c.buildConversationSystemPrompt(req)
@@ -99,8 +338,16 @@ func (c *Client) GenerateResponse(ctx context.Context, req ConversationRequest)
 		Role:  "user", // Gemini treats system messages as user messages
 	})
 
-	// Add conversation history
-	for _, msg := range req.ConversationHistory {
+	// Add conversation history; brief replies only need the latest turns
+	history := req.ConversationHistory
+	maxOutputTokens := int32(500)
+	if req.Brief {
+		if len(history) > briefHistoryMessages {
+			history = history[len(history)-briefHistoryMessages:]
+		}
+		maxOutputTokens = briefMaxOutputTokens
+	}
+	for _, msg := range history {
 		role := "user"
 		if msg.Sender == "ai" {
 			role = "model"
@@ -118,9 +365,9 @@ func (c *Client) GenerateResponse(ctx context.Context, req ConversationRequest)
 	})
 
 	// Generate response
-	response, err := c.client.Models.GenerateContent(ctx, c.model, messages, &genai.GenerateContentConfig{
+	response, err := c.generateContent(ctx, "GenerateResponse", messages, &genai.GenerateContentConfig{
 		Temperature:     float32Ptr(0.7),
-		MaxOutputTokens: 500,
+		MaxOutputTokens: maxOutputTokens,
 		ThinkingConfig: &genai.ThinkingConfig{
 			IncludeThoughts: false,
 			ThinkingBudget:  int32Ptr(0),
@@ -141,59 +388,102 @@ func (c *Client) GenerateResponse(ctx context.Context, req ConversationRequest)
 	}, nil
 }
 
-// AnalyzeEmotion analyzes emotions from conversation log
-func (c *Client) AnalyzeEmotion(ctx context.Context, conversationLog string) (*EmotionAnalysis, error) {
-	prompt := c.buildEmotionAnalysisPrompt(conversationLog)
-
-	messages := []*genai.Content{
-		{
-			Parts: []*genai.Part{{Text: prompt}},
-			Role:  "user",
-		},
-	}
+// AnalyzeEmotion analyzes emotions from a session's messages using the given taxonomy
+func (c *Client) AnalyzeEmotion(ctx context.Context, conversation []Message, taxonomy *EmotionTaxonomy) (*EmotionAnalysis, error) {
+	prompt := c.buildEmotionAnalysisPrompt(FormatConversationLog(conversation), taxonomy)
 
-	response, err := c.client.Models.GenerateContent(ctx, c.model, messages, &genai.GenerateContentConfig{
+	var analysis *EmotionAnalysis
+	err := c.generateStructured(ctx, "AnalyzeEmotion", prompt, &genai.GenerateContentConfig{
 		Temperature:      float32Ptr(0.3), // Lower temperature for more consistent analysis
 		MaxOutputTokens:  2000,
 		ResponseMIMEType: "application/json",
+		ResponseSchema:   emotionAnalysisSchema(taxonomy),
 		ThinkingConfig: &genai.ThinkingConfig{
 			IncludeThoughts: true,
 			ThinkingBudget:  int32Ptr(1000),
 		},
+	}, func(text string) ([]string, error) {
+		var repairs []string
+		var err error
+		analysis, repairs, err = parseEmotionAnalysis(text, taxonomy)
+		return repairs, err
 	})
-
 	if err != nil {
 		return nil, fmt.Errorf("failed to analyze emotion: %w", err)
 	}
 
-	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no analysis generated")
-	}
+	analysis.filterEvidence(conversation)
 
-	var responseText string
-	for _, part := range response.Candidates[0].Content.Parts {
-		if !part.Thought {
-			responseText = part.Text
-			break
+	return analysis, nil
+}
+
+// FormatConversationLog formats messages as a conversation log, prefixing each line with its message ID
+func FormatConversationLog(messages []Message) string {
+	var log strings.Builder
+	for _, msg := range messages {
+		senderName := "ユーザー"
+		if msg.Sender == "ai" {
+			senderName = "かさね"
 		}
+		if msg.ID != "" {
+			fmt.Fprintf(&log, "[%s] ", msg.ID)
+		}
+		fmt.Fprintf(&log, "%s: %s\n", senderName, msg.Content)
 	}
+	return log.String()
+}
 
-	if responseText == "" {
-		return nil, fmt.Errorf("no non-thought response found")
+// filterEvidence drops evidence that does not reference a user message in the conversation
+func (a *EmotionAnalysis) filterEvidence(conversation []Message) {
+	userMessages := make(map[string]bool)
+	for _, msg := range conversation {
+		if msg.Sender != "ai" && msg.ID != "" {
+			userMessages[msg.ID] = true
+		}
 	}
 
-	var analysis EmotionAnalysis
-	if err := json.Unmarshal([]byte(responseText), &analysis); err != nil {
-		return nil, fmt.Errorf("failed to parse emotion analysis: %w", err)
+	for i := range a.Details {
+		evidence := a.Details[i].Evidence[:0]
+		for _, e := range a.Details[i].Evidence {
+			if userMessages[e.MessageID] {
+				evidence = append(evidence, e)
+			}
+		}
+		a.Details[i].Evidence = evidence
 	}
-
-	return &analysis, nil
 }
 
 // CalculateTensionScore calculates tension score based on analysis and history
 func (c *Client) CalculateTensionScore(ctx context.Context, todayAnalysis *EmotionAnalysis, historicalData string) (*TensionScoreAnalysis, error) {
 	prompt := c.buildTensionScorePrompt(todayAnalysis, historicalData)
 
+	var analysis *TensionScoreAnalysis
+	err := c.generateStructured(ctx, "CalculateTensionScore", prompt, &genai.GenerateContentConfig{
+		Temperature:      float32Ptr(0.3),
+		MaxOutputTokens:  2000,
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   tensionScoreSchema,
+		ThinkingConfig: &genai.ThinkingConfig{
+			IncludeThoughts: true,
+			ThinkingBudget:  int32Ptr(1000),
+		},
+	}, func(text string) ([]string, error) {
+		var repairs []string
+		var err error
+		analysis, repairs, err = parseTensionScoreAnalysis(text)
+		return repairs, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tension score: %w", err)
+	}
+
+	return analysis, nil
+}
+
+// ExtractEntities extracts the people, places, activities and projects the user talked about
+func (c *Client) ExtractEntities(ctx context.Context, conversation []Message) (*EntityExtraction, error) {
+	prompt := c.buildEntityExtractionPrompt(FormatConversationLog(conversation))
+
 	messages := []*genai.Content{
 		{
 			Parts: []*genai.Part{{Text: prompt}},
@@ -201,42 +491,36 @@ func (c *Client) CalculateTensionScore(ctx context.Context, todayAnalysis *Emoti
 		},
 	}
 
-	response, err := c.client.Models.GenerateContent(ctx, c.model, messages, &genai.GenerateContentConfig{
-		Temperature:      float32Ptr(0.3),
-		MaxOutputTokens:  2000,
+	response, err := c.generateContent(ctx, "ExtractEntities", messages, &genai.GenerateContentConfig{
+		Temperature:      float32Ptr(0.1),
+		MaxOutputTokens:  1000,
 		ResponseMIMEType: "application/json",
 		ThinkingConfig: &genai.ThinkingConfig{
-			IncludeThoughts: true,
-			ThinkingBudget:  int32Ptr(1000),
+			IncludeThoughts: false,
+			ThinkingBudget:  int32Ptr(0),
 		},
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate tension score: %w", err)
+		return nil, fmt.Errorf("failed to extract entities: %w", err)
 	}
 
 	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no score analysis generated")
+		return nil, fmt.Errorf("no entities extracted")
 	}
 
-	var analysis TensionScoreAnalysis
-	var responseText string
-	for _, part := range response.Candidates[0].Content.Parts {
-		if !part.Thought {
-			responseText = part.Text
-			break
-		}
-	}
-	if err := json.Unmarshal([]byte(responseText), &analysis); err != nil {
-		return nil, fmt.Errorf("failed to parse tension score analysis: %w", err)
+	var extraction EntityExtraction
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &extraction); err != nil {
+		return nil, fmt.Errorf("failed to parse entity extraction: %w", err)
 	}
 
-	return &analysis, nil
+	return &extraction, nil
 }
 
-// GenerateFirstMessage generates the initial message for a new chat session
-func (c *Client) GenerateFirstMessage(ctx context.Context, userName, date, timeOfDay string) (*ConversationResponse, error) {
-	prompt := c.buildFirstMessagePrompt(userName, date, timeOfDay)
+// GenerateFirstMessage generates the initial message for a new chat session.
+// acknowledgement optionally describes a recent mood pattern to be acknowledged gently.
+func (c *Client) GenerateFirstMessage(ctx context.Context, userName, date, timeOfDay, acknowledgement string) (*ConversationResponse, error) {
+	prompt := c.buildFirstMessagePrompt(userName, date, timeOfDay, acknowledgement)
 
 	messages := []*genai.Content{
 		{
@@ -245,7 +529,7 @@ func (c *Client) GenerateFirstMessage(ctx context.Context, userName, date, timeO
 		},
 	}
 
-	response, err := c.client.Models.GenerateContent(ctx, c.model, messages, &genai.GenerateContentConfig{
+	response, err := c.generateContent(ctx, "GenerateFirstMessage", messages, &genai.GenerateContentConfig{
 		Temperature:     float32Ptr(0.7),
 		MaxOutputTokens: 1000,
 		ThinkingConfig: &genai.ThinkingConfig{
@@ -296,10 +580,14 @@ func (c *Client) buildConversationSystemPrompt(req ConversationRequest) string {
 時間帯: %s
 ユーザー名: %s`
 
-	return fmt.Sprintf(template, req.Date, req.TimeOfDay, req.UserName)
+	prompt := fmt.Sprintf(template, req.Date, req.TimeOfDay, req.UserName)
+	if req.Brief {
+		prompt += "\n\n## 注意\n返答は1〜2文で短くまとめてください。"
+	}
+	return prompt
 }
 
-func (c *Client) buildFirstMessagePrompt(userName, date, timeOfDay string) string {
+func (c *Client) buildFirstMessagePrompt(userName, date, timeOfDay, acknowledgement string) string {
 	template := `あなたはかさねという親しみやすいAIです。ユーザーの日記の相談相手として、今日の会話を始めてください。
 
 ユーザー名: %s
@@ -311,36 +599,91 @@ func (c *Client) buildFirstMessagePrompt(userName, date, timeOfDay string) strin
 - 今日の調子を聞く
 - 何か印象的な出来事があったか聞く
 - 適度に絵文字を使用
-
+%s
 150文字程度で簡潔にお願いします。`
 
-	return fmt.Sprintf(template, userName, date, timeOfDay)
+	var note string
+	if acknowledgement != "" {
+		note = fmt.Sprintf(`
+## 最近の様子
+%s
+このことにさりげなく触れ、気遣いを示してください。ただし、スコアや分析結果には直接言及せず、問い詰めたり不安をあおったりしないでください。
+`, acknowledgement)
+	}
+
+	return fmt.Sprintf(template, userName, date, timeOfDay, note)
 }
 
-func (c *Client) buildEmotionAnalysisPrompt(conversationLog string) string {
+func (c *Client) buildEmotionAnalysisPrompt(conversationLog string, taxonomy *EmotionTaxonomy) string {
 	template := `以下の会話ログから、ユーザーの感情状態を分析してください。
+各行の先頭の [ ] 内はメッセージIDです。
 
+## 感情モデル
+%s
+%s
 ## 分析項目
-1. 基本感情（happiness, sadness, anger, fear, surprise, disgust）のスコア（0-1）
+1. 各感情の強度スコア（0-1）。複数の感情が同時に存在して構いません
 2. 主要感情の特定
-3. 信頼度スコア（0-1）
-4. 感情の詳細説明
+3. 強度0.2以上の感情ごとに、根拠となるユーザー発言のメッセージIDと短い引用
+4. 会話開始時点と終了時点それぞれの感情スコア（感情の推移）
+5. 信頼度スコア（0-1）
+6. 感情の詳細説明
 
 ## 出力形式（JSON）
 {
   "primary_emotion": "感情名",
-  "emotions": {
-    "happiness": 0.8,
-    "sadness": 0.1,
-    "anger": 0.05,
-    "fear": 0.05,
-    "surprise": 0.0,
-    "disgust": 0.0
+  "emotions": %s,
+  "details": [
+    {
+      "emotion": "感情名",
+      "intensity": 0.8,
+      "evidence": [{"message_id": "メッセージID", "quote": "根拠となる発言の引用"}]
+    }
+  ],
+  "trajectory": {
+    "start": %s,
+    "end": %s
   },
   "confidence": 0.85,
   "explanation": "感情分析の根拠説明"
 }
 
+## 会話ログ
+%s`
+
+	var definitions strings.Builder
+	scores := make([]string, 0, len(taxonomy.Emotions))
+	for _, e := range taxonomy.Emotions {
+		fmt.Fprintf(&definitions, "- %s（%s）\n", e.Name, e.Label)
+		scores = append(scores, fmt.Sprintf("%q: 0.0", e.Name))
+	}
+	example := "{" + strings.Join(scores, ", ") + "}"
+
+	return fmt.Sprintf(template, taxonomy.Description, definitions.String(), example, example, example, conversationLog)
+}
+
+func (c *Client) buildEntityExtractionPrompt(conversationLog string) string {
+	template := `以下の会話ログから、ユーザーが話題にした固有の対象を抽出してください。
+
+## 抽出対象（kind）
+- person: 人物（家族・友人・同僚など。名前がなければ「母」「上司」のような呼び方）
+- place: 場所（店・駅・街・施設など）
+- activity: 活動（ランニング・料理・ゲームなど）
+- project: 取り組んでいる仕事や個人的なプロジェクト
+
+## ルール
+- ユーザー本人と「かさね」は含めない
+- 敬称（さん・くん・ちゃん等）は外す
+- 同じ対象は1件にまとめ、言及回数を mentions に入れる
+- 該当がなければ空の配列を返す
+
+## 出力形式（JSON）
+{
+  "entities": [
+    {"name": "田中", "kind": "person", "mentions": 2}
+  ]
+}
+
 ## 会話ログ
 %s`
 
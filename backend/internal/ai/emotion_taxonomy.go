@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Emotion taxonomy names
+const (
+	TaxonomyEkman    = "ekman"
+	TaxonomyPlutchik = "plutchik"
+	TaxonomyVAD      = "vad"
+)
+
+// DefaultEmotionTaxonomy is used when no taxonomy is configured
+const DefaultEmotionTaxonomy = TaxonomyEkman
+
+// EmotionTaxonomy describes the set of emotions the analysis is performed against
+type EmotionTaxonomy struct {
+	Name        string
+	Description string
+	// Dimensional taxonomies score continuous axes (0.5 = neutral) instead of discrete emotions
+	Dimensional bool
+	Emotions    []EmotionDefinition
+}
+
+// EmotionDefinition describes a single emotion or affect dimension in a taxonomy
+type EmotionDefinition struct {
+	Name  string
+	Label string
+	// Valence is the polarity used for emotional balance (-1 negative, 0 neutral, 1 positive)
+	Valence float64
+}
+
+var emotionTaxonomies = map[string]*EmotionTaxonomy{
+	TaxonomyEkman: {
+		Name:        TaxonomyEkman,
+		Description: "エクマンの基本6感情",
+		Emotions: []EmotionDefinition{
+			{Name: "happiness", Label: "喜び", Valence: 1},
+			{Name: "sadness", Label: "悲しみ", Valence: -1},
+			{Name: "anger", Label: "怒り", Valence: -1},
+			{Name: "fear", Label: "恐れ", Valence: -1},
+			{Name: "surprise", Label: "驚き", Valence: 1},
+			{Name: "disgust", Label: "嫌悪", Valence: 0},
+		},
+	},
+	TaxonomyPlutchik: {
+		Name:        TaxonomyPlutchik,
+		Description: "プルチックの感情の輪（8つの基本感情）",
+		Emotions: []EmotionDefinition{
+			{Name: "joy", Label: "喜び", Valence: 1},
+			{Name: "trust", Label: "信頼", Valence: 1},
+			{Name: "fear", Label: "恐れ", Valence: -1},
+			{Name: "surprise", Label: "驚き", Valence: 0},
+			{Name: "sadness", Label: "悲しみ", Valence: -1},
+			{Name: "disgust", Label: "嫌悪", Valence: -1},
+			{Name: "anger", Label: "怒り", Valence: -1},
+			{Name: "anticipation", Label: "期待", Valence: 1},
+		},
+	},
+	TaxonomyVAD: {
+		Name:        TaxonomyVAD,
+		Description: "感情価・覚醒度・支配性（VAD）の3次元モデル。各軸は0-1で0.5が中立",
+		Dimensional: true,
+		Emotions: []EmotionDefinition{
+			{Name: "valence", Label: "快-不快", Valence: 1},
+			{Name: "arousal", Label: "覚醒-沈静", Valence: 0},
+			{Name: "dominance", Label: "支配-服従", Valence: 0},
+		},
+	},
+}
+
+// LookupEmotionTaxonomy returns the taxonomy registered under the given name
+func LookupEmotionTaxonomy(name string) (*EmotionTaxonomy, error) {
+	if name == "" {
+		name = DefaultEmotionTaxonomy
+	}
+	taxonomy, ok := emotionTaxonomies[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown emotion taxonomy: %s", name)
+	}
+	return taxonomy, nil
+}
+
+// Has reports whether the taxonomy contains the given emotion
+func (t *EmotionTaxonomy) Has(emotion string) bool {
+	for _, e := range t.Emotions {
+		if e.Name == emotion {
+			return true
+		}
+	}
+	return false
+}
+
+// Polarity returns the weighted positive and negative mass of the given emotion scores
+func (t *EmotionTaxonomy) Polarity(emotions map[string]float64) (positive, negative float64) {
+	if t.Dimensional {
+		valence, ok := emotions["valence"]
+		if !ok {
+			valence = 0.5
+		}
+		return valence, 1 - valence
+	}
+
+	for _, e := range t.Emotions {
+		score := emotions[e.Name]
+		if e.Valence > 0 {
+			positive += score * e.Valence
+		} else if e.Valence < 0 {
+			negative += score * -e.Valence
+		}
+	}
+	return positive, negative
+}
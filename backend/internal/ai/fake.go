@@ -0,0 +1,297 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/trasta298/kasaneha/backend/internal/annotator"
+	"google.golang.org/genai"
+)
+
+// FakeProviderModel is the model name reported by FakeProvider responses
+const FakeProviderModel = "fake-lexicon"
+
+// FakeProvider answers every Client method deterministically without calling Gemini.
+// Analyses are derived from the lexicon annotator's sentiment of the user's messages,
+// so that offline runs (e.g. the prompt evaluation in CI) exercise prompts, parsing and validation end to end.
+type FakeProvider struct {
+	lexicon *annotator.LexiconAnnotator
+}
+
+// NewFakeProvider creates a fake provider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{lexicon: annotator.NewLexiconAnnotator()}
+}
+
+// GenerateContent implements Provider. The operation is recognized from the response schema and the contents.
+func (p *FakeProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("fake provider: no contents")
+	}
+	prompt := contentText(contents[0])
+
+	var text string
+	var err error
+	switch {
+	case config != nil && config.ResponseSchema != nil && config.ResponseSchema.Properties["primary_emotion"] != nil:
+		text, err = p.emotionAnalysis(ctx, prompt, config.ResponseSchema)
+	case config != nil && config.ResponseSchema != nil && config.ResponseSchema.Properties["tension_score"] != nil:
+		text, err = p.tensionScore(prompt)
+	case config != nil && config.ResponseMIMEType == "application/json":
+		text = `{"entities": []}`
+	case len(contents) == 1:
+		text = "こんにちは！今日はどんな一日でしたか？よかったら聞かせてください😊"
+	default:
+		text = p.reply(contentText(contents[len(contents)-1]))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	promptTokens := 0
+	for _, content := range contents {
+		promptTokens += estimateTokens(contentText(content))
+	}
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Parts: []*genai.Part{{Text: text}}, Role: "model"},
+			FinishReason: genai.FinishReasonStop,
+		}},
+		ModelVersion: FakeProviderModel,
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount:     int32(promptTokens),
+			CandidatesTokenCount: int32(estimateTokens(text)),
+		},
+	}, nil
+}
+
+// fakeMessage is a user message parsed back from a conversation log
+type fakeMessage struct {
+	id        string
+	content   string
+	sentiment float64
+}
+
+// emotionAnalysis scores the taxonomy's emotions from the sentiment of the user messages in the prompt's conversation log
+func (p *FakeProvider) emotionAnalysis(ctx context.Context, prompt string, schema *genai.Schema) (string, error) {
+	taxonomy := taxonomyForSchema(schema.Properties["emotions"])
+	if taxonomy == nil {
+		return "", fmt.Errorf("fake provider: unknown emotion taxonomy")
+	}
+
+	var messages []fakeMessage
+	for _, line := range strings.Split(sectionAfter(prompt, "## 会話ログ"), "\n") {
+		id, content, ok := parseLogLine(line)
+		if !ok {
+			continue
+		}
+		annotation, err := p.lexicon.Annotate(ctx, content)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, fakeMessage{id: id, content: content, sentiment: annotation.Sentiment.Score})
+	}
+
+	var total float64
+	for _, msg := range messages {
+		total += msg.sentiment
+	}
+	sentiment := 0.0
+	if len(messages) > 0 {
+		sentiment = total / float64(len(messages))
+	}
+
+	emotions := fakeScores(taxonomy, sentiment)
+	analysis := EmotionAnalysis{
+		PrimaryEmotion: strongestEmotion(emotions),
+		Emotions:       emotions,
+		Details:        []EmotionDetail{},
+		Confidence:     0.6,
+		Explanation:    "語彙ベースの感情スコアから推定しました",
+	}
+	if len(messages) > 0 {
+		analysis.Trajectory = &EmotionTrajectory{
+			Start: fakeScores(taxonomy, messages[0].sentiment),
+			End:   fakeScores(taxonomy, messages[len(messages)-1].sentiment),
+		}
+	}
+
+	// Cite the message that leans furthest in each emotion's direction
+	for _, e := range taxonomy.Emotions {
+		if emotions[e.Name] < 0.2 || taxonomy.Dimensional {
+			continue
+		}
+		detail := EmotionDetail{Emotion: e.Name, Intensity: emotions[e.Name], Evidence: []EmotionEvidence{}}
+		if evidence, ok := strongestMessage(messages, e.Valence); ok && evidence.id != "" {
+			detail.Evidence = append(detail.Evidence, EmotionEvidence{MessageID: evidence.id, Quote: truncateRunes(evidence.content, 30)})
+		}
+		analysis.Details = append(analysis.Details, detail)
+	}
+
+	output, err := json.Marshal(analysis)
+	return string(output), err
+}
+
+// tensionScore maps the polarity of the prompt's emotion scores to 0-100
+func (p *FakeProvider) tensionScore(prompt string) (string, error) {
+	var emotions map[string]float64
+	for _, line := range strings.Split(prompt, "\n") {
+		if scores, ok := strings.CutPrefix(line, "感情スコア: "); ok {
+			if err := json.Unmarshal([]byte(scores), &emotions); err != nil {
+				return "", fmt.Errorf("fake provider: failed to parse emotion scores: %w", err)
+			}
+		}
+	}
+
+	score := 50.0
+	names := make([]string, 0, len(emotions))
+	for name := range emotions {
+		names = append(names, name)
+	}
+	if taxonomy := taxonomyForNames(names); taxonomy != nil {
+		// The balance between positive and negative mass keeps fake scores within 10-90
+		if positive, negative := taxonomy.Polarity(emotions); positive+negative > 0 {
+			score = 50 + 40*(positive-negative)/(positive+negative)
+		}
+	}
+
+	output, err := json.Marshal(TensionScoreAnalysis{
+		TensionScore:  int(math.Round(score)),
+		RelativeScore: 0,
+		Reasoning:     "感情スコアの正負のバランスから算出しました",
+		KeyFactors:    []string{"感情のバランス"},
+	})
+	return string(output), err
+}
+
+// reply echoes the user's message back with a follow-up question
+func (p *FakeProvider) reply(userMessage string) string {
+	return fmt.Sprintf("「%s」だったんですね。そのとき、どんな気持ちでしたか？", truncateRunes(strings.TrimSpace(userMessage), 20))
+}
+
+// fakeScores spreads a -1..1 sentiment over the taxonomy's emotions by valence
+func fakeScores(taxonomy *EmotionTaxonomy, sentiment float64) map[string]float64 {
+	scores := make(map[string]float64, len(taxonomy.Emotions))
+	if taxonomy.Dimensional {
+		for _, e := range taxonomy.Emotions {
+			scores[e.Name] = 0.5
+		}
+		scores["valence"] = roundScore(0.5 + sentiment/2)
+		scores["arousal"] = roundScore(0.5 + math.Abs(sentiment)/4)
+		return scores
+	}
+
+	positive, negative := math.Max(sentiment, 0), math.Max(-sentiment, 0)
+	rank := map[bool]int{}
+	for _, e := range taxonomy.Emotions {
+		switch {
+		case e.Valence > 0:
+			rank[true]++
+			scores[e.Name] = roundScore(0.1 + 0.8*positive/float64(rank[true]))
+		case e.Valence < 0:
+			rank[false]++
+			scores[e.Name] = roundScore(0.1 + 0.8*negative/float64(rank[false]))
+		default:
+			scores[e.Name] = 0.1
+		}
+	}
+	return scores
+}
+
+// strongestMessage returns the message whose sentiment leans furthest towards valence
+func strongestMessage(messages []fakeMessage, valence float64) (fakeMessage, bool) {
+	var strongest fakeMessage
+	found := false
+	for _, msg := range messages {
+		lean := msg.sentiment * valence
+		if lean > 0 && (!found || lean > strongest.sentiment*valence) {
+			strongest, found = msg, true
+		}
+	}
+	return strongest, found
+}
+
+// taxonomyForSchema finds the registered taxonomy whose emotions are the schema's properties
+func taxonomyForSchema(schema *genai.Schema) *EmotionTaxonomy {
+	if schema == nil {
+		return nil
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	return taxonomyForNames(names)
+}
+
+// taxonomyForNames finds the registered taxonomy with exactly the given emotions
+func taxonomyForNames(names []string) *EmotionTaxonomy {
+	for _, taxonomy := range emotionTaxonomies {
+		if len(taxonomy.Emotions) != len(names) {
+			continue
+		}
+		matches := true
+		for _, name := range names {
+			if !taxonomy.Has(name) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return taxonomy
+		}
+	}
+	return nil
+}
+
+// parseLogLine parses a user line of FormatConversationLog output
+func parseLogLine(line string) (id, content string, ok bool) {
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "] ")
+		if end < 0 {
+			return "", "", false
+		}
+		id, line = line[1:end], line[end+2:]
+	}
+	content, ok = strings.CutPrefix(line, "ユーザー: ")
+	return id, content, ok
+}
+
+// sectionAfter returns the text following a heading
+func sectionAfter(text, heading string) string {
+	if i := strings.LastIndex(text, heading); i >= 0 {
+		return text[i+len(heading):]
+	}
+	return ""
+}
+
+func contentText(content *genai.Content) string {
+	if content == nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// estimateTokens approximates Gemini's token count for Japanese text
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/2 + 1
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(math.Max(0, math.Min(1, score))*100) / 100
+}
+
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
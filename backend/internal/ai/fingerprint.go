@@ -0,0 +1,32 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// PromptFingerprint identifies the current prompt templates and response schemas.
+// Prompts are rendered from fixed placeholders, so the fingerprint only changes when a template or schema does;
+// evaluation reports use it to tell prompt versions apart.
+func (c *Client) PromptFingerprint(taxonomy *EmotionTaxonomy) string {
+	const conversationLog = "{conversation_log}"
+	sampleAnalysis := &EmotionAnalysis{PrimaryEmotion: "{primary_emotion}", Emotions: map[string]float64{}}
+	schemas, _ := json.Marshal([]any{emotionAnalysisSchema(taxonomy), tensionScoreSchema})
+
+	hash := sha256.New()
+	for _, prompt := range []string{
+		c.buildConversationSystemPrompt(ConversationRequest{Date: "{date}", TimeOfDay: "{time_of_day}", UserName: "{user_name}"}),
+		c.buildConversationSystemPrompt(ConversationRequest{Date: "{date}", TimeOfDay: "{time_of_day}", UserName: "{user_name}", Brief: true}),
+		c.buildFirstMessagePrompt("{user_name}", "{date}", "{time_of_day}", "{acknowledgement}"),
+		c.buildEmotionAnalysisPrompt(conversationLog, taxonomy),
+		c.buildTensionScorePrompt(sampleAnalysis, "{history}"),
+		c.buildEntityExtractionPrompt(conversationLog),
+		buildRepairPrompt([]string{"{problem}"}),
+		string(schemas),
+	} {
+		hash.Write([]byte(prompt))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
@@ -0,0 +1,296 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Structured output failures; OutputError wraps one of them
+var (
+	// ErrEmptyOutput means Gemini returned no text, e.g. because the output was blocked or cut off
+	ErrEmptyOutput = errors.New("ai returned no output")
+	// ErrMalformedOutput means the output is not valid JSON for the expected type
+	ErrMalformedOutput = errors.New("ai output is not valid JSON")
+	// ErrInvalidOutput means the output parsed but violates the schema in a way that cannot be repaired
+	ErrInvalidOutput = errors.New("ai output failed validation")
+)
+
+// OutputError reports structured output that could not be used, even after re-prompting.
+// Gemini itself worked, so repeating the call may succeed.
+type OutputError struct {
+	Operation string
+	Problems  []string
+	Err       error
+}
+
+func (e *OutputError) Error() string {
+	message := e.Err.Error()
+	if e.Operation != "" {
+		message = e.Operation + ": " + message
+	}
+	if len(e.Problems) > 0 {
+		message += ": " + strings.Join(e.Problems, "; ")
+	}
+	return message
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// IsOutputError reports whether err means Gemini answered but its output could not be used
+func IsOutputError(err error) bool {
+	var outputErr *OutputError
+	return errors.As(err, &outputErr)
+}
+
+// responseText returns the non-thought text of the first candidate
+func responseText(response *genai.GenerateContentResponse) string {
+	if len(response.Candidates) == 0 || response.Candidates[0].Content == nil {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, part := range response.Candidates[0].Content.Parts {
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// emptyOutputError explains why a response had no text
+func emptyOutputError(response *genai.GenerateContentResponse) *OutputError {
+	var problems []string
+	if response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
+		problems = append(problems, "prompt blocked: "+string(response.PromptFeedback.BlockReason))
+	}
+	if len(response.Candidates) > 0 && response.Candidates[0].FinishReason != "" {
+		problems = append(problems, "finish reason: "+string(response.Candidates[0].FinishReason))
+	}
+	return &OutputError{Problems: problems, Err: ErrEmptyOutput}
+}
+
+// buildRepairPrompt asks the model to correct its previous output
+func buildRepairPrompt(problems []string) string {
+	return fmt.Sprintf(`直前の出力には次の問題がありました。
+- %s
+
+問題を修正し、指定したJSONスキーマに従ったJSONだけを出力し直してください。`, strings.Join(problems, "\n- "))
+}
+
+// Response schemas
+
+func numberSchema(min, max float64) *genai.Schema {
+	return &genai.Schema{Type: genai.TypeNumber, Minimum: &min, Maximum: &max}
+}
+
+func integerSchema(min, max float64) *genai.Schema {
+	return &genai.Schema{Type: genai.TypeInteger, Minimum: &min, Maximum: &max}
+}
+
+func stringSchema() *genai.Schema {
+	return &genai.Schema{Type: genai.TypeString}
+}
+
+func objectSchema(properties map[string]*genai.Schema, order []string, required ...string) *genai.Schema {
+	return &genai.Schema{Type: genai.TypeObject, Properties: properties, PropertyOrdering: order, Required: required}
+}
+
+// emotionScoresSchema requires a 0-1 score for every emotion in the taxonomy
+func emotionScoresSchema(taxonomy *EmotionTaxonomy) *genai.Schema {
+	properties := make(map[string]*genai.Schema, len(taxonomy.Emotions))
+	names := make([]string, 0, len(taxonomy.Emotions))
+	for _, e := range taxonomy.Emotions {
+		properties[e.Name] = numberSchema(0, 1)
+		names = append(names, e.Name)
+	}
+	return objectSchema(properties, names, names...)
+}
+
+// emotionAnalysisSchema is the response schema of AnalyzeEmotion for a taxonomy
+func emotionAnalysisSchema(taxonomy *EmotionTaxonomy) *genai.Schema {
+	emotionName := stringSchema()
+	if !taxonomy.Dimensional {
+		for _, e := range taxonomy.Emotions {
+			emotionName.Enum = append(emotionName.Enum, e.Name)
+		}
+	}
+
+	evidence := objectSchema(map[string]*genai.Schema{
+		"message_id": stringSchema(),
+		"quote":      stringSchema(),
+	}, []string{"message_id", "quote"}, "message_id", "quote")
+
+	detail := objectSchema(map[string]*genai.Schema{
+		"emotion":   emotionName,
+		"intensity": numberSchema(0, 1),
+		"evidence":  {Type: genai.TypeArray, Items: evidence},
+	}, []string{"emotion", "intensity", "evidence"}, "emotion", "intensity", "evidence")
+
+	trajectory := objectSchema(map[string]*genai.Schema{
+		"start": emotionScoresSchema(taxonomy),
+		"end":   emotionScoresSchema(taxonomy),
+	}, []string{"start", "end"}, "start", "end")
+
+	order := []string{"primary_emotion", "emotions", "details", "trajectory", "confidence", "explanation"}
+	return objectSchema(map[string]*genai.Schema{
+		"primary_emotion": emotionName,
+		"emotions":        emotionScoresSchema(taxonomy),
+		"details":         {Type: genai.TypeArray, Items: detail},
+		"trajectory":      trajectory,
+		"confidence":      numberSchema(0, 1),
+		"explanation":     stringSchema(),
+	}, order, order...)
+}
+
+// tensionScoreSchema is the response schema of CalculateTensionScore
+var tensionScoreSchema = objectSchema(map[string]*genai.Schema{
+	"tension_score":  integerSchema(0, 100),
+	"relative_score": integerSchema(-50, 50),
+	"reasoning":      stringSchema(),
+	"key_factors":    {Type: genai.TypeArray, Items: stringSchema()},
+}, []string{"tension_score", "relative_score", "reasoning", "key_factors"},
+	"tension_score", "relative_score", "reasoning", "key_factors")
+
+// Validation and repair. Out-of-range values are clamped and unknown emotions dropped, with a note for each repair;
+// problems that cannot be repaired are returned as an OutputError so that the model can be re-prompted.
+
+// parseEmotionAnalysis decodes and repairs AnalyzeEmotion output
+func parseEmotionAnalysis(text string, taxonomy *EmotionTaxonomy) (*EmotionAnalysis, []string, error) {
+	var analysis EmotionAnalysis
+	if err := json.Unmarshal([]byte(text), &analysis); err != nil {
+		return nil, nil, &OutputError{Problems: []string{err.Error()}, Err: ErrMalformedOutput}
+	}
+
+	var repairs []string
+	neutral := 0.0
+	if taxonomy.Dimensional {
+		neutral = 0.5
+	}
+
+	known := 0
+	for name := range analysis.Emotions {
+		if taxonomy.Has(name) {
+			known++
+		}
+	}
+	if known == 0 {
+		return nil, nil, &OutputError{Problems: []string{"emotions has no scores for the taxonomy's emotions"}, Err: ErrInvalidOutput}
+	}
+
+	analysis.Emotions = repairScores("emotions", analysis.Emotions, taxonomy, neutral, &repairs)
+
+	if !taxonomy.Dimensional && !taxonomy.Has(analysis.PrimaryEmotion) {
+		primary := strongestEmotion(analysis.Emotions)
+		repairs = append(repairs, fmt.Sprintf("primary_emotion %q replaced with %q", analysis.PrimaryEmotion, primary))
+		analysis.PrimaryEmotion = primary
+	}
+
+	details := analysis.Details[:0]
+	for _, detail := range analysis.Details {
+		if !taxonomy.Has(detail.Emotion) {
+			repairs = append(repairs, fmt.Sprintf("details: dropped unknown emotion %q", detail.Emotion))
+			continue
+		}
+		detail.Intensity = clampScore("details."+detail.Emotion+".intensity", detail.Intensity, 0, 1, &repairs)
+		details = append(details, detail)
+	}
+	analysis.Details = details
+
+	if analysis.Trajectory != nil {
+		analysis.Trajectory.Start = repairScores("trajectory.start", analysis.Trajectory.Start, taxonomy, neutral, &repairs)
+		analysis.Trajectory.End = repairScores("trajectory.end", analysis.Trajectory.End, taxonomy, neutral, &repairs)
+	}
+
+	analysis.Confidence = clampScore("confidence", analysis.Confidence, 0, 1, &repairs)
+	analysis.Taxonomy = taxonomy.Name
+
+	return &analysis, repairs, nil
+}
+
+// repairScores keeps exactly the taxonomy's emotions, filling missing ones with the neutral score and clamping to 0-1
+func repairScores(field string, scores map[string]float64, taxonomy *EmotionTaxonomy, neutral float64, repairs *[]string) map[string]float64 {
+	repaired := make(map[string]float64, len(taxonomy.Emotions))
+	for _, e := range taxonomy.Emotions {
+		score, ok := scores[e.Name]
+		if !ok {
+			*repairs = append(*repairs, fmt.Sprintf("%s.%s missing, set to %g", field, e.Name, neutral))
+			score = neutral
+		}
+		repaired[e.Name] = clampScore(field+"."+e.Name, score, 0, 1, repairs)
+	}
+	for name := range scores {
+		if !taxonomy.Has(name) {
+			*repairs = append(*repairs, fmt.Sprintf("%s: dropped unknown emotion %q", field, name))
+		}
+	}
+	return repaired
+}
+
+// strongestEmotion returns the highest-scoring emotion, breaking ties by name for stable results
+func strongestEmotion(scores map[string]float64) string {
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	strongest := ""
+	for _, name := range names {
+		if strongest == "" || scores[name] > scores[strongest] {
+			strongest = name
+		}
+	}
+	return strongest
+}
+
+// clampScore limits value to [min, max], noting the repair
+func clampScore(field string, value, min, max float64, repairs *[]string) float64 {
+	clamped := math.Max(min, math.Min(max, value))
+	if clamped != value {
+		*repairs = append(*repairs, fmt.Sprintf("%s %g clamped to %g", field, value, clamped))
+	}
+	return clamped
+}
+
+// parseTensionScoreAnalysis decodes and repairs CalculateTensionScore output
+func parseTensionScoreAnalysis(text string) (*TensionScoreAnalysis, []string, error) {
+	// Scores are decoded as numbers so that a missing score can be told apart from 0 and fractions can be rounded
+	var output struct {
+		TensionScore  *float64 `json:"tension_score"`
+		RelativeScore *float64 `json:"relative_score"`
+		Reasoning     string   `json:"reasoning"`
+		KeyFactors    []string `json:"key_factors"`
+	}
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		return nil, nil, &OutputError{Problems: []string{err.Error()}, Err: ErrMalformedOutput}
+	}
+	if output.TensionScore == nil {
+		return nil, nil, &OutputError{Problems: []string{"tension_score is missing"}, Err: ErrInvalidOutput}
+	}
+
+	var repairs []string
+	relativeScore := 0.0
+	if output.RelativeScore == nil {
+		repairs = append(repairs, "relative_score missing, set to 0")
+	} else {
+		relativeScore = *output.RelativeScore
+	}
+	if output.KeyFactors == nil {
+		output.KeyFactors = []string{}
+	}
+
+	return &TensionScoreAnalysis{
+		TensionScore:  int(math.Round(clampScore("tension_score", *output.TensionScore, 0, 100, &repairs))),
+		RelativeScore: int(math.Round(clampScore("relative_score", relativeScore, -50, 50, &repairs))),
+		Reasoning:     output.Reasoning,
+		KeyFactors:    output.KeyFactors,
+	}, repairs, nil
+}
@@ -0,0 +1,272 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustTaxonomy(t *testing.T, name string) *EmotionTaxonomy {
+	t.Helper()
+	taxonomy, err := LookupEmotionTaxonomy(name)
+	if err != nil {
+		t.Fatalf("LookupEmotionTaxonomy: %v", err)
+	}
+	return taxonomy
+}
+
+func TestRepairScores(t *testing.T) {
+	vad := mustTaxonomy(t, TaxonomyVAD)
+
+	tests := []struct {
+		name        string
+		scores      map[string]float64
+		neutral     float64
+		want        map[string]float64
+		wantRepairs int
+	}{
+		{
+			name:   "complete and in range",
+			scores: map[string]float64{"valence": 0.2, "arousal": 0.5, "dominance": 1},
+			want:   map[string]float64{"valence": 0.2, "arousal": 0.5, "dominance": 1},
+		},
+		{
+			name:        "out of range is clamped",
+			scores:      map[string]float64{"valence": -0.3, "arousal": 1.7, "dominance": 0.4},
+			want:        map[string]float64{"valence": 0, "arousal": 1, "dominance": 0.4},
+			wantRepairs: 2,
+		},
+		{
+			name:        "missing is neutral",
+			scores:      map[string]float64{"valence": 0.9},
+			neutral:     0.5,
+			want:        map[string]float64{"valence": 0.9, "arousal": 0.5, "dominance": 0.5},
+			wantRepairs: 2,
+		},
+		{
+			name:        "unknown is dropped",
+			scores:      map[string]float64{"valence": 0.1, "arousal": 0.2, "dominance": 0.3, "joy": 0.8},
+			want:        map[string]float64{"valence": 0.1, "arousal": 0.2, "dominance": 0.3},
+			wantRepairs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repairs []string
+			got := repairScores("emotions", tt.scores, vad, tt.neutral, &repairs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("repairScores = %v, want %v", got, tt.want)
+			}
+			for name, score := range tt.want {
+				if got[name] != score {
+					t.Errorf("repairScores = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			if len(repairs) != tt.wantRepairs {
+				t.Errorf("repairs = %q, want %d", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestParseEmotionAnalysis(t *testing.T) {
+	ekman := mustTaxonomy(t, TaxonomyEkman)
+	vad := mustTaxonomy(t, TaxonomyVAD)
+	const scores = `"happiness": 0.7, "sadness": 0.1, "anger": 0, "fear": 0.2, "surprise": 0, "disgust": 0`
+
+	tests := []struct {
+		name        string
+		taxonomy    *EmotionTaxonomy
+		text        string
+		wantErr     error
+		check       func(t *testing.T, analysis *EmotionAnalysis)
+		wantRepairs int
+	}{
+		{
+			name:     "valid",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "happiness", "emotions": {` + scores + `}, "details": [{"emotion": "happiness", "intensity": 0.7, "evidence": []}], "confidence": 0.8, "explanation": "楽しそう"}`,
+			check: func(t *testing.T, analysis *EmotionAnalysis) {
+				if analysis.PrimaryEmotion != "happiness" || analysis.Confidence != 0.8 || analysis.Taxonomy != TaxonomyEkman || len(analysis.Details) != 1 {
+					t.Errorf("analysis = %+v", analysis)
+				}
+			},
+		},
+		{
+			name:     "out-of-range values are clamped",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "happiness", "emotions": {"happiness": 1.4, "sadness": -0.2, "anger": 0, "fear": 0, "surprise": 0, "disgust": 0}, "details": [{"emotion": "happiness", "intensity": 2}], "confidence": 1.5}`,
+			check: func(t *testing.T, analysis *EmotionAnalysis) {
+				if analysis.Emotions["happiness"] != 1 || analysis.Emotions["sadness"] != 0 || analysis.Details[0].Intensity != 1 || analysis.Confidence != 1 {
+					t.Errorf("analysis = %+v, want scores clamped to 0-1", analysis)
+				}
+			},
+			wantRepairs: 4,
+		},
+		{
+			name:     "unknown emotions are dropped",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "joy", "emotions": {` + scores + `, "joy": 0.9}, "details": [{"emotion": "joy", "intensity": 0.9}, {"emotion": "fear", "intensity": 0.2}], "confidence": 0.5}`,
+			check: func(t *testing.T, analysis *EmotionAnalysis) {
+				if _, ok := analysis.Emotions["joy"]; ok {
+					t.Errorf("emotions = %v, want joy dropped", analysis.Emotions)
+				}
+				if analysis.PrimaryEmotion != "happiness" {
+					t.Errorf("primary emotion = %q, want the strongest known emotion", analysis.PrimaryEmotion)
+				}
+				if len(analysis.Details) != 1 || analysis.Details[0].Emotion != "fear" {
+					t.Errorf("details = %+v, want only fear", analysis.Details)
+				}
+			},
+			wantRepairs: 3,
+		},
+		{
+			name:     "missing dimensions are neutral",
+			taxonomy: vad,
+			text:     `{"primary_emotion": "calm", "emotions": {"valence": 0.8}, "trajectory": {"start": {"valence": 0.3}, "end": {"valence": 0.8, "arousal": 0.4, "dominance": 0.6}}, "confidence": 0.6}`,
+			check: func(t *testing.T, analysis *EmotionAnalysis) {
+				if analysis.Emotions["arousal"] != 0.5 || analysis.Trajectory.Start["dominance"] != 0.5 {
+					t.Errorf("analysis = %+v, want missing dimensions at 0.5", analysis)
+				}
+				// Dimensional taxonomies describe the primary emotion freely
+				if analysis.PrimaryEmotion != "calm" {
+					t.Errorf("primary emotion = %q, want calm", analysis.PrimaryEmotion)
+				}
+			},
+			wantRepairs: 4,
+		},
+		{
+			name:     "no known emotions",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "joy", "emotions": {"joy": 0.9}, "confidence": 0.5}`,
+			wantErr:  ErrInvalidOutput,
+		},
+		{
+			name:     "malformed JSON",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "happiness", "emotions": {`,
+			wantErr:  ErrMalformedOutput,
+		},
+		{
+			name:     "wrong types",
+			taxonomy: ekman,
+			text:     `{"primary_emotion": "happiness", "emotions": {"happiness": "high"}}`,
+			wantErr:  ErrMalformedOutput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, repairs, err := parseEmotionAnalysis(tt.text, tt.taxonomy)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !IsOutputError(err) {
+					t.Fatalf("parseEmotionAnalysis error = %v, want an OutputError wrapping %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEmotionAnalysis: %v", err)
+			}
+			if len(analysis.Emotions) != len(tt.taxonomy.Emotions) {
+				t.Errorf("emotions = %v, want exactly the taxonomy's", analysis.Emotions)
+			}
+			tt.check(t, analysis)
+			if len(repairs) != tt.wantRepairs {
+				t.Errorf("repairs = %q, want %d", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestParseTensionScoreAnalysis(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantErr      error
+		wantScore    int
+		wantRelative int
+		wantRepairs  int
+	}{
+		{
+			name:         "valid",
+			text:         `{"tension_score": 65, "relative_score": -10, "reasoning": "疲れ気味", "key_factors": ["仕事"]}`,
+			wantScore:    65,
+			wantRelative: -10,
+		},
+		{
+			name:         "zero is a score",
+			text:         `{"tension_score": 0, "relative_score": 0, "reasoning": "", "key_factors": []}`,
+			wantScore:    0,
+			wantRelative: 0,
+		},
+		{
+			name:         "fractions are rounded",
+			text:         `{"tension_score": 64.6, "relative_score": 12.4}`,
+			wantScore:    65,
+			wantRelative: 12,
+		},
+		{
+			name:         "out of range is clamped",
+			text:         `{"tension_score": 130, "relative_score": -80}`,
+			wantScore:    100,
+			wantRelative: -50,
+			wantRepairs:  2,
+		},
+		{
+			name:         "negative score is clamped",
+			text:         `{"tension_score": -5, "relative_score": 3}`,
+			wantScore:    0,
+			wantRelative: 3,
+			wantRepairs:  1,
+		},
+		{
+			name:        "missing relative score",
+			text:        `{"tension_score": 40}`,
+			wantScore:   40,
+			wantRepairs: 1,
+		},
+		{
+			name:    "missing tension score",
+			text:    `{"relative_score": 5, "reasoning": "不明"}`,
+			wantErr: ErrInvalidOutput,
+		},
+		{
+			name:    "null tension score",
+			text:    `{"tension_score": null, "relative_score": 5}`,
+			wantErr: ErrInvalidOutput,
+		},
+		{
+			name:    "malformed JSON",
+			text:    `tension_score: 40`,
+			wantErr: ErrMalformedOutput,
+		},
+		{
+			name:    "score as a string",
+			text:    `{"tension_score": "40"}`,
+			wantErr: ErrMalformedOutput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, repairs, err := parseTensionScoreAnalysis(tt.text)
+			if tt.wantErr != nil {
+				var outputErr *OutputError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &outputErr) || len(outputErr.Problems) == 0 {
+					t.Fatalf("parseTensionScoreAnalysis error = %v, want an OutputError wrapping %v with its problems", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTensionScoreAnalysis: %v", err)
+			}
+			if analysis.TensionScore != tt.wantScore || analysis.RelativeScore != tt.wantRelative {
+				t.Errorf("scores = %d, %d, want %d, %d", analysis.TensionScore, analysis.RelativeScore, tt.wantScore, tt.wantRelative)
+			}
+			if analysis.KeyFactors == nil {
+				t.Error("key factors = nil, want an empty list")
+			}
+			if len(repairs) != tt.wantRepairs {
+				t.Errorf("repairs = %q, want %d", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package ai
+
+import (
+	"context"
+
+	"google.golang.org/genai"
+)
+
+// Provider generates content for the Client. The Gemini API (*genai.Models) implements it;
+// FakeProvider stands in for it in tools and CI runs that must not call Gemini.
+type Provider interface {
+	GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
+}
+
+var _ Provider = (*genai.Models)(nil)
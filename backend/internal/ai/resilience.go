@@ -0,0 +1,238 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/metrics"
+	"google.golang.org/genai"
+)
+
+// ErrCircuitOpen is returned without calling Gemini while the circuit breaker is open
+var ErrCircuitOpen = errors.New("ai circuit breaker is open")
+
+// ErrCallBudgetExhausted is returned without calling Gemini once the context's call budget is used up
+var ErrCallBudgetExhausted = errors.New("ai call budget exhausted")
+
+// Options configures timeouts, retries and the circuit breaker around Gemini calls.
+// Zero values other than MaxRetries are replaced by the defaults.
+type Options struct {
+	// Timeouts bounds a single attempt per operation (Client method name); other operations use DefaultTimeout
+	Timeouts       map[string]time.Duration
+	DefaultTimeout time.Duration
+	// MaxRetries is how many times a retryable failure (429, 5xx, timeout) is retried; 0 disables retries
+	MaxRetries int
+	// RetryBaseDelay doubles with every retry up to RetryMaxDelay; the actual delay is randomized (full jitter)
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerThreshold consecutive unavailable calls open the circuit for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Default resilience settings. Chat replies are awaited by the user, so they get shorter timeouts than analyses.
+var defaultTimeouts = map[string]time.Duration{
+	"GenerateResponse":     15 * time.Second,
+	"GenerateFirstMessage": 15 * time.Second,
+}
+
+const (
+	defaultTimeout          = 60 * time.Second
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+	defaultRetryMaxDelay    = 4 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// withDefaults fills unset options with the defaults
+func (o Options) withDefaults() Options {
+	timeouts := make(map[string]time.Duration, len(defaultTimeouts)+len(o.Timeouts))
+	for operation, timeout := range defaultTimeouts {
+		timeouts[operation] = timeout
+	}
+	for operation, timeout := range o.Timeouts {
+		if timeout > 0 {
+			timeouts[operation] = timeout
+		}
+	}
+	o.Timeouts = timeouts
+
+	if o.DefaultTimeout <= 0 {
+		o.DefaultTimeout = defaultTimeout
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBaseDelay <= 0 {
+		o.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if o.RetryMaxDelay <= 0 {
+		o.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if o.BreakerThreshold <= 0 {
+		o.BreakerThreshold = defaultBreakerThreshold
+	}
+	if o.BreakerCooldown <= 0 {
+		o.BreakerCooldown = defaultBreakerCooldown
+	}
+	return o
+}
+
+// timeout returns the per-attempt timeout of an operation
+func (o Options) timeout(operation string) time.Duration {
+	if timeout, ok := o.Timeouts[operation]; ok {
+		return timeout
+	}
+	return o.DefaultTimeout
+}
+
+// retryDelay returns a random delay in [0, min(base*2^retry, max)) before the given retry (0-based)
+func (o Options) retryDelay(retry int) time.Duration {
+	// Compared before shifting, since the shift could overflow
+	ceiling := o.RetryMaxDelay
+	if retry < 63 && o.RetryBaseDelay <= o.RetryMaxDelay>>retry {
+		ceiling = o.RetryBaseDelay << retry
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// IsUnavailable reports whether err means Gemini is temporarily unavailable, as opposed to rejecting the request
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || isRetryable(err)
+}
+
+// isRetryable reports whether a failed attempt may succeed if repeated
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Circuit breaker states
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker stops calling Gemini after repeated unavailability, then lets a single trial call through after a cooldown
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     int
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may proceed; after the cooldown only one trial call is let through
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false // the trial call is still running
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of an allowed call
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Rejected requests say nothing about Gemini's availability
+	if err != nil && !isRetryable(err) {
+		if b.state == breakerHalfOpen {
+			b.state = breakerClosed
+			b.failures = 0
+			metrics.SetAICircuitOpen(false)
+		}
+		return
+	}
+
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		metrics.SetAICircuitOpen(false)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		metrics.SetAICircuitOpen(true)
+	}
+}
+
+type callBudgetKey struct{}
+
+// WithCallBudget limits the Gemini calls made with ctx to n, counting every retry and repair prompt, so
+// that work repeated around the client cannot multiply them. Calls without a budget are not limited.
+func WithCallBudget(ctx context.Context, n int) context.Context {
+	remaining := &atomic.Int64{}
+	remaining.Store(int64(n))
+	return context.WithValue(ctx, callBudgetKey{}, remaining)
+}
+
+// HasCallBudget reports whether another Gemini call may be made with ctx
+func HasCallBudget(ctx context.Context) bool {
+	remaining, ok := ctx.Value(callBudgetKey{}).(*atomic.Int64)
+	return !ok || remaining.Load() > 0
+}
+
+// takeCall uses up one call of ctx's budget, reporting false if none was left
+func takeCall(ctx context.Context) bool {
+	remaining, ok := ctx.Value(callBudgetKey{}).(*atomic.Int64)
+	return !ok || remaining.Add(-1) >= 0
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
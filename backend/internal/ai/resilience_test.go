@@ -0,0 +1,266 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"google.golang.org/genai"
+)
+
+var (
+	errUnavailable = genai.APIError{Code: http.StatusServiceUnavailable}
+	errRejected    = genai.APIError{Code: http.StatusBadRequest}
+)
+
+// newTestBreaker returns a breaker on a clock the test advances
+func newTestBreaker(threshold int, cooldown time.Duration) (*breaker, *time.Time) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	b := newBreaker(threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// fail records n unavailable calls
+func fail(t *testing.T, b *breaker, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d refused while closed", i+1)
+		}
+		b.record(errUnavailable)
+	}
+}
+
+func TestBreakerOpensAtThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	fail(t, b, 2)
+	if b.state != breakerClosed {
+		t.Fatalf("state after 2 failures = %d, want closed", b.state)
+	}
+
+	// A success starts the count over
+	b.allow()
+	b.record(nil)
+	fail(t, b, 2)
+	if b.state != breakerClosed {
+		t.Fatalf("state after a success and 2 failures = %d, want closed", b.state)
+	}
+
+	// Rejected requests do not count
+	b.allow()
+	b.record(errRejected)
+	if b.state != breakerClosed || b.failures != 2 {
+		t.Fatalf("state after a rejected request = %d with %d failures, want closed with 2", b.state, b.failures)
+	}
+
+	fail(t, b, 1)
+	if b.state != breakerOpen {
+		t.Fatalf("state after 3 failures = %d, want open", b.state)
+	}
+	if b.allow() {
+		t.Error("open breaker allowed a call")
+	}
+}
+
+func TestBreakerCooldown(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+	fail(t, b, 1)
+
+	*now = now.Add(time.Minute - time.Second)
+	if b.allow() {
+		t.Fatal("breaker allowed a call before the cooldown")
+	}
+
+	*now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("breaker refused the trial call after the cooldown")
+	}
+	if b.state != breakerHalfOpen {
+		t.Errorf("state after the cooldown = %d, want half-open", b.state)
+	}
+}
+
+func TestBreakerHalfOpenTrial(t *testing.T) {
+	tests := []struct {
+		name      string
+		trial     error
+		wantState int
+	}{
+		{"success closes", nil, breakerClosed},
+		{"unavailable reopens", errUnavailable, breakerOpen},
+		{"rejected request closes", errRejected, breakerClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, now := newTestBreaker(2, time.Minute)
+			fail(t, b, 2)
+			*now = now.Add(time.Minute)
+
+			if !b.allow() {
+				t.Fatal("breaker refused the trial call")
+			}
+			// Only one trial call runs at a time
+			if b.allow() {
+				t.Fatal("half-open breaker allowed a second call")
+			}
+
+			b.record(tt.trial)
+			if b.state != tt.wantState {
+				t.Fatalf("state after the trial = %d, want %d", b.state, tt.wantState)
+			}
+			if tt.wantState == breakerClosed {
+				if b.failures != 0 || !b.allow() {
+					t.Errorf("closed breaker has %d failures or refuses calls", b.failures)
+				}
+				return
+			}
+
+			// A failed trial restarts the cooldown
+			if !b.openedAt.Equal(*now) || b.allow() {
+				t.Errorf("reopened breaker opened at %v, want %v and refusing calls", b.openedAt, *now)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"too many requests", genai.APIError{Code: http.StatusTooManyRequests}, true},
+		{"internal error", genai.APIError{Code: http.StatusInternalServerError}, true},
+		{"bad gateway", genai.APIError{Code: http.StatusBadGateway}, true},
+		{"unavailable", genai.APIError{Code: http.StatusServiceUnavailable}, true},
+		{"gateway timeout", genai.APIError{Code: http.StatusGatewayTimeout}, true},
+		{"wrapped unavailable", fmt.Errorf("generate: %w", errUnavailable), true},
+		{"bad request", errRejected, false},
+		{"unauthorized", genai.APIError{Code: http.StatusUnauthorized}, false},
+		{"forbidden", genai.APIError{Code: http.StatusForbidden}, false},
+		{"not implemented", genai.APIError{Code: http.StatusNotImplemented}, false},
+		{"deadline", fmt.Errorf("attempt: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"other", errors.New("malformed output"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	if !IsUnavailable(fmt.Errorf("call: %w", ErrCircuitOpen)) {
+		t.Error("IsUnavailable(ErrCircuitOpen) = false, want true")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	options := Options{RetryBaseDelay: 100 * time.Millisecond, RetryMaxDelay: time.Second}.withDefaults()
+
+	tests := []struct {
+		retry   int
+		ceiling time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		// Shifts that overflow a Duration stay at the maximum
+		{38, time.Second},
+		{50, time.Second},
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		var longest time.Duration
+		for i := 0; i < 1000; i++ {
+			delay := options.retryDelay(tt.retry)
+			if delay < 0 || delay >= tt.ceiling {
+				t.Fatalf("retryDelay(%d) = %v, want in [0, %v)", tt.retry, delay, tt.ceiling)
+			}
+			longest = max(longest, delay)
+		}
+		// Full jitter spreads the delays over the whole range
+		if longest < tt.ceiling/2 {
+			t.Errorf("retryDelay(%d) never exceeded %v in 1000 draws, want delays up to %v", tt.retry, longest, tt.ceiling)
+		}
+	}
+}
+
+// scriptedProvider answers calls from a script, repeating its last entry, and counts them
+type scriptedProvider struct {
+	calls   int
+	answers []func() (*genai.GenerateContentResponse, error)
+}
+
+func (p *scriptedProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	answer := p.answers[min(p.calls, len(p.answers)-1)]
+	p.calls++
+	return answer()
+}
+
+func unavailable() (*genai.GenerateContentResponse, error) {
+	return nil, errUnavailable
+}
+
+func malformed() (*genai.GenerateContentResponse, error) {
+	return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content: &genai.Content{Parts: []*genai.Part{{Text: `{"tension_score": `}}},
+	}}}, nil
+}
+
+func newScriptedClient(answers ...func() (*genai.GenerateContentResponse, error)) (*Client, *scriptedProvider) {
+	provider := &scriptedProvider{answers: answers}
+	options := Options{MaxRetries: 5, RetryBaseDelay: time.Nanosecond, RetryMaxDelay: time.Nanosecond, BreakerThreshold: 100}
+	return NewClientWithProvider(provider, "test-model", options, logging.Discard()), provider
+}
+
+func TestCallBudgetLimitsRetries(t *testing.T) {
+	client, provider := newScriptedClient(unavailable)
+
+	_, err := client.CalculateTensionScore(WithCallBudget(context.Background(), 3), &EmotionAnalysis{}, "")
+	if !IsUnavailable(err) {
+		t.Errorf("error = %v, want the last unavailable error", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("calls = %d, want the budget of 3", provider.calls)
+	}
+
+	// Without a budget every retry is made
+	provider.calls = 0
+	client.CalculateTensionScore(context.Background(), &EmotionAnalysis{}, "")
+	if provider.calls != 6 {
+		t.Errorf("calls without a budget = %d, want 1 + 5 retries", provider.calls)
+	}
+}
+
+func TestCallBudgetLimitsRepairPrompts(t *testing.T) {
+	client, provider := newScriptedClient(malformed)
+
+	_, err := client.CalculateTensionScore(WithCallBudget(context.Background(), 1), &EmotionAnalysis{}, "")
+	if !errors.Is(err, ErrMalformedOutput) {
+		t.Errorf("error = %v, want the malformed output", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("calls = %d, want no repair prompt past the budget", provider.calls)
+	}
+
+	ctx := WithCallBudget(context.Background(), 1)
+	client.CalculateTensionScore(ctx, &EmotionAnalysis{}, "")
+	if _, err := client.CalculateTensionScore(ctx, &EmotionAnalysis{}, ""); !errors.Is(err, ErrCallBudgetExhausted) {
+		t.Errorf("call past the budget error = %v, want %v", err, ErrCallBudgetExhausted)
+	}
+	if provider.calls != 2 {
+		t.Errorf("calls = %d, want none past the budget", provider.calls)
+	}
+}
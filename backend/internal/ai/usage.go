@@ -0,0 +1,39 @@
+package ai
+
+import "context"
+
+// Usage represents the tokens used by one Gemini call
+type Usage struct {
+	// UserID and SessionID attribute the call; empty if the caller did not set a usage scope
+	UserID    string
+	SessionID string
+	// Operation is the Client method that made the call, e.g. "GenerateResponse"
+	Operation      string
+	Model          string
+	PromptTokens   int
+	OutputTokens   int
+	ThoughtsTokens int
+}
+
+// UsageRecorder stores the token usage of Gemini calls
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, usage Usage)
+}
+
+type usageScopeKey struct{}
+
+type usageScope struct {
+	userID    string
+	sessionID string
+}
+
+// WithUsageScope attributes the Gemini calls made with ctx to a user and, optionally, a session
+func WithUsageScope(ctx context.Context, userID, sessionID string) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, usageScope{userID: userID, sessionID: sessionID})
+}
+
+// usageScopeFrom returns the user and session set by WithUsageScope
+func usageScopeFrom(ctx context.Context) (string, string) {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope.userID, scope.sessionID
+}
@@ -0,0 +1,120 @@
+// Package alert evaluates mood alert rules against a user's tension score history.
+package alert
+
+import (
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// Alert types, stored as the notification type
+const (
+	TypeSustainedDecline = "alert.sustained_decline"
+	TypeSuddenDrop       = "alert.sudden_drop"
+	TypeMissedDays       = "alert.missed_days"
+)
+
+// Default thresholds, matching the alert_settings column defaults
+const (
+	DefaultDeclineDays       = 3
+	DefaultDeclineMinDrop    = 15
+	DefaultSuddenDropPoints  = 25
+	DefaultMissedDays        = 2
+	DefaultLowScoreThreshold = 35
+)
+
+// DefaultSettings returns the settings used for users who have not configured alerts
+func DefaultSettings(userID string) *types.AlertSettings {
+	return &types.AlertSettings{
+		UserID:            userID,
+		Enabled:           true,
+		DeclineDays:       DefaultDeclineDays,
+		DeclineMinDrop:    DefaultDeclineMinDrop,
+		SuddenDropPoints:  DefaultSuddenDropPoints,
+		MissedDays:        DefaultMissedDays,
+		LowScoreThreshold: DefaultLowScoreThreshold,
+		AcknowledgeInChat: true,
+	}
+}
+
+// Input is the data a rule is evaluated against
+type Input struct {
+	// Scores are the user's analyzed days, oldest first
+	Scores   []types.TensionScoreData
+	Settings *types.AlertSettings
+	// Today is the current date in JST
+	Today time.Time
+}
+
+// Alert is a triggered rule
+type Alert struct {
+	Type string
+	// Key identifies the occurrence (e.g. the date of the low day) so it is only notified once
+	Key   string
+	Title string
+	Body  string
+	Data  map[string]interface{}
+	// ChatHint tells the AI how to gently acknowledge the pattern in the next first message
+	ChatHint string
+}
+
+// Rule detects a single mood pattern
+type Rule interface {
+	Evaluate(input Input) *Alert
+}
+
+// Engine evaluates a set of rules
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine creates a rule engine; with no rules it uses DefaultRules
+func NewEngine(rules ...Rule) *Engine {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	return &Engine{rules: rules}
+}
+
+// DefaultRules returns the built-in mood rules
+func DefaultRules() []Rule {
+	return []Rule{
+		SustainedDeclineRule{},
+		SuddenDropRule{},
+		MissedDaysRule{},
+	}
+}
+
+// Evaluate returns the alerts triggered by input; disabled settings trigger nothing
+func (e *Engine) Evaluate(input Input) []Alert {
+	if input.Settings == nil || !input.Settings.Enabled || len(input.Scores) == 0 {
+		return nil
+	}
+
+	var alerts []Alert
+	for _, rule := range e.rules {
+		if alert := rule.Evaluate(input); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+	return alerts
+}
+
+// parseDate parses a YYYY-MM-DD score date
+func parseDate(date string) (time.Time, bool) {
+	t, err := time.Parse("2006-01-02", date)
+	return t, err == nil
+}
+
+// daysBetween returns the number of calendar days from a to b
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// isRecent reports whether the latest score is from today or yesterday, so rules only fire on fresh data
+func isRecent(input Input) bool {
+	latest, ok := parseDate(input.Scores[len(input.Scores)-1].Date)
+	return ok && daysBetween(latest, input.Today) <= 1
+}
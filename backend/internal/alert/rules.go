@@ -0,0 +1,128 @@
+package alert
+
+import (
+	"fmt"
+)
+
+// suddenDropMinHistory is the number of earlier scores needed before a drop can be judged sudden
+const suddenDropMinHistory = 3
+
+// SustainedDeclineRule fires when the score has decreased on consecutive days
+type SustainedDeclineRule struct{}
+
+// Evaluate implements Rule
+func (SustainedDeclineRule) Evaluate(input Input) *Alert {
+	settings := input.Settings
+	scores := input.Scores
+	if len(scores) < settings.DeclineDays+1 || !isRecent(input) {
+		return nil
+	}
+
+	// The last DeclineDays+1 scores must be on consecutive days and strictly decreasing
+	window := scores[len(scores)-settings.DeclineDays-1:]
+	for i := 1; i < len(window); i++ {
+		previous, ok1 := parseDate(window[i-1].Date)
+		current, ok2 := parseDate(window[i].Date)
+		if !ok1 || !ok2 || daysBetween(previous, current) != 1 {
+			return nil
+		}
+		if window[i].TensionScore >= window[i-1].TensionScore {
+			return nil
+		}
+	}
+
+	drop := window[0].TensionScore - window[len(window)-1].TensionScore
+	if drop < settings.DeclineMinDrop {
+		return nil
+	}
+
+	return &Alert{
+		Type:  TypeSustainedDecline,
+		Key:   window[len(window)-1].Date,
+		Title: "テンションが下がり続けています",
+		Body:  fmt.Sprintf("ここ%d日間、テンションスコアが続けて下がっています（%d点 → %d点）。無理せず、自分をいたわる時間をとってくださいね。", settings.DeclineDays, window[0].TensionScore, window[len(window)-1].TensionScore),
+		Data: map[string]interface{}{
+			"days":       settings.DeclineDays,
+			"from_score": window[0].TensionScore,
+			"to_score":   window[len(window)-1].TensionScore,
+			"drop":       drop,
+		},
+		ChatHint: fmt.Sprintf("ここ%d日ほど気分が少しずつ沈んでいるようです。", settings.DeclineDays),
+	}
+}
+
+// SuddenDropRule fires when the latest score falls well below the recent average, or is a negative anomaly
+type SuddenDropRule struct{}
+
+// Evaluate implements Rule
+func (SuddenDropRule) Evaluate(input Input) *Alert {
+	scores := input.Scores
+	if len(scores) < suddenDropMinHistory+1 || !isRecent(input) {
+		return nil
+	}
+
+	latest := scores[len(scores)-1]
+	previous := scores[len(scores)-2]
+
+	// Compare against the rolling average up to the previous day so the drop itself is excluded
+	baseline := float64(previous.TensionScore)
+	if previous.RollingAverage != nil {
+		baseline = *previous.RollingAverage
+	}
+	drop := baseline - float64(latest.TensionScore)
+
+	negativeAnomaly := latest.Anomaly && latest.ZScore != nil && *latest.ZScore < 0
+	if drop < float64(input.Settings.SuddenDropPoints) && !negativeAnomaly {
+		return nil
+	}
+
+	return &Alert{
+		Type:  TypeSuddenDrop,
+		Key:   latest.Date,
+		Title: "テンションが急に下がりました",
+		Body:  fmt.Sprintf("最新のテンションスコアは%d点で、最近の平均（%.0f点）を大きく下回っています。何かあったら、いつでも話してくださいね。", latest.TensionScore, baseline),
+		Data: map[string]interface{}{
+			"score":    latest.TensionScore,
+			"baseline": baseline,
+			"drop":     drop,
+			"anomaly":  negativeAnomaly,
+		},
+		ChatHint: "前回の会話では、いつもより気分が大きく落ち込んでいたようです。",
+	}
+}
+
+// MissedDaysRule fires when the user has not journaled for several days after a low day
+type MissedDaysRule struct{}
+
+// Evaluate implements Rule
+func (MissedDaysRule) Evaluate(input Input) *Alert {
+	settings := input.Settings
+	latest := input.Scores[len(input.Scores)-1]
+	if latest.TensionScore > settings.LowScoreThreshold {
+		return nil
+	}
+
+	lastDate, ok := parseDate(latest.Date)
+	if !ok {
+		return nil
+	}
+
+	// Days strictly between the low day and today; today may still get a session
+	missed := daysBetween(lastDate, input.Today) - 1
+	if missed < settings.MissedDays {
+		return nil
+	}
+
+	return &Alert{
+		Type:  TypeMissedDays,
+		Key:   latest.Date,
+		Title: "最近お話しできていませんね",
+		Body:  fmt.Sprintf("前回（%s）は少し元気がなさそうでした。%d日ぶりに、今日の気持ちを聞かせてもらえませんか？", latest.Date, missed+1),
+		Data: map[string]interface{}{
+			"last_date":   latest.Date,
+			"last_score":  latest.TensionScore,
+			"missed_days": missed,
+		},
+		ChatHint: fmt.Sprintf("ユーザーは元気がなかった日のあと、%d日ぶりに来てくれました。", missed+1),
+	}
+}
@@ -0,0 +1,164 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// today is the date the rules are evaluated on
+var today = time.Date(2026, 3, 10, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+
+// daily returns scores on consecutive days ending daysAgo days before today
+func daily(daysAgo int, scores ...int) []types.TensionScoreData {
+	data := make([]types.TensionScoreData, len(scores))
+	for i, score := range scores {
+		date := today.AddDate(0, 0, -daysAgo-(len(scores)-1-i))
+		data[i] = types.TensionScoreData{Date: date.Format("2006-01-02"), TensionScore: score}
+	}
+	return data
+}
+
+func evaluate(rule Rule, scores []types.TensionScoreData, configure func(*types.AlertSettings)) *Alert {
+	settings := DefaultSettings("user")
+	if configure != nil {
+		configure(settings)
+	}
+	return rule.Evaluate(Input{Scores: scores, Settings: settings, Today: today})
+}
+
+func TestSustainedDeclineRule(t *testing.T) {
+	gap := daily(0, 70, 60, 50)
+	gap = append(daily(4, 80), gap...)
+
+	tests := []struct {
+		name   string
+		scores []types.TensionScoreData
+		want   bool
+	}{
+		{"three days of decline", daily(0, 70, 60, 50, 40), true},
+		{"ending yesterday", daily(1, 70, 60, 50, 40), true},
+		{"minimum drop", daily(0, 70, 65, 60, 55), true},
+		{"drop too small", daily(0, 70, 66, 62, 58), false},
+		{"two days of decline", daily(0, 50, 70, 60, 50), false},
+		{"flat day", daily(0, 70, 60, 60, 40), false},
+		{"too few scores", daily(0, 70, 60, 40), false},
+		{"gap between days", gap, false},
+		{"stale", daily(2, 70, 60, 50, 40), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := evaluate(SustainedDeclineRule{}, tt.scores, nil)
+			if (alert != nil) != tt.want {
+				t.Fatalf("alert = %+v, want fired %v", alert, tt.want)
+			}
+			if alert != nil && (alert.Type != TypeSustainedDecline || alert.Key != tt.scores[len(tt.scores)-1].Date) {
+				t.Errorf("alert = %s keyed %s, want %s keyed by the last day", alert.Type, alert.Key, TypeSustainedDecline)
+			}
+		})
+	}
+
+	// The window follows the settings
+	if alert := evaluate(SustainedDeclineRule{}, daily(0, 70, 60, 50), func(s *types.AlertSettings) { s.DeclineDays = 2 }); alert == nil || alert.Data["drop"] != 20 {
+		t.Errorf("2-day decline alert = %+v, want a drop of 20", alert)
+	}
+}
+
+func TestSuddenDropRule(t *testing.T) {
+	average := func(value float64) *float64 { return &value }
+	zScore := func(value float64) *float64 { return &value }
+
+	withAverage := daily(0, 60, 60, 60, 40)
+	withAverage[2].RollingAverage = average(70)
+
+	anomaly := daily(0, 60, 60, 60, 50)
+	anomaly[3].Anomaly, anomaly[3].ZScore = true, zScore(-2.5)
+
+	positiveAnomaly := daily(0, 60, 60, 60, 50)
+	positiveAnomaly[3].Anomaly, positiveAnomaly[3].ZScore = true, zScore(2.5)
+
+	tests := []struct {
+		name   string
+		scores []types.TensionScoreData
+		want   bool
+	}{
+		{"drop from the previous day", daily(0, 60, 60, 70, 45), true},
+		{"drop too small", daily(0, 60, 60, 70, 46), false},
+		{"drop from the rolling average", withAverage, true},
+		{"negative anomaly", anomaly, true},
+		{"positive anomaly", positiveAnomaly, false},
+		{"rise", daily(0, 60, 60, 40, 80), false},
+		{"too little history", daily(0, 60, 70, 30), false},
+		{"stale", daily(2, 60, 60, 70, 30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := evaluate(SuddenDropRule{}, tt.scores, nil)
+			if (alert != nil) != tt.want {
+				t.Fatalf("alert = %+v, want fired %v", alert, tt.want)
+			}
+			if alert != nil && (alert.Type != TypeSuddenDrop || alert.Key != tt.scores[len(tt.scores)-1].Date) {
+				t.Errorf("alert = %s keyed %s, want %s keyed by the latest day", alert.Type, alert.Key, TypeSuddenDrop)
+			}
+		})
+	}
+
+	if alert := evaluate(SuddenDropRule{}, withAverage, nil); alert.Data["baseline"] != 70.0 || alert.Data["drop"] != 30.0 {
+		t.Errorf("alert data = %v, want the rolling average as baseline", alert.Data)
+	}
+}
+
+func TestMissedDaysRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		scores    []types.TensionScoreData
+		threshold int
+		want      bool
+		wantDays  int
+	}{
+		{"two days missed after a low day", daily(3, 60, 30), 35, true, 2},
+		{"a week missed", daily(8, 30), 35, true, 7},
+		{"score at the threshold", daily(3, 35), 35, true, 2},
+		{"score above the threshold", daily(3, 36), 35, false, 0},
+		{"higher threshold", daily(3, 50), 60, true, 2},
+		{"one day missed", daily(2, 30), 35, false, 0},
+		{"journaled yesterday", daily(1, 30), 35, false, 0},
+		{"journaled today", daily(0, 30), 35, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := evaluate(MissedDaysRule{}, tt.scores, func(s *types.AlertSettings) { s.LowScoreThreshold = tt.threshold })
+			if (alert != nil) != tt.want {
+				t.Fatalf("alert = %+v, want fired %v", alert, tt.want)
+			}
+			if alert == nil {
+				return
+			}
+			if alert.Type != TypeMissedDays || alert.Key != tt.scores[len(tt.scores)-1].Date || alert.Data["missed_days"] != tt.wantDays {
+				t.Errorf("alert = %s keyed %s with %v, want %d missed days since the low day", alert.Type, alert.Key, alert.Data, tt.wantDays)
+			}
+		})
+	}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	scores := daily(0, 70, 60, 50, 20)
+
+	alerts := NewEngine().Evaluate(Input{Scores: scores, Settings: DefaultSettings("user"), Today: today})
+	if len(alerts) != 2 || alerts[0].Type != TypeSustainedDecline || alerts[1].Type != TypeSuddenDrop {
+		t.Errorf("alerts = %+v, want a sustained decline and a sudden drop", alerts)
+	}
+
+	disabled := DefaultSettings("user")
+	disabled.Enabled = false
+	for name, input := range map[string]Input{
+		"disabled":    {Scores: scores, Settings: disabled, Today: today},
+		"no settings": {Scores: scores, Today: today},
+		"no scores":   {Settings: DefaultSettings("user"), Today: today},
+	} {
+		if alerts := NewEngine().Evaluate(input); len(alerts) != 0 {
+			t.Errorf("%s: alerts = %+v, want none", name, alerts)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package annotator
+
+import (
+	"context"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// Annotator annotates a user message with sentiment, topics and named entities
+type Annotator interface {
+	Annotate(ctx context.Context, text string) (*types.MessageAnnotation, error)
+}
@@ -0,0 +1,332 @@
+package annotator
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// LexiconAnnotatorName identifies annotations produced by LexiconAnnotator
+const LexiconAnnotatorName = "lexicon-v1"
+
+// Sentiment labels
+const (
+	SentimentPositive = "positive"
+	SentimentNeutral  = "neutral"
+	SentimentNegative = "negative"
+)
+
+// sentimentThreshold is the minimum absolute score for a non-neutral label
+const sentimentThreshold = 0.2
+
+// Japanese adjectives are listed by stem so that conjugations (楽しかった, 楽しくない) also match
+var positiveWords = []string{
+	// Japanese
+	"嬉し", "うれし", "楽し", "たのし", "幸せ", "しあわせ", "良かった", "よかった", "最高",
+	"好き", "面白", "おもしろ", "ありがとう", "感謝", "安心", "元気", "気持ちいい",
+	"すっきり", "達成", "成功", "褒められ", "わくわく", "ワクワク", "癒され", "美味し", "おいし",
+	"満足", "充実", "頑張れた", "できた", "笑",
+	// English
+	"happy", "glad", "great", "good", "fun", "love", "enjoyed", "enjoy", "excited", "thankful",
+	"grateful", "relieved", "proud", "awesome", "amazing", "nice", "wonderful", "calm",
+}
+
+var negativeWords = []string{
+	// Japanese
+	"悲し", "かなし", "辛い", "つらい", "しんどい", "疲れ", "つかれ", "不安", "心配", "怖",
+	"こわ", "嫌", "むかつく", "ムカつく", "イライラ", "いらいら", "怒", "落ち込", "憂鬱",
+	"ゆううつ", "最悪", "寂し", "さみし", "失敗", "後悔", "ストレス", "眠れな", "痛", "だる",
+	"泣", "焦", "緊張",
+	// English
+	"sad", "tired", "angry", "upset", "anxious", "worried", "scared", "afraid", "bad", "awful",
+	"terrible", "stress", "stressed", "lonely", "depressed", "hate", "frustrated", "exhausted",
+}
+
+var intensifiers = []string{"とても", "すごく", "めっちゃ", "かなり", "本当に", "超", "very", "really", "so", "extremely"}
+
+// japaneseNegations flip the polarity of a Japanese match when they closely follow it
+var japaneseNegations = []string{"ない", "なかった", "なく", "ません", "じゃない"}
+
+// englishNegations flip the polarity of an English match when they precede it within englishModifierWindow words
+var englishNegations = map[string]bool{
+	"not": true, "no": true, "never": true, "don't": true, "doesn't": true, "didn't": true,
+	"isn't": true, "aren't": true, "wasn't": true, "weren't": true, "can't": true, "couldn't": true, "won't": true,
+}
+
+// englishModifierWindow is how many preceding words can negate or intensify an English match,
+// so that "not very happy" and "didn't really enjoy" are caught
+const englishModifierWindow = 3
+
+// englishClauseBreaks end the reach of a negation or intensifier
+var englishClauseBreaks = map[string]bool{"but": true, "and": true, "though": true, "although": true}
+
+var topicKeywords = map[string][]string{
+	"work":    {"仕事", "会社", "職場", "上司", "同僚", "会議", "残業", "出勤", "work", "job", "office", "meeting", "boss"},
+	"study":   {"勉強", "学校", "授業", "試験", "テスト", "宿題", "大学", "study", "school", "exam", "class", "homework"},
+	"family":  {"家族", "母", "父", "両親", "兄", "姉", "弟", "妹", "子供", "子ども", "family", "mom", "dad", "parents", "kids"},
+	"friends": {"友達", "友人", "仲間", "friend", "friends"},
+	"love":    {"恋人", "彼氏", "彼女", "デート", "好きな人", "date", "boyfriend", "girlfriend", "partner"},
+	"health":  {"病院", "体調", "風邪", "頭痛", "熱", "薬", "運動", "ジム", "health", "sick", "doctor", "gym", "exercise"},
+	"sleep":   {"睡眠", "寝", "眠", "夢", "sleep", "slept", "nap"},
+	"food":    {"ご飯", "ごはん", "料理", "ランチ", "夕飯", "朝ごはん", "カフェ", "食べ", "food", "lunch", "dinner", "breakfast", "cooking"},
+	"hobby":   {"趣味", "ゲーム", "映画", "音楽", "読書", "漫画", "アニメ", "旅行", "game", "movie", "music", "book", "travel"},
+	"money":   {"お金", "給料", "買い物", "節約", "money", "salary", "shopping"},
+	"weather": {"天気", "雨", "晴れ", "雪", "暑い", "寒い", "weather", "rain", "sunny", "snow"},
+}
+
+var (
+	japanesePersonPattern = regexp.MustCompile(`([\p{Han}\p{Katakana}ー]{1,8})(さん|くん|君|ちゃん|先生|先輩|部長|課長)`)
+	japanesePlacePattern  = regexp.MustCompile(`([\p{Han}\p{Katakana}ー]{1,10}(駅|公園|病院|学校|大学|高校|会社|空港|神社|寺|市|県|区|町|村))`)
+	englishWordPattern    = regexp.MustCompile(`[A-Za-z][A-Za-z'\-]*`)
+)
+
+// englishPlacePrepositions mark the following capitalized word as a place
+var englishPlacePrepositions = map[string]bool{"in": true, "at": true, "to": true, "from": true}
+
+// LexiconAnnotator is a dependency-free annotator based on Japanese and English word lists
+type LexiconAnnotator struct{}
+
+// NewLexiconAnnotator creates a new lexicon-based annotator
+func NewLexiconAnnotator() *LexiconAnnotator {
+	return &LexiconAnnotator{}
+}
+
+// Annotate scores sentiment and extracts topics and entities from text
+func (a *LexiconAnnotator) Annotate(ctx context.Context, text string) (*types.MessageAnnotation, error) {
+	score := a.scoreSentiment(text)
+
+	return &types.MessageAnnotation{
+		Sentiment: types.Sentiment{
+			Score: score,
+			Label: sentimentLabel(score),
+		},
+		Topics:      a.extractTopics(text),
+		Entities:    a.extractEntities(text),
+		Annotator:   LexiconAnnotatorName,
+		AnnotatedAt: timeutil.NowJST(),
+	}, nil
+}
+
+// scoreSentiment returns a sentiment score between -1 (negative) and 1 (positive)
+func (a *LexiconAnnotator) scoreSentiment(text string) float64 {
+	lower := strings.ToLower(text)
+	wordLocs := englishWordPattern.FindAllStringIndex(lower, -1)
+	words := make([]string, len(wordLocs))
+	for i, loc := range wordLocs {
+		words[i] = lower[loc[0]:loc[1]]
+	}
+
+	var positive, negative float64
+	tally := func(weight float64, isPositive bool) {
+		if isPositive {
+			positive += weight
+		} else {
+			negative += weight
+		}
+	}
+
+	for _, isPositive := range []bool{true, false} {
+		lexicon := negativeWords
+		if isPositive {
+			lexicon = positiveWords
+		}
+
+		for _, word := range lexicon {
+			if isASCII(word) {
+				for i, w := range words {
+					if w != word {
+						continue
+					}
+					weight, polarity := 1.0, isPositive
+					negated, intensified := englishModifiers(lower, wordLocs, i)
+					if negated {
+						polarity = !polarity
+					}
+					if intensified {
+						weight = 1.5
+					}
+					tally(weight, polarity)
+				}
+				continue
+			}
+
+			for offset := 0; ; {
+				idx := strings.Index(lower[offset:], word)
+				if idx < 0 {
+					break
+				}
+				start := offset + idx
+				end := start + len(word)
+				weight, polarity := 1.0, isPositive
+				if hasNegationAfter(lower[end:]) {
+					polarity = !polarity
+				}
+				if hasIntensifierBefore(lower[:start]) {
+					weight = 1.5
+				}
+				tally(weight, polarity)
+				offset = end
+			}
+		}
+	}
+
+	total := positive + negative
+	if total == 0 {
+		return 0
+	}
+	// Damp scores from a single match so that one word does not saturate the scale
+	return (positive - negative) / (total + 1)
+}
+
+// extractTopics returns the topics whose keywords appear in text
+func (a *LexiconAnnotator) extractTopics(text string) []string {
+	lower := strings.ToLower(text)
+	words := englishWordPattern.FindAllString(lower, -1)
+
+	topics := []string{}
+	for topic, keywords := range topicKeywords {
+		for _, keyword := range keywords {
+			matched := false
+			if isASCII(keyword) {
+				matched = containsString(words, keyword)
+			} else {
+				matched = strings.Contains(lower, keyword)
+			}
+			if matched {
+				topics = append(topics, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// extractEntities finds people and places using honorifics, place suffixes and capitalization
+func (a *LexiconAnnotator) extractEntities(text string) []types.NamedEntity {
+	entities := []types.NamedEntity{}
+	seen := make(map[string]bool)
+	add := func(name, entityType string) {
+		key := entityType + ":" + name
+		if name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		entities = append(entities, types.NamedEntity{Text: name, Type: entityType})
+	}
+
+	for _, match := range japanesePersonPattern.FindAllStringSubmatch(text, -1) {
+		add(match[1], types.EntityTypePerson)
+	}
+	for _, match := range japanesePlacePattern.FindAllStringSubmatch(text, -1) {
+		add(match[1], types.EntityTypePlace)
+	}
+
+	// English proper nouns: capitalized words that do not start a sentence
+	words := englishWordPattern.FindAllStringIndex(text, -1)
+	for i, loc := range words {
+		word := text[loc[0]:loc[1]]
+		if !unicode.IsUpper(rune(word[0])) || isFirstPerson(word) || startsSentence(text[:loc[0]]) {
+			continue
+		}
+		entityType := types.EntityTypePerson
+		if i > 0 && englishPlacePrepositions[strings.ToLower(text[words[i-1][0]:words[i-1][1]])] {
+			entityType = types.EntityTypePlace
+		}
+		add(word, entityType)
+	}
+
+	return entities
+}
+
+func sentimentLabel(score float64) string {
+	if score >= sentimentThreshold {
+		return SentimentPositive
+	} else if score <= -sentimentThreshold {
+		return SentimentNegative
+	}
+	return SentimentNeutral
+}
+
+func hasNegationAfter(rest string) bool {
+	// Allow a few conjugation characters between the word and the negation (e.g. 安心+でき+ない)
+	runes := []rune(rest)
+	if len(runes) > 5 {
+		runes = runes[:5]
+	}
+	window := string(runes)
+	for _, negation := range japaneseNegations {
+		if strings.Contains(window, negation) {
+			return true
+		}
+	}
+	return false
+}
+
+// englishModifiers looks back from words[i] for a negation or an intensifier. The search stops
+// after englishModifierWindow words, at punctuation, at a conjunction and at another sentiment word,
+// so "not bad, happy" and "not sad but happy" leave "happy" alone.
+func englishModifiers(lower string, locs [][]int, i int) (negated, intensified bool) {
+	for j := i - 1; j >= 0 && j >= i-englishModifierWindow; j-- {
+		if strings.ContainsAny(lower[locs[j][1]:locs[j+1][0]], ".,;:!?。、！？\n") {
+			break
+		}
+		word := lower[locs[j][0]:locs[j][1]]
+		if englishClauseBreaks[word] || containsString(positiveWords, word) || containsString(negativeWords, word) {
+			break
+		}
+		if englishNegations[word] {
+			negated = !negated
+		}
+		if containsString(intensifiers, word) {
+			intensified = true
+		}
+	}
+	return negated, intensified
+}
+
+func hasIntensifierBefore(before string) bool {
+	for _, intensifier := range intensifiers {
+		if !isASCII(intensifier) && strings.HasSuffix(before, intensifier) {
+			return true
+		}
+	}
+	return false
+}
+
+func startsSentence(before string) bool {
+	trimmed := strings.TrimRightFunc(before, unicode.IsSpace)
+	if trimmed == "" {
+		return true
+	}
+	last := []rune(trimmed)[len([]rune(trimmed))-1]
+	return strings.ContainsRune(".!?。！？\n", last)
+}
+
+// isFirstPerson reports whether word is "I" or one of its contractions ("I'm", "I've", ...)
+func isFirstPerson(word string) bool {
+	return word == "I" || strings.HasPrefix(word, "I'")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
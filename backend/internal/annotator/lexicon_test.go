@@ -0,0 +1,104 @@
+package annotator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestScoreSentiment(t *testing.T) {
+	a := NewLexiconAnnotator()
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"I am happy today", SentimentPositive},
+		{"I am not happy", SentimentNegative},
+		{"I am not very happy", SentimentNegative},
+		{"I didn't really enjoy the party", SentimentNegative},
+		{"It was not bad at all", SentimentPositive},
+		{"I was not sad but happy", SentimentPositive},
+		{"Not now. Happy anyway", SentimentPositive},
+		{"No, I am happy", SentimentPositive},
+		{"今日はとても楽しかった", SentimentPositive},
+		{"全然楽しくない", SentimentNegative},
+		{"安心できない", SentimentNegative},
+		{"会議がありました", SentimentNeutral},
+	}
+	for _, tt := range tests {
+		if got := sentimentLabel(a.scoreSentiment(tt.text)); got != tt.want {
+			t.Errorf("sentiment of %q = %s (%.2f), want %s", tt.text, got, a.scoreSentiment(tt.text), tt.want)
+		}
+	}
+}
+
+func TestScoreSentimentIntensifiers(t *testing.T) {
+	a := NewLexiconAnnotator()
+
+	plain := a.scoreSentiment("I am tired")
+	for _, text := range []string{"I am very tired", "I am really so tired"} {
+		if got := a.scoreSentiment(text); got >= plain {
+			t.Errorf("score of %q = %.2f, want below %.2f", text, got, plain)
+		}
+	}
+	if got, want := a.scoreSentiment("とても疲れた"), a.scoreSentiment("疲れた"); got >= want {
+		t.Errorf("score of とても疲れた = %.2f, want below %.2f", got, want)
+	}
+}
+
+func TestExtractEntities(t *testing.T) {
+	a := NewLexiconAnnotator()
+
+	tests := []struct {
+		text string
+		want []types.NamedEntity
+	}{
+		{
+			"田中さんと新宿駅で会った",
+			[]types.NamedEntity{{Text: "田中", Type: types.EntityTypePerson}, {Text: "新宿駅", Type: types.EntityTypePlace}},
+		},
+		{
+			"Yesterday I'm sure I met Alice in Kyoto",
+			[]types.NamedEntity{{Text: "Alice", Type: types.EntityTypePerson}, {Text: "Kyoto", Type: types.EntityTypePlace}},
+		},
+		{
+			"Honestly I've been tired and I'd rather rest, so I'll stay home",
+			[]types.NamedEntity{},
+		},
+	}
+	for _, tt := range tests {
+		got := a.extractEntities(tt.text)
+		if len(got) != len(tt.want) {
+			t.Errorf("entities of %q = %v, want %v", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("entities of %q = %v, want %v", tt.text, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	annotation, err := NewLexiconAnnotator().Annotate(context.Background(), "仕事で疲れたけど、友達とご飯を食べて楽しかった")
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	if annotation.Annotator != LexiconAnnotatorName {
+		t.Errorf("annotator = %s, want %s", annotation.Annotator, LexiconAnnotatorName)
+	}
+	want := []string{"food", "friends", "work"}
+	if len(annotation.Topics) != len(want) {
+		t.Fatalf("topics = %v, want %v", annotation.Topics, want)
+	}
+	for i := range want {
+		if annotation.Topics[i] != want[i] {
+			t.Errorf("topics = %v, want %v", annotation.Topics, want)
+			break
+		}
+	}
+}
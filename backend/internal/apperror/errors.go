@@ -0,0 +1,232 @@
+// Package apperror defines the domain errors shared by repositories, services and handlers,
+// and how they are rendered as API error responses.
+package apperror
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Kind classifies an error by how a client should react to it
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindRateLimited
+	KindUpstreamAI
+	KindUnavailable
+)
+
+// Status returns the HTTP status code for errors of the kind
+func (k Kind) Status() int {
+	switch k {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindRateLimited:
+		return http.StatusTooManyRequests
+	case KindUpstreamAI:
+		return http.StatusBadGateway
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a domain error with a stable code for API clients
+type Error struct {
+	Kind Kind
+	// Code is the ErrorResponse code, e.g. SESSION_NOT_FOUND
+	Code string
+	// Message is the English message; see Localize for the other languages
+	Message string
+	// Details is rendered as the details of the ErrorResponse
+	Details interface{}
+	// RetryAfter, if positive, is sent as the Retry-After header
+	RetryAfter time.Duration
+	// Err is the underlying cause; it is logged but never sent to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors with the same code, so that wrapped copies of a sentinel match the sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error caused by err
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithDetails returns a copy of the error carrying details for the client
+func (e *Error) WithDetails(details interface{}) *Error {
+	detailed := *e
+	detailed.Details = details
+	return &detailed
+}
+
+// WithRetryAfter returns a copy of the error telling the client to retry after d
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	delayed := *e
+	delayed.RetryAfter = d
+	return &delayed
+}
+
+// As returns the first *Error in err's chain
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+// New creates an error of the given kind
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Validation creates an error for requests that are well-formed but not acceptable
+func Validation(code, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+// Unauthorized creates an error for requests without valid credentials
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+// Forbidden creates an error for authenticated users lacking a permission
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+// NotFound creates an error for resources that do not exist or belong to another user
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+// Conflict creates an error for requests that clash with the current state
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+// RateLimited creates an error for requests over a limit or quota
+func RateLimited(code, message string) *Error {
+	return New(KindRateLimited, code, message)
+}
+
+// UpstreamAI creates an error for unusable responses from the AI provider
+func UpstreamAI(code, message string) *Error {
+	return New(KindUpstreamAI, code, message)
+}
+
+// Unavailable creates an error for dependencies that are temporarily down
+func Unavailable(code, message string) *Error {
+	return New(KindUnavailable, code, message)
+}
+
+// Errors returned across the API. Compare with errors.Is; wrapped copies keep matching.
+var (
+	ErrInternal = New(KindInternal, "INTERNAL_ERROR", "Internal server error")
+
+	ErrInvalidRequest    = Validation("INVALID_REQUEST", "Invalid request body")
+	ErrValidation        = Validation("VALIDATION_ERROR", "Request validation failed")
+	ErrRateLimitExceeded = RateLimited("RATE_LIMIT_EXCEEDED", "Too many requests; please wait and try again")
+
+	// Users and authentication
+	ErrUnauthorized       = Unauthorized("UNAUTHORIZED", "User not authenticated")
+	ErrInvalidCredentials = Unauthorized("INVALID_CREDENTIALS", "Invalid username or password")
+	ErrLoginThrottled     = RateLimited("LOGIN_THROTTLED", "Too many failed logins; please wait before trying again")
+	ErrInvalidMFACode     = Unauthorized("INVALID_MFA_CODE", "Invalid authentication code")
+	ErrMFAAlreadyEnabled  = Conflict("MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+	ErrMFANotEnabled      = Conflict("MFA_NOT_ENABLED", "Two-factor authentication is not enabled")
+	ErrMFANotEnrolled     = Conflict("MFA_NOT_ENROLLED", "Start two-factor enrollment before verifying a code")
+	ErrWrongPassword      = Validation("WRONG_PASSWORD", "Current password is incorrect")
+	ErrInvalidResetToken  = Validation("INVALID_RESET_TOKEN", "The password reset link is invalid or has expired")
+	ErrResetUnavailable   = Unavailable("PASSWORD_RESET_UNAVAILABLE", "Password reset by email is not available")
+	ErrForbidden          = Forbidden("FORBIDDEN", "Admin access required")
+	ErrUserNotFound       = NotFound("USER_NOT_FOUND", "User not found")
+	ErrUserExists         = Conflict("USER_EXISTS", "Username or email already exists")
+
+	// Sessions and messages
+	ErrSessionNotFound     = NotFound("SESSION_NOT_FOUND", "Session not found")
+	ErrSessionExists       = Conflict("SESSION_EXISTS", "Session already exists for this date")
+	ErrSessionInactive     = Validation("SESSION_INACTIVE", "Session is not active")
+	ErrSessionCompleted    = Validation("SESSION_ALREADY_COMPLETED", "Session is already completed")
+	ErrMessageNotFound     = NotFound("MESSAGE_NOT_FOUND", "Message not found")
+	ErrMessageNotRetryable = Conflict("MESSAGE_NOT_RETRYABLE", "Only the latest message whose reply failed can be retried")
+	ErrInvalidDate         = Validation("INVALID_DATE", "Invalid date format (expected YYYY-MM-DD)")
+
+	// Analyses and the AI provider
+	ErrNoMessages       = Validation("NO_MESSAGES", "No messages found for analysis")
+	ErrAnalysisNotFound = NotFound("ANALYSIS_NOT_FOUND", "Analysis not found")
+	ErrAIQuotaExceeded  = RateLimited("AI_QUOTA_EXCEEDED", "AI usage quota exceeded; the analysis will run in the next batch")
+	ErrAIUnavailable    = Unavailable("AI_SERVICE_UNAVAILABLE", "AI service is temporarily unavailable")
+	ErrAIInvalidOutput  = UpstreamAI("AI_INVALID_OUTPUT", "AI returned an unusable response; please try again")
+	ErrInvalidYear      = Validation("INVALID_YEAR", "Invalid year parameter")
+	ErrInvalidMonth     = Validation("INVALID_MONTH", "Invalid month parameter")
+
+	// Listings
+	ErrInvalidFilter    = Validation("INVALID_FILTER", "Filters must be well-formed; tension scores range from 0 to 100")
+	ErrInvalidDateRange = Validation("INVALID_DATE_RANGE", "from and to must be YYYY-MM-DD dates with from <= to")
+	ErrInvalidSort      = Validation("INVALID_SORT", "Unsupported sort order")
+	ErrInvalidCursor    = Validation("INVALID_CURSOR", "The cursor is invalid or was issued for another sort order")
+
+	// Entities
+	ErrEntityNotFound    = NotFound("ENTITY_NOT_FOUND", "Entity not found")
+	ErrInvalidEntityKind = Validation("INVALID_KIND", "Kind must be one of person, place, activity or project")
+	ErrInvalidEntityName = Validation("INVALID_NAME", "Name must be between 1 and 100 characters")
+	ErrEntityNameInUse   = Conflict("ENTITY_NAME_IN_USE", "Another entity already uses this name; merge them instead")
+	ErrInvalidMerge      = Validation("INVALID_MERGE", "Merge needs at least one other entity, each listed once")
+
+	// Alerts
+	ErrInvalidAlertSettings = Validation("INVALID_SETTINGS", "Alert thresholds are out of range")
+	ErrNotificationNotFound = NotFound("NOTIFICATION_NOT_FOUND", "Notification not found")
+
+	// Reminders
+	ErrInvalidRemindAt      = Validation("INVALID_REMIND_AT", "remind_at must be in HH:MM format")
+	ErrInvalidTimezone      = Validation("INVALID_TIMEZONE", "Unknown timezone")
+	ErrUnsupportedChannel   = Validation("UNSUPPORTED_CHANNEL", "Channel is not available on this server")
+	ErrInvalidQuietHours    = Validation("INVALID_QUIET_HOURS", "Quiet hours need both a start and an end in HH:MM format")
+	ErrInvalidSubscription  = Validation("INVALID_SUBSCRIPTION", "Subscription needs a public https endpoint and p256dh/auth keys")
+	ErrSubscriptionNotFound = NotFound("SUBSCRIPTION_NOT_FOUND", "Push subscription not found")
+
+	// Webhooks
+	ErrInvalidWebhookURL     = Validation("INVALID_WEBHOOK_URL", "A public https webhook URL is required")
+	ErrWebhookNotFound       = NotFound("WEBHOOK_NOT_FOUND", "Webhook not found")
+	ErrWebhookLimitReached   = Conflict("WEBHOOK_LIMIT_REACHED", "Too many webhooks registered")
+	ErrUnsupportedEvent      = Validation("UNSUPPORTED_EVENT", "events must contain at least one supported event type")
+	ErrInvalidDeliveryStatus = Validation("INVALID_STATUS", "status must be pending, succeeded or failed")
+	ErrDeliveryNotFound      = NotFound("DELIVERY_NOT_FOUND", "Webhook delivery not found")
+
+	// AI usage
+	ErrInvalidQuota = Validation("INVALID_QUOTA", "Quotas must be 0 (unlimited) or more")
+)
@@ -0,0 +1,39 @@
+package apperror
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// Write sends err as an ErrorResponse. Errors that are not *Error are reported as INTERNAL_ERROR,
+// and server-side errors are logged with their cause. RetryAfter is sent as the Retry-After header.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	appErr, ok := As(err)
+	if !ok {
+		appErr = ErrInternal.Wrap(err)
+	}
+
+	status := appErr.Kind.Status()
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", slog.String("code", appErr.Code), logging.Err(err))
+	}
+
+	if appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+	}
+
+	render.Status(r, status)
+	render.JSON(w, r, types.ErrorResponse{
+		Error: types.ErrorDetail{
+			Code:    appErr.Code,
+			Message: Localize(appErr, r.Header.Get("Accept-Language")),
+			Details: appErr.Details,
+		},
+	})
+}
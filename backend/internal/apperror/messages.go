@@ -0,0 +1,92 @@
+package apperror
+
+import (
+	"golang.org/x/text/language"
+)
+
+// supportedLanguages lists the message languages; the first is the fallback
+var supportedLanguages = []language.Tag{language.English, language.Japanese}
+
+var languageMatcher = language.NewMatcher(supportedLanguages)
+
+// japaneseMessages translates messages by error code
+var japaneseMessages = map[string]string{
+	"INTERNAL_ERROR":      "サーバー内部でエラーが発生しました",
+	"INVALID_REQUEST":     "リクエストボディが不正です",
+	"VALIDATION_ERROR":    "リクエストの検証に失敗しました",
+	"RATE_LIMIT_EXCEEDED": "リクエストが多すぎます。しばらく待ってから再度お試しください",
+
+	"UNAUTHORIZED":        "認証されていません",
+	"INVALID_CREDENTIALS": "ユーザー名またはパスワードが正しくありません",
+	"LOGIN_THROTTLED":     "ログインの失敗が続いています。しばらく待ってから再度お試しください",
+	"INVALID_MFA_CODE":    "認証コードが正しくありません",
+	"MFA_ALREADY_ENABLED": "二要素認証は既に有効です",
+	"MFA_NOT_ENABLED":     "二要素認証は有効になっていません",
+	"MFA_NOT_ENROLLED":    "先に二要素認証の登録を開始してください",
+	"WRONG_PASSWORD":      "現在のパスワードが正しくありません",
+	"INVALID_RESET_TOKEN": "パスワード再設定のリンクが無効か、期限が切れています",
+	"FORBIDDEN":           "管理者権限が必要です",
+	"USER_NOT_FOUND":      "ユーザーが見つかりません",
+	"USER_EXISTS":         "ユーザー名またはメールアドレスは既に使われています",
+
+	"PASSWORD_RESET_UNAVAILABLE": "メールによるパスワード再設定は利用できません",
+
+	"SESSION_NOT_FOUND":         "セッションが見つかりません",
+	"SESSION_EXISTS":            "この日付のセッションは既に存在します",
+	"SESSION_INACTIVE":          "セッションはアクティブではありません",
+	"SESSION_ALREADY_COMPLETED": "セッションは既に完了しています",
+	"MESSAGE_NOT_FOUND":         "メッセージが見つかりません",
+	"MESSAGE_NOT_RETRYABLE":     "再試行できるのは返信に失敗した最新のメッセージだけです",
+	"INVALID_DATE":              "日付の形式が不正です (YYYY-MM-DD)",
+
+	"NO_MESSAGES":            "分析するメッセージがありません",
+	"ANALYSIS_NOT_FOUND":     "分析結果が見つかりません",
+	"AI_QUOTA_EXCEEDED":      "AIの利用上限に達しました。分析は次回のバッチで実行されます",
+	"AI_SERVICE_UNAVAILABLE": "AIサービスが一時的に利用できません",
+	"AI_INVALID_OUTPUT":      "AIの応答を利用できませんでした。もう一度お試しください",
+	"INVALID_YEAR":           "年の指定が不正です",
+	"INVALID_MONTH":          "月の指定が不正です",
+
+	"INVALID_FILTER":     "フィルターの形式が不正です。テンションスコアは0から100の範囲です",
+	"INVALID_DATE_RANGE": "from と to は YYYY-MM-DD 形式で、from <= to である必要があります",
+	"INVALID_SORT":       "サポートされていない並び順です",
+	"INVALID_CURSOR":     "カーソルが不正か、別の並び順で発行されたものです",
+
+	"ENTITY_NOT_FOUND":   "エンティティが見つかりません",
+	"INVALID_KIND":       "種類は person、place、activity、project のいずれかです",
+	"INVALID_NAME":       "名前は1文字以上100文字以下にしてください",
+	"ENTITY_NAME_IN_USE": "この名前は別のエンティティで使われています。統合してください",
+	"INVALID_MERGE":      "統合には他のエンティティを1つ以上、重複なく指定してください",
+
+	"INVALID_SETTINGS":       "アラートのしきい値が範囲外です",
+	"NOTIFICATION_NOT_FOUND": "通知が見つかりません",
+
+	"INVALID_REMIND_AT":      "remind_at は HH:MM 形式で指定してください",
+	"INVALID_TIMEZONE":       "タイムゾーンが不明です",
+	"UNSUPPORTED_CHANNEL":    "このサーバーでは利用できないチャネルです",
+	"INVALID_QUIET_HOURS":    "おやすみ時間は開始と終了の両方を HH:MM 形式で指定してください",
+	"INVALID_SUBSCRIPTION":   "購読には公開された https のエンドポイントと p256dh/auth キーが必要です",
+	"SUBSCRIPTION_NOT_FOUND": "プッシュ通知の購読が見つかりません",
+
+	"INVALID_WEBHOOK_URL":   "公開された https の Webhook URL が必要です",
+	"WEBHOOK_NOT_FOUND":     "Webhook が見つかりません",
+	"WEBHOOK_LIMIT_REACHED": "登録できる Webhook の上限に達しています",
+	"UNSUPPORTED_EVENT":     "events にはサポートされているイベントを1つ以上指定してください",
+	"INVALID_STATUS":        "status は pending、succeeded、failed のいずれかです",
+	"DELIVERY_NOT_FOUND":    "Webhook の配信記録が見つかりません",
+
+	"INVALID_QUOTA": "上限は0 (無制限) 以上で指定してください",
+}
+
+// Localize returns the message of err in the language preferred by an Accept-Language header,
+// falling back to English
+func Localize(err *Error, acceptLanguage string) string {
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, index, _ := languageMatcher.Match(tags...)
+	if supportedLanguages[index] == language.Japanese {
+		if message, ok := japaneseMessages[err.Code]; ok {
+			return message
+		}
+	}
+	return err.Message
+}
@@ -4,17 +4,24 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	AI       AIConfig
-	JWT      JWTConfig
-	Redis    RedisConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	AI        AIConfig
+	JWT       JWTConfig
+	Login     LoginConfig
+	Redis     RedisConfig
+	RateLimit RateLimitConfig
+	Notify    NotifyConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
+	Log       LogConfig
 }
 
 // DatabaseConfig holds database configuration
@@ -31,12 +38,27 @@ type ServerConfig struct {
 	Host string
 	Port string
 	Env  string
+	// TrustedProxies lists the proxy addresses and CIDR ranges whose X-Forwarded-For and X-Real-IP
+	// headers are believed; empty means clients connect directly
+	TrustedProxies string
 }
 
 // AIConfig holds AI service configuration
 type AIConfig struct {
-	GeminiAPIKey string
-	Model        string
+	GeminiAPIKey    string
+	Model           string
+	EmotionTaxonomy string
+	// DailyTokenQuota and MonthlyTokenQuota are the default per-user token quotas; 0 means unlimited
+	DailyTokenQuota   int
+	MonthlyTokenQuota int
+	// Timeout bounds a single Gemini call; Timeouts overrides it per client method (e.g. GenerateResponse)
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+	// MaxRetries is how many times a 429, 5xx or timed-out call is retried; 0 disables retries
+	MaxRetries int
+	// BreakerThreshold consecutive unavailable calls stop Gemini calls for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 // JWTConfig holds JWT configuration
@@ -44,11 +66,79 @@ type JWTConfig struct {
 	Secret string
 }
 
+// LoginConfig holds failed login throttling configuration
+type LoginConfig struct {
+	// LockoutThreshold consecutive failed logins lock the account for LockoutDuration; 0 disables lockout
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// IPMaxFailures failed logins from one IP address within IPWindow refuse its logins; 0 disables the limit
+	IPMaxFailures int
+	IPWindow      time.Duration
+	// PasswordResetTTL is how long a password reset link stays valid
+	PasswordResetTTL time.Duration
+}
+
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
 	URL string
 }
 
+// RateLimitConfig holds request rate limits. Limits are "<requests>/<duration>" (e.g. "20/1m");
+// "off" or an empty limit disables it.
+type RateLimitConfig struct {
+	// Store is "memory" (per API instance) or "redis" (shared through REDIS_URL)
+	Store string
+	// Auth limits login and registration per client IP
+	Auth string
+	// Chat limits sending messages and retrying replies per user
+	Chat string
+	// Analysis limits getting and triggering session analyses per user
+	Analysis string
+}
+
+// NotifyConfig holds notification channel and reminder configuration
+type NotifyConfig struct {
+	AppURL           string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	MailDir          string
+	VAPIDPublicKey   string
+	VAPIDPrivateKey  string
+	VAPIDSubject     string
+	ReminderInterval string
+}
+
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	// Token is required as a bearer token to scrape /metrics; /metrics is not served without it
+	Token string
+	// PushgatewayURL is where the batch job pushes its metrics; empty disables pushing
+	PushgatewayURL string
+	// MinMessages is the batch's threshold used when counting the analysis queue
+	MinMessages int
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// Exporter is one of "otlp", "stdout" or "none"; OTLP itself is configured by OTEL_EXPORTER_OTLP_*
+	Exporter    string
+	ServiceName string
+	SampleRatio float64
+}
+
+// LogConfig holds structured logging configuration
+type LogConfig struct {
+	// Level is one of "debug", "info", "warn" or "error"
+	Level string
+	// Format is "json" or "text"
+	Format string
+	// Redact hides diary content and personal data in logs; secrets are always hidden
+	Redact bool
+}
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if exists
@@ -63,20 +153,84 @@ func Load() (*Config, error) {
 			MaxConnIdleTime: getEnv("DB_MAX_CONN_IDLE_TIME", "30m"),
 		},
 		Server: ServerConfig{
-			Host: getEnv("HOST", "0.0.0.0"),
-			Port: getEnv("PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Host:           getEnv("HOST", "0.0.0.0"),
+			Port:           getEnv("PORT", "8080"),
+			Env:            getEnv("ENV", "development"),
+			TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
 		},
 		AI: AIConfig{
-			GeminiAPIKey: getEnv("GEMINI_API_KEY", ""),
-			Model:        getEnv("GEMINI_MODEL", "gemini-2.5-flash-preview-05-20"),
+			GeminiAPIKey:      getEnv("GEMINI_API_KEY", ""),
+			Model:             getEnv("GEMINI_MODEL", "gemini-2.5-flash-preview-05-20"),
+			EmotionTaxonomy:   getEnv("EMOTION_TAXONOMY", "ekman"),
+			DailyTokenQuota:   getEnvAsInt("AI_DAILY_TOKEN_QUOTA", 200000),
+			MonthlyTokenQuota: getEnvAsInt("AI_MONTHLY_TOKEN_QUOTA", 3000000),
+			Timeout:           getEnvAsDuration("AI_TIMEOUT", 60*time.Second),
+			Timeouts:          getEnvAsDurationMap("AI_TIMEOUTS", "GenerateResponse=15s,GenerateFirstMessage=15s"),
+			MaxRetries:        getEnvAsInt("AI_MAX_RETRIES", 2),
+			BreakerThreshold:  getEnvAsInt("AI_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:   getEnvAsDuration("AI_BREAKER_COOLDOWN", 30*time.Second),
 		},
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", "your-secret-key"),
 		},
+		Login: LoginConfig{
+			LockoutThreshold: getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			LockoutDuration:  getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			IPMaxFailures:    getEnvAsInt("LOGIN_IP_MAX_FAILURES", 50),
+			IPWindow:         getEnvAsDuration("LOGIN_IP_WINDOW", 15*time.Minute),
+			PasswordResetTTL: getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+		},
 		Redis: RedisConfig{
 			URL: getEnv("REDIS_URL", "redis://localhost:6379"),
 		},
+		RateLimit: RateLimitConfig{
+			Store:    getEnv("RATE_LIMIT_STORE", "memory"),
+			Auth:     getEnv("RATE_LIMIT_AUTH", "10/1m"),
+			Chat:     getEnv("RATE_LIMIT_CHAT", "20/1m"),
+			Analysis: getEnv("RATE_LIMIT_ANALYSIS", "30/1m"),
+		},
+		Notify: NotifyConfig{
+			AppURL:           getEnv("APP_URL", "http://localhost:4321"),
+			SMTPHost:         getEnv("SMTP_HOST", ""),
+			SMTPPort:         getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:         getEnv("SMTP_FROM", "kasaneha@localhost"),
+			MailDir:          getEnv("MAIL_DIR", ""),
+			VAPIDPublicKey:   getEnv("VAPID_PUBLIC_KEY", ""),
+			VAPIDPrivateKey:  getEnv("VAPID_PRIVATE_KEY", ""),
+			VAPIDSubject:     getEnv("VAPID_SUBJECT", "mailto:kasaneha@localhost"),
+			ReminderInterval: getEnv("REMINDER_INTERVAL", "1m"),
+		},
+		Metrics: MetricsConfig{
+			Token:          getEnv("METRICS_TOKEN", ""),
+			PushgatewayURL: getEnv("PUSHGATEWAY_URL", ""),
+			MinMessages:    getEnvAsInt("MIN_MESSAGES", 2),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "kasaneha-backend"),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1.0),
+		},
+		Log: LogConfig{
+			Level:  getEnv("LOG_LEVEL", ""),
+			Format: getEnv("LOG_FORMAT", ""),
+			Redact: getEnvAsBool("LOG_REDACT", true),
+		},
+	}
+
+	// Verbose, human-readable logs in development; JSON at info level elsewhere
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "info"
+		if cfg.IsDevelopment() {
+			cfg.Log.Level = "debug"
+		}
+	}
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = "json"
+		if cfg.IsDevelopment() {
+			cfg.Log.Format = "text"
+		}
 	}
 
 	return cfg, nil
@@ -109,3 +263,49 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// getEnvAsFloat gets an environment variable as float with a fallback value
+func getEnvAsFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return fallback
+}
+
+// getEnvAsBool gets an environment variable as boolean with a fallback value
+func getEnvAsBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return fallback
+}
+
+// getEnvAsDuration gets an environment variable as duration (e.g. "30s") with a fallback value
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return fallback
+}
+
+// getEnvAsDurationMap gets an environment variable of the form "name=duration,name=duration".
+// Malformed entries are skipped.
+func getEnvAsDurationMap(key, fallback string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, entry := range strings.Split(getEnv(key, fallback), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if duration, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			durations[strings.TrimSpace(name)] = duration
+		}
+	}
+	return durations
+}
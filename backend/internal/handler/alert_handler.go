@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// AlertHandler handles mood alert settings and notification requests
+type AlertHandler struct {
+	alertService *service.AlertService
+}
+
+// NewAlertHandler creates a new alert handler
+func NewAlertHandler(alertService *service.AlertService) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+	}
+}
+
+// GetAlertSettings handles GET /alerts/settings
+func (h *AlertHandler) GetAlertSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	settings, err := h.alertService.GetSettings(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, settings)
+}
+
+// UpdateAlertSettings handles PUT /alerts/settings
+func (h *AlertHandler) UpdateAlertSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.UpdateAlertSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	settings, err := h.alertService.UpdateSettings(r.Context(), userID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, settings)
+}
+
+// GetNotifications handles GET /notifications
+func (h *AlertHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Parse query parameters
+	limit := 20 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	response, err := h.alertService.GetNotifications(r.Context(), userID, unreadOnly, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// MarkNotificationRead handles PUT /notifications/:notificationId/read
+func (h *AlertHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	notificationID := chi.URLParam(r, "notificationId")
+
+	if err := h.alertService.MarkNotificationRead(r.Context(), userID, notificationID); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
+	})
+}
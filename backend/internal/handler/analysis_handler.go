@@ -1,13 +1,14 @@
 package handler
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/pagination"
 	"github.com/trasta298/kasaneha/backend/internal/service"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
@@ -29,26 +30,15 @@ func NewAnalysisHandler(analysisService *service.AnalysisService) *AnalysisHandl
 func (h *AnalysisHandler) GetSessionAnalysis(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	sessionID := chi.URLParam(r, "sessionId")
-	if sessionID == "" {
-		h.errorResponse(w, r, http.StatusBadRequest, "MISSING_SESSION_ID", "Session ID is required", nil)
-		return
-	}
 
 	analysis, err := h.analysisService.GetSessionAnalysis(r.Context(), userID, sessionID)
 	if err != nil {
-		switch err.Error() {
-		case "session not found or access denied":
-			h.errorResponse(w, r, http.StatusNotFound, "SESSION_NOT_FOUND", "Session not found", nil)
-		case "no messages found for analysis":
-			h.errorResponse(w, r, http.StatusBadRequest, "NO_MESSAGES", "No messages found for analysis", nil)
-		default:
-			h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get analysis", err)
-		}
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -63,26 +53,15 @@ func (h *AnalysisHandler) GetSessionAnalysis(w http.ResponseWriter, r *http.Requ
 func (h *AnalysisHandler) TriggerSessionAnalysis(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	sessionID := chi.URLParam(r, "sessionId")
-	if sessionID == "" {
-		h.errorResponse(w, r, http.StatusBadRequest, "MISSING_SESSION_ID", "Session ID is required", nil)
-		return
-	}
 
 	analysis, err := h.analysisService.AnalyzeSession(r.Context(), userID, sessionID)
 	if err != nil {
-		switch err.Error() {
-		case "session not found or access denied":
-			h.errorResponse(w, r, http.StatusNotFound, "SESSION_NOT_FOUND", "Session not found", nil)
-		case "no messages found for analysis":
-			h.errorResponse(w, r, http.StatusBadRequest, "NO_MESSAGES", "No messages found for analysis", nil)
-		default:
-			h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to perform analysis", err)
-		}
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -98,8 +77,7 @@ func (h *AnalysisHandler) TriggerSessionAnalysis(w http.ResponseWriter, r *http.
 func (h *AnalysisHandler) GetTensionScores(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get user ID from context: %v\n", err)
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -111,49 +89,66 @@ func (h *AnalysisHandler) GetTensionScores(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	fmt.Printf("DEBUG: Getting tension scores for userID: %s, days: %d\n", userID, days)
 	scores, err := h.analysisService.GetTensionScores(r.Context(), userID, days)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get tension scores: %v\n", err)
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get tension scores", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
-	fmt.Printf("DEBUG: Successfully retrieved tension scores: %+v\n", scores)
 	render.JSON(w, r, scores)
 }
 
+// GetEmotionTrend handles GET /analysis/emotions
+func (h *AnalysisHandler) GetEmotionTrend(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Parse query parameters
+	days := 30 // default
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		if parsedDays, err := strconv.Atoi(daysStr); err == nil && parsedDays > 0 && parsedDays <= 365 {
+			days = parsedDays
+		}
+	}
+
+	trend, err := h.analysisService.GetEmotionTrend(r.Context(), userID, days)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, trend)
+}
+
 // GetCalendarData handles GET /calendar/:year/:month
 func (h *AnalysisHandler) GetCalendarData(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	yearStr := chi.URLParam(r, "year")
 	monthStr := chi.URLParam(r, "month")
 
-	if yearStr == "" || monthStr == "" {
-		h.errorResponse(w, r, http.StatusBadRequest, "MISSING_PARAMETERS", "Year and month are required", nil)
-		return
-	}
-
 	year, err := strconv.Atoi(yearStr)
 	if err != nil || year < 2020 || year > timeutil.NowJST().Year()+1 {
-		h.errorResponse(w, r, http.StatusBadRequest, "INVALID_YEAR", "Invalid year parameter", nil)
+		apperror.Write(w, r, apperror.ErrInvalidYear)
 		return
 	}
 
 	month, err := strconv.Atoi(monthStr)
 	if err != nil || month < 1 || month > 12 {
-		h.errorResponse(w, r, http.StatusBadRequest, "INVALID_MONTH", "Invalid month parameter", nil)
+		apperror.Write(w, r, apperror.ErrInvalidMonth)
 		return
 	}
 
 	calendarData, err := h.analysisService.GetCalendarData(r.Context(), userID, year, month)
 	if err != nil {
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get calendar data", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -162,35 +157,25 @@ func (h *AnalysisHandler) GetCalendarData(w http.ResponseWriter, r *http.Request
 
 // GetUserAnalyses handles GET /analysis/history
 func (h *AnalysisHandler) GetUserAnalyses(w http.ResponseWriter, r *http.Request) {
-	_, err := middleware.GetUserIDFromContext(r.Context())
+	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
-	// Parse query parameters
-	limit := 20 // default
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
-			limit = parsedLimit
-		}
-	}
-
-	offset := 0 // default
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	query, err := parseListQuery(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
 
-	// Note: This would require implementing GetAnalysesByUserID in analysis service
-	// For now, we'll return a placeholder response
-	response := map[string]interface{}{
-		"message": "Analysis history endpoint - implementation pending",
-		"limit":   limit,
-		"offset":  offset,
+	response, err := h.analysisService.GetUserAnalyses(r.Context(), userID, query)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
 
+	pagination.SetLinkHeader(w, r, response.Pagination.NextCursor)
 	render.JSON(w, r, response)
 }
 
@@ -198,7 +183,7 @@ func (h *AnalysisHandler) GetUserAnalyses(w http.ResponseWriter, r *http.Request
 func (h *AnalysisHandler) GetAnalysisInsights(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -213,17 +198,33 @@ func (h *AnalysisHandler) GetAnalysisInsights(w http.ResponseWriter, r *http.Req
 	// Get tension scores for insights
 	tensionData, err := h.analysisService.GetTensionScores(r.Context(), userID, days)
 	if err != nil {
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get insights", err)
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Correlations need more history than the summary insights to be meaningful
+	correlationDays := 90 // default
+	if daysStr := r.URL.Query().Get("correlation_days"); daysStr != "" {
+		if parsedDays, err := strconv.Atoi(daysStr); err == nil && parsedDays > 0 && parsedDays <= 365 {
+			correlationDays = parsedDays
+		}
+	}
+
+	correlations, err := h.analysisService.GetTensionCorrelations(r.Context(), userID, correlationDays)
+	if err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
 	// Generate insights based on the data
 	insights := h.generateInsights(tensionData, days)
+	insights = append(insights, h.generateCorrelationInsights(correlations)...)
 
 	response := map[string]interface{}{
-		"insights":   insights,
-		"timeframe":  days,
-		"statistics": tensionData.Statistics,
+		"insights":     insights,
+		"timeframe":    days,
+		"statistics":   tensionData.Statistics,
+		"correlations": correlations,
 	}
 
 	render.JSON(w, r, response)
@@ -305,13 +306,27 @@ func (h *AnalysisHandler) generateInsights(data *types.TensionScoresResponse, da
 	return insights
 }
 
-// errorResponse sends an error response
-func (h *AnalysisHandler) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string, err error) {
-	render.Status(r, status)
-	render.JSON(w, r, types.ErrorResponse{
-		Error: types.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	})
+// generateCorrelationInsights creates insights from statistically significant correlations
+func (h *AnalysisHandler) generateCorrelationInsights(data *types.TensionCorrelationsResponse) []map[string]interface{} {
+	insights := []map[string]interface{}{}
+
+	for _, correlation := range data.Correlations {
+		if !correlation.Significant {
+			continue
+		}
+
+		level := "positive"
+		if correlation.Difference < 0 {
+			level = "attention"
+		}
+
+		insights = append(insights, map[string]interface{}{
+			"type":    "correlation",
+			"level":   level,
+			"message": correlation.Message,
+			"value":   correlation.Difference,
+		})
+	}
+
+	return insights
 }
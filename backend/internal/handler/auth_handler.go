@@ -4,25 +4,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/middleware"
 	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/service"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 )
 
 // AuthHandler handles authentication related requests
 type AuthHandler struct {
-	userRepo *repository.UserRepository
-	auth     *middleware.AuthMiddleware
+	userRepo    repository.UserStore
+	authService *service.AuthService
+	auth        *middleware.AuthMiddleware
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(userRepo *repository.UserRepository, auth *middleware.AuthMiddleware) *AuthHandler {
+func NewAuthHandler(userRepo repository.UserStore, authService *service.AuthService, auth *middleware.AuthMiddleware) *AuthHandler {
 	return &AuthHandler{
-		userRepo: userRepo,
-		auth:     auth,
+		userRepo:    userRepo,
+		authService: authService,
+		auth:        auth,
 	}
 }
 
@@ -30,32 +35,21 @@ func NewAuthHandler(userRepo *repository.UserRepository, auth *middleware.AuthMi
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req types.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, r, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", err)
-		return
-	}
-
-	// Validate request
-	if err := h.validateRegisterRequest(&req); err != nil {
-		h.errorResponse(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
 		return
 	}
 
 	// Create user
 	user, err := h.userRepo.CreateUser(r.Context(), &req)
 	if err != nil {
-		// Check if it's a duplicate username/email error
-		if isUniqueConstraintError(err) {
-			h.errorResponse(w, r, http.StatusConflict, "USER_EXISTS", "Username or email already exists", nil)
-			return
-		}
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create user", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	// Generate JWT token
-	token, err := h.auth.GenerateToken(user.ID, user.Username)
+	token, err := h.auth.GenerateToken(user.ID, user.Username, nil)
 	if err != nil {
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate token", err)
+		apperror.Write(w, r, fmt.Errorf("failed to generate token: %w", err))
 		return
 	}
 
@@ -73,27 +67,110 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req types.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, r, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", err)
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	// Validate password, counting failures against the account and IP
+	result, err := h.authService.Login(r.Context(), req.Username, req.Password, clientInfo(r))
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Users with two-factor authentication complete the login at /auth/login/mfa
+	if result.MFARequired {
+		mfaToken, expiresAt, err := h.auth.GenerateMFAToken(result.User.ID, result.MFAChallenge)
+		if err != nil {
+			apperror.Write(w, r, fmt.Errorf("failed to generate MFA token: %w", err))
+			return
+		}
+
+		render.JSON(w, r, types.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresAt:   expiresAt,
+		})
+		return
+	}
+
+	h.writeLogin(w, r, result.User)
+}
+
+// LoginMFA handles the second login step with a TOTP or recovery code
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req types.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	userID, challenge, err := h.auth.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	// Validate password
-	user, err := h.userRepo.ValidatePassword(r.Context(), req.Username, req.Password)
+	user, err := h.authService.CompleteMFALogin(r.Context(), userID, challenge, req.Code, clientInfo(r))
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid username or password", nil)
+		apperror.Write(w, r, err)
+		return
+	}
+
+	h.writeLogin(w, r, user)
+}
+
+// RequestPasswordReset handles POST /auth/password/reset-request
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req types.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	// The response is the same whether or not the address is registered
+	if err := h.authService.RequestPasswordReset(r.Context(), req.Email, clientInfo(r)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ResetPassword handles POST /auth/password/reset
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req types.PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
 		return
 	}
 
-	// Update last login
-	if err := h.userRepo.UpdateLastLogin(r.Context(), user.ID); err != nil {
-		// Log error but don't fail the login
-		// In a real app, you might want to use a proper logger here
+	if err := h.authService.ResetPassword(r.Context(), req.Token, req.NewPassword, clientInfo(r)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// writeLogin responds with a JWT token for a logged in user
+func (h *AuthHandler) writeLogin(w http.ResponseWriter, r *http.Request, user *types.User) {
+	// The token is tied to the current password, so that changing it revokes the token
+	passwordChangedAt, err := h.userRepo.GetPasswordChangedAt(r.Context(), user.ID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
 
 	// Generate JWT token
-	token, err := h.auth.GenerateToken(user.ID, user.Username)
+	token, err := h.auth.GenerateToken(user.ID, user.Username, passwordChangedAt)
 	if err != nil {
-		h.errorResponse(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate token", err)
+		apperror.Write(w, r, fmt.Errorf("failed to generate token: %w", err))
 		return
 	}
 
@@ -110,50 +187,195 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
-		h.errorResponse(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	user, err := h.userRepo.GetUserByID(r.Context(), userID)
 	if err != nil {
-		h.errorResponse(w, r, http.StatusNotFound, "USER_NOT_FOUND", "User not found", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
 	render.JSON(w, r, user)
 }
 
-// validateRegisterRequest validates registration request
-func (h *AuthHandler) validateRegisterRequest(req *types.RegisterRequest) error {
-	if len(req.Username) < 3 {
-		return fmt.Errorf("username must be at least 3 characters long")
+// ChangePassword handles PUT /auth/password. Earlier tokens stop working, so the response carries
+// a new one.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	if err := h.authService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword, clientInfo(r)); err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
-	if len(req.Password) < 6 {
-		return fmt.Errorf("password must be at least 6 characters long")
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
-	if req.Email != nil && *req.Email != "" {
-		// Simple email validation
-		if !strings.Contains(*req.Email, "@") {
-			return fmt.Errorf("invalid email format")
+
+	h.writeLogin(w, r, user)
+}
+
+// GetSecurityEvents handles GET /auth/security-events
+func (h *AuthHandler) GetSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Parse query parameters
+	limit := 20 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
 		}
 	}
-	return nil
+
+	response, err := h.authService.GetSecurityEvents(r.Context(), userID, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// GetMFAStatus handles GET /auth/mfa
+func (h *AuthHandler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	status, err := h.authService.GetMFAStatus(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, status)
+}
+
+// EnrollMFA handles POST /auth/mfa/enroll
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	enrollment, err := h.authService.EnrollMFA(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, enrollment)
 }
 
-// errorResponse sends an error response
-func (h *AuthHandler) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string, err error) {
-	render.Status(r, status)
-	render.JSON(w, r, types.ErrorResponse{
-		Error: types.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
+// VerifyMFA handles POST /auth/mfa/verify
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	response, err := h.authService.ConfirmMFA(r.Context(), userID, req.Code, clientInfo(r))
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// DisableMFA handles POST /auth/mfa/disable
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	if err := h.authService.DisableMFA(r.Context(), userID, req.Code, clientInfo(r)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
 	})
 }
 
-// isUniqueConstraintError checks if the error is a unique constraint violation
-func isUniqueConstraintError(err error) bool {
-	// This is a simplified check. In a real application, you'd want to
-	// check for specific PostgreSQL error codes (23505 for unique_violation)
-	return strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "duplicate")
+// RegenerateRecoveryCodes handles POST /auth/mfa/recovery-codes
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	response, err := h.authService.RegenerateRecoveryCodes(r.Context(), userID, req.Code, clientInfo(r))
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// UnlockUser handles POST /admin/users/:userId/unlock
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userId")
+
+	if err := h.authService.UnlockUser(r.Context(), userID); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// clientInfo returns the request's client address and user agent
+func clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
 }
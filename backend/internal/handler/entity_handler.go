@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// EntityHandler handles requests for the people, places, activities and projects users mention
+type EntityHandler struct {
+	entityService *service.EntityService
+}
+
+// NewEntityHandler creates a new entity handler
+func NewEntityHandler(entityService *service.EntityService) *EntityHandler {
+	return &EntityHandler{
+		entityService: entityService,
+	}
+}
+
+// GetEntities handles GET /entities
+func (h *EntityHandler) GetEntities(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// Parse query parameters
+	limit := 20 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	var kind *string
+	if kindStr := r.URL.Query().Get("kind"); kindStr != "" {
+		kind = &kindStr
+	}
+
+	response, err := h.entityService.GetEntities(r.Context(), userID, kind, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// GetEntity handles GET /entities/:entityId
+func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	entityID := chi.URLParam(r, "entityId")
+
+	response, err := h.entityService.GetEntityDetail(r.Context(), userID, entityID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// RenameEntity handles PUT /entities/:entityId
+func (h *EntityHandler) RenameEntity(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	entityID := chi.URLParam(r, "entityId")
+
+	var req types.RenameEntityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	response, err := h.entityService.RenameEntity(r.Context(), userID, entityID, req.Name)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// MergeEntities handles POST /entities/:entityId/merge
+func (h *EntityHandler) MergeEntities(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	entityID := chi.URLParam(r, "entityId")
+
+	var req types.MergeEntitiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	response, err := h.entityService.MergeEntities(r.Context(), userID, entityID, req.SourceIDs)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// parseListQuery reads the pagination, sort and filter parameters shared by session and analysis listings
+func parseListQuery(r *http.Request) (types.ListQuery, error) {
+	params := r.URL.Query()
+	query := types.ListQuery{
+		Sort:         params.Get("sort"),
+		Cursor:       params.Get("cursor"),
+		Limit:        20, // default
+		IncludeTotal: params.Get("include_total") == "true",
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			query.Limit = parsedLimit
+		}
+	}
+
+	optionalString := func(name string) *string {
+		if value := params.Get(name); value != "" {
+			return &value
+		}
+		return nil
+	}
+	var parseErr error
+	optionalInt := func(name string) *int {
+		value := params.Get(name)
+		if value == "" {
+			return nil
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			parseErr = apperror.ErrInvalidFilter
+			return nil
+		}
+		return &parsed
+	}
+
+	query.DateFrom = optionalString("from")
+	query.DateTo = optionalString("to")
+	query.Year = optionalInt("year")
+	query.Month = optionalInt("month")
+	query.Status = optionalString("status")
+	query.MinTension = optionalInt("min_tension")
+	query.MaxTension = optionalInt("max_tension")
+	query.Emotion = optionalString("emotion")
+	query.Keyword = optionalString("keyword")
+	if value := params.Get("has_analysis"); value != "" {
+		hasAnalysis, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, apperror.ErrInvalidFilter
+		}
+		query.HasAnalysis = &hasAnalysis
+	}
+	if query.Month != nil && (*query.Month < 1 || *query.Month > 12) {
+		return query, apperror.ErrInvalidFilter
+	}
+
+	return query, parseErr
+}
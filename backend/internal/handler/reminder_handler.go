@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ReminderHandler handles journaling reminder settings and push subscription requests
+type ReminderHandler struct {
+	reminderService *service.ReminderService
+}
+
+// NewReminderHandler creates a new reminder handler
+func NewReminderHandler(reminderService *service.ReminderService) *ReminderHandler {
+	return &ReminderHandler{
+		reminderService: reminderService,
+	}
+}
+
+// GetReminderSettings handles GET /reminders/settings
+func (h *ReminderHandler) GetReminderSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	response, err := h.reminderService.GetSettings(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// UpdateReminderSettings handles PUT /reminders/settings
+func (h *ReminderHandler) UpdateReminderSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.UpdateReminderSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	response, err := h.reminderService.UpdateSettings(r.Context(), userID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// SubscribePush handles POST /reminders/push-subscriptions
+func (h *ReminderHandler) SubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	subscription, err := h.reminderService.SubscribePush(r.Context(), userID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, subscription)
+}
+
+// UnsubscribePush handles DELETE /reminders/push-subscriptions
+func (h *ReminderHandler) UnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var req types.PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	if err := h.reminderService.UnsubscribePush(r.Context(), userID, req.Endpoint); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/middleware"
+	"github.com/trasta298/kasaneha/backend/internal/service"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// UsageHandler handles AI token usage and quota requests
+type UsageHandler struct {
+	usageService *service.UsageService
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(usageService *service.UsageService) *UsageHandler {
+	return &UsageHandler{
+		usageService: usageService,
+	}
+}
+
+// GetUsage handles GET /usage
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	response, err := h.usageService.GetUserUsage(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// GetUsageReport handles GET /admin/usage
+func (h *UsageHandler) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	// Default to the current month so far
+	now := timeutil.NowJST()
+	from := timeutil.BeginningOfMonthJST(now).Format("2006-01-02")
+	to := now.Format("2006-01-02")
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from = fromStr
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to = toStr
+	}
+
+	response, err := h.usageService.GetUsageReport(r.Context(), from, to)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, response)
+}
+
+// UpdateQuota handles PUT /admin/usage/users/:userId/quota
+func (h *UsageHandler) UpdateQuota(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userId")
+
+	var req types.UpdateAIQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.ErrInvalidRequest)
+		return
+	}
+
+	quota, err := h.usageService.UpdateQuota(r.Context(), userID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, quota)
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config holds logging configuration
+type Config struct {
+	// Level is one of "debug", "info", "warn" or "error"
+	Level string
+	// Format is "json" or "text"
+	Format string
+	// Redact replaces diary content and personal data with a placeholder. Secrets are always redacted.
+	Redact bool
+}
+
+// redacted replaces the value of sensitive attributes
+const redacted = "[REDACTED]"
+
+// secretKeys are never logged; any attribute whose key contains one of them is redacted
+var secretKeys = []string{"password", "secret", "api_key", "apikey", "authorization", "cookie", "private_key"}
+
+// personalKeys hold diary content or personal data and are redacted unless redaction is disabled
+var personalKeys = map[string]bool{
+	"content":      true,
+	"conversation": true,
+	"summary":      true,
+	"prompt":       true,
+	"response":     true,
+	"text":         true,
+	"body":         true,
+	"email":        true,
+	"username":     true,
+	"remote_ip":    true,
+}
+
+// New creates a logger that adds request, user and trace IDs from the context to every record
+func New(cfg Config, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: parseLevel(cfg.Level),
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			return redactAttr(attr, cfg.Redact)
+		},
+	}
+
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// Discard returns a logger that drops everything, for tools and tests that do not need logs
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// Err returns the conventional attribute for an error
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func redactAttr(attr slog.Attr, redactPersonal bool) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	// "token" and "access_token" are credentials, "input_tokens" is not
+	if key == "token" || strings.HasSuffix(key, "_token") {
+		return slog.String(attr.Key, redacted)
+	}
+	if redactPersonal && personalKeys[key] {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+// requestInfo is shared by all contexts derived from a request, so that values learned deeper in the
+// middleware chain (e.g. the authenticated user) are visible to the request log written at the top
+type requestInfo struct {
+	userID string
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo prepares ctx to carry the user ID set later by SetUserID
+func WithRequestInfo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{})
+}
+
+// WithUserID returns a context whose log records carry userID, for background work started outside a request
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{userID: userID})
+}
+
+// SetUserID records the authenticated user for log records of the current request
+func SetUserID(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// UserID returns the user recorded for the current request, if any
+func UserID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.userID
+	}
+	return ""
+}
+
+// contextHandler adds request_id, user_id, trace_id and span_id from the context
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID := middleware.GetReqID(ctx); requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+		if userID := UserID(ctx); userID != "" {
+			record.AddAttrs(slog.String("user_id", userID))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
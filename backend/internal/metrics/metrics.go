@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kasaneha"
+
+// HTTP metrics, labelled by chi route pattern so that path parameters do not explode cardinality
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// AI metrics, labelled by client method (GenerateResponse, AnalyzeEmotion, ...)
+var (
+	aiDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ai_request_duration_seconds",
+		Help:      "Gemini call latency by client method.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"method"})
+
+	aiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_request_errors_total",
+		Help:      "Failed Gemini calls by client method.",
+	}, []string{"method"})
+
+	aiTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_tokens_total",
+		Help:      "Gemini tokens by client method and type (prompt, candidates, thoughts).",
+	}, []string{"method", "type"})
+
+	aiRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_retries_total",
+		Help:      "Retried Gemini calls by client method.",
+	}, []string{"method"})
+
+	aiInvalidOutputs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_invalid_outputs_total",
+		Help:      "Gemini responses whose structured output could not be used, by client method.",
+	}, []string{"method"})
+
+	aiCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ai_circuit_open",
+		Help:      "1 while the Gemini circuit breaker is open or half-open, 0 otherwise.",
+	})
+)
+
+// Analysis metrics
+var analysisInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "analysis_in_flight",
+	Help:      "Session analyses currently running in the background.",
+})
+
+// Batch metrics live in their own collectors so that the batch job can push just these to a Pushgateway
+var (
+	// BatchJobs counts batch job runs by job and result
+	BatchJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "batch_jobs_total",
+		Help:      "Batch job runs by job and result (success, failure).",
+	}, []string{"job", "result"})
+
+	// BatchSessions counts sessions processed by the batch analysis by result
+	BatchSessions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "batch_sessions_total",
+		Help:      "Sessions processed by the batch analysis by result (success, failure).",
+	}, []string{"result"})
+
+	// BatchLastRun records when each batch job last finished, by job and result
+	BatchLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "batch_last_run_timestamp_seconds",
+		Help:      "Unix time a batch job last finished, by job and result.",
+	}, []string{"job", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(BatchJobs, BatchSessions, BatchLastRun)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+// Requests must carry token as a bearer token; an empty token refuses every request.
+func Handler(token string) http.Handler {
+	h := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Middleware records request counts and latency per chi route pattern
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		// The pattern is only complete once routing has finished
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveAICall records the latency and outcome of a Gemini call
+func ObserveAICall(method string, duration time.Duration, err error) {
+	aiDuration.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil {
+		aiErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// AddAITokens records the tokens a Gemini call used
+func AddAITokens(method string, prompt, candidates, thoughts int32) {
+	aiTokens.WithLabelValues(method, "prompt").Add(float64(prompt))
+	aiTokens.WithLabelValues(method, "candidates").Add(float64(candidates))
+	aiTokens.WithLabelValues(method, "thoughts").Add(float64(thoughts))
+}
+
+// AddAIRetry counts a retried Gemini call
+func AddAIRetry(method string) {
+	aiRetries.WithLabelValues(method).Inc()
+}
+
+// AddAIInvalidOutput counts a Gemini response whose structured output could not be used
+func AddAIInvalidOutput(method string) {
+	aiInvalidOutputs.WithLabelValues(method).Inc()
+}
+
+// SetAICircuitOpen records whether the Gemini circuit breaker is open
+func SetAICircuitOpen(open bool) {
+	if open {
+		aiCircuitOpen.Set(1)
+	} else {
+		aiCircuitOpen.Set(0)
+	}
+}
+
+// AnalysisStarted marks a background analysis as running; call the returned function when it ends
+func AnalysisStarted() func() {
+	analysisInFlight.Inc()
+	return analysisInFlight.Dec
+}
+
+// RecordBatchJob counts a finished batch job run
+func RecordBatchJob(job string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	BatchJobs.WithLabelValues(job, result).Inc()
+	BatchLastRun.WithLabelValues(job, result).SetToCurrentTime()
+}
+
+// RecordBatchSession counts a session processed by the batch analysis
+func RecordBatchSession(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	BatchSessions.WithLabelValues(result).Inc()
+}
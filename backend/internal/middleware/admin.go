@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+)
+
+// RequireAdmin rejects authenticated users who are not admins; it must run after AuthenticateUser
+func RequireAdmin(isAdmin func(ctx context.Context, userID string) (bool, error)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				apperror.Write(w, r, apperror.ErrForbidden)
+				return
+			}
+
+			admin, err := isAdmin(r.Context(), userID)
+			if err != nil {
+				apperror.Write(w, r, fmt.Errorf("failed to check admin: %w", err))
+				return
+			}
+			if !admin {
+				apperror.Write(w, r, apperror.ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,14 +2,15 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/go-chi/render"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
 )
 
@@ -25,66 +26,106 @@ func NewAuthMiddleware(jwtSecret string) *AuthMiddleware {
 	}
 }
 
+// mfaTokenPurpose marks the short-lived token issued between the two steps of an MFA login
+const mfaTokenPurpose = "mfa"
+
+// mfaTokenTTL is how long the second step of an MFA login may take
+const mfaTokenTTL = 5 * time.Minute
+
 // UserClaims represents JWT claims for users
 type UserClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	// Purpose is empty for access tokens; other tokens do not authenticate requests
+	Purpose string `json:"purpose,omitempty"`
+	// PasswordVersion is the PasswordVersion of the user's password when the token was issued
+	PasswordVersion int64 `json:"pwv,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// PasswordVersion identifies a user's password by when it last changed, to the microsecond the
+// database keeps (0 if it never changed). Issue times are in whole seconds, too coarse to tell a
+// token issued just before a change from one issued just after.
+func PasswordVersion(passwordChangedAt *time.Time) int64 {
+	if passwordChangedAt == nil {
+		return 0
+	}
+	return passwordChangedAt.UnixMicro()
+}
+
 // AuthenticateUser middleware that verifies JWT token
 func (a *AuthMiddleware) AuthenticateUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract token from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			a.unauthorizedError(w, r, "missing authorization header")
+			apperror.Write(w, r, apperror.ErrUnauthorized)
 			return
 		}
 
 		// Check if header starts with "Bearer "
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			a.unauthorizedError(w, r, "invalid authorization header format")
+			apperror.Write(w, r, apperror.ErrUnauthorized)
 			return
 		}
 
 		tokenString := parts[1]
 
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// Verify signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return a.jwtSecret, nil
-		})
-
-		if err != nil {
-			a.unauthorizedError(w, r, fmt.Sprintf("invalid token: %v", err))
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(*UserClaims)
-		if !ok || !token.Valid {
-			a.unauthorizedError(w, r, "invalid token claims")
+		claims, err := a.parseToken(tokenString)
+		if err != nil || claims.Purpose != "" {
+			apperror.Write(w, r, apperror.ErrUnauthorized.Wrap(err))
 			return
 		}
 
 		// Add user info to request context
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "username", claims.Username)
+		ctx = context.WithValue(ctx, "password_version", claims.PasswordVersion)
+		logging.SetUserID(ctx, claims.UserID)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// GenerateToken generates a JWT token for a user
-func (a *AuthMiddleware) GenerateToken(userID, username string) (string, error) {
+// RejectRevokedTokens rejects tokens issued for an earlier password of the user and tokens of
+// deactivated users; it must run after AuthenticateUser
+func RejectRevokedTokens(passwordChangedAt func(ctx context.Context, userID string) (*time.Time, error)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				apperror.Write(w, r, err)
+				return
+			}
+
+			changedAt, err := passwordChangedAt(r.Context(), userID)
+			if err != nil {
+				if errors.Is(err, apperror.ErrUserNotFound) {
+					apperror.Write(w, r, apperror.ErrUnauthorized.Wrap(err))
+					return
+				}
+				apperror.Write(w, r, fmt.Errorf("failed to check token revocation: %w", err))
+				return
+			}
+
+			version, _ := r.Context().Value("password_version").(int64)
+			if version != PasswordVersion(changedAt) {
+				apperror.Write(w, r, apperror.ErrUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GenerateToken generates a JWT token for a user whose password last changed at passwordChangedAt
+func (a *AuthMiddleware) GenerateToken(userID, username string, passwordChangedAt *time.Time) (string, error) {
 	claims := UserClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:          userID,
+		Username:        username,
+		PasswordVersion: PasswordVersion(passwordChangedAt),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(timeutil.NowJST().Add(24 * time.Hour)), // 24 hours
 			IssuedAt:  jwt.NewNumericDate(timeutil.NowJST()),
@@ -96,11 +137,63 @@ func (a *AuthMiddleware) GenerateToken(userID, username string) (string, error)
 	return token.SignedString(a.jwtSecret)
 }
 
+// GenerateMFAToken generates the short-lived token that completes a login with a second factor.
+// challenge identifies the pending login step so that the token works only once.
+func (a *AuthMiddleware) GenerateMFAToken(userID, challenge string) (string, time.Time, error) {
+	now := timeutil.NowJST()
+	expiresAt := now.Add(mfaTokenTTL)
+	claims := UserClaims{
+		UserID:  userID,
+		Purpose: mfaTokenPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challenge,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "kasaneha",
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ParseMFAToken verifies a token from GenerateMFAToken and returns its user ID and challenge
+func (a *AuthMiddleware) ParseMFAToken(tokenString string) (string, string, error) {
+	claims, err := a.parseToken(tokenString)
+	if err != nil || claims.Purpose != mfaTokenPurpose || claims.ID == "" {
+		return "", "", apperror.ErrUnauthorized.Wrap(err)
+	}
+	return claims.UserID, claims.ID, nil
+}
+
+// parseToken verifies a token's signature and expiry and returns its claims
+func (a *AuthMiddleware) parseToken(tokenString string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
+		// Verify signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return a.jwtSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	return claims, nil
+}
+
 // GetUserIDFromContext extracts user ID from request context
 func GetUserIDFromContext(ctx context.Context) (string, error) {
 	userID, ok := ctx.Value("user_id").(string)
 	if !ok {
-		return "", fmt.Errorf("user_id not found in context")
+		return "", apperror.ErrUnauthorized
 	}
 	return userID, nil
 }
@@ -113,13 +206,3 @@ func GetUsernameFromContext(ctx context.Context) (string, error) {
 	}
 	return username, nil
 }
-
-func (a *AuthMiddleware) unauthorizedError(w http.ResponseWriter, r *http.Request, message string) {
-	w.WriteHeader(http.StatusUnauthorized)
-	render.JSON(w, r, types.ErrorResponse{
-		Error: types.ErrorDetail{
-			Code:    "UNAUTHORIZED",
-			Message: message,
-		},
-	})
-}
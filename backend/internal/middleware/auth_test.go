@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+)
+
+func TestRejectRevokedTokens(t *testing.T) {
+	auth := NewAuthMiddleware("test-secret")
+	var changedAt *time.Time
+	handler := auth.AuthenticateUser(RejectRevokedTokens(func(ctx context.Context, userID string) (*time.Time, error) {
+		if userID != "alice" {
+			return nil, apperror.ErrUserNotFound
+		}
+		return changedAt, nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	token := func(userID string) string {
+		token, err := auth.GenerateToken(userID, userID, changedAt)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		return token
+	}
+
+	original := token("alice")
+	if got := status(original); got != http.StatusNoContent {
+		t.Errorf("status with a current token = %d, want %d", got, http.StatusNoContent)
+	}
+
+	// Changes a few milliseconds apart fall in the same second as the tokens' issue times
+	first := time.Now().Truncate(time.Second)
+	changedAt = &first
+	if got := status(original); got != http.StatusUnauthorized {
+		t.Errorf("status with a token from before the change = %d, want %d", got, http.StatusUnauthorized)
+	}
+	afterFirst := token("alice")
+	if got := status(afterFirst); got != http.StatusNoContent {
+		t.Errorf("status with a token from after the change = %d, want %d", got, http.StatusNoContent)
+	}
+
+	second := first.Add(5 * time.Millisecond)
+	changedAt = &second
+	if got := status(afterFirst); got != http.StatusUnauthorized {
+		t.Errorf("status with a token from before a change in the same second = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := status(token("alice")); got != http.StatusNoContent {
+		t.Errorf("status with a token from after the second change = %d, want %d", got, http.StatusNoContent)
+	}
+
+	if got := status(token("bob")); got != http.StatusUnauthorized {
+		t.Errorf("status for a deactivated user = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct client", true, "198.51.100.7:4000", "203.0.113.1", "", "198.51.100.7"},
+		{"no trusted proxies", false, "10.0.0.2:4000", "203.0.113.1", "", "10.0.0.2"},
+		{"trusted proxy", true, "10.0.0.2:4000", "203.0.113.1", "", "203.0.113.1"},
+		{"spoofed leftmost entry", true, "10.0.0.2:4000", "1.2.3.4, 203.0.113.1", "", "203.0.113.1"},
+		{"chain of trusted proxies", true, "192.0.2.10:4000", "203.0.113.1, 10.0.0.3", "", "203.0.113.1"},
+		{"malformed entry", true, "10.0.0.2:4000", "not-an-ip", "", "10.0.0.2"},
+		{"real IP header", true, "10.0.0.2:4000", "", "203.0.113.9", "203.0.113.9"},
+		{"real IP from untrusted client", true, "198.51.100.7:4000", "", "203.0.113.9", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+
+			var got string
+			handler := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	for _, value := range []string{"nginx", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies(value); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", value)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// RequestValidator checks requests against the OpenAPI document before they reach the handlers
+type RequestValidator struct {
+	router  routers.Router
+	options *openapi3filter.Options
+}
+
+// NewRequestValidator creates a request validator for doc
+func NewRequestValidator(doc *openapi3.T) (*RequestValidator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	return &RequestValidator{
+		router: router,
+		options: &openapi3filter.Options{
+			MultiError: true,
+			// AuthenticateUser checks the token; the document only declares it
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			// Handlers apply their own defaults
+			SkipSettingDefaults: true,
+		},
+	}, nil
+}
+
+// ValidateRequest rejects requests whose parameters or body do not match the document.
+// Requests to routes the document does not describe are passed through.
+func (v *RequestValidator) ValidateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    v.options,
+		})
+		if err != nil {
+			if malformedBody(err) {
+				apperror.Write(w, r, apperror.ErrInvalidRequest.Wrap(err))
+				return
+			}
+			apperror.Write(w, r, apperror.ErrValidation.Wrap(err).WithDetails(fieldErrors(err)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fieldErrors flattens an error returned by openapi3filter into one entry per invalid field
+func fieldErrors(err error) []types.FieldError {
+	var fields []types.FieldError
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			fields = append(fields, fieldErrors(inner)...)
+		}
+	case *openapi3filter.RequestError:
+		in, name := "body", ""
+		if e.Parameter != nil {
+			in, name = e.Parameter.In, e.Parameter.Name
+		}
+		for _, schemaErr := range schemaErrors(e.Err) {
+			field := name
+			if pointer := schemaErr.JSONPointer(); len(pointer) > 0 && e.Parameter == nil {
+				field = strings.Join(pointer, ".")
+			}
+			fields = append(fields, types.FieldError{Field: field, In: in, Message: schemaErr.Reason})
+		}
+		if len(fields) == 0 {
+			message := e.Reason
+			if message == "" && e.Err != nil {
+				message = e.Err.Error()
+			}
+			fields = append(fields, types.FieldError{Field: name, In: in, Message: message})
+		}
+	default:
+		fields = append(fields, types.FieldError{Message: err.Error()})
+	}
+	return fields
+}
+
+// malformedBody reports whether err is about a request body that could not be decoded at all
+func malformedBody(err error) bool {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		return slices.ContainsFunc(e, malformedBody)
+	case *openapi3filter.RequestError:
+		var parseErr *openapi3filter.ParseError
+		return e.RequestBody != nil && errors.As(e.Err, &parseErr)
+	}
+	return false
+}
+
+// schemaErrors collects the schema violations wrapped in err
+func schemaErrors(err error) []*openapi3.SchemaError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var result []*openapi3.SchemaError
+		for _, inner := range e {
+			result = append(result, schemaErrors(inner)...)
+		}
+		return result
+	case *openapi3.SchemaError:
+		return []*openapi3.SchemaError{e}
+	}
+	return nil
+}
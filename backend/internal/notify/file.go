@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// FileNotifier writes emails to files in a directory instead of sending them, for local
+// development without an SMTP server
+type FileNotifier struct {
+	dir  string
+	from string
+}
+
+// NewFileNotifier creates a notifier that writes emails to dir
+func NewFileNotifier(dir, from string) *FileNotifier {
+	return &FileNotifier{dir: dir, from: from}
+}
+
+// Channel implements Notifier
+func (n *FileNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// Send implements Notifier
+func (n *FileNotifier) Send(ctx context.Context, recipient Recipient, msg Message) error {
+	if recipient.Email == "" {
+		return ErrNoAddress
+	}
+
+	if err := os.MkdirAll(n.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	file, err := os.CreateTemp(n.dir, "mail-*.eml")
+	if err != nil {
+		return fmt.Errorf("failed to create mail file: %w", err)
+	}
+
+	if _, err := file.Write(formatEmail(n.from, recipient.Email, msg)); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package notify delivers user-facing messages such as journaling reminders over pluggable channels.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Channel names
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelPush    = "push"
+)
+
+// ErrNoAddress is returned when the recipient has no address for the notifier's channel
+var ErrNoAddress = errors.New("recipient has no address for this channel")
+
+// Message is the content of a notification
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url,omitempty"`
+}
+
+// PushSubscription is a browser Push API subscription
+type PushSubscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// Recipient holds the addresses a user can be reached at
+type Recipient struct {
+	UserID            string
+	Username          string
+	Email             string
+	WebhookURL        string
+	PushSubscriptions []PushSubscription
+}
+
+// Notifier sends a message to a recipient over a single channel
+type Notifier interface {
+	// Channel returns the channel name, e.g. ChannelEmail
+	Channel() string
+	// Send delivers msg, returning ErrNoAddress if the recipient cannot be reached on this channel
+	Send(ctx context.Context, recipient Recipient, msg Message) error
+}
+
+// ExpiredSubscriptionsError reports push subscriptions the push service no longer accepts
+type ExpiredSubscriptionsError struct {
+	Endpoints []string
+}
+
+func (e *ExpiredSubscriptionsError) Error() string {
+	return fmt.Sprintf("%d push subscriptions have expired", len(e.Endpoints))
+}
+
+// Registry holds the configured notifiers by channel
+type Registry struct {
+	notifiers map[string]Notifier
+}
+
+// NewRegistry creates a registry of the given notifiers
+func NewRegistry(notifiers ...Notifier) *Registry {
+	registry := &Registry{notifiers: make(map[string]Notifier)}
+	for _, notifier := range notifiers {
+		registry.notifiers[notifier.Channel()] = notifier
+	}
+	return registry
+}
+
+// Get returns the notifier for a channel
+func (r *Registry) Get(channel string) (Notifier, bool) {
+	notifier, ok := r.notifiers[channel]
+	return notifier, ok
+}
+
+// Channels returns the names of the configured channels
+func (r *Registry) Channels() []string {
+	channels := make([]string, 0, len(r.notifiers))
+	for _, channel := range []string{ChannelEmail, ChannelWebhook, ChannelPush} {
+		if _, ok := r.notifiers[channel]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// headerSafe strips line breaks so that values can be used in mail headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the SMTP server settings
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPNotifier sends notifications by email
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+// NewSMTPNotifier creates a new SMTP notifier
+func NewSMTPNotifier(config SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{config: config}
+}
+
+// Channel implements Notifier
+func (n *SMTPNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// Send implements Notifier
+func (n *SMTPNotifier) Send(ctx context.Context, recipient Recipient, msg Message) error {
+	if recipient.Email == "" {
+		return ErrNoAddress
+	}
+
+	addr := net.JoinHostPort(n.config.Host, fmt.Sprintf("%d", n.config.Port))
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	// net/smtp has no context support; run it in the background and honor cancellation
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, n.config.From, []string{recipient.Email}, formatEmail(n.config.From, recipient.Email, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// formatEmail formats msg as a plain-text email
+func formatEmail(from, to string, msg Message) []byte {
+	body := msg.Body
+	if msg.URL != "" {
+		body += "\n\n" + msg.URL
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "From: %s\r\n", headerSafe(from))
+	fmt.Fprintf(&builder, "To: %s\r\n", headerSafe(to))
+	fmt.Fprintf(&builder, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerSafe(msg.Title)))
+	fmt.Fprintf(&builder, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	builder.WriteString("\r\n")
+	return []byte(builder.String())
+}
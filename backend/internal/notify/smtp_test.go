@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"mime"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what a fake SMTP server received in one session
+type smtpSession struct {
+	from       string
+	recipients []string
+	data       string
+}
+
+// startFakeSMTP accepts one SMTP session on a local port and returns the port and the session,
+// which is available once the client quits
+func startFakeSMTP(t *testing.T) (int, <-chan smtpSession) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var session smtpSession
+		text.PrintfLine("220 localhost fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				text.PrintfLine("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = line[len("MAIL FROM:"):]
+				text.PrintfLine("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.recipients = append(session.recipients, line[len("RCPT TO:"):])
+				text.PrintfLine("250 OK")
+			case command == "DATA":
+				text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				session.data = string(data)
+				text.PrintfLine("250 OK")
+			case command == "QUIT":
+				text.PrintfLine("221 Bye")
+				sessions <- session
+				return
+			default:
+				text.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func TestSMTPNotifierSend(t *testing.T) {
+	port, sessions := startFakeSMTP(t)
+	notifier := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: port, From: "kasaneha@example.com"})
+
+	msg := Message{
+		Title: "今日の日記を書きませんか？",
+		Body:  "aliceさん、今日はどんな一日でしたか？\n二行目",
+		URL:   "https://kasaneha.example.com/",
+	}
+	if err := notifier.Send(context.Background(), Recipient{Email: "alice@example.com"}, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	session := <-sessions
+
+	if session.from != "<kasaneha@example.com>" {
+		t.Errorf("MAIL FROM = %q, want <kasaneha@example.com>", session.from)
+	}
+	if len(session.recipients) != 1 || session.recipients[0] != "<alice@example.com>" {
+		t.Errorf("RCPT TO = %q, want <alice@example.com>", session.recipients)
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(session.data)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("ReadMIMEHeader: %v", err)
+	}
+	if header.Get("From") != "kasaneha@example.com" || header.Get("To") != "alice@example.com" {
+		t.Errorf("From/To = %q/%q", header.Get("From"), header.Get("To"))
+	}
+	if header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+
+	// The subject is Q-encoded UTF-8
+	subject := header.Get("Subject")
+	if !strings.HasPrefix(subject, "=?utf-8?q?") {
+		t.Errorf("Subject = %q, want a Q-encoded word", subject)
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err != nil || decoded != msg.Title {
+		t.Errorf("decoded Subject = %q, %v, want %q", decoded, err, msg.Title)
+	}
+
+	body := strings.Join(strings.SplitAfter(session.data, "\n\n")[1:], "")
+	if !strings.Contains(body, "二行目\n\nhttps://kasaneha.example.com/") {
+		t.Errorf("body = %q, want the message followed by the link", body)
+	}
+}
+
+func TestSMTPNotifierSendWithoutAddress(t *testing.T) {
+	notifier := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: 1, From: "kasaneha@example.com"})
+	if err := notifier.Send(context.Background(), Recipient{}, Message{Title: "title"}); !errors.Is(err, ErrNoAddress) {
+		t.Errorf("Send error = %v, want %v", err, ErrNoAddress)
+	}
+}
+
+func TestFormatEmailStripsHeaderInjection(t *testing.T) {
+	email := string(formatEmail("kasaneha@example.com", "alice@example.com\r\nBcc: eve@example.com", Message{Title: "hi\r\nBcc: eve@example.com"}))
+	header, _, _ := strings.Cut(email, "\r\n\r\n")
+	for _, line := range strings.Split(header, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("header injection succeeded: %q", header)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+)
+
+// webhookTimeout bounds a single webhook request
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier posts notifications as JSON to a user-provided URL. Internal addresses are refused
+// and redirects are not followed.
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a new webhook notifier
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		client: netguard.NewClient(webhookTimeout),
+	}
+}
+
+// webhookPayload is the JSON body posted to the webhook URL.
+// "text" makes the payload usable with Slack/Discord-style incoming webhooks as is.
+type webhookPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url,omitempty"`
+	Text  string `json:"text"`
+}
+
+// Channel implements Notifier
+func (n *WebhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+// Send implements Notifier
+func (n *WebhookNotifier) Send(ctx context.Context, recipient Recipient, msg Message) error {
+	if recipient.WebhookURL == "" {
+		return ErrNoAddress
+	}
+
+	text := msg.Title + "\n" + msg.Body
+	if msg.URL != "" {
+		text += "\n" + msg.URL
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Title: msg.Title,
+		Body:  msg.Body,
+		URL:   msg.URL,
+		Text:  text,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, recipient.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
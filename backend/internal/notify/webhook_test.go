@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+)
+
+func TestWebhookNotifierRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier().Send(context.Background(), Recipient{WebhookURL: server.URL}, Message{Title: "title", Body: "body"})
+	if !errors.Is(err, netguard.ErrBlockedAddress) {
+		t.Errorf("Send error = %v, want %v", err, netguard.ErrBlockedAddress)
+	}
+	if called {
+		t.Error("the loopback server received the webhook")
+	}
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+)
+
+// pushTTL is how long, in seconds, the push service keeps an undelivered reminder
+const pushTTL = 12 * 60 * 60
+
+// pushTimeout bounds a single request to a push service
+const pushTimeout = 10 * time.Second
+
+// WebPushConfig holds the VAPID key pair and contact used to sign push requests
+type WebPushConfig struct {
+	PublicKey  string
+	PrivateKey string
+	// Subject is a mailto: or https: contact for the push service operator
+	Subject string
+}
+
+// WebPushNotifier sends notifications to browsers through the Web Push protocol
+type WebPushNotifier struct {
+	config WebPushConfig
+	client *http.Client
+}
+
+// NewWebPushNotifier creates a new Web Push notifier. Subscription endpoints come from users, so
+// requests only go to public addresses.
+func NewWebPushNotifier(config WebPushConfig) *WebPushNotifier {
+	return &WebPushNotifier{
+		config: config,
+		client: netguard.NewClient(pushTimeout),
+	}
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (n *WebPushNotifier) PublicKey() string {
+	return n.config.PublicKey
+}
+
+// Channel implements Notifier
+func (n *WebPushNotifier) Channel() string {
+	return ChannelPush
+}
+
+// Send implements Notifier. It delivers to every subscription and reports the ones that expired
+// with an *ExpiredSubscriptionsError so that the caller can remove them.
+func (n *WebPushNotifier) Send(ctx context.Context, recipient Recipient, msg Message) error {
+	if len(recipient.PushSubscriptions) == 0 {
+		return ErrNoAddress
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push payload: %w", err)
+	}
+
+	var expired []string
+	var lastErr error
+	delivered := 0
+
+	for _, subscription := range recipient.PushSubscriptions {
+		resp, err := webpush.SendNotificationWithContext(ctx, payload, &webpush.Subscription{
+			Endpoint: subscription.Endpoint,
+			Keys: webpush.Keys{
+				P256dh: subscription.P256dh,
+				Auth:   subscription.Auth,
+			},
+		}, &webpush.Options{
+			HTTPClient:      n.client,
+			Subscriber:      n.config.Subject,
+			VAPIDPublicKey:  n.config.PublicKey,
+			VAPIDPrivateKey: n.config.PrivateKey,
+			TTL:             pushTTL,
+			Urgency:         webpush.UrgencyNormal,
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound:
+			expired = append(expired, subscription.Endpoint)
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			lastErr = fmt.Errorf("push service returned status %d", resp.StatusCode)
+		default:
+			delivered++
+		}
+	}
+
+	if len(expired) > 0 {
+		return &ExpiredSubscriptionsError{Endpoints: expired}
+	}
+	if delivered == 0 && lastErr != nil {
+		return fmt.Errorf("failed to send push notification: %w", lastErr)
+	}
+
+	return nil
+}
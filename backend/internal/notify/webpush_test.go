@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+)
+
+func TestWebPushNotifierRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("GenerateVAPIDKeys: %v", err)
+	}
+	notifier := NewWebPushNotifier(WebPushConfig{PublicKey: publicKey, PrivateKey: privateKey, Subject: "mailto:admin@example.com"})
+
+	// A browser's subscription keys, so that the payload can be encrypted
+	browserKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	subscription := PushSubscription{
+		Endpoint: server.URL + "/push",
+		P256dh:   base64.RawURLEncoding.EncodeToString(browserKey.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}
+
+	err = notifier.Send(context.Background(), Recipient{PushSubscriptions: []PushSubscription{subscription}}, Message{Title: "title", Body: "body"})
+	if !errors.Is(err, netguard.ErrBlockedAddress) {
+		t.Errorf("Send error = %v, want %v", err, netguard.ErrBlockedAddress)
+	}
+	if called {
+		t.Error("the loopback server received the push")
+	}
+}
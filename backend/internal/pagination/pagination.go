@@ -0,0 +1,89 @@
+// Package pagination encodes keyset cursors and the Link headers pointing at the next page.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ErrInvalidCursor is returned for malformed cursors and cursors issued for another sort order
+var ErrInvalidCursor = apperror.ErrInvalidCursor
+
+// uuidPattern matches the row IDs cursors carry
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Encode turns a cursor into an opaque URL-safe string
+func Encode(cursor types.PageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor returned by Encode and checks it was issued for sort. Cursors are opaque
+// but not signed, so the ID and sort key are checked to be values the listing queries can compare.
+func Decode(value, sort string) (*types.PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor types.PageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || !uuidPattern.MatchString(cursor.ID) {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Value, err = normalizeValue(sort, cursor.Value); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// normalizeValue checks that a cursor's sort key parses as the type of the column sort orders by,
+// and returns it in the form PostgreSQL reads back as that type
+func normalizeValue(sort, value string) (string, error) {
+	switch strings.TrimPrefix(sort, "-") {
+	case types.SortDateAsc:
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil || date.Year() < 1 {
+			return "", ErrInvalidCursor
+		}
+		return date.Format(time.DateOnly), nil
+	case types.SortUpdatedAsc:
+		timestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil || timestamp.UTC().Year() < 1 {
+			return "", ErrInvalidCursor
+		}
+		return timestamp.UTC().Format(time.RFC3339Nano), nil
+	case types.SortTensionAsc:
+		// The column is a 32-bit integer
+		score, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return "", ErrInvalidCursor
+		}
+		return strconv.FormatInt(score, 10), nil
+	default:
+		return "", ErrInvalidCursor
+	}
+}
+
+// SetLinkHeader points the Link header at the next page, keeping the other query parameters of the request
+func SetLinkHeader(w http.ResponseWriter, r *http.Request, nextCursor *string) {
+	if nextCursor == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", *nextCursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+}
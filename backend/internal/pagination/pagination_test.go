@@ -0,0 +1,63 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+const testID = "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		cursor    types.PageCursor
+		sort      string
+		wantValue string
+		wantErr   bool
+	}{
+		{"date", types.PageCursor{Sort: "-date", Value: "2026-01-31", ID: testID}, "-date", "2026-01-31", false},
+		{"timestamp", types.PageCursor{Sort: "updated_at", Value: "2026-01-31T12:00:00.5Z", ID: testID}, "updated_at", "2026-01-31T12:00:00.5Z", false},
+		{"timestamp in another zone", types.PageCursor{Sort: "updated_at", Value: "2026-01-31T21:00:00+09:00", ID: testID}, "updated_at", "2026-01-31T12:00:00Z", false},
+		{"score", types.PageCursor{Sort: "-tension_score", Value: "42", ID: testID}, "-tension_score", "42", false},
+		{"upper-case ID", types.PageCursor{Sort: "date", Value: "2026-01-31", ID: "6F1C2A8E-3B4D-4E5F-8A9B-0C1D2E3F4A5B"}, "date", "2026-01-31", false},
+		{"another sort", types.PageCursor{Sort: "date", Value: "2026-01-31", ID: testID}, "-date", "", true},
+		{"unknown sort", types.PageCursor{Sort: "title", Value: "a", ID: testID}, "title", "", true},
+		{"missing ID", types.PageCursor{Sort: "date", Value: "2026-01-31"}, "date", "", true},
+		{"ID not a UUID", types.PageCursor{Sort: "date", Value: "2026-01-31", ID: "1' OR '1'='1"}, "date", "", true},
+		{"missing value", types.PageCursor{Sort: "date", ID: testID}, "date", "", true},
+		{"invalid date", types.PageCursor{Sort: "date", Value: "2026-02-30", ID: testID}, "date", "", true},
+		{"year zero", types.PageCursor{Sort: "date", Value: "0000-01-01", ID: testID}, "date", "", true},
+		{"date for a timestamp", types.PageCursor{Sort: "updated_at", Value: "2026-01-31", ID: testID}, "updated_at", "", true},
+		{"timestamp for a date", types.PageCursor{Sort: "date", Value: "2026-01-31T12:00:00Z", ID: testID}, "date", "", true},
+		{"non-numeric score", types.PageCursor{Sort: "tension_score", Value: "high", ID: testID}, "tension_score", "", true},
+		{"score out of range", types.PageCursor{Sort: "tension_score", Value: "4294967296", ID: testID}, "tension_score", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := Decode(Encode(tt.cursor), tt.sort)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Errorf("Decode = %+v, %v, want invalid cursor", cursor, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if cursor.Value != tt.wantValue || cursor.ID != tt.cursor.ID {
+				t.Errorf("Decode = %+v, want value %q and ID %q", cursor, tt.wantValue, tt.cursor.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, value := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("not json"))} {
+		if _, err := Decode(value, "date"); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Decode(%q) error = %v, want invalid cursor", value, err)
+		}
+	}
+}
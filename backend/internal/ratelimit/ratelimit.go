@@ -0,0 +1,93 @@
+// Package ratelimit implements token-bucket rate limits over pluggable stores.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Per. The bucket holds up to Requests tokens and refills
+// continuously, so bursts up to Requests are allowed. The zero Limit is unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses "<requests>/<duration>", e.g. "20/1m". An empty string or "off" is the unlimited Limit.
+func ParseLimit(value string) (Limit, error) {
+	if value = strings.TrimSpace(value); value == "" || value == "off" {
+		return Limit{}, nil
+	}
+
+	requestsStr, perStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected <requests>/<duration>", value)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(requestsStr))
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", value)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(perStr))
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: duration must be positive", value)
+	}
+
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// Unlimited reports whether the limit lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// tokensPerSecond is the refill rate of the bucket
+func (l Limit) tokensPerSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left after the request
+	Remaining int
+	// RetryAfter is how long until a token is available; zero when Allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take removes a token from the bucket for key, refilled according to limit
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// refill returns the tokens in a bucket last updated elapsed ago
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.tokensPerSecond())
+}
+
+// result describes a bucket left with tokens after a request
+func result(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.tokensPerSecond()
+	res := Result{
+		Allowed:    allowed,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: secondsToDuration((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisURLEnv points the Redis store tests at a server whose keys they may create
+const redisURLEnv = "REDIS_TEST_URL"
+
+type clockedStore interface {
+	Store
+	SetClock(now func() time.Time)
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "20/1m", want: Limit{Requests: 20, Per: time.Minute}},
+		{value: " 5 / 10s ", want: Limit{Requests: 5, Per: 10 * time.Second}},
+		{value: "", want: Limit{}},
+		{value: "off", want: Limit{}},
+		{value: "20", wantErr: true},
+		{value: "0/1m", wantErr: true},
+		{value: "x/1m", wantErr: true},
+		{value: "20/0s", wantErr: true},
+		{value: "20/minute", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLimit(%q) = %+v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLimit(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	url := os.Getenv(redisURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", redisURLEnv)
+	}
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("ParseURL: %v", err)
+	}
+	client := redis.NewClient(options)
+	t.Cleanup(func() { client.Close() })
+
+	testStore(t, NewRedisStore(client, "kasaneha-test:"+strconv.FormatInt(time.Now().UnixNano(), 10)+":"))
+}
+
+// testStore checks the token bucket behavior every store must share
+func testStore(t *testing.T, store clockedStore) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	limit := Limit{Requests: 3, Per: 30 * time.Second}
+
+	take := func(key string) Result {
+		t.Helper()
+		result, err := store.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		return result
+	}
+
+	// A full bucket allows a burst of Requests
+	for want := 2; want >= 0; want-- {
+		result := take("alice")
+		if !result.Allowed || result.Remaining != want {
+			t.Fatalf("got allowed=%v remaining=%d, want allowed with %d remaining", result.Allowed, result.Remaining, want)
+		}
+	}
+
+	result := take("alice")
+	if result.Allowed {
+		t.Fatalf("request over the burst was allowed")
+	}
+	if result.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %v, want 10s", result.RetryAfter)
+	}
+	if result.ResetAfter != 30*time.Second {
+		t.Errorf("ResetAfter = %v, want 30s", result.ResetAfter)
+	}
+
+	// Other keys have their own buckets
+	if result := take("bob"); !result.Allowed {
+		t.Errorf("another key was limited")
+	}
+
+	// One token refills every 10s
+	now = now.Add(10 * time.Second)
+	if result := take("alice"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got allowed=%v remaining=%d after a refill, want allowed with 0 remaining", result.Allowed, result.Remaining)
+	}
+	if result := take("alice"); result.Allowed {
+		t.Errorf("request after the refilled token was used was allowed")
+	}
+
+	// The bucket never holds more than Requests
+	now = now.Add(time.Hour)
+	if result := take("alice"); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("got allowed=%v remaining=%d after idling, want allowed with 2 remaining", result.Allowed, result.Remaining)
+	}
+}
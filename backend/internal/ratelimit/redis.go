@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket atomically. The bucket is a hash of its tokens and the
+// time of the last update in milliseconds, and expires once it would be full again.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+	tokens = capacity
+	updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps buckets in Redis so that all API instances share the limits
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisStore creates a store on client; keys are prefixed with prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces the store's clock, for tests
+func (s *RedisStore) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Take removes a token from the bucket for key
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tokensPerMillisecond := limit.tokensPerSecond() / 1000
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, strconv.FormatFloat(tokensPerMillisecond, 'g', -1, 64), s.now().UnixMilli(),
+	).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("failed to take rate limit token: unexpected reply %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return result(limit, tokens, allowed == 1), nil
+}
@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// AlertRepository handles alert settings and notification data operations
+type AlertRepository struct {
+	db *Database
+}
+
+// NewAlertRepository creates a new alert repository
+func NewAlertRepository(db *Database) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+// GetAlertSettings retrieves a user's alert settings, or nil if the user has not configured them
+func (r *AlertRepository) GetAlertSettings(ctx context.Context, userID string) (*types.AlertSettings, error) {
+	query := `
+		SELECT user_id, enabled, decline_days, decline_min_drop, sudden_drop_points,
+		       missed_days, low_score_threshold, acknowledge_in_chat, updated_at
+		FROM alert_settings
+		WHERE user_id = $1
+	`
+
+	var settings types.AlertSettings
+	row := r.db.conn().QueryRow(ctx, query, userID)
+
+	err := row.Scan(
+		&settings.UserID,
+		&settings.Enabled,
+		&settings.DeclineDays,
+		&settings.DeclineMinDrop,
+		&settings.SuddenDropPoints,
+		&settings.MissedDays,
+		&settings.LowScoreThreshold,
+		&settings.AcknowledgeInChat,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Defaults apply
+		}
+		return nil, fmt.Errorf("failed to get alert settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpsertAlertSettings creates or replaces a user's alert settings
+func (r *AlertRepository) UpsertAlertSettings(ctx context.Context, settings *types.AlertSettings) (*types.AlertSettings, error) {
+	query := `
+		INSERT INTO alert_settings (
+			user_id, enabled, decline_days, decline_min_drop, sudden_drop_points,
+			missed_days, low_score_threshold, acknowledge_in_chat
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			decline_days = EXCLUDED.decline_days,
+			decline_min_drop = EXCLUDED.decline_min_drop,
+			sudden_drop_points = EXCLUDED.sudden_drop_points,
+			missed_days = EXCLUDED.missed_days,
+			low_score_threshold = EXCLUDED.low_score_threshold,
+			acknowledge_in_chat = EXCLUDED.acknowledge_in_chat
+		RETURNING updated_at
+	`
+
+	result := *settings
+	err := r.db.conn().QueryRow(ctx, query,
+		settings.UserID,
+		settings.Enabled,
+		settings.DeclineDays,
+		settings.DeclineMinDrop,
+		settings.SuddenDropPoints,
+		settings.MissedDays,
+		settings.LowScoreThreshold,
+		settings.AcknowledgeInChat,
+	).Scan(&result.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save alert settings: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetAlertUserIDs retrieves active users who have not opted out of alerts
+func (r *AlertRepository) GetAlertUserIDs(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		LEFT JOIN alert_settings s ON u.id = s.user_id
+		WHERE u.is_active = true
+		  AND COALESCE(s.enabled, true) = true
+	`
+
+	rows, err := r.db.conn().Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
+// CreateNotification creates a new notification
+func (r *AlertRepository) CreateNotification(ctx context.Context, userID, notificationType, title, body string, data map[string]interface{}) (*types.Notification, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification data: %w", err)
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, type, title, body, data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, type, title, body, data, read_at, acknowledged_in_chat_at, created_at
+	`
+
+	var notification types.Notification
+	row := r.db.conn().QueryRow(ctx, query, userID, notificationType, title, body, dataJSON)
+
+	err = row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Type,
+		&notification.Title,
+		&notification.Body,
+		&notification.Data,
+		&notification.ReadAt,
+		&notification.AcknowledgedInChatAt,
+		&notification.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return &notification, nil
+}
+
+// HasRecentNotification checks whether a notification of the type was created for the same key or since the given time
+func (r *AlertRepository) HasRecentNotification(ctx context.Context, userID, notificationType, key string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM notifications
+			WHERE user_id = $1
+			  AND type = $2
+			  AND (data->>'key' = $3 OR created_at >= $4)
+		)
+	`
+
+	var exists bool
+	err := r.db.conn().QueryRow(ctx, query, userID, notificationType, key, since).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check recent notifications: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetNotifications retrieves a user's notifications, newest first
+func (r *AlertRepository) GetNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]types.Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, body, data, read_at, acknowledged_in_chat_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		  AND ($2 = false OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []types.Notification{}
+	for rows.Next() {
+		var notification types.Notification
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Type,
+			&notification.Title,
+			&notification.Body,
+			&notification.Data,
+			&notification.ReadAt,
+			&notification.AcknowledgedInChatAt,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func (r *AlertRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.conn().QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkNotificationRead marks a user's notification as read
+func (r *AlertRepository) MarkNotificationRead(ctx context.Context, userID, notificationID string) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.conn().Exec(ctx, query, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperror.ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+// GetChatAcknowledgement returns the newest alert since the given time that has not been acknowledged
+// in chat yet, or nil if there is none
+func (r *AlertRepository) GetChatAcknowledgement(ctx context.Context, userID string, since time.Time) (*types.Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, body, data, read_at, acknowledged_in_chat_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		  AND type LIKE 'alert.%'
+		  AND acknowledged_in_chat_at IS NULL
+		  AND created_at >= $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var notification types.Notification
+	row := r.db.conn().QueryRow(ctx, query, userID, since)
+
+	err := row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Type,
+		&notification.Title,
+		&notification.Body,
+		&notification.Data,
+		&notification.ReadAt,
+		&notification.AcknowledgedInChatAt,
+		&notification.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Nothing to acknowledge
+		}
+		return nil, fmt.Errorf("failed to get chat acknowledgement: %w", err)
+	}
+
+	return &notification, nil
+}
+
+// MarkAcknowledgedInChat records that an alert was acknowledged in a first message
+func (r *AlertRepository) MarkAcknowledgedInChat(ctx context.Context, notificationID string) error {
+	query := `
+		UPDATE notifications
+		SET acknowledged_in_chat_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND acknowledged_in_chat_at IS NULL
+	`
+
+	if _, err := r.db.conn().Exec(ctx, query, notificationID); err != nil {
+		return fmt.Errorf("failed to mark alert as acknowledged: %w", err)
+	}
+
+	return nil
+}
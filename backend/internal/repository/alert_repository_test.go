@@ -0,0 +1,154 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestAlertRepositorySettings(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAlertRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+
+	if settings, err := repo.GetAlertSettings(ctx, alice.ID); err != nil || settings != nil {
+		t.Fatalf("GetAlertSettings before saving = %+v, %v, want nil", settings, err)
+	}
+
+	settings := &types.AlertSettings{
+		UserID:            alice.ID,
+		Enabled:           false,
+		DeclineDays:       4,
+		DeclineMinDrop:    20,
+		SuddenDropPoints:  30,
+		MissedDays:        3,
+		LowScoreThreshold: 30,
+		AcknowledgeInChat: false,
+	}
+	saved, err := repo.UpsertAlertSettings(ctx, settings)
+	if err != nil {
+		t.Fatalf("UpsertAlertSettings: %v", err)
+	}
+	if saved.UpdatedAt.IsZero() {
+		t.Errorf("updated_at was not returned")
+	}
+
+	settings.DeclineDays = 5
+	if _, err := repo.UpsertAlertSettings(ctx, settings); err != nil {
+		t.Fatalf("UpsertAlertSettings (update): %v", err)
+	}
+	found, err := repo.GetAlertSettings(ctx, alice.ID)
+	if err != nil || found == nil || found.DeclineDays != 5 || found.Enabled {
+		t.Errorf("GetAlertSettings = %+v, %v, want the updated settings", found, err)
+	}
+
+	settings.DeclineDays = 1
+	if _, err := repo.UpsertAlertSettings(ctx, settings); err == nil {
+		t.Errorf("UpsertAlertSettings accepted decline_days outside 2-14")
+	}
+
+	// Alice opted out; Bob has no settings and gets alerts by default
+	userIDs, err := repo.GetAlertUserIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetAlertUserIDs: %v", err)
+	}
+	if len(userIDs) != 1 || userIDs[0] != bob.ID {
+		t.Errorf("alert users = %v, want only %s", userIDs, bob.ID)
+	}
+}
+
+func TestAlertRepositoryNotifications(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAlertRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+
+	first, err := repo.CreateNotification(ctx, alice.ID, "alert.decline", "下がり気味", "最近下がっています", map[string]interface{}{"key": "decline:2024-03-10"})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	second, err := repo.CreateNotification(ctx, alice.ID, "reminder", "リマインド", "今日の日記", nil)
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if recent, err := repo.HasRecentNotification(ctx, alice.ID, "alert.decline", "decline:2024-03-10", future); err != nil || !recent {
+		t.Errorf("HasRecentNotification(same key) = %v, %v, want true", recent, err)
+	}
+	if recent, err := repo.HasRecentNotification(ctx, alice.ID, "alert.decline", "decline:2024-03-11", future); err != nil || recent {
+		t.Errorf("HasRecentNotification(new key) = %v, %v, want false", recent, err)
+	}
+	if recent, err := repo.HasRecentNotification(ctx, alice.ID, "alert.decline", "decline:2024-03-11", time.Now().Add(-time.Hour)); err != nil || !recent {
+		t.Errorf("HasRecentNotification(within the window) = %v, %v, want true", recent, err)
+	}
+
+	notifications, err := repo.GetNotifications(ctx, alice.ID, false, 10)
+	if err != nil {
+		t.Fatalf("GetNotifications: %v", err)
+	}
+	if len(notifications) != 2 || notifications[0].ID != second.ID {
+		t.Errorf("notifications = %+v, want both newest first", notifications)
+	}
+	if count, err := repo.CountUnreadNotifications(ctx, alice.ID); err != nil || count != 2 {
+		t.Errorf("CountUnreadNotifications = %d, %v, want 2", count, err)
+	}
+
+	if err := repo.MarkNotificationRead(ctx, bob.ID, first.ID); !errors.Is(err, apperror.ErrNotificationNotFound) {
+		t.Errorf("MarkNotificationRead by another user error = %v, want notification not found", err)
+	}
+	if err := repo.MarkNotificationRead(ctx, alice.ID, first.ID); err != nil {
+		t.Fatalf("MarkNotificationRead: %v", err)
+	}
+	unread, err := repo.GetNotifications(ctx, alice.ID, true, 10)
+	if err != nil || len(unread) != 1 || unread[0].ID != second.ID {
+		t.Errorf("unread notifications = %+v, %v, want only %s", unread, err, second.ID)
+	}
+	if count, err := repo.CountUnreadNotifications(ctx, alice.ID); err != nil || count != 1 {
+		t.Errorf("CountUnreadNotifications = %d, %v, want 1", count, err)
+	}
+}
+
+func TestAlertRepositoryChatAcknowledgement(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAlertRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	since := time.Now().Add(-time.Hour)
+
+	if _, err := repo.CreateNotification(ctx, user.ID, "reminder", "リマインド", "今日の日記", nil); err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	if found, err := repo.GetChatAcknowledgement(ctx, user.ID, since); err != nil || found != nil {
+		t.Errorf("found a notification that is not an alert: %+v, %v", found, err)
+	}
+
+	alert, err := repo.CreateNotification(ctx, user.ID, "alert.low_score", "低め", "低い日が続いています", nil)
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	found, err := repo.GetChatAcknowledgement(ctx, user.ID, since)
+	if err != nil || found == nil || found.ID != alert.ID || found.AcknowledgedInChatAt != nil {
+		t.Fatalf("GetChatAcknowledgement = %+v, %v, want %s", found, err, alert.ID)
+	}
+
+	// Looking it up does not use it up; marking it does
+	if again, err := repo.GetChatAcknowledgement(ctx, user.ID, since); err != nil || again == nil {
+		t.Errorf("GetChatAcknowledgement again = %+v, %v, want %s", again, err, alert.ID)
+	}
+	if err := repo.MarkAcknowledgedInChat(ctx, alert.ID); err != nil {
+		t.Fatalf("MarkAcknowledgedInChat: %v", err)
+	}
+	if again, err := repo.GetChatAcknowledgement(ctx, user.ID, since); err != nil || again != nil {
+		t.Errorf("alert was acknowledged twice: %+v, %v", again, err)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
 )
@@ -58,7 +60,7 @@ func (r *AnalysisRepository) CreateAnalysis(ctx context.Context, analysis *types
 	`
 
 	var result types.Analysis
-	row := r.db.Pool.QueryRow(
+	row := r.db.conn().QueryRow(
 		ctx, query,
 		analysis.SessionID,
 		analysis.Summary,
@@ -99,7 +101,7 @@ func (r *AnalysisRepository) GetAnalysisBySessionID(ctx context.Context, session
 	`
 
 	var analysis types.Analysis
-	row := r.db.Pool.QueryRow(ctx, query, sessionID)
+	row := r.db.conn().QueryRow(ctx, query, sessionID)
 
 	err := row.Scan(
 		&analysis.ID,
@@ -140,7 +142,7 @@ func (r *AnalysisRepository) GetTensionScores(ctx context.Context, userID string
 		LIMIT $4
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, userID, startDate, endDate, limit)
+	rows, err := r.db.conn().Query(ctx, query, userID, startDate, endDate, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tension scores: %w", err)
 	}
@@ -166,7 +168,108 @@ func (r *AnalysisRepository) GetTensionScores(ctx context.Context, userID string
 	return scores, nil
 }
 
-// GetTensionStatistics calculates tension score statistics for a user
+// GetEmotionalStates retrieves stored emotional states for a user within a date range
+func (r *AnalysisRepository) GetEmotionalStates(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.EmotionalStateRecord, error) {
+	query := `
+		SELECT 
+			cs.session_date::text as date,
+			a.session_id,
+			a.emotional_state
+		FROM analyses a
+		JOIN chat_sessions cs ON a.session_id = cs.id
+		WHERE cs.user_id = $1 
+		  AND cs.session_date >= $2 
+		  AND cs.session_date <= $3
+		ORDER BY cs.session_date ASC
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get emotional states: %w", err)
+	}
+	defer rows.Close()
+
+	var records []types.EmotionalStateRecord
+	for rows.Next() {
+		var record types.EmotionalStateRecord
+		err := rows.Scan(&record.Date, &record.SessionID, &record.EmotionalState)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan emotional state: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// GetTensionFactorSamples retrieves analyzed days with their keywords, message topics and mentioned entities
+func (r *AnalysisRepository) GetTensionFactorSamples(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.TensionFactorSample, error) {
+	query := `
+		SELECT 
+			cs.session_date::text as date,
+			a.session_id,
+			a.tension_score,
+			COALESCE(a.keywords, '[]'::jsonb),
+			COALESCE((
+				SELECT array_agg(DISTINCT topic)
+				FROM messages m,
+				     jsonb_array_elements_text(
+				         CASE WHEN jsonb_typeof(m.metadata->'annotation'->'topics') = 'array'
+				              THEN m.metadata->'annotation'->'topics'
+				              ELSE '[]'::jsonb END
+				     ) AS topic
+				WHERE m.session_id = a.session_id
+			), '{}') as topics,
+			COALESCE((
+				SELECT array_agg(e.kind || ':' || e.name)
+				FROM entity_mentions em
+				JOIN entities e ON em.entity_id = e.id
+				WHERE em.session_id = a.session_id
+			), '{}') as entities
+		FROM analyses a
+		JOIN chat_sessions cs ON a.session_id = cs.id
+		WHERE cs.user_id = $1 
+		  AND cs.session_date >= $2 
+		  AND cs.session_date <= $3
+		ORDER BY cs.session_date ASC
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tension factor samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []types.TensionFactorSample
+	for rows.Next() {
+		var sample types.TensionFactorSample
+		var keywordsJSON []byte
+
+		err := rows.Scan(
+			&sample.Date,
+			&sample.SessionID,
+			&sample.TensionScore,
+			&keywordsJSON,
+			&sample.Topics,
+			&sample.Entities,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tension factor sample: %w", err)
+		}
+
+		if err := json.Unmarshal(keywordsJSON, &sample.Keywords); err != nil {
+			// Keywords are free-form AI output; treat anything that is not a string array as empty
+			sample.Keywords = nil
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// GetTensionStatistics calculates the average, minimum and maximum tension score of a user; the trend
+// and the other time-series fields are left for the service to compute
 func (r *AnalysisRepository) GetTensionStatistics(ctx context.Context, userID string, days int) (*types.TensionStatistics, error) {
 	endDate := timeutil.NowJST()
 	startDate := endDate.AddDate(0, 0, -days)
@@ -188,65 +291,20 @@ func (r *AnalysisRepository) GetTensionStatistics(ctx context.Context, userID st
 	var minScore, maxScore *int
 	var count int
 
-	row := r.db.Pool.QueryRow(ctx, query, userID, startDate, endDate)
+	row := r.db.conn().QueryRow(ctx, query, userID, startDate, endDate)
 	err := row.Scan(&avg, &minScore, &maxScore, &count)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tension statistics: %w", err)
 	}
 
 	if count == 0 {
-		return &types.TensionStatistics{
-			Average: 0,
-			Min:     0,
-			Max:     0,
-			Trend:   "stable",
-		}, nil
-	}
-
-	// Calculate trend by comparing recent vs older scores
-	trend := "stable"
-	if count >= 7 { // Need at least a week of data
-		trendQuery := `
-			WITH recent_scores AS (
-				SELECT AVG(a.tension_score) as avg_score
-				FROM analyses a
-				JOIN chat_sessions cs ON a.session_id = cs.id
-				WHERE cs.user_id = $1 
-				  AND cs.session_date >= $2
-			),
-			older_scores AS (
-				SELECT AVG(a.tension_score) as avg_score
-				FROM analyses a
-				JOIN chat_sessions cs ON a.session_id = cs.id
-				WHERE cs.user_id = $1 
-				  AND cs.session_date >= $3
-				  AND cs.session_date < $2
-			)
-			SELECT 
-				recent_scores.avg_score - COALESCE(older_scores.avg_score, recent_scores.avg_score) as trend_diff
-			FROM recent_scores
-			LEFT JOIN older_scores ON true
-		`
-
-		recentDate := endDate.AddDate(0, 0, -3)     // Last 3 days
-		olderStartDate := endDate.AddDate(0, 0, -7) // 4-7 days ago
-
-		var trendDiff float64
-		err = r.db.Pool.QueryRow(ctx, trendQuery, userID, recentDate, olderStartDate).Scan(&trendDiff)
-		if err == nil {
-			if trendDiff > 5 {
-				trend = "improving"
-			} else if trendDiff < -5 {
-				trend = "declining"
-			}
-		}
+		return &types.TensionStatistics{}, nil
 	}
 
 	stats := &types.TensionStatistics{
 		Average: *avg,
 		Min:     *minScore,
 		Max:     *maxScore,
-		Trend:   trend,
 	}
 
 	return stats, nil
@@ -284,11 +342,11 @@ func (r *AnalysisRepository) UpdateAnalysis(ctx context.Context, analysisID stri
 		UPDATE analyses 
 		SET %s
 		WHERE id = $%d
-	`, fmt.Sprintf("%s", setParts), argIndex)
+	`, strings.Join(setParts, ", "), argIndex)
 
 	args = append(args, analysisID)
 
-	_, err := r.db.Pool.Exec(ctx, query, args...)
+	_, err := r.db.conn().Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to update analysis: %w", err)
 	}
@@ -303,56 +361,53 @@ func (r *AnalysisRepository) DeleteAnalysis(ctx context.Context, analysisID stri
 		WHERE id = $1
 	`
 
-	result, err := r.db.Pool.Exec(ctx, query, analysisID)
+	result, err := r.db.conn().Exec(ctx, query, analysisID)
 	if err != nil {
 		return fmt.Errorf("failed to delete analysis: %w", err)
 	}
 
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("analysis not found")
+		return apperror.ErrAnalysisNotFound
 	}
 
 	return nil
 }
 
-// GetAnalysesByUserID retrieves all analyses for a user with pagination
-func (r *AnalysisRepository) GetAnalysesByUserID(ctx context.Context, userID string, limit, offset int) ([]types.Analysis, int, error) {
-	// Count total analyses
-	countQuery := `
-		SELECT COUNT(*)
-		FROM analyses a
-		JOIN chat_sessions cs ON a.session_id = cs.id
-		WHERE cs.user_id = $1
-	`
-
-	var total int
-	err := r.db.Pool.QueryRow(ctx, countQuery, userID).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count analyses: %w", err)
+// GetAnalysesByUserID retrieves a page of a user's analyses following the cursor.
+// It returns the cursor of the next page, or nil on the last page.
+func (r *AnalysisRepository) GetAnalysesByUserID(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.AnalysisHistoryItem, *types.PageCursor, error) {
+	key, ok := analysisSortKeys[sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported analysis sort %q", sort)
 	}
 
-	// Get analyses with pagination
-	query := `
+	where := &whereBuilder{}
+	where.where("cs.user_id = " + where.arg(userID))
+	where.filter(filter)
+	where.after(key, "a.id", after)
+
+	// Fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
 		SELECT 
 			a.id, a.session_id, a.summary, a.emotional_state, a.behavioral_insights,
-			a.tension_score, a.relative_score, a.keywords, a.raw_analysis_data, a.created_at
+			a.tension_score, a.relative_score, a.keywords, a.created_at, cs.session_date::text
 		FROM analyses a
 		JOIN chat_sessions cs ON a.session_id = cs.id
-		WHERE cs.user_id = $1
-		ORDER BY a.created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+		%s
+		%s
+		LIMIT %s
+	`, where, key.orderBy("a.id"), where.arg(limit+1))
 
-	rows, err := r.db.Pool.Query(ctx, query, userID, limit, offset)
+	rows, err := r.db.conn().Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get analyses: %w", err)
+		return nil, nil, fmt.Errorf("failed to get analyses: %w", err)
 	}
 	defer rows.Close()
 
-	var analyses []types.Analysis
+	analyses := []types.AnalysisHistoryItem{}
 	for rows.Next() {
-		var analysis types.Analysis
+		var analysis types.AnalysisHistoryItem
 		err := rows.Scan(
 			&analysis.ID,
 			&analysis.SessionID,
@@ -362,14 +417,43 @@ func (r *AnalysisRepository) GetAnalysesByUserID(ctx context.Context, userID str
 			&analysis.TensionScore,
 			&analysis.RelativeScore,
 			&analysis.Keywords,
-			&analysis.RawAnalysisData,
 			&analysis.CreatedAt,
+			&analysis.SessionDate,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan analysis: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan analysis: %w", err)
 		}
 		analyses = append(analyses, analysis)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get analyses: %w", err)
+	}
+
+	if len(analyses) <= limit {
+		return analyses, nil, nil
+	}
+	analyses = analyses[:limit]
+	last := analyses[limit-1]
+	return analyses, &types.PageCursor{Sort: sort, Value: analysisCursorValue(sort, last), ID: last.ID}, nil
+}
+
+// CountAnalyses counts a user's analyses matching the filter
+func (r *AnalysisRepository) CountAnalyses(ctx context.Context, userID string, filter types.SessionFilter) (int, error) {
+	where := &whereBuilder{}
+	where.where("cs.user_id = " + where.arg(userID))
+	where.filter(filter)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM analyses a
+		JOIN chat_sessions cs ON a.session_id = cs.id
+		%s
+	`, where)
+
+	var total int
+	if err := r.db.conn().QueryRow(ctx, query, where.args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count analyses: %w", err)
+	}
 
-	return analyses, total, nil
+	return total, nil
 }
@@ -0,0 +1,271 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+func TestAnalysisRepositoryCreateAndGet(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	session := pgtest.Session(t, db, pgtest.User(t, db, "alice").ID, "2024-03-10")
+
+	if analysis, err := repo.GetAnalysisBySessionID(ctx, session.ID); err != nil || analysis != nil {
+		t.Fatalf("GetAnalysisBySessionID before analyzing = %+v, %v, want nil", analysis, err)
+	}
+
+	created := pgtest.Analysis(t, db, session.ID, 64)
+	if created.ID == "" || created.TensionScore != 64 {
+		t.Errorf("created analysis = %+v", created)
+	}
+
+	found, err := repo.GetAnalysisBySessionID(ctx, session.ID)
+	if err != nil || found == nil {
+		t.Fatalf("GetAnalysisBySessionID = %+v, %v", found, err)
+	}
+	var emotionalState struct {
+		Emotions map[string]float64 `json:"emotions"`
+	}
+	if err := json.Unmarshal(found.EmotionalState, &emotionalState); err != nil || emotionalState.Emotions["joy"] != 0.6 {
+		t.Errorf("emotional_state = %s, want the stored object", found.EmotionalState)
+	}
+
+	// One analysis per session
+	_, err = repo.CreateAnalysis(ctx, &types.Analysis{
+		SessionID:          session.ID,
+		Summary:            "二回目",
+		EmotionalState:     json.RawMessage(`{}`),
+		BehavioralInsights: json.RawMessage(`{}`),
+		TensionScore:       10,
+	})
+	if err == nil {
+		t.Errorf("CreateAnalysis accepted a second analysis of the session")
+	}
+}
+
+func TestAnalysisRepositoryUpdateAndDelete(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	session := pgtest.Session(t, db, pgtest.User(t, db, "alice").ID, "2024-03-10")
+	analysis := pgtest.Analysis(t, db, session.ID, 64)
+
+	err := repo.UpdateAnalysis(ctx, analysis.ID, map[string]interface{}{
+		"summary":  "見直した要約",
+		"keywords": []string{"読書"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateAnalysis: %v", err)
+	}
+	updated, err := repo.GetAnalysisBySessionID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetAnalysisBySessionID: %v", err)
+	}
+	var keywords []string
+	if err := json.Unmarshal(updated.Keywords, &keywords); err != nil || len(keywords) != 1 || keywords[0] != "読書" {
+		t.Errorf("keywords = %s, want [読書]", updated.Keywords)
+	}
+	if updated.Summary != "見直した要約" {
+		t.Errorf("summary = %q", updated.Summary)
+	}
+
+	if err := repo.DeleteAnalysis(ctx, analysis.ID); err != nil {
+		t.Fatalf("DeleteAnalysis: %v", err)
+	}
+	if found, err := repo.GetAnalysisBySessionID(ctx, session.ID); err != nil || found != nil {
+		t.Errorf("analysis after delete = %+v, %v, want nil", found, err)
+	}
+	if err := repo.DeleteAnalysis(ctx, analysis.ID); !errors.Is(err, apperror.ErrAnalysisNotFound) {
+		t.Errorf("second DeleteAnalysis error = %v, want analysis not found", err)
+	}
+}
+
+func TestAnalysisRepositoryRangeQueries(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	other := pgtest.User(t, db, "bob")
+
+	for date, score := range map[string]int{"2024-03-09": 20, "2024-03-10": 40, "2024-03-12": 80, "2024-03-20": 90} {
+		pgtest.Analysis(t, db, pgtest.Session(t, db, user.ID, date).ID, score)
+	}
+	pgtest.Analysis(t, db, pgtest.Session(t, db, other.ID, "2024-03-11").ID, 10)
+
+	start := mustDate(t, "2024-03-10")
+	end := mustDate(t, "2024-03-12")
+
+	scores, err := repo.GetTensionScores(ctx, user.ID, start, end, 10)
+	if err != nil {
+		t.Fatalf("GetTensionScores: %v", err)
+	}
+	if len(scores) != 2 || scores[0].Date != "2024-03-12" || scores[0].TensionScore != 80 || scores[1].Date != "2024-03-10" {
+		t.Errorf("tension scores = %+v, want 03-12 and 03-10 newest first", scores)
+	}
+	if limited, err := repo.GetTensionScores(ctx, user.ID, start, end, 1); err != nil || len(limited) != 1 {
+		t.Errorf("GetTensionScores with limit 1 = %+v, %v", limited, err)
+	}
+
+	states, err := repo.GetEmotionalStates(ctx, user.ID, start, end)
+	if err != nil {
+		t.Fatalf("GetEmotionalStates: %v", err)
+	}
+	if len(states) != 2 || states[0].Date != "2024-03-10" || len(states[0].EmotionalState) == 0 {
+		t.Errorf("emotional states = %+v, want 03-10 and 03-12 oldest first", states)
+	}
+
+	samples, err := repo.GetTensionFactorSamples(ctx, user.ID, start, end)
+	if err != nil {
+		t.Fatalf("GetTensionFactorSamples: %v", err)
+	}
+	if len(samples) != 2 || samples[0].TensionScore != 40 || len(samples[0].Keywords) != 2 {
+		t.Errorf("tension factor samples = %+v, want two days with keywords", samples)
+	}
+
+}
+
+func TestAnalysisRepositoryGetAnalysesByUserID(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	other := pgtest.User(t, db, "bob")
+
+	for date, score := range map[string]int{"2024-03-09": 20, "2024-03-10": 40, "2024-03-12": 40, "2024-03-20": 90} {
+		pgtest.Analysis(t, db, pgtest.Session(t, db, user.ID, date).ID, score)
+	}
+	pgtest.Session(t, db, user.ID, "2024-03-21")
+	pgtest.Analysis(t, db, pgtest.Session(t, db, other.ID, "2024-03-11").ID, 10)
+
+	// Walk the pages by tension score; equal scores are ordered by ID
+	var scores []int
+	var after *types.PageCursor
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatalf("pagination does not terminate")
+		}
+		analyses, next, err := repo.GetAnalysesByUserID(ctx, user.ID, types.SortTensionDesc, types.SessionFilter{}, after, 3)
+		if err != nil {
+			t.Fatalf("GetAnalysesByUserID: %v", err)
+		}
+		for _, analysis := range analyses {
+			scores = append(scores, analysis.TensionScore)
+			if analysis.SessionDate == "" || analysis.RawAnalysisData != nil {
+				t.Errorf("analysis = %+v, want its session date without raw data", analysis)
+			}
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	if len(scores) != 4 || scores[0] != 90 || scores[1] != 40 || scores[2] != 40 || scores[3] != 20 {
+		t.Errorf("scores = %v, want 90, 40, 40, 20", scores)
+	}
+
+	minTension, keyword, emotion := 30, "散歩", "joy"
+	filter := types.SessionFilter{MinTension: &minTension, Keyword: &keyword, Emotion: &emotion}
+	analyses, next, err := repo.GetAnalysesByUserID(ctx, user.ID, types.SortDateAsc, filter, nil, 10)
+	if err != nil {
+		t.Fatalf("GetAnalysesByUserID (filtered): %v", err)
+	}
+	if next != nil || len(analyses) != 3 || analyses[0].SessionDate != "2024-03-10" {
+		t.Errorf("filtered analyses = %+v, next = %+v, want 03-10, 03-12 and 03-20", analyses, next)
+	}
+	if total, err := repo.CountAnalyses(ctx, user.ID, filter); err != nil || total != 3 {
+		t.Errorf("CountAnalyses = %d, %v, want 3", total, err)
+	}
+
+	unknown := "anger"
+	if analyses, _, err := repo.GetAnalysesByUserID(ctx, user.ID, types.SortDateAsc, types.SessionFilter{Emotion: &unknown}, nil, 10); err != nil || len(analyses) != 0 {
+		t.Errorf("analyses with primary emotion anger = %+v, %v, want none", analyses, err)
+	}
+}
+
+func TestAnalysisRepositoryGetTensionFactorSamplesWithTopicsAndEntities(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	session := pgtest.Session(t, db, user.ID, "2024-03-10")
+	pgtest.Analysis(t, db, session.ID, 55)
+
+	_, err := repository.NewMessageRepository(db).CreateMessage(ctx, session.ID, types.SenderUser, "同僚とランチ",
+		map[string]interface{}{types.MessageMetadataAnnotation: map[string]interface{}{"topics": []string{"work", "food"}}})
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	entities := repository.NewEntityRepository(db)
+	entity, err := entities.CreateEntity(ctx, user.ID, "person", "田中さん", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	if err := entities.RecordMention(ctx, entity.ID, session.ID, 2); err != nil {
+		t.Fatalf("RecordMention: %v", err)
+	}
+
+	day := mustDate(t, "2024-03-10")
+	samples, err := repo.GetTensionFactorSamples(ctx, user.ID, day, day)
+	if err != nil {
+		t.Fatalf("GetTensionFactorSamples: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("got %d samples, want 1", len(samples))
+	}
+	if len(samples[0].Topics) != 2 {
+		t.Errorf("topics = %v, want work and food", samples[0].Topics)
+	}
+	if len(samples[0].Entities) != 1 || samples[0].Entities[0] != "person:田中さん" {
+		t.Errorf("entities = %v, want person:田中さん", samples[0].Entities)
+	}
+}
+
+func TestAnalysisRepositoryGetTensionStatistics(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewAnalysisRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	empty, err := repo.GetTensionStatistics(ctx, user.ID, 30)
+	if err != nil {
+		t.Fatalf("GetTensionStatistics without analyses: %v", err)
+	}
+	if empty.Average != 0 || empty.Min != 0 || empty.Max != 0 || empty.Trend != "" {
+		t.Errorf("statistics without analyses = %+v", empty)
+	}
+
+	now := timeutil.NowJST()
+	for daysAgo, score := range map[int]int{2: 30, 3: 50, 4: 70, 60: 100} {
+		date := timeutil.FormatJST(now.AddDate(0, 0, -daysAgo), "2006-01-02")
+		pgtest.Analysis(t, db, pgtest.Session(t, db, user.ID, date).ID, score)
+	}
+
+	stats, err := repo.GetTensionStatistics(ctx, user.ID, 30)
+	if err != nil {
+		t.Fatalf("GetTensionStatistics: %v", err)
+	}
+	if stats.Average != 50 || stats.Min != 30 || stats.Max != 70 {
+		t.Errorf("statistics = %+v, want average 50 between 30 and 70", stats)
+	}
+}
+
+// mustDate parses a YYYY-MM-DD date in JST
+func mustDate(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	date, err := timeutil.ParseDateInJST("2006-01-02", value)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", value, err)
+	}
+	return date
+}
@@ -2,16 +2,48 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/trasta298/kasaneha/backend/internal/config"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
 )
 
 // Database wraps the database connection pool
 type Database struct {
 	Pool *pgxpool.Pool
+
+	// tx is set on the copy of the database handed to a unit of work
+	tx pgx.Tx
+}
+
+// querier is the part of pgxpool.Pool and pgx.Tx the repositories use
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// conn returns the transaction of the current unit of work, or the pool outside of one
+func (db *Database) conn() querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.Pool
+}
+
+// uniqueViolation is the SQLSTATE of unique constraint violations
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is a Postgres unique_violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
 }
 
 // NewDatabase creates a new database instance
@@ -34,6 +66,9 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 		poolConfig.MaxConnIdleTime = maxIdleTime
 	}
 
+	// Trace every query as a child of the caller's span
+	poolConfig.ConnConfig.Tracer = tracing.NewQueryTracer()
+
 	// Create connection pool
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// EntityRepository handles entity data operations
+type EntityRepository struct {
+	db *Database
+}
+
+// NewEntityRepository creates a new entity repository
+func NewEntityRepository(db *Database) *EntityRepository {
+	return &EntityRepository{db: db}
+}
+
+// entitySummarySelect aggregates mention statistics per entity; callers append WHERE/ORDER clauses
+const entitySummarySelect = `
+	SELECT
+		e.id,
+		e.kind,
+		e.name,
+		COUNT(DISTINCT cs.session_date) as day_count,
+		COALESCE(SUM(em.mention_count), 0) as mention_count,
+		AVG(a.tension_score)::float8 as average_tension_score,
+		MAX(cs.session_date)::text as last_mentioned_on
+	FROM entities e
+	LEFT JOIN entity_mentions em ON e.id = em.entity_id
+	LEFT JOIN chat_sessions cs ON em.session_id = cs.id
+	LEFT JOIN analyses a ON em.session_id = a.session_id
+`
+
+// FindEntityByAlias retrieves the entity a normalized name resolves to
+func (r *EntityRepository) FindEntityByAlias(ctx context.Context, userID, kind, alias string) (*types.Entity, error) {
+	query := `
+		SELECT e.id, e.user_id, e.kind, e.name, e.created_at, e.updated_at
+		FROM entity_aliases ea
+		JOIN entities e ON ea.entity_id = e.id
+		WHERE ea.user_id = $1 AND ea.kind = $2 AND ea.alias = $3
+	`
+
+	var entity types.Entity
+	row := r.db.conn().QueryRow(ctx, query, userID, kind, alias)
+
+	err := row.Scan(
+		&entity.ID,
+		&entity.UserID,
+		&entity.Kind,
+		&entity.Name,
+		&entity.CreatedAt,
+		&entity.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // No entity uses this alias yet
+		}
+		return nil, fmt.Errorf("failed to find entity: %w", err)
+	}
+
+	return &entity, nil
+}
+
+// CreateEntity creates a new entity together with its first alias
+func (r *EntityRepository) CreateEntity(ctx context.Context, userID, kind, name, alias string) (*types.Entity, error) {
+	query := `
+		WITH new_entity AS (
+			INSERT INTO entities (user_id, kind, name)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, kind, name, created_at, updated_at
+		), new_alias AS (
+			INSERT INTO entity_aliases (entity_id, user_id, kind, alias)
+			SELECT id, user_id, kind, $4 FROM new_entity
+		)
+		SELECT id, user_id, kind, name, created_at, updated_at
+		FROM new_entity
+	`
+
+	var entity types.Entity
+	row := r.db.conn().QueryRow(ctx, query, userID, kind, name, alias)
+
+	err := row.Scan(
+		&entity.ID,
+		&entity.UserID,
+		&entity.Kind,
+		&entity.Name,
+		&entity.CreatedAt,
+		&entity.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entity: %w", err)
+	}
+
+	return &entity, nil
+}
+
+// RecordMention records how often an entity was mentioned in a session
+func (r *EntityRepository) RecordMention(ctx context.Context, entityID, sessionID string, mentionCount int) error {
+	query := `
+		INSERT INTO entity_mentions (entity_id, session_id, mention_count)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (entity_id, session_id)
+		DO UPDATE SET mention_count = entity_mentions.mention_count + EXCLUDED.mention_count
+	`
+
+	_, err := r.db.conn().Exec(ctx, query, entityID, sessionID, mentionCount)
+	if err != nil {
+		return fmt.Errorf("failed to record entity mention: %w", err)
+	}
+
+	return nil
+}
+
+// GetEntities retrieves a user's entities ordered by the number of days they were mentioned
+func (r *EntityRepository) GetEntities(ctx context.Context, userID string, kind *string, limit int) ([]types.EntitySummary, error) {
+	whereClause := "WHERE e.user_id = $1"
+	args := []interface{}{userID}
+	argIndex := 2
+
+	if kind != nil {
+		whereClause += fmt.Sprintf(" AND e.kind = $%d", argIndex)
+		args = append(args, *kind)
+		argIndex++
+	}
+
+	query := fmt.Sprintf(`%s
+		%s
+		GROUP BY e.id, e.kind, e.name
+		ORDER BY day_count DESC, mention_count DESC, e.name ASC
+		LIMIT $%d
+	`, entitySummarySelect, whereClause, argIndex)
+
+	args = append(args, limit)
+
+	rows, err := r.db.conn().Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entities: %w", err)
+	}
+	defer rows.Close()
+
+	var entities []types.EntitySummary
+	for rows.Next() {
+		var entity types.EntitySummary
+		err := rows.Scan(
+			&entity.ID,
+			&entity.Kind,
+			&entity.Name,
+			&entity.DayCount,
+			&entity.MentionCount,
+			&entity.AverageTensionScore,
+			&entity.LastMentionedOn,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan entity: %w", err)
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
+
+// GetEntitySummary retrieves a single entity with aggregated mention statistics
+func (r *EntityRepository) GetEntitySummary(ctx context.Context, userID, entityID string) (*types.EntitySummary, error) {
+	query := entitySummarySelect + `
+		WHERE e.user_id = $1 AND e.id = $2
+		GROUP BY e.id, e.kind, e.name
+	`
+
+	var entity types.EntitySummary
+	row := r.db.conn().QueryRow(ctx, query, userID, entityID)
+
+	err := row.Scan(
+		&entity.ID,
+		&entity.Kind,
+		&entity.Name,
+		&entity.DayCount,
+		&entity.MentionCount,
+		&entity.AverageTensionScore,
+		&entity.LastMentionedOn,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrEntityNotFound
+		}
+		return nil, fmt.Errorf("failed to get entity: %w", err)
+	}
+
+	return &entity, nil
+}
+
+// GetEntityAliases retrieves the normalized names that resolve to an entity
+func (r *EntityRepository) GetEntityAliases(ctx context.Context, entityID string) ([]string, error) {
+	query := `
+		SELECT alias
+		FROM entity_aliases
+		WHERE entity_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entity aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := []string{}
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, fmt.Errorf("failed to scan entity alias: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+// GetEntityDays retrieves the days an entity was mentioned along with that day's tension score
+func (r *EntityRepository) GetEntityDays(ctx context.Context, entityID string) ([]types.EntityDay, error) {
+	query := `
+		SELECT
+			cs.session_date::text as date,
+			cs.id,
+			em.mention_count,
+			a.tension_score
+		FROM entity_mentions em
+		JOIN chat_sessions cs ON em.session_id = cs.id
+		LEFT JOIN analyses a ON em.session_id = a.session_id
+		WHERE em.entity_id = $1
+		ORDER BY cs.session_date DESC
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entity days: %w", err)
+	}
+	defer rows.Close()
+
+	days := []types.EntityDay{}
+	for rows.Next() {
+		var day types.EntityDay
+		err := rows.Scan(&day.Date, &day.SessionID, &day.MentionCount, &day.TensionScore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan entity day: %w", err)
+		}
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// RenameEntity renames an entity and registers the new name as an alias
+func (r *EntityRepository) RenameEntity(ctx context.Context, userID, entityID, name, alias string) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var kind string
+	err = tx.QueryRow(ctx, `
+		UPDATE entities
+		SET name = $1
+		WHERE id = $2 AND user_id = $3
+		RETURNING kind
+	`, name, entityID, userID).Scan(&kind)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return apperror.ErrEntityNotFound
+		}
+		return fmt.Errorf("failed to rename entity: %w", err)
+	}
+
+	var aliasOwner string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO entity_aliases (entity_id, user_id, kind, alias)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind, alias) DO UPDATE SET alias = EXCLUDED.alias
+		RETURNING entity_id
+	`, entityID, userID, kind, alias).Scan(&aliasOwner)
+	if err != nil {
+		return fmt.Errorf("failed to add entity alias: %w", err)
+	}
+	if aliasOwner != entityID {
+		return apperror.ErrEntityNameInUse
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// MergeEntities moves the mentions and aliases of the source entities to the target and deletes the sources
+func (r *EntityRepository) MergeEntities(ctx context.Context, userID, targetID string, sourceIDs []string) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// All entities must belong to the user and share the target's kind
+	var matched int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM entities e
+		JOIN entities target ON target.id = $2 AND target.user_id = $1
+		WHERE e.user_id = $1 AND e.id = ANY($3::uuid[]) AND e.kind = target.kind
+	`, userID, targetID, sourceIDs).Scan(&matched)
+	if err != nil {
+		return fmt.Errorf("failed to check entities: %w", err)
+	}
+	if matched != len(sourceIDs) {
+		return apperror.ErrEntityNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO entity_mentions (entity_id, session_id, mention_count)
+		SELECT $1, session_id, SUM(mention_count)
+		FROM entity_mentions
+		WHERE entity_id = ANY($2::uuid[])
+		GROUP BY session_id
+		ON CONFLICT (entity_id, session_id)
+		DO UPDATE SET mention_count = entity_mentions.mention_count + EXCLUDED.mention_count
+	`, targetID, sourceIDs)
+	if err != nil {
+		return fmt.Errorf("failed to merge entity mentions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE entity_aliases
+		SET entity_id = $1
+		WHERE entity_id = ANY($2::uuid[])
+	`, targetID, sourceIDs)
+	if err != nil {
+		return fmt.Errorf("failed to merge entity aliases: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM entities
+		WHERE id = ANY($1::uuid[])
+	`, sourceIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete merged entities: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
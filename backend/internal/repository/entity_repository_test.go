@@ -0,0 +1,199 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+)
+
+func TestEntityRepositoryCreateAndFind(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewEntityRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	other := pgtest.User(t, db, "bob")
+
+	if entity, err := repo.FindEntityByAlias(ctx, user.ID, "person", "田中"); err != nil || entity != nil {
+		t.Fatalf("FindEntityByAlias before creating = %+v, %v, want nil", entity, err)
+	}
+
+	created, err := repo.CreateEntity(ctx, user.ID, "person", "田中さん", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+
+	found, err := repo.FindEntityByAlias(ctx, user.ID, "person", "田中")
+	if err != nil || found == nil || found.ID != created.ID || found.Name != "田中さん" {
+		t.Errorf("FindEntityByAlias = %+v, %v, want %s", found, err, created.ID)
+	}
+	if found, err := repo.FindEntityByAlias(ctx, user.ID, "place", "田中"); err != nil || found != nil {
+		t.Errorf("alias matched another kind: %+v, %v", found, err)
+	}
+	if found, err := repo.FindEntityByAlias(ctx, other.ID, "person", "田中"); err != nil || found != nil {
+		t.Errorf("alias matched another user's entity: %+v, %v", found, err)
+	}
+
+	aliases, err := repo.GetEntityAliases(ctx, created.ID)
+	if err != nil || len(aliases) != 1 || aliases[0] != "田中" {
+		t.Errorf("GetEntityAliases = %v, %v, want [田中]", aliases, err)
+	}
+}
+
+func TestEntityRepositoryMentionsAndSummaries(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewEntityRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	first := pgtest.Session(t, db, user.ID, "2024-03-10")
+	pgtest.Analysis(t, db, first.ID, 40)
+	second := pgtest.Session(t, db, user.ID, "2024-03-11")
+	pgtest.Analysis(t, db, second.ID, 80)
+
+	tanaka, err := repo.CreateEntity(ctx, user.ID, "person", "田中さん", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	cafe, err := repo.CreateEntity(ctx, user.ID, "place", "カフェ", "カフェ")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+
+	for _, mention := range []struct {
+		entityID, sessionID string
+		count               int
+	}{
+		{tanaka.ID, first.ID, 1},
+		{tanaka.ID, first.ID, 2}, // Adds to the existing mention
+		{tanaka.ID, second.ID, 1},
+		{cafe.ID, second.ID, 1},
+	} {
+		if err := repo.RecordMention(ctx, mention.entityID, mention.sessionID, mention.count); err != nil {
+			t.Fatalf("RecordMention: %v", err)
+		}
+	}
+
+	entities, err := repo.GetEntities(ctx, user.ID, nil, 10)
+	if err != nil {
+		t.Fatalf("GetEntities: %v", err)
+	}
+	if len(entities) != 2 || entities[0].ID != tanaka.ID {
+		t.Fatalf("entities = %+v, want 田中さん first", entities)
+	}
+	if entities[0].DayCount != 2 || entities[0].MentionCount != 4 {
+		t.Errorf("田中さん = %+v, want 2 days and 4 mentions", entities[0])
+	}
+	if entities[0].AverageTensionScore == nil || *entities[0].AverageTensionScore != 60 {
+		t.Errorf("average tension score = %v, want 60", entities[0].AverageTensionScore)
+	}
+	if entities[0].LastMentionedOn == nil || *entities[0].LastMentionedOn != "2024-03-11" {
+		t.Errorf("last mentioned on = %v, want 2024-03-11", entities[0].LastMentionedOn)
+	}
+
+	kind := "place"
+	places, err := repo.GetEntities(ctx, user.ID, &kind, 10)
+	if err != nil || len(places) != 1 || places[0].ID != cafe.ID {
+		t.Errorf("GetEntities(place) = %+v, %v, want only カフェ", places, err)
+	}
+
+	summary, err := repo.GetEntitySummary(ctx, user.ID, tanaka.ID)
+	if err != nil || summary.MentionCount != 4 {
+		t.Errorf("GetEntitySummary = %+v, %v, want 4 mentions", summary, err)
+	}
+	if _, err := repo.GetEntitySummary(ctx, pgtest.User(t, db, "bob").ID, tanaka.ID); !errors.Is(err, apperror.ErrEntityNotFound) {
+		t.Errorf("GetEntitySummary for another user error = %v, want entity not found", err)
+	}
+
+	days, err := repo.GetEntityDays(ctx, tanaka.ID)
+	if err != nil {
+		t.Fatalf("GetEntityDays: %v", err)
+	}
+	if len(days) != 2 || days[0].Date != "2024-03-11" || days[1].MentionCount != 3 || days[1].TensionScore == nil || *days[1].TensionScore != 40 {
+		t.Errorf("entity days = %+v, want 03-11 then 03-10 with 3 mentions and score 40", days)
+	}
+}
+
+func TestEntityRepositoryRenameEntity(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewEntityRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	tanaka, err := repo.CreateEntity(ctx, user.ID, "person", "田中", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	suzuki, err := repo.CreateEntity(ctx, user.ID, "person", "鈴木", "鈴木")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+
+	if err := repo.RenameEntity(ctx, user.ID, tanaka.ID, "田中太郎", "田中太郎"); err != nil {
+		t.Fatalf("RenameEntity: %v", err)
+	}
+	found, err := repo.FindEntityByAlias(ctx, user.ID, "person", "田中太郎")
+	if err != nil || found == nil || found.ID != tanaka.ID || found.Name != "田中太郎" {
+		t.Errorf("entity by new alias = %+v, %v", found, err)
+	}
+	if found, err := repo.FindEntityByAlias(ctx, user.ID, "person", "田中"); err != nil || found == nil || found.ID != tanaka.ID {
+		t.Errorf("old alias no longer resolves: %+v, %v", found, err)
+	}
+
+	if err := repo.RenameEntity(ctx, user.ID, tanaka.ID, "鈴木", "鈴木"); !errors.Is(err, apperror.ErrEntityNameInUse) {
+		t.Errorf("RenameEntity to another entity's name error = %v, want entity name already in use", err)
+	}
+	if summary, err := repo.GetEntitySummary(ctx, user.ID, tanaka.ID); err != nil || summary.Name != "田中太郎" {
+		t.Errorf("failed rename was not rolled back: %+v, %v", summary, err)
+	}
+	if err := repo.RenameEntity(ctx, pgtest.User(t, db, "bob").ID, suzuki.ID, "x", "x"); !errors.Is(err, apperror.ErrEntityNotFound) {
+		t.Errorf("RenameEntity of another user's entity error = %v, want entity not found", err)
+	}
+}
+
+func TestEntityRepositoryMergeEntities(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewEntityRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	session := pgtest.Session(t, db, user.ID, "2024-03-10")
+
+	target, err := repo.CreateEntity(ctx, user.ID, "person", "田中さん", "田中さん")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	source, err := repo.CreateEntity(ctx, user.ID, "person", "田中", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	place, err := repo.CreateEntity(ctx, user.ID, "place", "田中屋", "田中屋")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	for _, entityID := range []string{target.ID, source.ID} {
+		if err := repo.RecordMention(ctx, entityID, session.ID, 2); err != nil {
+			t.Fatalf("RecordMention: %v", err)
+		}
+	}
+
+	if err := repo.MergeEntities(ctx, user.ID, target.ID, []string{place.ID}); !errors.Is(err, apperror.ErrEntityNotFound) {
+		t.Errorf("merging another kind error = %v, want entity not found", err)
+	}
+
+	if err := repo.MergeEntities(ctx, user.ID, target.ID, []string{source.ID}); err != nil {
+		t.Fatalf("MergeEntities: %v", err)
+	}
+	summary, err := repo.GetEntitySummary(ctx, user.ID, target.ID)
+	if err != nil || summary.MentionCount != 4 || summary.DayCount != 1 {
+		t.Errorf("merged entity = %+v, %v, want 4 mentions on 1 day", summary, err)
+	}
+	if found, err := repo.FindEntityByAlias(ctx, user.ID, "person", "田中"); err != nil || found == nil || found.ID != target.ID {
+		t.Errorf("merged alias resolves to %+v, %v, want the target", found, err)
+	}
+	if _, err := repo.GetEntitySummary(ctx, user.ID, source.ID); err == nil {
+		t.Errorf("merged source entity still exists")
+	}
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// The interfaces below are what services and handlers depend on. The Postgres repositories in this
+// package implement them; internal/repository/memory provides in-memory implementations for tests.
+
+// UserStore is implemented by UserRepository
+type UserStore interface {
+	CreateUser(ctx context.Context, req *types.RegisterRequest) (*types.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*types.User, error)
+	GetUserByID(ctx context.Context, userID string) (*types.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*types.User, error)
+	IsAdmin(ctx context.Context, userID string) (bool, error)
+	UpdateLastLogin(ctx context.Context, userID string) error
+	ValidatePassword(ctx context.Context, username, password string) (*types.User, error)
+	UpdatePassword(ctx context.Context, userID, password string) error
+	GetPasswordChangedAt(ctx context.Context, userID string) (*time.Time, error)
+	UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) error
+	DeactivateUser(ctx context.Context, userID string) error
+}
+
+// SessionStore is implemented by SessionRepository
+type SessionStore interface {
+	GetTodaySession(ctx context.Context, userID string) (*types.ChatSession, error)
+	CreateSession(ctx context.Context, userID, date string) (*types.ChatSession, error)
+	GetSessionByID(ctx context.Context, sessionID string) (*types.ChatSession, error)
+	CompleteSession(ctx context.Context, sessionID string) error
+	GetUserSessions(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.SessionSummary, *types.PageCursor, error)
+	CountUserSessions(ctx context.Context, userID string, filter types.SessionFilter) (int, error)
+	GetCalendarData(ctx context.Context, userID string, year, month int) ([]types.CalendarDay, error)
+	CheckSessionOwnership(ctx context.Context, sessionID, userID string) (bool, error)
+	HasUserMessagesSince(ctx context.Context, userID string, since time.Time) (bool, error)
+	CountSessionsAwaitingAnalysis(ctx context.Context, minMessages int) (int, error)
+	GetActiveSessionsWithMinMessages(ctx context.Context, minMessages int) ([]types.SessionForBatch, error)
+	GetUnanalyzedCompletedSessions(ctx context.Context, minMessages int) ([]types.SessionForBatch, error)
+}
+
+// MessageStore is implemented by MessageRepository
+type MessageStore interface {
+	CreateMessage(ctx context.Context, sessionID, sender, content string, metadata map[string]interface{}) (*types.Message, error)
+	GetSessionMessages(ctx context.Context, sessionID string) ([]types.Message, error)
+	GetSessionMessagesWithPagination(ctx context.Context, sessionID string, limit, offset int) ([]types.Message, int, error)
+	GetLatestMessages(ctx context.Context, sessionID string, limit int) ([]types.Message, error)
+	GetMessageByID(ctx context.Context, messageID string) (*types.Message, error)
+	GetConversationLog(ctx context.Context, sessionID string) (string, error)
+	UpdateMessage(ctx context.Context, messageID, content string, metadata map[string]interface{}) error
+	MergeMessageMetadata(ctx context.Context, messageID string, metadata map[string]interface{}) error
+	ClearMessageMetadataKey(ctx context.Context, messageID, key string) (bool, error)
+	DeleteMessage(ctx context.Context, messageID string) error
+	GetMessageCount(ctx context.Context, sessionID string) (int, error)
+}
+
+// AnalysisStore is implemented by AnalysisRepository
+type AnalysisStore interface {
+	CreateAnalysis(ctx context.Context, analysis *types.Analysis) (*types.Analysis, error)
+	GetAnalysisBySessionID(ctx context.Context, sessionID string) (*types.Analysis, error)
+	GetTensionScores(ctx context.Context, userID string, startDate, endDate time.Time, limit int) ([]types.TensionScoreData, error)
+	GetEmotionalStates(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.EmotionalStateRecord, error)
+	GetTensionFactorSamples(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.TensionFactorSample, error)
+	GetTensionStatistics(ctx context.Context, userID string, days int) (*types.TensionStatistics, error)
+	UpdateAnalysis(ctx context.Context, analysisID string, updates map[string]interface{}) error
+	DeleteAnalysis(ctx context.Context, analysisID string) error
+	GetAnalysesByUserID(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.AnalysisHistoryItem, *types.PageCursor, error)
+	CountAnalyses(ctx context.Context, userID string, filter types.SessionFilter) (int, error)
+}
+
+// EntityStore is implemented by EntityRepository
+type EntityStore interface {
+	FindEntityByAlias(ctx context.Context, userID, kind, alias string) (*types.Entity, error)
+	CreateEntity(ctx context.Context, userID, kind, name, alias string) (*types.Entity, error)
+	RecordMention(ctx context.Context, entityID, sessionID string, mentionCount int) error
+	GetEntities(ctx context.Context, userID string, kind *string, limit int) ([]types.EntitySummary, error)
+	GetEntitySummary(ctx context.Context, userID, entityID string) (*types.EntitySummary, error)
+	GetEntityAliases(ctx context.Context, entityID string) ([]string, error)
+	GetEntityDays(ctx context.Context, entityID string) ([]types.EntityDay, error)
+	RenameEntity(ctx context.Context, userID, entityID, name, alias string) error
+	MergeEntities(ctx context.Context, userID, targetID string, sourceIDs []string) error
+}
+
+// AlertStore is implemented by AlertRepository
+type AlertStore interface {
+	GetAlertSettings(ctx context.Context, userID string) (*types.AlertSettings, error)
+	UpsertAlertSettings(ctx context.Context, settings *types.AlertSettings) (*types.AlertSettings, error)
+	GetAlertUserIDs(ctx context.Context) ([]string, error)
+	CreateNotification(ctx context.Context, userID, notificationType, title, body string, data map[string]interface{}) (*types.Notification, error)
+	HasRecentNotification(ctx context.Context, userID, notificationType, key string, since time.Time) (bool, error)
+	GetNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]types.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int, error)
+	MarkNotificationRead(ctx context.Context, userID, notificationID string) error
+	GetChatAcknowledgement(ctx context.Context, userID string, since time.Time) (*types.Notification, error)
+	MarkAcknowledgedInChat(ctx context.Context, notificationID string) error
+}
+
+// ReminderStore is implemented by ReminderRepository
+type ReminderStore interface {
+	GetReminderSettings(ctx context.Context, userID string) (*types.ReminderSettings, error)
+	UpsertReminderSettings(ctx context.Context, settings *types.ReminderSettings) (*types.ReminderSettings, error)
+	GetEnabledReminderSettings(ctx context.Context) ([]types.ReminderSettings, error)
+	ClaimReminder(ctx context.Context, userID, localDate string) (bool, error)
+	SavePushSubscription(ctx context.Context, userID, endpoint, p256dh, auth string) (*types.PushSubscription, error)
+	GetPushSubscriptions(ctx context.Context, userID string) ([]types.PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, userID, endpoint string) error
+	DeletePushSubscriptionsByEndpoint(ctx context.Context, endpoints []string) error
+}
+
+// WebhookStore is implemented by WebhookRepository
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, userID, url, secret string, events []string, description *string) (*types.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]types.Webhook, error)
+	CountWebhooks(ctx context.Context, userID string) (int, error)
+	GetWebhook(ctx context.Context, userID, webhookID string) (*types.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *types.Webhook) (*types.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	GetWebhookIDsForEvent(ctx context.Context, userID, eventType string) ([]string, error)
+	CreateDelivery(ctx context.Context, webhookID, eventID, eventType string, payload []byte) error
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]types.WebhookDeliveryTask, error)
+	MarkDeliverySucceeded(ctx context.Context, deliveryID string, responseStatus int) error
+	MarkDeliveryFailed(ctx context.Context, deliveryID string, responseStatus *int, lastError string, nextAttemptAt *time.Time) error
+	GetDeliveries(ctx context.Context, webhookID string, status string, limit int) ([]types.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, userID, webhookID, deliveryID string) error
+}
+
+// UsageStore is implemented by UsageRepository
+type UsageStore interface {
+	CreateUsage(ctx context.Context, usage *types.AIUsage) error
+	SumUserTokens(ctx context.Context, userID string, since time.Time) (int64, error)
+	GetUserUsageByOperation(ctx context.Context, userID string, from, to time.Time) ([]types.AIOperationUsage, error)
+	GetUsageReport(ctx context.Context, from, to time.Time) ([]types.AIUserUsage, types.AIUsageTotals, error)
+	GetQuota(ctx context.Context, userID string) (*types.AIQuota, error)
+	UpsertQuota(ctx context.Context, userID string, dailyTokens, monthlyTokens *int64) (*types.AIQuota, error)
+}
+
+// SecurityStore is implemented by SecurityRepository
+type SecurityStore interface {
+	GetLoginState(ctx context.Context, userID string) (*types.LoginState, error)
+	IncrementFailedLogins(ctx context.Context, userID string) (int, error)
+	LockUser(ctx context.Context, userID string, until time.Time) error
+	ResetFailedLogins(ctx context.Context, userID string) error
+	CreateSecurityEvent(ctx context.Context, event *types.SecurityEvent) error
+	CountFailedLoginsByIP(ctx context.Context, ipAddress string, since time.Time) (int, *time.Time, error)
+	CountUnknownUserLogins(ctx context.Context, username string, since time.Time) (int, *time.Time, error)
+	GetSecurityEvents(ctx context.Context, userID string, limit int) ([]types.SecurityEvent, error)
+}
+
+// MFAStore is implemented by MFARepository
+type MFAStore interface {
+	GetMFAState(ctx context.Context, userID string) (*types.MFAState, error)
+	SetTOTPSecret(ctx context.Context, userID, secret string) error
+	EnableMFA(ctx context.Context, userID string, counter int64, codeHashes []string) error
+	DisableMFA(ctx context.Context, userID string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+	ClaimTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error)
+	StartMFAChallenge(ctx context.Context, userID, challenge string) error
+	FinishMFAChallenge(ctx context.Context, userID, challenge string) (bool, error)
+}
+
+// PasswordResetStore is implemented by PasswordResetRepository
+type PasswordResetStore interface {
+	CreateResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash, password string, now time.Time) (string, error)
+}
+
+var (
+	_ UserStore          = (*UserRepository)(nil)
+	_ SessionStore       = (*SessionRepository)(nil)
+	_ MessageStore       = (*MessageRepository)(nil)
+	_ AnalysisStore      = (*AnalysisRepository)(nil)
+	_ EntityStore        = (*EntityRepository)(nil)
+	_ AlertStore         = (*AlertRepository)(nil)
+	_ ReminderStore      = (*ReminderRepository)(nil)
+	_ WebhookStore       = (*WebhookRepository)(nil)
+	_ UsageStore         = (*UsageRepository)(nil)
+	_ SecurityStore      = (*SecurityRepository)(nil)
+	_ MFAStore           = (*MFARepository)(nil)
+	_ PasswordResetStore = (*PasswordResetRepository)(nil)
+)
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// sortKey describes how a listing is ordered; rows with equal keys are ordered by ID
+type sortKey struct {
+	column string
+	// cast converts the cursor value back to the column type
+	cast string
+	desc bool
+}
+
+var sessionSortKeys = map[string]sortKey{
+	types.SortDateAsc:     {column: "cs.session_date", cast: "date"},
+	types.SortDateDesc:    {column: "cs.session_date", cast: "date", desc: true},
+	types.SortUpdatedAsc:  {column: "cs.updated_at", cast: "timestamptz"},
+	types.SortUpdatedDesc: {column: "cs.updated_at", cast: "timestamptz", desc: true},
+}
+
+var analysisSortKeys = map[string]sortKey{
+	types.SortDateAsc:     {column: "cs.session_date", cast: "date"},
+	types.SortDateDesc:    {column: "cs.session_date", cast: "date", desc: true},
+	types.SortTensionAsc:  {column: "a.tension_score", cast: "integer"},
+	types.SortTensionDesc: {column: "a.tension_score", cast: "integer", desc: true},
+}
+
+// whereBuilder collects the conditions of a listing query and their arguments
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds an argument and returns its placeholder
+func (b *whereBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *whereBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *whereBuilder) String() string {
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// filter adds the conditions of a session filter; the query aliases chat_sessions as cs and analyses as a
+func (b *whereBuilder) filter(filter types.SessionFilter) {
+	if filter.DateFrom != nil {
+		b.where("cs.session_date >= " + b.arg(*filter.DateFrom) + "::date")
+	}
+	if filter.DateTo != nil {
+		b.where("cs.session_date <= " + b.arg(*filter.DateTo) + "::date")
+	}
+	if filter.Year != nil {
+		b.where("EXTRACT(YEAR FROM cs.session_date) = " + b.arg(*filter.Year))
+	}
+	if filter.Month != nil {
+		b.where("EXTRACT(MONTH FROM cs.session_date) = " + b.arg(*filter.Month))
+	}
+	if filter.Status != nil {
+		b.where("cs.status = " + b.arg(*filter.Status))
+	}
+	if filter.HasAnalysis != nil {
+		if *filter.HasAnalysis {
+			b.where("a.id IS NOT NULL")
+		} else {
+			b.where("a.id IS NULL")
+		}
+	}
+	if filter.MinTension != nil {
+		b.where("a.tension_score >= " + b.arg(*filter.MinTension))
+	}
+	if filter.MaxTension != nil {
+		b.where("a.tension_score <= " + b.arg(*filter.MaxTension))
+	}
+	if filter.Emotion != nil {
+		b.where("a.emotional_state->>'primary_emotion' = " + b.arg(*filter.Emotion))
+	}
+	if filter.Keyword != nil {
+		b.where("a.keywords @> jsonb_build_array(" + b.arg(*filter.Keyword) + "::text)")
+	}
+}
+
+// after restricts the listing to rows following the cursor
+func (b *whereBuilder) after(key sortKey, idColumn string, cursor *types.PageCursor) {
+	if cursor == nil {
+		return
+	}
+	operator := ">"
+	if key.desc {
+		operator = "<"
+	}
+	b.where(fmt.Sprintf("(%s, %s) %s (%s::%s, %s::uuid)",
+		key.column, idColumn, operator, b.arg(cursor.Value), key.cast, b.arg(cursor.ID)))
+}
+
+// orderBy returns the ORDER BY clause matching after
+func (key sortKey) orderBy(idColumn string) string {
+	direction := "ASC"
+	if key.desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s", key.column, direction, idColumn, direction)
+}
+
+// sessionCursorValue returns the sort key of a session summary
+func sessionCursorValue(sort string, session types.SessionSummary) string {
+	switch sort {
+	case types.SortUpdatedAsc, types.SortUpdatedDesc:
+		return session.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return session.Date
+	}
+}
+
+// analysisCursorValue returns the sort key of an analysis
+func analysisCursorValue(sort string, analysis types.AnalysisHistoryItem) string {
+	switch sort {
+	case types.SortTensionAsc, types.SortTensionDesc:
+		return strconv.Itoa(analysis.TensionScore)
+	default:
+		return analysis.SessionDate
+	}
+}
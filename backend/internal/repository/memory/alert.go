@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// AlertRepository is an in-memory repository.AlertStore
+type AlertRepository struct {
+	store *Store
+}
+
+var _ repository.AlertStore = (*AlertRepository)(nil)
+
+// NewAlertRepository creates a new in-memory alert repository
+func NewAlertRepository(store *Store) *AlertRepository {
+	return &AlertRepository{store: store}
+}
+
+// GetAlertSettings retrieves a user's alert settings, or nil if the user has not configured them
+func (r *AlertRepository) GetAlertSettings(ctx context.Context, userID string) (*types.AlertSettings, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	settings, ok := r.store.alertSettings[userID]
+	if !ok {
+		return nil, nil // Defaults apply
+	}
+	result := *settings
+	return &result, nil
+}
+
+// UpsertAlertSettings creates or replaces a user's alert settings
+func (r *AlertRepository) UpsertAlertSettings(ctx context.Context, settings *types.AlertSettings) (*types.AlertSettings, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	saved := *settings
+	saved.UpdatedAt = r.store.Now()
+	r.store.alertSettings[settings.UserID] = &saved
+
+	result := saved
+	return &result, nil
+}
+
+// GetAlertUserIDs retrieves active users who have not opted out of alerts
+func (r *AlertRepository) GetAlertUserIDs(ctx context.Context) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var userIDs []string
+	for _, user := range r.store.users {
+		if !user.IsActive {
+			continue
+		}
+		if settings, ok := r.store.alertSettings[user.ID]; ok && !settings.Enabled {
+			continue
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	return userIDs, nil
+}
+
+// CreateNotification creates a new notification
+func (r *AlertRepository) CreateNotification(ctx context.Context, userID, notificationType, title, body string, data map[string]interface{}) (*types.Notification, error) {
+	dataJSON, err := toJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification data: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	notification := &types.Notification{
+		ID:        newID(),
+		UserID:    userID,
+		Type:      notificationType,
+		Title:     title,
+		Body:      body,
+		Data:      dataJSON,
+		CreatedAt: r.store.Now(),
+	}
+	r.store.notifications = append(r.store.notifications, notification)
+
+	result := *notification
+	return &result, nil
+}
+
+// HasRecentNotification checks whether a notification of the type was created for the same key or since the given time
+func (r *AlertRepository) HasRecentNotification(ctx context.Context, userID, notificationType, key string, since time.Time) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, notification := range r.store.notifications {
+		if notification.UserID != userID || notification.Type != notificationType {
+			continue
+		}
+		var data struct {
+			Key string `json:"key"`
+		}
+		_ = json.Unmarshal(notification.Data, &data)
+		if data.Key == key || !notification.CreatedAt.Before(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetNotifications retrieves a user's notifications, newest first
+func (r *AlertRepository) GetNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]types.Notification, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	notifications := []types.Notification{}
+	for _, notification := range r.store.notifications {
+		if notification.UserID == userID && (!unreadOnly || notification.ReadAt == nil) {
+			notifications = append(notifications, *notification)
+		}
+	}
+	sortNewestFirst(notifications)
+
+	return page(notifications, limit, 0), nil
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func (r *AlertRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, notification := range r.store.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks a user's notification as read
+func (r *AlertRepository) MarkNotificationRead(ctx context.Context, userID, notificationID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, notification := range r.store.notifications {
+		if notification.ID == notificationID && notification.UserID == userID {
+			if notification.ReadAt == nil {
+				notification.ReadAt = ptr(r.store.Now())
+			}
+			return nil
+		}
+	}
+	return apperror.ErrNotificationNotFound
+}
+
+// GetChatAcknowledgement returns the newest alert since the given time that has not been acknowledged
+// in chat yet, or nil if there is none
+func (r *AlertRepository) GetChatAcknowledgement(ctx context.Context, userID string, since time.Time) (*types.Notification, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var newest *types.Notification
+	for _, notification := range r.store.notifications {
+		if notification.UserID != userID ||
+			!strings.HasPrefix(notification.Type, "alert.") ||
+			notification.AcknowledgedInChatAt != nil ||
+			notification.CreatedAt.Before(since) {
+			continue
+		}
+		if newest == nil || !notification.CreatedAt.Before(newest.CreatedAt) {
+			newest = notification
+		}
+	}
+	if newest == nil {
+		return nil, nil // Nothing to acknowledge
+	}
+
+	result := *newest
+	return &result, nil
+}
+
+// MarkAcknowledgedInChat records that an alert was acknowledged in a first message
+func (r *AlertRepository) MarkAcknowledgedInChat(ctx context.Context, notificationID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, notification := range r.store.notifications {
+		if notification.ID == notificationID && notification.AcknowledgedInChatAt == nil {
+			notification.AcknowledgedInChatAt = ptr(r.store.Now())
+		}
+	}
+	return nil
+}
+
+// sortNewestFirst orders notifications by creation time, newest first; later inserts win ties
+func sortNewestFirst(notifications []types.Notification) {
+	for i, j := 0, len(notifications)-1; i < j; i, j = i+1, j-1 {
+		notifications[i], notifications[j] = notifications[j], notifications[i]
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+	})
+}
@@ -0,0 +1,346 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// AnalysisRepository is an in-memory repository.AnalysisStore
+type AnalysisRepository struct {
+	store *Store
+}
+
+var _ repository.AnalysisStore = (*AnalysisRepository)(nil)
+
+// NewAnalysisRepository creates a new in-memory analysis repository
+func NewAnalysisRepository(store *Store) *AnalysisRepository {
+	return &AnalysisRepository{store: store}
+}
+
+// CreateAnalysis creates a new analysis record; a session has at most one analysis
+func (r *AnalysisRepository) CreateAnalysis(ctx context.Context, analysis *types.Analysis) (*types.Analysis, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.store.session(analysis.SessionID) == nil {
+		return nil, fmt.Errorf("failed to create analysis: session %s does not exist", analysis.SessionID)
+	}
+	if r.store.analysis(analysis.SessionID) != nil {
+		return nil, fmt.Errorf("failed to create analysis: duplicate analysis for session %s", analysis.SessionID)
+	}
+
+	row := *analysis
+	row.ID = newID()
+	row.CreatedAt = r.store.Now()
+	if row.RelativeScore != nil {
+		row.RelativeScore = ptr(*row.RelativeScore)
+	}
+	r.store.analyses = append(r.store.analyses, &row)
+
+	result := row
+	return &result, nil
+}
+
+// GetAnalysisBySessionID retrieves the analysis of a session, or nil if there is none
+func (r *AnalysisRepository) GetAnalysisBySessionID(ctx context.Context, sessionID string) (*types.Analysis, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	analysis := r.store.analysis(sessionID)
+	if analysis == nil {
+		return nil, nil // No analysis found for this session
+	}
+	result := *analysis
+	return &result, nil
+}
+
+// GetTensionScores retrieves tension scores for a user within a date range, newest first
+func (r *AnalysisRepository) GetTensionScores(ctx context.Context, userID string, startDate, endDate time.Time, limit int) ([]types.TensionScoreData, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var scores []types.TensionScoreData
+	for _, row := range r.store.analyzedSessions(userID, startDate, endDate) {
+		score := types.TensionScoreData{
+			Date:         row.session.date,
+			TensionScore: row.analysis.TensionScore,
+			SessionID:    row.session.ID,
+		}
+		if row.analysis.RelativeScore != nil {
+			score.RelativeScore = *row.analysis.RelativeScore
+		}
+		scores = append(scores, score)
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Date > scores[j].Date })
+
+	return page(scores, limit, 0), nil
+}
+
+// GetEmotionalStates retrieves stored emotional states for a user within a date range, oldest first
+func (r *AnalysisRepository) GetEmotionalStates(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.EmotionalStateRecord, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var records []types.EmotionalStateRecord
+	for _, row := range r.store.analyzedSessions(userID, startDate, endDate) {
+		records = append(records, types.EmotionalStateRecord{
+			Date:           row.session.date,
+			SessionID:      row.session.ID,
+			EmotionalState: row.analysis.EmotionalState,
+		})
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Date < records[j].Date })
+
+	return records, nil
+}
+
+// GetTensionFactorSamples retrieves analyzed days with their keywords, message topics and mentioned entities
+func (r *AnalysisRepository) GetTensionFactorSamples(ctx context.Context, userID string, startDate, endDate time.Time) ([]types.TensionFactorSample, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var samples []types.TensionFactorSample
+	for _, row := range r.store.analyzedSessions(userID, startDate, endDate) {
+		sample := types.TensionFactorSample{
+			Date:         row.session.date,
+			SessionID:    row.session.ID,
+			TensionScore: row.analysis.TensionScore,
+			Topics:       []string{},
+			Entities:     []string{},
+		}
+		if err := json.Unmarshal(row.analysis.Keywords, &sample.Keywords); err != nil {
+			// Keywords are free-form AI output; treat anything that is not a string array as empty
+			sample.Keywords = nil
+		}
+
+		seen := make(map[string]bool)
+		for _, msg := range r.store.sessionMessages(row.session.ID) {
+			var metadata struct {
+				Annotation struct {
+					Topics []string `json:"topics"`
+				} `json:"annotation"`
+			}
+			if json.Unmarshal(msg.Metadata, &metadata) != nil {
+				continue
+			}
+			for _, topic := range metadata.Annotation.Topics {
+				if !seen[topic] {
+					seen[topic] = true
+					sample.Topics = append(sample.Topics, topic)
+				}
+			}
+		}
+		sort.Strings(sample.Topics)
+
+		for _, mention := range r.store.entityMentions {
+			if mention.sessionID != row.session.ID {
+				continue
+			}
+			if entity := r.store.entity(mention.entityID); entity != nil {
+				sample.Entities = append(sample.Entities, entity.Kind+":"+entity.Name)
+			}
+		}
+
+		samples = append(samples, sample)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Date < samples[j].Date })
+
+	return samples, nil
+}
+
+// GetTensionStatistics calculates the average, minimum and maximum tension score of a user over the
+// last days; the trend and the other time-series fields are left for the service to compute
+func (r *AnalysisRepository) GetTensionStatistics(ctx context.Context, userID string, days int) (*types.TensionStatistics, error) {
+	endDate := r.store.Now()
+	startDate := endDate.AddDate(0, 0, -days)
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stats := &types.TensionStatistics{}
+	rows := r.store.analyzedSessions(userID, startDate, endDate)
+	if len(rows) == 0 {
+		return stats, nil
+	}
+
+	sum := 0
+	stats.Min, stats.Max = rows[0].analysis.TensionScore, rows[0].analysis.TensionScore
+	for _, row := range rows {
+		score := row.analysis.TensionScore
+		sum += score
+		stats.Min = min(stats.Min, score)
+		stats.Max = max(stats.Max, score)
+	}
+	stats.Average = float64(sum) / float64(len(rows))
+
+	return stats, nil
+}
+
+// UpdateAnalysis updates analysis columns by name
+func (r *AnalysisRepository) UpdateAnalysis(ctx context.Context, analysisID string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var analysis *types.Analysis
+	for _, row := range r.store.analyses {
+		if row.ID == analysisID {
+			analysis = row
+		}
+	}
+	if analysis == nil {
+		return nil
+	}
+
+	for field, value := range updates {
+		var column *json.RawMessage
+		switch field {
+		case "emotional_state":
+			column = &analysis.EmotionalState
+		case "behavioral_insights":
+			column = &analysis.BehavioralInsights
+		case "keywords":
+			column = &analysis.Keywords
+		case "raw_analysis_data":
+			column = &analysis.RawAnalysisData
+		case "summary":
+			summary, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("failed to update analysis: unsupported value for %s", field)
+			}
+			analysis.Summary = summary
+			continue
+		case "tension_score":
+			score, ok := value.(int)
+			if !ok {
+				return fmt.Errorf("failed to update analysis: unsupported value for %s", field)
+			}
+			analysis.TensionScore = score
+			continue
+		case "relative_score":
+			score, ok := value.(int)
+			if !ok {
+				return fmt.Errorf("failed to update analysis: unsupported value for %s", field)
+			}
+			analysis.RelativeScore = &score
+			continue
+		default:
+			return fmt.Errorf("failed to update analysis: unknown column %s", field)
+		}
+
+		jsonValue, err := toJSON(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", field, err)
+		}
+		*column = jsonValue
+	}
+
+	return nil
+}
+
+// DeleteAnalysis deletes an analysis record
+func (r *AnalysisRepository) DeleteAnalysis(ctx context.Context, analysisID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, row := range r.store.analyses {
+		if row.ID == analysisID {
+			r.store.analyses = append(r.store.analyses[:i], r.store.analyses[i+1:]...)
+			return nil
+		}
+	}
+	return apperror.ErrAnalysisNotFound
+}
+
+// GetAnalysesByUserID retrieves a page of a user's analyses following the cursor
+func (r *AnalysisRepository) GetAnalysesByUserID(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.AnalysisHistoryItem, *types.PageCursor, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	compare := strings.Compare
+	value := func(item types.AnalysisHistoryItem) string { return item.SessionDate }
+	switch sort {
+	case types.SortDateAsc, types.SortDateDesc:
+	case types.SortTensionAsc, types.SortTensionDesc:
+		compare = func(a, b string) int {
+			scoreA, _ := strconv.Atoi(a)
+			scoreB, _ := strconv.Atoi(b)
+			return cmp.Compare(scoreA, scoreB)
+		}
+		value = func(item types.AnalysisHistoryItem) string { return strconv.Itoa(item.TensionScore) }
+	default:
+		return nil, nil, fmt.Errorf("unsupported analysis sort %q", sort)
+	}
+
+	var rows []keyed[types.AnalysisHistoryItem]
+	for _, session := range r.store.userSessions(userID) {
+		analysis := r.store.analysis(session.ID)
+		if analysis == nil || !matchesFilter(session, analysis, filter) {
+			continue
+		}
+		item := types.AnalysisHistoryItem{Analysis: *analysis, SessionDate: session.date}
+		// Listings leave out the raw model output
+		item.RawAnalysisData = nil
+		rows = append(rows, keyed[types.AnalysisHistoryItem]{row: item, value: value(item), id: analysis.ID})
+	}
+
+	analyses, next := keysetPage(rows, sort, compare, after, limit)
+	return analyses, next, nil
+}
+
+// CountAnalyses counts a user's analyses matching the filter
+func (r *AnalysisRepository) CountAnalyses(ctx context.Context, userID string, filter types.SessionFilter) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	total := 0
+	for _, session := range r.store.userSessions(userID) {
+		if analysis := r.store.analysis(session.ID); analysis != nil && matchesFilter(session, analysis, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// analyzedSession joins a session with its analysis
+type analyzedSession struct {
+	session  *sessionRow
+	analysis *types.Analysis
+}
+
+// analysis returns the analysis of a session; the caller holds the lock
+func (s *Store) analysis(sessionID string) *types.Analysis {
+	for _, row := range s.analyses {
+		if row.SessionID == sessionID {
+			return row
+		}
+	}
+	return nil
+}
+
+// analyzedSessions returns a user's analyzed sessions dated within [startDate, endDate]; the caller holds the lock
+func (s *Store) analyzedSessions(userID string, startDate, endDate time.Time) []analyzedSession {
+	var rows []analyzedSession
+	for _, session := range s.userSessions(userID) {
+		if !dateInRange(session.date, startDate, endDate) {
+			continue
+		}
+		if analysis := s.analysis(session.ID); analysis != nil {
+			rows = append(rows, analyzedSession{session: session, analysis: analysis})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,294 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// entityAlias is a normalized name that resolves to an entity, unique per user and kind
+type entityAlias struct {
+	entityID string
+	userID   string
+	kind     string
+	alias    string
+}
+
+// entityMention counts an entity's mentions in a session
+type entityMention struct {
+	entityID     string
+	sessionID    string
+	mentionCount int
+}
+
+// EntityRepository is an in-memory repository.EntityStore
+type EntityRepository struct {
+	store *Store
+}
+
+var _ repository.EntityStore = (*EntityRepository)(nil)
+
+// NewEntityRepository creates a new in-memory entity repository
+func NewEntityRepository(store *Store) *EntityRepository {
+	return &EntityRepository{store: store}
+}
+
+// FindEntityByAlias retrieves the entity a normalized name resolves to, or nil
+func (r *EntityRepository) FindEntityByAlias(ctx context.Context, userID, kind, alias string) (*types.Entity, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	if a := r.store.entityAlias(userID, kind, alias); a != nil {
+		if entity := r.store.entity(a.entityID); entity != nil {
+			result := *entity
+			return &result, nil
+		}
+	}
+	return nil, nil // No entity uses this alias yet
+}
+
+// CreateEntity creates a new entity together with its first alias
+func (r *EntityRepository) CreateEntity(ctx context.Context, userID, kind, name, alias string) (*types.Entity, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.store.entityAlias(userID, kind, alias) != nil {
+		return nil, fmt.Errorf("failed to create entity: duplicate alias %s", alias)
+	}
+
+	now := r.store.Now()
+	entity := &types.Entity{ID: newID(), UserID: userID, Kind: kind, Name: name, CreatedAt: now, UpdatedAt: now}
+	r.store.entities = append(r.store.entities, entity)
+	r.store.entityAliases = append(r.store.entityAliases, &entityAlias{entityID: entity.ID, userID: userID, kind: kind, alias: alias})
+
+	result := *entity
+	return &result, nil
+}
+
+// RecordMention adds to how often an entity was mentioned in a session
+func (r *EntityRepository) RecordMention(ctx context.Context, entityID, sessionID string, mentionCount int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.addMention(entityID, sessionID, mentionCount)
+	return nil
+}
+
+// GetEntities retrieves a user's entities ordered by the number of days they were mentioned
+func (r *EntityRepository) GetEntities(ctx context.Context, userID string, kind *string, limit int) ([]types.EntitySummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var entities []types.EntitySummary
+	for _, entity := range r.store.entities {
+		if entity.UserID != userID || (kind != nil && entity.Kind != *kind) {
+			continue
+		}
+		entities = append(entities, r.store.entitySummary(entity))
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := entities[i], entities[j]
+		if a.DayCount != b.DayCount {
+			return a.DayCount > b.DayCount
+		}
+		if a.MentionCount != b.MentionCount {
+			return a.MentionCount > b.MentionCount
+		}
+		return a.Name < b.Name
+	})
+
+	return page(entities, limit, 0), nil
+}
+
+// GetEntitySummary retrieves a single entity with aggregated mention statistics
+func (r *EntityRepository) GetEntitySummary(ctx context.Context, userID, entityID string) (*types.EntitySummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	entity := r.store.entity(entityID)
+	if entity == nil || entity.UserID != userID {
+		return nil, apperror.ErrEntityNotFound
+	}
+	summary := r.store.entitySummary(entity)
+	return &summary, nil
+}
+
+// GetEntityAliases retrieves the normalized names that resolve to an entity, oldest first
+func (r *EntityRepository) GetEntityAliases(ctx context.Context, entityID string) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	aliases := []string{}
+	for _, a := range r.store.entityAliases {
+		if a.entityID == entityID {
+			aliases = append(aliases, a.alias)
+		}
+	}
+	return aliases, nil
+}
+
+// GetEntityDays retrieves the days an entity was mentioned along with that day's tension score, newest first
+func (r *EntityRepository) GetEntityDays(ctx context.Context, entityID string) ([]types.EntityDay, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	days := []types.EntityDay{}
+	for _, mention := range r.store.entityMentions {
+		if mention.entityID != entityID {
+			continue
+		}
+		session := r.store.session(mention.sessionID)
+		if session == nil {
+			continue
+		}
+		day := types.EntityDay{Date: session.date, SessionID: session.ID, MentionCount: mention.mentionCount}
+		if analysis := r.store.analysis(session.ID); analysis != nil {
+			day.TensionScore = ptr(analysis.TensionScore)
+		}
+		days = append(days, day)
+	}
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Date > days[j].Date })
+
+	return days, nil
+}
+
+// RenameEntity renames an entity and registers the new name as an alias
+func (r *EntityRepository) RenameEntity(ctx context.Context, userID, entityID, name, alias string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	entity := r.store.entity(entityID)
+	if entity == nil || entity.UserID != userID {
+		return apperror.ErrEntityNotFound
+	}
+
+	existing := r.store.entityAlias(userID, entity.Kind, alias)
+	if existing != nil && existing.entityID != entityID {
+		return apperror.ErrEntityNameInUse
+	}
+
+	entity.Name = name
+	entity.UpdatedAt = r.store.Now()
+	if existing == nil {
+		r.store.entityAliases = append(r.store.entityAliases, &entityAlias{entityID: entityID, userID: userID, kind: entity.Kind, alias: alias})
+	}
+
+	return nil
+}
+
+// MergeEntities moves the mentions and aliases of the source entities to the target and deletes the sources
+func (r *EntityRepository) MergeEntities(ctx context.Context, userID, targetID string, sourceIDs []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// All entities must belong to the user and share the target's kind
+	target := r.store.entity(targetID)
+	if target == nil || target.UserID != userID {
+		return apperror.ErrEntityNotFound
+	}
+	sources := make(map[string]bool, len(sourceIDs))
+	for _, id := range sourceIDs {
+		source := r.store.entity(id)
+		if source == nil || source.UserID != userID || source.Kind != target.Kind {
+			return apperror.ErrEntityNotFound
+		}
+		sources[id] = true
+	}
+
+	var mentions []*entityMention
+	var moved []*entityMention
+	for _, mention := range r.store.entityMentions {
+		if sources[mention.entityID] {
+			moved = append(moved, mention)
+		} else {
+			mentions = append(mentions, mention)
+		}
+	}
+	r.store.entityMentions = mentions
+	for _, mention := range moved {
+		r.store.addMention(targetID, mention.sessionID, mention.mentionCount)
+	}
+
+	for _, a := range r.store.entityAliases {
+		if sources[a.entityID] {
+			a.entityID = targetID
+		}
+	}
+
+	var entities []*types.Entity
+	for _, entity := range r.store.entities {
+		if !sources[entity.ID] {
+			entities = append(entities, entity)
+		}
+	}
+	r.store.entities = entities
+
+	return nil
+}
+
+// entity returns an entity row; the caller holds the lock
+func (s *Store) entity(entityID string) *types.Entity {
+	for _, entity := range s.entities {
+		if entity.ID == entityID {
+			return entity
+		}
+	}
+	return nil
+}
+
+// entityAlias returns an alias row; the caller holds the lock
+func (s *Store) entityAlias(userID, kind, alias string) *entityAlias {
+	for _, a := range s.entityAliases {
+		if a.userID == userID && a.kind == kind && a.alias == alias {
+			return a
+		}
+	}
+	return nil
+}
+
+// addMention upserts an entity mention; the caller holds the write lock
+func (s *Store) addMention(entityID, sessionID string, mentionCount int) {
+	for _, mention := range s.entityMentions {
+		if mention.entityID == entityID && mention.sessionID == sessionID {
+			mention.mentionCount += mentionCount
+			return
+		}
+	}
+	s.entityMentions = append(s.entityMentions, &entityMention{entityID: entityID, sessionID: sessionID, mentionCount: mentionCount})
+}
+
+// entitySummary aggregates an entity's mention statistics; the caller holds the lock
+func (s *Store) entitySummary(entity *types.Entity) types.EntitySummary {
+	summary := types.EntitySummary{ID: entity.ID, Kind: entity.Kind, Name: entity.Name}
+
+	days := make(map[string]bool)
+	var tensionSum, tensionCount int
+	for _, mention := range s.entityMentions {
+		if mention.entityID != entity.ID {
+			continue
+		}
+		summary.MentionCount += mention.mentionCount
+		session := s.session(mention.sessionID)
+		if session == nil {
+			continue
+		}
+		days[session.date] = true
+		if summary.LastMentionedOn == nil || session.date > *summary.LastMentionedOn {
+			summary.LastMentionedOn = ptr(session.date)
+		}
+		if analysis := s.analysis(session.ID); analysis != nil {
+			tensionSum += analysis.TensionScore
+			tensionCount++
+		}
+	}
+	summary.DayCount = len(days)
+	if tensionCount > 0 {
+		summary.AverageTensionScore = ptr(float64(tensionSum) / float64(tensionCount))
+	}
+
+	return summary
+}
@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// MessageRepository is an in-memory repository.MessageStore
+type MessageRepository struct {
+	store *Store
+}
+
+var _ repository.MessageStore = (*MessageRepository)(nil)
+
+// NewMessageRepository creates a new in-memory message repository
+func NewMessageRepository(store *Store) *MessageRepository {
+	return &MessageRepository{store: store}
+}
+
+// CreateMessage creates a new message with the next sequence number of its session
+func (r *MessageRepository) CreateMessage(ctx context.Context, sessionID, sender, content string, metadata map[string]interface{}) (*types.Message, error) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadataJSON, err := toJSON(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.store.session(sessionID) == nil {
+		return nil, fmt.Errorf("failed to create message: session %s does not exist", sessionID)
+	}
+
+	sequenceNumber := 1
+	for _, msg := range r.store.messages {
+		if msg.SessionID == sessionID && msg.SequenceNumber >= sequenceNumber {
+			sequenceNumber = msg.SequenceNumber + 1
+		}
+	}
+
+	message := &types.Message{
+		ID:             newID(),
+		SessionID:      sessionID,
+		Sender:         sender,
+		Content:        content,
+		CreatedAt:      r.store.Now(),
+		Metadata:       metadataJSON,
+		SequenceNumber: sequenceNumber,
+	}
+	r.store.messages = append(r.store.messages, message)
+
+	result := *message
+	return &result, nil
+}
+
+// GetSessionMessages retrieves all messages for a session in order
+func (r *MessageRepository) GetSessionMessages(ctx context.Context, sessionID string) ([]types.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.sessionMessages(sessionID), nil
+}
+
+// GetSessionMessagesWithPagination retrieves messages for a session with pagination
+func (r *MessageRepository) GetSessionMessagesWithPagination(ctx context.Context, sessionID string, limit, offset int) ([]types.Message, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	messages := r.store.sessionMessages(sessionID)
+	return page(messages, limit, offset), len(messages), nil
+}
+
+// GetLatestMessages retrieves the latest N messages for a session, oldest first
+func (r *MessageRepository) GetLatestMessages(ctx context.Context, sessionID string, limit int) ([]types.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	messages := r.store.sessionMessages(sessionID)
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+// GetMessageByID retrieves a specific message by ID
+func (r *MessageRepository) GetMessageByID(ctx context.Context, messageID string) (*types.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	msg := r.store.message(messageID)
+	if msg == nil {
+		return nil, apperror.ErrMessageNotFound
+	}
+	result := *msg
+	return &result, nil
+}
+
+// GetConversationLog retrieves all messages for a session as a formatted string for AI analysis
+func (r *MessageRepository) GetConversationLog(ctx context.Context, sessionID string) (string, error) {
+	messages, err := r.GetSessionMessages(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	var log string
+	for _, msg := range messages {
+		senderName := "ユーザー"
+		if msg.Sender == types.SenderAI {
+			senderName = "かさね"
+		}
+		log += fmt.Sprintf("%s: %s\n", senderName, msg.Content)
+	}
+
+	return log, nil
+}
+
+// UpdateMessage replaces a message's content and metadata
+func (r *MessageRepository) UpdateMessage(ctx context.Context, messageID, content string, metadata map[string]interface{}) error {
+	var metadataJSON json.RawMessage
+	if metadata != nil {
+		var err error
+		if metadataJSON, err = toJSON(metadata); err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if msg := r.store.message(messageID); msg != nil {
+		msg.Content = content
+		msg.Metadata = metadataJSON
+	}
+	return nil
+}
+
+// MergeMessageMetadata merges the given keys into a message's metadata
+func (r *MessageRepository) MergeMessageMetadata(ctx context.Context, messageID string, metadata map[string]interface{}) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	msg := r.store.message(messageID)
+	if msg == nil {
+		return apperror.ErrMessageNotFound
+	}
+
+	merged, err := decodeMetadata(msg.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to update message metadata: %w", err)
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	if msg.Metadata, err = toJSON(merged); err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	return nil
+}
+
+// ClearMessageMetadataKey removes a key from a message's metadata; it reports false if the key was not set
+func (r *MessageRepository) ClearMessageMetadataKey(ctx context.Context, messageID, key string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	msg := r.store.message(messageID)
+	if msg == nil {
+		return false, nil
+	}
+
+	metadata, err := decodeMetadata(msg.Metadata)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear message metadata: %w", err)
+	}
+	if _, ok := metadata[key]; !ok {
+		return false, nil
+	}
+	delete(metadata, key)
+	if msg.Metadata, err = toJSON(metadata); err != nil {
+		return false, fmt.Errorf("failed to clear message metadata: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteMessage deletes a message
+func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, msg := range r.store.messages {
+		if msg.ID == messageID {
+			r.store.messages = append(r.store.messages[:i], r.store.messages[i+1:]...)
+			return nil
+		}
+	}
+	return apperror.ErrMessageNotFound
+}
+
+// GetMessageCount returns the total number of messages for a session
+func (r *MessageRepository) GetMessageCount(ctx context.Context, sessionID string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.messageCount(sessionID), nil
+}
+
+// decodeMetadata decodes a metadata column, treating NULL as an empty object
+func decodeMetadata(raw json.RawMessage) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return metadata, nil
+	}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// message returns a message row; the caller holds the lock
+func (s *Store) message(messageID string) *types.Message {
+	for _, msg := range s.messages {
+		if msg.ID == messageID {
+			return msg
+		}
+	}
+	return nil
+}
+
+// sessionMessages returns copies of a session's messages ordered by sequence number; the caller holds the lock
+func (s *Store) sessionMessages(sessionID string) []types.Message {
+	var messages []types.Message
+	for _, msg := range s.messages {
+		if msg.SessionID == sessionID {
+			messages = append(messages, *msg)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].SequenceNumber < messages[j].SequenceNumber })
+	return messages
+}
+
+// messageCount counts a session's messages; the caller holds the lock
+func (s *Store) messageCount(sessionID string) int {
+	count := 0
+	for _, msg := range s.messages {
+		if msg.SessionID == sessionID {
+			count++
+		}
+	}
+	return count
+}
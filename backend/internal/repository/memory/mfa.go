@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// recoveryCode is a row of mfa_recovery_codes
+type recoveryCode struct {
+	userID   string
+	codeHash string
+	usedAt   *time.Time
+}
+
+// MFARepository is an in-memory repository.MFAStore
+type MFARepository struct {
+	store *Store
+}
+
+var _ repository.MFAStore = (*MFARepository)(nil)
+
+// NewMFARepository creates a new in-memory MFA repository
+func NewMFARepository(store *Store) *MFARepository {
+	return &MFARepository{store: store}
+}
+
+// GetMFAState retrieves a user's TOTP secret and whether it is enabled
+func (r *MFARepository) GetMFAState(ctx context.Context, userID string) (*types.MFAState, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.user(userID)
+	if row == nil {
+		return nil, apperror.ErrUserNotFound
+	}
+	state := row.mfa
+	return &state, nil
+}
+
+// SetTOTPSecret stores a secret pending verification; it replaces an earlier pending secret
+func (r *MFARepository) SetTOTPSecret(ctx context.Context, userID, secret string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil || row.mfa.EnabledAt != nil {
+		return apperror.ErrMFAAlreadyEnabled
+	}
+	row.mfa = types.MFAState{Secret: &secret}
+	return nil
+}
+
+// EnableMFA turns on the pending secret, marks counter as used and stores the recovery code hashes
+func (r *MFARepository) EnableMFA(ctx context.Context, userID string, counter int64, codeHashes []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil || row.mfa.Secret == nil || row.mfa.EnabledAt != nil {
+		return apperror.ErrMFAAlreadyEnabled
+	}
+	row.mfa.EnabledAt = ptr(r.store.Now())
+	row.mfa.LastCounter = &counter
+	r.store.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// DisableMFA removes a user's TOTP secret and recovery codes
+func (r *MFARepository) DisableMFA(ctx context.Context, userID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.mfa = types.MFAState{}
+	}
+	r.store.replaceRecoveryCodes(userID, nil)
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all of a user's recovery codes
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether there was one
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, code := range r.store.recoveryCodes {
+		if code.userID == userID && code.codeHash == codeHash && code.usedAt == nil {
+			code.usedAt = ptr(r.store.Now())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, code := range r.store.recoveryCodes {
+		if code.userID == userID && code.usedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ClaimTOTPCounter records that the code of a time step was used, and reports false if that step
+// or a later one was used already
+func (r *MFARepository) ClaimTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil || (row.mfa.LastCounter != nil && *row.mfa.LastCounter >= counter) {
+		return false, nil
+	}
+	row.mfa.LastCounter = &counter
+	return true, nil
+}
+
+// StartMFAChallenge records the pending second step of a login, replacing an earlier one
+func (r *MFARepository) StartMFAChallenge(ctx context.Context, userID, challenge string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil {
+		return apperror.ErrUserNotFound
+	}
+	row.mfa.Challenge = &challenge
+	return nil
+}
+
+// FinishMFAChallenge clears the pending second step of a login, and reports false if challenge was
+// not the pending one (it was finished already, replaced, or dropped by a password change)
+func (r *MFARepository) FinishMFAChallenge(ctx context.Context, userID, challenge string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil || row.mfa.Challenge == nil || *row.mfa.Challenge != challenge {
+		return false, nil
+	}
+	row.mfa.Challenge = nil
+	return true, nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and adds new ones; the caller holds the lock
+func (s *Store) replaceRecoveryCodes(userID string, codeHashes []string) {
+	kept := s.recoveryCodes[:0:0]
+	for _, code := range s.recoveryCodes {
+		if code.userID != userID {
+			kept = append(kept, code)
+		}
+	}
+	for _, hash := range codeHashes {
+		kept = append(kept, &recoveryCode{userID: userID, codeHash: hash})
+	}
+	s.recoveryCodes = kept
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// resetToken is a row of password_reset_tokens
+type resetToken struct {
+	userID    string
+	tokenHash string
+	expiresAt time.Time
+	usedAt    *time.Time
+}
+
+// PasswordResetRepository is an in-memory repository.PasswordResetStore
+type PasswordResetRepository struct {
+	store *Store
+}
+
+var _ repository.PasswordResetStore = (*PasswordResetRepository)(nil)
+
+// NewPasswordResetRepository creates a new in-memory password reset repository
+func NewPasswordResetRepository(store *Store) *PasswordResetRepository {
+	return &PasswordResetRepository{store: store}
+}
+
+// CreateResetToken stores the hash of a new reset token for a user; the user's earlier unused
+// tokens stop working
+func (r *PasswordResetRepository) CreateResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.deleteUnusedResetTokens(userID)
+	r.store.resetTokens = append(r.store.resetTokens, &resetToken{userID: userID, tokenHash: tokenHash, expiresAt: expiresAt})
+	return nil
+}
+
+// ResetPassword uses an unexpired reset token to set its user's password, clearing their failed
+// logins, and returns the user ID
+func (r *PasswordResetRepository) ResetPassword(ctx context.Context, tokenHash, password string, now time.Time) (string, error) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, token := range r.store.resetTokens {
+		if token.tokenHash != tokenHash || token.usedAt != nil || !token.expiresAt.After(now) {
+			continue
+		}
+		row := r.store.activeUser(token.userID)
+		if row == nil {
+			break
+		}
+		token.usedAt = &now
+		row.PasswordHash = hashedPassword
+		row.passwordChangedAt = &now
+		row.mfa.Challenge = nil
+		row.login = types.LoginState{}
+		row.UpdatedAt = now
+		r.store.deleteUnusedResetTokens(token.userID)
+		return token.userID, nil
+	}
+	return "", apperror.ErrInvalidResetToken
+}
+
+// deleteUnusedResetTokens deletes a user's unused reset tokens; the caller holds the lock
+func (s *Store) deleteUnusedResetTokens(userID string) {
+	kept := s.resetTokens[:0:0]
+	for _, token := range s.resetTokens {
+		if token.userID != userID || token.usedAt != nil {
+			kept = append(kept, token)
+		}
+	}
+	s.resetTokens = kept
+}
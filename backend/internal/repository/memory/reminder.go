@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ReminderRepository is an in-memory repository.ReminderStore
+type ReminderRepository struct {
+	store *Store
+}
+
+var _ repository.ReminderStore = (*ReminderRepository)(nil)
+
+// NewReminderRepository creates a new in-memory reminder repository
+func NewReminderRepository(store *Store) *ReminderRepository {
+	return &ReminderRepository{store: store}
+}
+
+// GetReminderSettings retrieves a user's reminder settings, or nil if the user has not configured them
+func (r *ReminderRepository) GetReminderSettings(ctx context.Context, userID string) (*types.ReminderSettings, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	settings, ok := r.store.reminderSettings[userID]
+	if !ok {
+		return nil, nil // Defaults apply
+	}
+	return copyReminderSettings(settings), nil
+}
+
+// UpsertReminderSettings creates or replaces a user's reminder settings, keeping the last reminded date
+func (r *ReminderRepository) UpsertReminderSettings(ctx context.Context, settings *types.ReminderSettings) (*types.ReminderSettings, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	saved := copyReminderSettings(settings)
+	saved.LastRemindedOn = nil
+	if existing, ok := r.store.reminderSettings[settings.UserID]; ok {
+		saved.LastRemindedOn = existing.LastRemindedOn
+	}
+	saved.UpdatedAt = r.store.Now()
+	r.store.reminderSettings[settings.UserID] = saved
+
+	return copyReminderSettings(saved), nil
+}
+
+// GetEnabledReminderSettings retrieves the settings of active users with reminders turned on
+func (r *ReminderRepository) GetEnabledReminderSettings(ctx context.Context) ([]types.ReminderSettings, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var settingsList []types.ReminderSettings
+	for _, user := range r.store.users {
+		settings, ok := r.store.reminderSettings[user.ID]
+		if ok && settings.Enabled && user.IsActive {
+			settingsList = append(settingsList, *copyReminderSettings(settings))
+		}
+	}
+	return settingsList, nil
+}
+
+// ClaimReminder records that the user's reminder for the given local date is being handled.
+// It returns false if it was already handled.
+func (r *ReminderRepository) ClaimReminder(ctx context.Context, userID, localDate string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	settings, ok := r.store.reminderSettings[userID]
+	if !ok || (settings.LastRemindedOn != nil && *settings.LastRemindedOn >= localDate) {
+		return false, nil
+	}
+	settings.LastRemindedOn = ptr(localDate)
+	return true, nil
+}
+
+// SavePushSubscription registers a browser push subscription, replacing an existing one for the endpoint
+func (r *ReminderRepository) SavePushSubscription(ctx context.Context, userID, endpoint, p256dh, auth string) (*types.PushSubscription, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, subscription := range r.store.pushSubscriptions {
+		if subscription.Endpoint == endpoint {
+			subscription.UserID, subscription.P256dh, subscription.Auth = userID, p256dh, auth
+			result := *subscription
+			return &result, nil
+		}
+	}
+
+	subscription := &types.PushSubscription{
+		ID:        newID(),
+		UserID:    userID,
+		Endpoint:  endpoint,
+		P256dh:    p256dh,
+		Auth:      auth,
+		CreatedAt: r.store.Now(),
+	}
+	r.store.pushSubscriptions = append(r.store.pushSubscriptions, subscription)
+
+	result := *subscription
+	return &result, nil
+}
+
+// GetPushSubscriptions retrieves a user's push subscriptions
+func (r *ReminderRepository) GetPushSubscriptions(ctx context.Context, userID string) ([]types.PushSubscription, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var subscriptions []types.PushSubscription
+	for _, subscription := range r.store.pushSubscriptions {
+		if subscription.UserID == userID {
+			subscriptions = append(subscriptions, *subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+// DeletePushSubscription removes one of a user's push subscriptions
+func (r *ReminderRepository) DeletePushSubscription(ctx context.Context, userID, endpoint string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, subscription := range r.store.pushSubscriptions {
+		if subscription.UserID == userID && subscription.Endpoint == endpoint {
+			r.store.pushSubscriptions = append(r.store.pushSubscriptions[:i], r.store.pushSubscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return apperror.ErrSubscriptionNotFound
+}
+
+// DeletePushSubscriptionsByEndpoint removes subscriptions the push service reported as expired
+func (r *ReminderRepository) DeletePushSubscriptionsByEndpoint(ctx context.Context, endpoints []string) error {
+	expired := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		expired[endpoint] = true
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var subscriptions []*types.PushSubscription
+	for _, subscription := range r.store.pushSubscriptions {
+		if !expired[subscription.Endpoint] {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	r.store.pushSubscriptions = subscriptions
+
+	return nil
+}
+
+func copyReminderSettings(settings *types.ReminderSettings) *types.ReminderSettings {
+	result := *settings
+	result.Channels = cloneStrings(settings.Channels)
+	if result.Channels == nil {
+		result.Channels = []string{}
+	}
+	return &result
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// countedLoginFailures are the failure reasons CountFailedLoginsByIP counts
+var countedLoginFailures = map[string]bool{
+	types.LoginFailureUnknownUser:     true,
+	types.LoginFailureInvalidPassword: true,
+	types.LoginFailureInvalidMFACode:  true,
+}
+
+// SecurityRepository is an in-memory repository.SecurityStore
+type SecurityRepository struct {
+	store *Store
+}
+
+var _ repository.SecurityStore = (*SecurityRepository)(nil)
+
+// NewSecurityRepository creates a new in-memory security repository
+func NewSecurityRepository(store *Store) *SecurityRepository {
+	return &SecurityRepository{store: store}
+}
+
+// GetLoginState retrieves a user's failed login count and lockout
+func (r *SecurityRepository) GetLoginState(ctx context.Context, userID string) (*types.LoginState, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.user(userID)
+	if row == nil {
+		return nil, apperror.ErrUserNotFound
+	}
+	state := row.login
+	return &state, nil
+}
+
+// IncrementFailedLogins counts a failed login and returns the failures since the last successful one
+func (r *SecurityRepository) IncrementFailedLogins(ctx context.Context, userID string) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil {
+		return 0, apperror.ErrUserNotFound
+	}
+	row.login.FailedLoginCount++
+	return row.login.FailedLoginCount, nil
+}
+
+// LockUser refuses the user's logins until the given time
+func (r *SecurityRepository) LockUser(ctx context.Context, userID string, until time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.login.LockedUntil = &until
+	}
+	return nil
+}
+
+// ResetFailedLogins clears a user's failed login count and lockout
+func (r *SecurityRepository) ResetFailedLogins(ctx context.Context, userID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.login = types.LoginState{}
+	}
+	return nil
+}
+
+// CreateSecurityEvent records a security event
+func (r *SecurityRepository) CreateSecurityEvent(ctx context.Context, event *types.SecurityEvent) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	event.ID = newID()
+	event.CreatedAt = r.store.Now()
+	row := *event
+	r.store.securityEvents = append(r.store.securityEvents, &row)
+
+	return nil
+}
+
+// CountFailedLoginsByIP counts the failed logins from an IP address since a time, and returns the
+// time of the oldest of them (nil if there are none). Attempts refused before checking the password
+// or code (locked accounts, throttled IPs) are not counted.
+func (r *SecurityRepository) CountFailedLoginsByIP(ctx context.Context, ipAddress string, since time.Time) (int, *time.Time, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	var oldest *time.Time
+	for _, event := range r.store.securityEvents {
+		if event.EventType != types.SecurityEventLoginFailed || event.IPAddress == nil || *event.IPAddress != ipAddress || event.CreatedAt.Before(since) {
+			continue
+		}
+		if event.Reason == nil || !countedLoginFailures[*event.Reason] {
+			continue
+		}
+		count++
+		if oldest == nil || event.CreatedAt.Before(*oldest) {
+			oldest = ptr(event.CreatedAt)
+		}
+	}
+	return count, oldest, nil
+}
+
+// CountUnknownUserLogins counts the failed logins with a username that has no account since a time,
+// and returns the time of the latest of them (nil if there are none)
+func (r *SecurityRepository) CountUnknownUserLogins(ctx context.Context, username string, since time.Time) (int, *time.Time, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	var latest *time.Time
+	for _, event := range r.store.securityEvents {
+		if event.EventType != types.SecurityEventLoginFailed || event.Reason == nil || *event.Reason != types.LoginFailureUnknownUser {
+			continue
+		}
+		if event.Username == nil || *event.Username != username || event.CreatedAt.Before(since) {
+			continue
+		}
+		count++
+		if latest == nil || event.CreatedAt.After(*latest) {
+			latest = ptr(event.CreatedAt)
+		}
+	}
+	return count, latest, nil
+}
+
+// GetSecurityEvents retrieves a user's most recent security events
+func (r *SecurityRepository) GetSecurityEvents(ctx context.Context, userID string, limit int) ([]types.SecurityEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	events := []types.SecurityEvent{}
+	for i := len(r.store.securityEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		event := r.store.securityEvents[i]
+		if event.UserID != nil && *event.UserID == userID {
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// SessionRepository is an in-memory repository.SessionStore
+type SessionRepository struct {
+	store *Store
+}
+
+var _ repository.SessionStore = (*SessionRepository)(nil)
+
+// NewSessionRepository creates a new in-memory session repository
+func NewSessionRepository(store *Store) *SessionRepository {
+	return &SessionRepository{store: store}
+}
+
+// GetTodaySession retrieves today's session for a user
+func (r *SessionRepository) GetTodaySession(ctx context.Context, userID string) (*types.ChatSession, error) {
+	today := timeutil.FormatJST(r.store.Now(), "2006-01-02")
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.sessions {
+		if row.UserID == userID && row.date == today {
+			session := row.ChatSession
+			return &session, nil
+		}
+	}
+	return nil, nil // No session found for today
+}
+
+// CreateSession creates a new chat session
+func (r *SessionRepository) CreateSession(ctx context.Context, userID, date string) (*types.ChatSession, error) {
+	// Dates scan from Postgres as midnight UTC
+	sessionDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, row := range r.store.sessions {
+		if row.UserID == userID && row.date == date {
+			return nil, apperror.ErrSessionExists
+		}
+	}
+
+	now := r.store.Now()
+	row := &sessionRow{
+		ChatSession: types.ChatSession{
+			ID:          newID(),
+			UserID:      userID,
+			SessionDate: sessionDate,
+			Status:      types.SessionStatusActive,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		date: date,
+	}
+	r.store.sessions = append(r.store.sessions, row)
+
+	session := row.ChatSession
+	return &session, nil
+}
+
+// GetSessionByID retrieves a session by ID
+func (r *SessionRepository) GetSessionByID(ctx context.Context, sessionID string) (*types.ChatSession, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.session(sessionID)
+	if row == nil {
+		return nil, apperror.ErrSessionNotFound
+	}
+	session := row.ChatSession
+	return &session, nil
+}
+
+// CompleteSession marks a session as completed
+func (r *SessionRepository) CompleteSession(ctx context.Context, sessionID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.session(sessionID); row != nil {
+		now := r.store.Now()
+		row.Status = types.SessionStatusCompleted
+		row.CompletedAt = &now
+		row.UpdatedAt = now
+	}
+	return nil
+}
+
+// GetUserSessions retrieves a page of a user's sessions following the cursor
+func (r *SessionRepository) GetUserSessions(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.SessionSummary, *types.PageCursor, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	compare := strings.Compare
+	value := func(row *sessionRow) string { return row.date }
+	switch sort {
+	case types.SortDateAsc, types.SortDateDesc:
+	case types.SortUpdatedAsc, types.SortUpdatedDesc:
+		compare = compareTimes
+		value = func(row *sessionRow) string { return row.UpdatedAt.UTC().Format(time.RFC3339Nano) }
+	default:
+		return nil, nil, fmt.Errorf("unsupported session sort %q", sort)
+	}
+
+	var rows []keyed[types.SessionSummary]
+	for _, row := range r.store.userSessions(userID) {
+		analysis := r.store.analysis(row.ID)
+		if !matchesFilter(row, analysis, filter) {
+			continue
+		}
+		rows = append(rows, keyed[types.SessionSummary]{
+			row: types.SessionSummary{
+				ID:           row.ID,
+				Date:         row.date,
+				Status:       row.Status,
+				MessageCount: r.store.messageCount(row.ID),
+				HasAnalysis:  analysis != nil,
+				CreatedAt:    row.CreatedAt,
+				UpdatedAt:    row.UpdatedAt,
+			},
+			value: value(row),
+			id:    row.ID,
+		})
+	}
+
+	sessions, next := keysetPage(rows, sort, compare, after, limit)
+	return sessions, next, nil
+}
+
+// CountUserSessions counts a user's sessions matching the filter
+func (r *SessionRepository) CountUserSessions(ctx context.Context, userID string, filter types.SessionFilter) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	total := 0
+	for _, row := range r.store.userSessions(userID) {
+		if matchesFilter(row, r.store.analysis(row.ID), filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// compareTimes compares RFC 3339 timestamps
+func compareTimes(a, b string) int {
+	timeA, _ := time.Parse(time.RFC3339Nano, a)
+	timeB, _ := time.Parse(time.RFC3339Nano, b)
+	return timeA.Compare(timeB)
+}
+
+// GetCalendarData retrieves calendar data for a specific month
+func (r *SessionRepository) GetCalendarData(ctx context.Context, userID string, year, month int) ([]types.CalendarDay, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var days []types.CalendarDay
+	for _, row := range r.store.userSessions(userID) {
+		if row.SessionDate.Year() != year || int(row.SessionDate.Month()) != month {
+			continue
+		}
+		day := types.CalendarDay{
+			Date:         row.date,
+			HasSession:   true,
+			Status:       row.Status,
+			MessageCount: ptr(r.store.messageCount(row.ID)),
+		}
+		if analysis := r.store.analysis(row.ID); analysis != nil {
+			day.TensionScore = ptr(analysis.TensionScore)
+		}
+		days = append(days, day)
+	}
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	return days, nil
+}
+
+// CheckSessionOwnership verifies if a session belongs to a user
+func (r *SessionRepository) CheckSessionOwnership(ctx context.Context, sessionID, userID string) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.session(sessionID)
+	return row != nil && row.UserID == userID, nil
+}
+
+// HasUserMessagesSince checks whether the user has written anything since the given time
+func (r *SessionRepository) HasUserMessagesSince(ctx context.Context, userID string, since time.Time) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.userSessions(userID) {
+		for _, msg := range r.store.messages {
+			if msg.SessionID == row.ID && msg.Sender == types.SenderUser && !msg.CreatedAt.Before(since) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// CountSessionsAwaitingAnalysis counts sessions without an analysis that are either completed
+// or active with at least minMessages messages
+func (r *SessionRepository) CountSessionsAwaitingAnalysis(ctx context.Context, minMessages int) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, row := range r.store.sessions {
+		if r.store.analysis(row.ID) != nil {
+			continue
+		}
+		if row.Status == types.SessionStatusCompleted || r.store.messageCount(row.ID) >= minMessages {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetActiveSessionsWithMinMessages retrieves active sessions with at least minMessages messages and no analysis
+func (r *SessionRepository) GetActiveSessionsWithMinMessages(ctx context.Context, minMessages int) ([]types.SessionForBatch, error) {
+	return r.getUnanalyzedSessions(types.SessionStatusActive, minMessages), nil
+}
+
+// GetUnanalyzedCompletedSessions retrieves completed sessions with at least minMessages messages and no analysis
+func (r *SessionRepository) GetUnanalyzedCompletedSessions(ctx context.Context, minMessages int) ([]types.SessionForBatch, error) {
+	return r.getUnanalyzedSessions(types.SessionStatusCompleted, minMessages), nil
+}
+
+func (r *SessionRepository) getUnanalyzedSessions(status string, minMessages int) []types.SessionForBatch {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var sessions []types.SessionForBatch
+	for _, row := range r.store.sessions {
+		count := r.store.messageCount(row.ID)
+		if row.Status != status || count < minMessages || r.store.analysis(row.ID) != nil {
+			continue
+		}
+		sessions = append(sessions, types.SessionForBatch{
+			ID:           row.ID,
+			UserID:       row.UserID,
+			Date:         row.date,
+			Status:       row.Status,
+			MessageCount: count,
+			CreatedAt:    row.CreatedAt,
+			UpdatedAt:    row.UpdatedAt,
+		})
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Date > sessions[j].Date })
+
+	return sessions
+}
+
+// session returns the row of a session; the caller holds the lock
+func (s *Store) session(sessionID string) *sessionRow {
+	for _, row := range s.sessions {
+		if row.ID == sessionID {
+			return row
+		}
+	}
+	return nil
+}
+
+// userSessions returns a user's session rows; the caller holds the lock
+func (s *Store) userSessions(userID string) []*sessionRow {
+	var rows []*sessionRow
+	for _, row := range s.sessions {
+		if row.UserID == userID {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
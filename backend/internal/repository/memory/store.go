@@ -0,0 +1,198 @@
+// Package memory provides thread-safe in-memory implementations of the repository interfaces,
+// so that services can be tested without Postgres.
+//
+// The repositories share a Store the way the Postgres repositories share a Database, which lets
+// queries that join tables (e.g. sessions with their message counts) behave like their SQL counterparts.
+package memory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// Store holds the rows of every in-memory repository. Rows are kept in insertion order.
+type Store struct {
+	mu sync.RWMutex
+
+	users             []*userRow
+	sessions          []*sessionRow
+	messages          []*types.Message
+	analyses          []*types.Analysis
+	entities          []*types.Entity
+	entityAliases     []*entityAlias
+	entityMentions    []*entityMention
+	alertSettings     map[string]*types.AlertSettings
+	notifications     []*types.Notification
+	reminderSettings  map[string]*types.ReminderSettings
+	pushSubscriptions []*types.PushSubscription
+	webhooks          []*webhookRow
+	deliveries        []*types.WebhookDelivery
+	usage             []*types.AIUsage
+	quotas            map[string]*types.AIQuota
+	securityEvents    []*types.SecurityEvent
+	recoveryCodes     []*recoveryCode
+	resetTokens       []*resetToken
+
+	// Now is the clock used for timestamps; tests may replace it before use
+	Now func() time.Time
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		alertSettings:    make(map[string]*types.AlertSettings),
+		reminderSettings: make(map[string]*types.ReminderSettings),
+		quotas:           make(map[string]*types.AIQuota),
+		Now:              timeutil.NowJST,
+	}
+}
+
+// sessionRow is a chat session with its date as stored (YYYY-MM-DD)
+type sessionRow struct {
+	types.ChatSession
+	date string
+}
+
+// newID returns a random UUID (version 4), like the database's uuid_generate_v4()
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	id := hex.EncodeToString(b[:])
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+// toJSON marshals a value the way the repositories store JSONB columns
+func toJSON(value interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// dateInRange reports whether a session date lies within [start, end], compared as JST dates
+func dateInRange(date string, start, end time.Time) bool {
+	return date >= timeutil.FormatJST(start, "2006-01-02") && date <= timeutil.FormatJST(end, "2006-01-02")
+}
+
+// matchesFilter reports whether a session and its analysis (nil if none) pass a listing filter; the caller holds the lock
+func matchesFilter(session *sessionRow, analysis *types.Analysis, filter types.SessionFilter) bool {
+	switch {
+	case filter.DateFrom != nil && session.date < *filter.DateFrom,
+		filter.DateTo != nil && session.date > *filter.DateTo,
+		filter.Year != nil && session.SessionDate.Year() != *filter.Year,
+		filter.Month != nil && int(session.SessionDate.Month()) != *filter.Month,
+		filter.Status != nil && session.Status != *filter.Status,
+		filter.HasAnalysis != nil && (analysis != nil) != *filter.HasAnalysis:
+		return false
+	}
+	if filter.MinTension == nil && filter.MaxTension == nil && filter.Emotion == nil && filter.Keyword == nil {
+		return true
+	}
+
+	// The remaining filters only match analyzed sessions, as with SQL comparisons against NULL
+	if analysis == nil {
+		return false
+	}
+	if filter.MinTension != nil && analysis.TensionScore < *filter.MinTension ||
+		filter.MaxTension != nil && analysis.TensionScore > *filter.MaxTension {
+		return false
+	}
+	if filter.Emotion != nil {
+		var state struct {
+			PrimaryEmotion string `json:"primary_emotion"`
+		}
+		if json.Unmarshal(analysis.EmotionalState, &state) != nil || state.PrimaryEmotion != *filter.Emotion {
+			return false
+		}
+	}
+	if filter.Keyword != nil {
+		var keywords []interface{}
+		json.Unmarshal(analysis.Keywords, &keywords)
+		found := false
+		for _, keyword := range keywords {
+			if keyword == *filter.Keyword {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// keyed is a listing row with its sort key
+type keyed[T any] struct {
+	row   T
+	value string
+	id    string
+}
+
+// keysetPage orders rows by their sort key then ID, and returns the page following the cursor
+// with the cursor of the next page, like the Postgres listings
+func keysetPage[T any](rows []keyed[T], sort string, compare func(a, b string) int, after *types.PageCursor, limit int) ([]T, *types.PageCursor) {
+	desc := strings.HasPrefix(sort, "-")
+	order := func(a, b keyed[T]) int {
+		c := compare(a.value, b.value)
+		if c == 0 {
+			c = strings.Compare(a.id, b.id)
+		}
+		if desc {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(rows, order)
+
+	if after != nil {
+		position := keyed[T]{value: after.Value, id: after.ID}
+		rows = slices.DeleteFunc(rows, func(row keyed[T]) bool { return order(row, position) <= 0 })
+	}
+
+	result := []T{}
+	for i, row := range rows {
+		if i == limit {
+			last := rows[i-1]
+			return result, &types.PageCursor{Sort: sort, Value: last.value, ID: last.id}
+		}
+		result = append(result, row.row)
+	}
+	return result, nil
+}
+
+// page applies LIMIT and OFFSET to a result
+func page[T any](rows []T, limit, offset int) []T {
+	if offset >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+)
+
+// TxManager is an in-memory repository.TxManager. A unit of work snapshots the store and restores
+// the snapshot if it fails, so units of work are serialized and cannot be nested; writes made outside
+// of one while it is rolled back are undone as well.
+type TxManager struct {
+	store *Store
+	mu    sync.Mutex
+}
+
+var _ repository.TxManager = (*TxManager)(nil)
+
+// NewTxManager creates a new in-memory transaction manager
+func NewTxManager(store *Store) *TxManager {
+	return &TxManager{store: store}
+}
+
+// WithTx implements repository.TxManager
+func (m *TxManager) WithTx(ctx context.Context, fn func(tx repository.Repos) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.store.snapshot()
+	if err := fn(NewRepos(m.store)); err != nil {
+		m.store.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// NewRepos creates every in-memory repository on the same store
+func NewRepos(store *Store) repository.Repos {
+	return repository.Repos{
+		Users:     NewUserRepository(store),
+		Sessions:  NewSessionRepository(store),
+		Messages:  NewMessageRepository(store),
+		Analyses:  NewAnalysisRepository(store),
+		Entities:  NewEntityRepository(store),
+		Alerts:    NewAlertRepository(store),
+		Reminders: NewReminderRepository(store),
+		Webhooks:  NewWebhookRepository(store),
+		Usage:     NewUsageRepository(store),
+	}
+}
+
+// snapshot copies the rows of the store
+func (s *Store) snapshot() *Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &Store{
+		users:             cloneRows(s.users),
+		sessions:          cloneRows(s.sessions),
+		messages:          cloneRows(s.messages),
+		analyses:          cloneRows(s.analyses),
+		entities:          cloneRows(s.entities),
+		entityAliases:     cloneRows(s.entityAliases),
+		entityMentions:    cloneRows(s.entityMentions),
+		alertSettings:     cloneMap(s.alertSettings),
+		notifications:     cloneRows(s.notifications),
+		reminderSettings:  cloneMap(s.reminderSettings),
+		pushSubscriptions: cloneRows(s.pushSubscriptions),
+		webhooks:          cloneRows(s.webhooks),
+		deliveries:        cloneRows(s.deliveries),
+		usage:             cloneRows(s.usage),
+		quotas:            cloneMap(s.quotas),
+		securityEvents:    cloneRows(s.securityEvents),
+		recoveryCodes:     cloneRows(s.recoveryCodes),
+		resetTokens:       cloneRows(s.resetTokens),
+	}
+}
+
+// restore puts back the rows of a snapshot
+func (s *Store) restore(snapshot *Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = snapshot.users
+	s.sessions = snapshot.sessions
+	s.messages = snapshot.messages
+	s.analyses = snapshot.analyses
+	s.entities = snapshot.entities
+	s.entityAliases = snapshot.entityAliases
+	s.entityMentions = snapshot.entityMentions
+	s.alertSettings = snapshot.alertSettings
+	s.notifications = snapshot.notifications
+	s.reminderSettings = snapshot.reminderSettings
+	s.pushSubscriptions = snapshot.pushSubscriptions
+	s.webhooks = snapshot.webhooks
+	s.deliveries = snapshot.deliveries
+	s.usage = snapshot.usage
+	s.quotas = snapshot.quotas
+	s.securityEvents = snapshot.securityEvents
+	s.recoveryCodes = snapshot.recoveryCodes
+	s.resetTokens = snapshot.resetTokens
+}
+
+// cloneRows copies every row, since the repositories update rows in place
+func cloneRows[T any](rows []*T) []*T {
+	cloned := make([]*T, len(rows))
+	for i, row := range rows {
+		copied := *row
+		cloned[i] = &copied
+	}
+	return cloned
+}
+
+func cloneMap[T any](rows map[string]*T) map[string]*T {
+	cloned := make(map[string]*T, len(rows))
+	for key, row := range rows {
+		copied := *row
+		cloned[key] = &copied
+	}
+	return cloned
+}
@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// UsageRepository is an in-memory repository.UsageStore
+type UsageRepository struct {
+	store *Store
+}
+
+var _ repository.UsageStore = (*UsageRepository)(nil)
+
+// NewUsageRepository creates a new in-memory usage repository
+func NewUsageRepository(store *Store) *UsageRepository {
+	return &UsageRepository{store: store}
+}
+
+// CreateUsage records the tokens used by one Gemini call
+func (r *UsageRepository) CreateUsage(ctx context.Context, usage *types.AIUsage) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := *usage
+	row.ID = newID()
+	row.CreatedAt = r.store.Now()
+	r.store.usage = append(r.store.usage, &row)
+
+	return nil
+}
+
+// SumUserTokens returns the total tokens a user has used since the given time
+func (r *UsageRepository) SumUserTokens(ctx context.Context, userID string, since time.Time) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var total int64
+	for _, usage := range r.store.usage {
+		if usage.UserID != nil && *usage.UserID == userID && !usage.CreatedAt.Before(since) {
+			total += int64(usage.PromptTokens + usage.OutputTokens + usage.ThoughtsTokens)
+		}
+	}
+	return total, nil
+}
+
+// GetUserUsageByOperation returns a user's token usage in [from, to) grouped by operation
+func (r *UsageRepository) GetUserUsageByOperation(ctx context.Context, userID string, from, to time.Time) ([]types.AIOperationUsage, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var rows []*types.AIUsage
+	for _, usage := range r.store.usage {
+		if usage.UserID != nil && *usage.UserID == userID && inPeriod(usage.CreatedAt, from, to) {
+			rows = append(rows, usage)
+		}
+	}
+	return groupByOperation(rows), nil
+}
+
+// GetUsageReport returns every user's token usage in [from, to) grouped by operation, heaviest users first.
+// Calls not attributed to a user are only counted in the totals.
+func (r *UsageRepository) GetUsageReport(ctx context.Context, from, to time.Time) ([]types.AIUserUsage, types.AIUsageTotals, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var totals types.AIUsageTotals
+	rowsByUser := make(map[string][]*types.AIUsage)
+	var userIDs []string
+	for _, usage := range r.store.usage {
+		if !inPeriod(usage.CreatedAt, from, to) {
+			continue
+		}
+		addUsage(&totals, usage)
+		if usage.UserID == nil {
+			continue
+		}
+		if _, ok := rowsByUser[*usage.UserID]; !ok {
+			userIDs = append(userIDs, *usage.UserID)
+		}
+		rowsByUser[*usage.UserID] = append(rowsByUser[*usage.UserID], usage)
+	}
+	sort.Strings(userIDs)
+
+	users := []types.AIUserUsage{}
+	for _, userID := range userIDs {
+		user := types.AIUserUsage{UserID: userID, Operations: groupByOperation(rowsByUser[userID])}
+		if row := r.store.user(userID); row != nil {
+			user.Username = row.Username
+		}
+		for _, usage := range rowsByUser[userID] {
+			addUsage(&user.AIUsageTotals, usage)
+		}
+		users = append(users, user)
+	}
+	sort.SliceStable(users, func(i, j int) bool { return users[i].TotalTokens > users[j].TotalTokens })
+
+	return users, totals, nil
+}
+
+// GetQuota retrieves a user's quota overrides, or nil if the defaults apply
+func (r *UsageRepository) GetQuota(ctx context.Context, userID string) (*types.AIQuota, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	quota, ok := r.store.quotas[userID]
+	if !ok {
+		return nil, nil // Defaults apply
+	}
+	result := *quota
+	return &result, nil
+}
+
+// UpsertQuota creates or replaces a user's quota overrides
+func (r *UsageRepository) UpsertQuota(ctx context.Context, userID string, dailyTokens, monthlyTokens *int64) (*types.AIQuota, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	quota := &types.AIQuota{UserID: userID, UpdatedAt: r.store.Now()}
+	if dailyTokens != nil {
+		quota.DailyTokens = ptr(*dailyTokens)
+	}
+	if monthlyTokens != nil {
+		quota.MonthlyTokens = ptr(*monthlyTokens)
+	}
+	r.store.quotas[userID] = quota
+
+	result := *quota
+	return &result, nil
+}
+
+func inPeriod(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// groupByOperation sums usage rows per operation, ordered by operation
+func groupByOperation(rows []*types.AIUsage) []types.AIOperationUsage {
+	byOperation := make(map[string]*types.AIOperationUsage)
+	var names []string
+	for _, usage := range rows {
+		operation, ok := byOperation[usage.Operation]
+		if !ok {
+			operation = &types.AIOperationUsage{Operation: usage.Operation}
+			byOperation[usage.Operation] = operation
+			names = append(names, usage.Operation)
+		}
+		addUsage(&operation.AIUsageTotals, usage)
+	}
+	sort.Strings(names)
+
+	operations := []types.AIOperationUsage{}
+	for _, name := range names {
+		operations = append(operations, *byOperation[name])
+	}
+	return operations
+}
+
+// addUsage adds one call to totals
+func addUsage(totals *types.AIUsageTotals, usage *types.AIUsage) {
+	totals.Calls++
+	totals.PromptTokens += int64(usage.PromptTokens)
+	totals.OutputTokens += int64(usage.OutputTokens)
+	totals.ThoughtsTokens += int64(usage.ThoughtsTokens)
+	totals.TotalTokens += int64(usage.PromptTokens + usage.OutputTokens + usage.ThoughtsTokens)
+}
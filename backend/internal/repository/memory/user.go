@@ -0,0 +1,286 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userRow is a user with the columns types.User does not carry
+type userRow struct {
+	types.User
+	isAdmin bool
+	login   types.LoginState
+	mfa     types.MFAState
+
+	passwordChangedAt *time.Time
+}
+
+// UserRepository is an in-memory repository.UserStore
+type UserRepository struct {
+	store *Store
+}
+
+var _ repository.UserStore = (*UserRepository)(nil)
+
+// NewUserRepository creates a new in-memory user repository
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+// CreateUser creates a new user
+func (r *UserRepository) CreateUser(ctx context.Context, req *types.RegisterRequest) (*types.User, error) {
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, row := range r.store.users {
+		if row.Username == req.Username {
+			return nil, apperror.ErrUserExists
+		}
+	}
+
+	now := r.store.Now()
+	row := &userRow{User: types.User{
+		ID:           newID(),
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		IsActive:     true,
+		Timezone:     "UTC",
+	}}
+	r.store.users = append(r.store.users, row)
+
+	user := row.User
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+// GetUserByUsername retrieves an active user by username, including the password hash
+func (r *UserRepository) GetUserByUsername(ctx context.Context, username string) (*types.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.users {
+		if row.Username == username && row.IsActive {
+			user := row.User
+			return &user, nil
+		}
+	}
+	return nil, apperror.ErrUserNotFound
+}
+
+// GetUserByID retrieves an active user by ID
+func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*types.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.activeUser(userID)
+	if row == nil {
+		return nil, apperror.ErrUserNotFound
+	}
+	user := row.User
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+// GetUserByEmail retrieves an active user by email address
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, row := range r.store.users {
+		if row.Email != nil && *row.Email == email && row.IsActive {
+			user := row.User
+			user.PasswordHash = ""
+			return &user, nil
+		}
+	}
+	return nil, apperror.ErrUserNotFound
+}
+
+// IsAdmin reports whether the user may access admin endpoints
+func (r *UserRepository) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.activeUser(userID)
+	return row != nil && row.isAdmin, nil
+}
+
+// SetAdmin grants or revokes admin access; the Postgres schema has no repository method for it
+func (r *UserRepository) SetAdmin(userID string, isAdmin bool) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.isAdmin = isAdmin
+	}
+}
+
+// UpdateLastLogin updates the last login timestamp
+func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.LastLoginAt = ptr(r.store.Now())
+	}
+	return nil
+}
+
+// ValidatePassword validates a user's password. Unknown usernames are checked against a dummy hash
+// so that they take as long as a wrong password.
+func (r *UserRepository) ValidatePassword(ctx context.Context, username, password string) (*types.User, error) {
+	user, err := r.GetUserByUsername(ctx, username)
+	if errors.Is(err, apperror.ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, apperror.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, apperror.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// UpdatePassword sets a user's password; tokens issued before the change stop being accepted
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.activeUser(userID)
+	if row == nil {
+		return apperror.ErrUserNotFound
+	}
+	now := r.store.Now()
+	row.PasswordHash = hashedPassword
+	row.passwordChangedAt = &now
+	row.mfa.Challenge = nil
+	row.UpdatedAt = now
+	return nil
+}
+
+// GetPasswordChangedAt returns when an active user's password last changed (nil if never)
+func (r *UserRepository) GetPasswordChangedAt(ctx context.Context, userID string) (*time.Time, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.activeUser(userID)
+	if row == nil {
+		return nil, apperror.ErrUserNotFound
+	}
+	return row.passwordChangedAt, nil
+}
+
+// UpdateUser updates user columns by name
+func (r *UserRepository) UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.user(userID)
+	if row == nil {
+		return nil
+	}
+	for field, value := range updates {
+		var ok bool
+		switch field {
+		case "username":
+			row.Username, ok = value.(string)
+		case "email":
+			switch email := value.(type) {
+			case string:
+				row.Email, ok = ptr(email), true
+			case *string:
+				row.Email, ok = email, true
+			case nil:
+				row.Email, ok = nil, true
+			}
+		case "timezone":
+			row.Timezone, ok = value.(string)
+		case "is_active":
+			row.IsActive, ok = value.(bool)
+		case "is_admin":
+			row.isAdmin, ok = value.(bool)
+		case "password_hash":
+			row.PasswordHash, ok = value.(string)
+		}
+		if !ok {
+			return fmt.Errorf("failed to update user: unsupported value for %s", field)
+		}
+	}
+	row.UpdatedAt = r.store.Now()
+
+	return nil
+}
+
+// DeactivateUser soft deletes a user
+func (r *UserRepository) DeactivateUser(ctx context.Context, userID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if row := r.store.user(userID); row != nil {
+		row.IsActive = false
+		row.UpdatedAt = r.store.Now()
+	}
+	return nil
+}
+
+// user returns the row of a user; the caller holds the lock
+func (s *Store) user(userID string) *userRow {
+	for _, row := range s.users {
+		if row.ID == userID {
+			return row
+		}
+	}
+	return nil
+}
+
+// activeUser returns the row of an active user; the caller holds the lock
+func (s *Store) activeUser(userID string) *userRow {
+	if row := s.user(userID); row != nil && row.IsActive {
+		return row
+	}
+	return nil
+}
+
+// dummyPasswordHash is compared with the passwords given for unknown usernames
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("kasaneha-unknown-user"), bcrypt.MinCost)
+	return hash
+})
+
+// hashPassword hashes a password at the lowest cost, since the store only backs tests
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
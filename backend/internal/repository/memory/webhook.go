@@ -0,0 +1,309 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// webhookRow is a webhook with its secret, which types.Webhook only carries on creation
+type webhookRow struct {
+	types.Webhook
+	secret string
+}
+
+// WebhookRepository is an in-memory repository.WebhookStore
+type WebhookRepository struct {
+	store *Store
+}
+
+var _ repository.WebhookStore = (*WebhookRepository)(nil)
+
+// NewWebhookRepository creates a new in-memory webhook repository
+func NewWebhookRepository(store *Store) *WebhookRepository {
+	return &WebhookRepository{store: store}
+}
+
+// CreateWebhook registers a new webhook for a user
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, userID, url, secret string, events []string, description *string) (*types.Webhook, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.Now()
+	row := &webhookRow{
+		Webhook: types.Webhook{
+			ID:          newID(),
+			UserID:      userID,
+			URL:         url,
+			Events:      cloneStrings(events),
+			Description: description,
+			IsActive:    true,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		secret: secret,
+	}
+	r.store.webhooks = append(r.store.webhooks, row)
+
+	return copyWebhook(row), nil
+}
+
+// GetWebhooks retrieves a user's webhooks
+func (r *WebhookRepository) GetWebhooks(ctx context.Context, userID string) ([]types.Webhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	webhooks := []types.Webhook{}
+	for _, row := range r.store.webhooks {
+		if row.UserID == userID {
+			webhooks = append(webhooks, *copyWebhook(row))
+		}
+	}
+	return webhooks, nil
+}
+
+// CountWebhooks counts a user's webhooks
+func (r *WebhookRepository) CountWebhooks(ctx context.Context, userID string) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, row := range r.store.webhooks {
+		if row.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetWebhook retrieves one of a user's webhooks, or nil
+func (r *WebhookRepository) GetWebhook(ctx context.Context, userID, webhookID string) (*types.Webhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	row := r.store.webhook(webhookID)
+	if row == nil || row.UserID != userID {
+		return nil, nil // Webhook not found
+	}
+	return copyWebhook(row), nil
+}
+
+// UpdateWebhook saves the URL, events, description and active flag of a webhook
+func (r *WebhookRepository) UpdateWebhook(ctx context.Context, webhook *types.Webhook) (*types.Webhook, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	row := r.store.webhook(webhook.ID)
+	if row == nil || row.UserID != webhook.UserID {
+		return nil, apperror.ErrWebhookNotFound
+	}
+	row.URL = webhook.URL
+	row.Events = cloneStrings(webhook.Events)
+	row.Description = webhook.Description
+	row.IsActive = webhook.IsActive
+	row.UpdatedAt = r.store.Now()
+
+	return copyWebhook(row), nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, row := range r.store.webhooks {
+		if row.ID == webhookID && row.UserID == userID {
+			r.store.webhooks = append(r.store.webhooks[:i], r.store.webhooks[i+1:]...)
+
+			var deliveries []*types.WebhookDelivery
+			for _, delivery := range r.store.deliveries {
+				if delivery.WebhookID != webhookID {
+					deliveries = append(deliveries, delivery)
+				}
+			}
+			r.store.deliveries = deliveries
+			return nil
+		}
+	}
+	return apperror.ErrWebhookNotFound
+}
+
+// GetWebhookIDsForEvent retrieves the IDs of a user's active webhooks subscribed to an event type
+func (r *WebhookRepository) GetWebhookIDsForEvent(ctx context.Context, userID, eventType string) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var ids []string
+	for _, row := range r.store.webhooks {
+		if row.UserID != userID || !row.IsActive {
+			continue
+		}
+		for _, event := range row.Events {
+			if event == eventType {
+				ids = append(ids, row.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// CreateDelivery queues an event for immediate delivery to a webhook
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, webhookID, eventID, eventType string, payload []byte) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.Now()
+	r.store.deliveries = append(r.store.deliveries, &types.WebhookDelivery{
+		ID:            newID(),
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       append([]byte{}, payload...),
+		Status:        types.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	})
+
+	return nil
+}
+
+// ClaimDueDeliveries takes up to limit pending deliveries whose next attempt is due, counts the attempt
+// and pushes the next attempt back by lease
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]types.WebhookDeliveryTask, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.Now()
+	var due []*types.WebhookDelivery
+	for _, delivery := range r.store.deliveries {
+		if delivery.Status != types.WebhookDeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if webhook := r.store.webhook(delivery.WebhookID); webhook != nil && webhook.IsActive {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+
+	var tasks []types.WebhookDeliveryTask
+	for _, delivery := range page(due, limit, 0) {
+		delivery.Attempts++
+		delivery.NextAttemptAt = ptr(now.Add(lease))
+
+		webhook := r.store.webhook(delivery.WebhookID)
+		tasks = append(tasks, types.WebhookDeliveryTask{
+			Delivery: types.WebhookDelivery{
+				ID:        delivery.ID,
+				WebhookID: delivery.WebhookID,
+				EventID:   delivery.EventID,
+				EventType: delivery.EventType,
+				Payload:   delivery.Payload,
+				Status:    types.WebhookDeliveryPending,
+				Attempts:  delivery.Attempts,
+				CreatedAt: delivery.CreatedAt,
+			},
+			URL:    webhook.URL,
+			Secret: webhook.secret,
+		})
+	}
+
+	return tasks, nil
+}
+
+// MarkDeliverySucceeded records a successful delivery attempt
+func (r *WebhookRepository) MarkDeliverySucceeded(ctx context.Context, deliveryID string, responseStatus int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if delivery := r.store.delivery(deliveryID); delivery != nil {
+		delivery.Status = types.WebhookDeliverySucceeded
+		delivery.ResponseStatus = &responseStatus
+		delivery.LastError = nil
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = ptr(r.store.Now())
+	}
+	return nil
+}
+
+// MarkDeliveryFailed records a failed delivery attempt. A nil nextAttemptAt gives up on the delivery.
+func (r *WebhookRepository) MarkDeliveryFailed(ctx context.Context, deliveryID string, responseStatus *int, lastError string, nextAttemptAt *time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if delivery := r.store.delivery(deliveryID); delivery != nil {
+		delivery.Status = types.WebhookDeliveryPending
+		if nextAttemptAt == nil {
+			delivery.Status = types.WebhookDeliveryFailed
+		}
+		delivery.ResponseStatus = responseStatus
+		delivery.LastError = &lastError
+		delivery.NextAttemptAt = nextAttemptAt
+	}
+	return nil
+}
+
+// GetDeliveries retrieves the most recent deliveries of a webhook, optionally filtered by status
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookID string, status string, limit int) ([]types.WebhookDelivery, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	deliveries := []types.WebhookDelivery{}
+	for i := len(r.store.deliveries) - 1; i >= 0; i-- {
+		delivery := r.store.deliveries[i]
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+
+	return page(deliveries, limit, 0), nil
+}
+
+// RetryDelivery puts a delivery of a user's webhook back in the queue for immediate delivery
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, userID, webhookID, deliveryID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delivery := r.store.delivery(deliveryID)
+	webhook := r.store.webhook(webhookID)
+	if delivery == nil || delivery.WebhookID != webhookID || webhook == nil || webhook.UserID != userID {
+		return apperror.ErrDeliveryNotFound
+	}
+	delivery.Status = types.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = ptr(r.store.Now())
+
+	return nil
+}
+
+// webhook returns a webhook row; the caller holds the lock
+func (s *Store) webhook(webhookID string) *webhookRow {
+	for _, row := range s.webhooks {
+		if row.ID == webhookID {
+			return row
+		}
+	}
+	return nil
+}
+
+// delivery returns a delivery row; the caller holds the lock
+func (s *Store) delivery(deliveryID string) *types.WebhookDelivery {
+	for _, delivery := range s.deliveries {
+		if delivery.ID == deliveryID {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// copyWebhook returns a webhook without its secret
+func copyWebhook(row *webhookRow) *types.Webhook {
+	webhook := row.Webhook
+	webhook.Events = cloneStrings(row.Events)
+	return &webhook
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 )
 
@@ -29,7 +30,7 @@ func (r *MessageRepository) CreateMessage(ctx context.Context, sessionID, sender
 	`
 
 	var sequenceNumber int
-	err := r.db.Pool.QueryRow(ctx, sequenceQuery, sessionID).Scan(&sequenceNumber)
+	err := r.db.conn().QueryRow(ctx, sequenceQuery, sessionID).Scan(&sequenceNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sequence number: %w", err)
 	}
@@ -53,7 +54,7 @@ func (r *MessageRepository) CreateMessage(ctx context.Context, sessionID, sender
 	`
 
 	var message types.Message
-	row := r.db.Pool.QueryRow(ctx, query, sessionID, sender, content, metadataJSON, sequenceNumber)
+	row := r.db.conn().QueryRow(ctx, query, sessionID, sender, content, metadataJSON, sequenceNumber)
 
 	err = row.Scan(
 		&message.ID,
@@ -80,7 +81,7 @@ func (r *MessageRepository) GetSessionMessages(ctx context.Context, sessionID st
 		ORDER BY sequence_number ASC
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, sessionID)
+	rows, err := r.db.conn().Query(ctx, query, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
@@ -117,7 +118,7 @@ func (r *MessageRepository) GetSessionMessagesWithPagination(ctx context.Context
 	`
 
 	var total int
-	err := r.db.Pool.QueryRow(ctx, countQuery, sessionID).Scan(&total)
+	err := r.db.conn().QueryRow(ctx, countQuery, sessionID).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
 	}
@@ -131,7 +132,7 @@ func (r *MessageRepository) GetSessionMessagesWithPagination(ctx context.Context
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, sessionID, limit, offset)
+	rows, err := r.db.conn().Query(ctx, query, sessionID, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get messages: %w", err)
 	}
@@ -168,7 +169,7 @@ func (r *MessageRepository) GetLatestMessages(ctx context.Context, sessionID str
 		LIMIT $2
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, sessionID, limit)
+	rows, err := r.db.conn().Query(ctx, query, sessionID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest messages: %w", err)
 	}
@@ -209,7 +210,7 @@ func (r *MessageRepository) GetMessageByID(ctx context.Context, messageID string
 	`
 
 	var message types.Message
-	row := r.db.Pool.QueryRow(ctx, query, messageID)
+	row := r.db.conn().QueryRow(ctx, query, messageID)
 
 	err := row.Scan(
 		&message.ID,
@@ -222,7 +223,7 @@ func (r *MessageRepository) GetMessageByID(ctx context.Context, messageID string
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("message not found")
+			return nil, apperror.ErrMessageNotFound
 		}
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
@@ -267,7 +268,7 @@ func (r *MessageRepository) UpdateMessage(ctx context.Context, messageID, conten
 		WHERE id = $3
 	`
 
-	_, err = r.db.Pool.Exec(ctx, query, content, metadataJSON, messageID)
+	_, err = r.db.conn().Exec(ctx, query, content, metadataJSON, messageID)
 	if err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
 	}
@@ -275,6 +276,48 @@ func (r *MessageRepository) UpdateMessage(ctx context.Context, messageID, conten
 	return nil
 }
 
+// MergeMessageMetadata merges the given keys into a message's metadata
+func (r *MessageRepository) MergeMessageMetadata(ctx context.Context, messageID string, metadata map[string]interface{}) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	query := `
+		UPDATE messages 
+		SET metadata = COALESCE(metadata, '{}'::jsonb) || $1::jsonb
+		WHERE id = $2
+	`
+
+	result, err := r.db.conn().Exec(ctx, query, metadataJSON, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to update message metadata: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperror.ErrMessageNotFound
+	}
+
+	return nil
+}
+
+// ClearMessageMetadataKey removes a key from a message's metadata.
+// It reports false if the key was not set, so that concurrent callers can use it to claim work exactly once.
+func (r *MessageRepository) ClearMessageMetadataKey(ctx context.Context, messageID, key string) (bool, error) {
+	query := `
+		UPDATE messages
+		SET metadata = metadata - $1::text
+		WHERE id = $2 AND metadata ? $1::text
+	`
+
+	result, err := r.db.conn().Exec(ctx, query, key, messageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear message metadata: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
 // DeleteMessage deletes a message (for future moderation functionality)
 func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID string) error {
 	query := `
@@ -282,14 +325,14 @@ func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID string)
 		WHERE id = $1
 	`
 
-	result, err := r.db.Pool.Exec(ctx, query, messageID)
+	result, err := r.db.conn().Exec(ctx, query, messageID)
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("message not found")
+		return apperror.ErrMessageNotFound
 	}
 
 	return nil
@@ -304,7 +347,7 @@ func (r *MessageRepository) GetMessageCount(ctx context.Context, sessionID strin
 	`
 
 	var count int
-	err := r.db.Pool.QueryRow(ctx, query, sessionID).Scan(&count)
+	err := r.db.conn().QueryRow(ctx, query, sessionID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count messages: %w", err)
 	}
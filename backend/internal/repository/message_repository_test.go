@@ -0,0 +1,147 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestMessageRepositoryCreateAndList(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewMessageRepository(db)
+	ctx := context.Background()
+	session := pgtest.Session(t, db, pgtest.User(t, db, "alice").ID, "2024-03-10")
+
+	first, err := repo.CreateMessage(ctx, session.ID, types.SenderAI, "今日はどうだった？", nil)
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	second, err := repo.CreateMessage(ctx, session.ID, types.SenderUser, "散歩した", map[string]interface{}{"source": "test"})
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if first.SequenceNumber != 1 || second.SequenceNumber != 2 {
+		t.Errorf("sequence numbers = %d, %d, want 1, 2", first.SequenceNumber, second.SequenceNumber)
+	}
+	if !hasKey(second.Metadata, "source") {
+		t.Errorf("metadata = %s, want the source key", second.Metadata)
+	}
+	pgtest.Messages(t, db, session.ID, "カフェにも寄った", "いいね！")
+
+	messages, err := repo.GetSessionMessages(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionMessages: %v", err)
+	}
+	if len(messages) != 4 || messages[0].ID != first.ID || messages[3].Content != "いいね！" {
+		t.Errorf("messages = %+v, want all four in order", messages)
+	}
+
+	page, total, err := repo.GetSessionMessagesWithPagination(ctx, session.ID, 2, 1)
+	if err != nil {
+		t.Fatalf("GetSessionMessagesWithPagination: %v", err)
+	}
+	if total != 4 || len(page) != 2 || page[0].SequenceNumber != 2 || page[1].SequenceNumber != 3 {
+		t.Errorf("page = %+v (total %d), want messages 2 and 3 of 4", page, total)
+	}
+
+	latest, err := repo.GetLatestMessages(ctx, session.ID, 2)
+	if err != nil {
+		t.Fatalf("GetLatestMessages: %v", err)
+	}
+	if len(latest) != 2 || latest[0].SequenceNumber != 3 || latest[1].SequenceNumber != 4 {
+		t.Errorf("latest = %+v, want messages 3 and 4 oldest first", latest)
+	}
+
+	if count, err := repo.GetMessageCount(ctx, session.ID); err != nil || count != 4 {
+		t.Errorf("GetMessageCount = %d, %v, want 4", count, err)
+	}
+
+	log, err := repo.GetConversationLog(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetConversationLog: %v", err)
+	}
+	want := "かさね: 今日はどうだった？\nユーザー: 散歩した\nユーザー: カフェにも寄った\nかさね: いいね！\n"
+	if log != want {
+		t.Errorf("conversation log = %q, want %q", log, want)
+	}
+}
+
+func TestMessageRepositoryUpdateAndDelete(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewMessageRepository(db)
+	ctx := context.Background()
+	session := pgtest.Session(t, db, pgtest.User(t, db, "alice").ID, "2024-03-10")
+	message := pgtest.Messages(t, db, session.ID, "こんにちわ")[0]
+
+	if err := repo.UpdateMessage(ctx, message.ID, "こんにちは", map[string]interface{}{"edited": true}); err != nil {
+		t.Fatalf("UpdateMessage: %v", err)
+	}
+	updated, err := repo.GetMessageByID(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if updated.Content != "こんにちは" || !hasKey(updated.Metadata, "edited") {
+		t.Errorf("updated message = %+v", updated)
+	}
+
+	if err := repo.DeleteMessage(ctx, message.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if _, err := repo.GetMessageByID(ctx, message.ID); !errors.Is(err, apperror.ErrMessageNotFound) {
+		t.Errorf("GetMessageByID after delete error = %v, want message not found", err)
+	}
+	if err := repo.DeleteMessage(ctx, message.ID); !errors.Is(err, apperror.ErrMessageNotFound) {
+		t.Errorf("second DeleteMessage error = %v, want message not found", err)
+	}
+}
+
+func TestMessageRepositoryMetadata(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewMessageRepository(db)
+	ctx := context.Background()
+	session := pgtest.Session(t, db, pgtest.User(t, db, "alice").ID, "2024-03-10")
+	message, err := repo.CreateMessage(ctx, session.ID, types.SenderUser, "少し疲れた", map[string]interface{}{"keep": 1})
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+
+	if err := repo.MergeMessageMetadata(ctx, message.ID, map[string]interface{}{types.MessageMetadataReplyFailed: true}); err != nil {
+		t.Fatalf("MergeMessageMetadata: %v", err)
+	}
+	merged, err := repo.GetMessageByID(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if !hasKey(merged.Metadata, "keep") || !hasKey(merged.Metadata, types.MessageMetadataReplyFailed) {
+		t.Errorf("merged metadata = %s, want both keys", merged.Metadata)
+	}
+
+	// Clearing the key claims the retry exactly once
+	if cleared, err := repo.ClearMessageMetadataKey(ctx, message.ID, types.MessageMetadataReplyFailed); err != nil || !cleared {
+		t.Errorf("ClearMessageMetadataKey = %v, %v, want true", cleared, err)
+	}
+	if cleared, err := repo.ClearMessageMetadataKey(ctx, message.ID, types.MessageMetadataReplyFailed); err != nil || cleared {
+		t.Errorf("second ClearMessageMetadataKey = %v, %v, want false", cleared, err)
+	}
+
+	err = repo.MergeMessageMetadata(ctx, "00000000-0000-0000-0000-000000000000", map[string]interface{}{"a": 1})
+	if !errors.Is(err, apperror.ErrMessageNotFound) {
+		t.Errorf("MergeMessageMetadata(unknown) error = %v, want message not found", err)
+	}
+}
+
+// hasKey reports whether a JSON object contains the key
+func hasKey(raw json.RawMessage, key string) bool {
+	var object map[string]interface{}
+	if json.Unmarshal(raw, &object) != nil {
+		return false
+	}
+	_, ok := object[key]
+	return ok
+}
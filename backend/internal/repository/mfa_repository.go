@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// MFARepository handles TOTP secrets and recovery codes
+type MFARepository struct {
+	db *Database
+}
+
+// NewMFARepository creates a new MFA repository
+func NewMFARepository(db *Database) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetMFAState retrieves a user's TOTP secret and whether it is enabled
+func (r *MFARepository) GetMFAState(ctx context.Context, userID string) (*types.MFAState, error) {
+	query := `SELECT totp_secret, totp_enabled_at, totp_last_counter, mfa_challenge FROM users WHERE id = $1`
+
+	var state types.MFAState
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(&state.Secret, &state.EnabledAt, &state.LastCounter, &state.Challenge)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get MFA state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// SetTOTPSecret stores a secret pending verification; it replaces an earlier pending secret
+func (r *MFARepository) SetTOTPSecret(ctx context.Context, userID, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = $1, totp_enabled_at = NULL, totp_last_counter = NULL
+		WHERE id = $2 AND totp_enabled_at IS NULL
+	`
+
+	tag, err := r.db.conn().Exec(ctx, query, secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set TOTP secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+// EnableMFA turns on the pending secret, marks counter as used and stores the recovery code hashes
+func (r *MFARepository) EnableMFA(ctx context.Context, userID string, counter int64, codeHashes []string) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_counter = $1
+		WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+	`, counter, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrMFAAlreadyEnabled
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DisableMFA removes a user's TOTP secret and recovery codes
+func (r *MFARepository) DisableMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = NULL, mfa_challenge = NULL
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all of a user's recovery codes
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and inserts new ones in tx
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`, userID, codeHashes)
+	if err != nil {
+		return fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether there was one
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	tag, err := r.db.conn().Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.conn().QueryRow(ctx, `
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
+
+// ClaimTOTPCounter records that the code of a time step was used, and reports false if that step
+// or a later one was used already
+func (r *MFARepository) ClaimTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_counter = $1
+		WHERE id = $2 AND (totp_last_counter IS NULL OR totp_last_counter < $1)
+	`
+
+	tag, err := r.db.conn().Exec(ctx, query, counter, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim TOTP counter: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// StartMFAChallenge records the pending second step of a login, replacing an earlier one
+func (r *MFARepository) StartMFAChallenge(ctx context.Context, userID, challenge string) error {
+	tag, err := r.db.conn().Exec(ctx, `UPDATE users SET mfa_challenge = $1 WHERE id = $2`, challenge, userID)
+	if err != nil {
+		return fmt.Errorf("failed to start MFA challenge: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// FinishMFAChallenge clears the pending second step of a login, and reports false if challenge was
+// not the pending one (it was finished already, replaced, or dropped by a password change)
+func (r *MFARepository) FinishMFAChallenge(ctx context.Context, userID, challenge string) (bool, error) {
+	query := `
+		UPDATE users
+		SET mfa_challenge = NULL
+		WHERE id = $1 AND mfa_challenge = $2
+	`
+
+	tag, err := r.db.conn().Exec(ctx, query, userID, challenge)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish MFA challenge: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
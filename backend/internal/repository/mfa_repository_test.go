@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+)
+
+func TestMFARepository(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewMFARepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+
+	if err := repo.SetTOTPSecret(ctx, alice.ID, "SECRET"); err != nil {
+		t.Fatalf("SetTOTPSecret: %v", err)
+	}
+	state, err := repo.GetMFAState(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetMFAState: %v", err)
+	}
+	if state.Secret == nil || *state.Secret != "SECRET" || state.EnabledAt != nil {
+		t.Errorf("enrolled MFA state = %+v, want a pending secret", state)
+	}
+
+	if err := repo.EnableMFA(ctx, alice.ID, 100, []string{"hash-1", "hash-2"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	if err := repo.SetTOTPSecret(ctx, alice.ID, "OTHER"); !errors.Is(err, apperror.ErrMFAAlreadyEnabled) {
+		t.Errorf("SetTOTPSecret when enabled error = %v, want already enabled", err)
+	}
+
+	// Time steps are claimed once, in increasing order
+	for _, tc := range []struct {
+		counter int64
+		want    bool
+	}{{100, false}, {101, true}, {101, false}, {99, false}} {
+		if claimed, err := repo.ClaimTOTPCounter(ctx, alice.ID, tc.counter); err != nil || claimed != tc.want {
+			t.Errorf("ClaimTOTPCounter(%d) = %v, %v, want %v", tc.counter, claimed, err, tc.want)
+		}
+	}
+
+	if used, err := repo.UseRecoveryCode(ctx, alice.ID, "hash-1"); err != nil || !used {
+		t.Errorf("UseRecoveryCode = %v, %v, want used", used, err)
+	}
+	if used, err := repo.UseRecoveryCode(ctx, alice.ID, "hash-1"); err != nil || used {
+		t.Errorf("UseRecoveryCode twice = %v, %v, want unused", used, err)
+	}
+	if count, err := repo.CountRecoveryCodes(ctx, alice.ID); err != nil || count != 1 {
+		t.Errorf("CountRecoveryCodes = %d, %v, want 1", count, err)
+	}
+
+	if err := repo.ReplaceRecoveryCodes(ctx, alice.ID, []string{"hash-1", "hash-3", "hash-4"}); err != nil {
+		t.Fatalf("ReplaceRecoveryCodes: %v", err)
+	}
+	if count, err := repo.CountRecoveryCodes(ctx, alice.ID); err != nil || count != 3 {
+		t.Errorf("CountRecoveryCodes after replacing = %d, %v, want 3", count, err)
+	}
+
+	// A challenge is finished once, and only the latest one
+	for _, challenge := range []string{"challenge-1", "challenge-2"} {
+		if err := repo.StartMFAChallenge(ctx, alice.ID, challenge); err != nil {
+			t.Fatalf("StartMFAChallenge: %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		challenge string
+		want      bool
+	}{{"challenge-1", false}, {"challenge-2", true}, {"challenge-2", false}} {
+		if finished, err := repo.FinishMFAChallenge(ctx, alice.ID, tc.challenge); err != nil || finished != tc.want {
+			t.Errorf("FinishMFAChallenge(%s) = %v, %v, want %v", tc.challenge, finished, err, tc.want)
+		}
+	}
+
+	// Changing the password drops a pending challenge
+	if err := repo.StartMFAChallenge(ctx, alice.ID, "challenge-3"); err != nil {
+		t.Fatalf("StartMFAChallenge: %v", err)
+	}
+	if err := repository.NewUserRepository(db).UpdatePassword(ctx, alice.ID, "new-password"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if finished, err := repo.FinishMFAChallenge(ctx, alice.ID, "challenge-3"); err != nil || finished {
+		t.Errorf("FinishMFAChallenge after a password change = %v, %v, want false", finished, err)
+	}
+
+	if err := repo.DisableMFA(ctx, alice.ID); err != nil {
+		t.Fatalf("DisableMFA: %v", err)
+	}
+	state, err = repo.GetMFAState(ctx, alice.ID)
+	if err != nil || state.Secret != nil || state.EnabledAt != nil || state.LastCounter != nil || state.Challenge != nil {
+		t.Errorf("disabled MFA state = %+v, %v, want none", state, err)
+	}
+	if count, err := repo.CountRecoveryCodes(ctx, alice.ID); err != nil || count != 0 {
+		t.Errorf("CountRecoveryCodes after disabling = %d, %v, want 0", count, err)
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+)
+
+// PasswordResetRepository handles password reset tokens
+type PasswordResetRepository struct {
+	db *Database
+}
+
+// NewPasswordResetRepository creates a new password reset repository
+func NewPasswordResetRepository(db *Database) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// CreateResetToken stores the hash of a new reset token for a user; the user's earlier unused
+// tokens stop working
+func (r *PasswordResetRepository) CreateResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("failed to delete reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword uses an unexpired reset token to set its user's password, clearing their failed
+// logins, and returns the user ID
+func (r *PasswordResetRepository) ResetPassword(ctx context.Context, tokenHash, password string, now time.Time) (string, error) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := r.db.conn().Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	err = tx.QueryRow(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		RETURNING user_id
+	`, tokenHash, now).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", apperror.ErrInvalidResetToken
+		}
+		return "", fmt.Errorf("failed to use reset token: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = $2, failed_login_count = 0, locked_until = NULL,
+		    mfa_challenge = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND is_active = true
+	`, hashedPassword, now, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", apperror.ErrInvalidResetToken
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return "", fmt.Errorf("failed to delete reset tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
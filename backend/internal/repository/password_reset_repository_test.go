@@ -0,0 +1,58 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+)
+
+func TestPasswordResetRepository(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewPasswordResetRepository(db)
+	users := repository.NewUserRepository(db)
+	security := repository.NewSecurityRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	now := time.Now()
+
+	if err := repo.CreateResetToken(ctx, alice.ID, "hash-1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateResetToken: %v", err)
+	}
+	if err := repo.CreateResetToken(ctx, alice.ID, "hash-2", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateResetToken: %v", err)
+	}
+	if err := security.LockUser(ctx, alice.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("LockUser: %v", err)
+	}
+
+	// The newer token replaces the older one, and expires
+	if _, err := repo.ResetPassword(ctx, "hash-1", "new-password", now); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with a replaced token error = %v, want invalid token", err)
+	}
+	if _, err := repo.ResetPassword(ctx, "hash-2", "new-password", now.Add(time.Hour)); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with an expired token error = %v, want invalid token", err)
+	}
+
+	userID, err := repo.ResetPassword(ctx, "hash-2", "new-password", now)
+	if err != nil || userID != alice.ID {
+		t.Fatalf("ResetPassword = %q, %v, want alice", userID, err)
+	}
+	if _, err := repo.ResetPassword(ctx, "hash-2", "other-password", now); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword reusing a token error = %v, want invalid token", err)
+	}
+
+	if _, err := users.ValidatePassword(ctx, "alice", "new-password"); err != nil {
+		t.Errorf("ValidatePassword with the new password: %v", err)
+	}
+	if changedAt, err := users.GetPasswordChangedAt(ctx, alice.ID); err != nil || changedAt == nil {
+		t.Errorf("GetPasswordChangedAt = %v, %v, want the reset time", changedAt, err)
+	}
+	if state, err := security.GetLoginState(ctx, alice.ID); err != nil || state.LockedUntil != nil {
+		t.Errorf("login state = %+v, %v, want unlocked", state, err)
+	}
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ReminderRepository handles reminder settings and push subscription data operations
+type ReminderRepository struct {
+	db *Database
+}
+
+// NewReminderRepository creates a new reminder repository
+func NewReminderRepository(db *Database) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+// reminderSettingsColumns selects reminder settings with times formatted as HH:MM
+const reminderSettingsColumns = `
+	user_id, enabled, to_char(remind_at, 'HH24:MI'), timezone, channels, webhook_url,
+	to_char(quiet_hours_start, 'HH24:MI'), to_char(quiet_hours_end, 'HH24:MI'),
+	last_reminded_on::text, updated_at
+`
+
+func scanReminderSettings(row pgx.Row) (*types.ReminderSettings, error) {
+	var settings types.ReminderSettings
+	err := row.Scan(
+		&settings.UserID,
+		&settings.Enabled,
+		&settings.RemindAt,
+		&settings.Timezone,
+		&settings.Channels,
+		&settings.WebhookURL,
+		&settings.QuietHoursStart,
+		&settings.QuietHoursEnd,
+		&settings.LastRemindedOn,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetReminderSettings retrieves a user's reminder settings, or nil if the user has not configured them
+func (r *ReminderRepository) GetReminderSettings(ctx context.Context, userID string) (*types.ReminderSettings, error) {
+	query := `SELECT ` + reminderSettingsColumns + ` FROM reminder_settings WHERE user_id = $1`
+
+	settings, err := scanReminderSettings(r.db.conn().QueryRow(ctx, query, userID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Defaults apply
+		}
+		return nil, fmt.Errorf("failed to get reminder settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// UpsertReminderSettings creates or replaces a user's reminder settings
+func (r *ReminderRepository) UpsertReminderSettings(ctx context.Context, settings *types.ReminderSettings) (*types.ReminderSettings, error) {
+	query := `
+		INSERT INTO reminder_settings (
+			user_id, enabled, remind_at, timezone, channels, webhook_url, quiet_hours_start, quiet_hours_end
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			remind_at = EXCLUDED.remind_at,
+			timezone = EXCLUDED.timezone,
+			channels = EXCLUDED.channels,
+			webhook_url = EXCLUDED.webhook_url,
+			quiet_hours_start = EXCLUDED.quiet_hours_start,
+			quiet_hours_end = EXCLUDED.quiet_hours_end
+		RETURNING ` + reminderSettingsColumns
+
+	saved, err := scanReminderSettings(r.db.conn().QueryRow(ctx, query,
+		settings.UserID,
+		settings.Enabled,
+		settings.RemindAt,
+		settings.Timezone,
+		settings.Channels,
+		settings.WebhookURL,
+		settings.QuietHoursStart,
+		settings.QuietHoursEnd,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reminder settings: %w", err)
+	}
+
+	return saved, nil
+}
+
+// GetEnabledReminderSettings retrieves the settings of active users with reminders turned on
+func (r *ReminderRepository) GetEnabledReminderSettings(ctx context.Context) ([]types.ReminderSettings, error) {
+	query := `
+		SELECT ` + reminderSettingsColumns + `
+		FROM reminder_settings
+		WHERE enabled = true
+		  AND user_id IN (SELECT id FROM users WHERE is_active = true)
+	`
+
+	rows, err := r.db.conn().Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reminder settings: %w", err)
+	}
+	defer rows.Close()
+
+	var settingsList []types.ReminderSettings
+	for rows.Next() {
+		settings, err := scanReminderSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reminder settings: %w", err)
+		}
+		settingsList = append(settingsList, *settings)
+	}
+
+	return settingsList, nil
+}
+
+// ClaimReminder records that the user's reminder for the given local date is being handled.
+// It returns false if another run already handled it, so each reminder is sent at most once.
+func (r *ReminderRepository) ClaimReminder(ctx context.Context, userID, localDate string) (bool, error) {
+	query := `
+		UPDATE reminder_settings
+		SET last_reminded_on = $2
+		WHERE user_id = $1
+		  AND (last_reminded_on IS NULL OR last_reminded_on < $2)
+	`
+
+	result, err := r.db.conn().Exec(ctx, query, userID, localDate)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim reminder: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// SavePushSubscription registers a browser push subscription for a user
+func (r *ReminderRepository) SavePushSubscription(ctx context.Context, userID, endpoint, p256dh, auth string) (*types.PushSubscription, error) {
+	// A browser re-subscribing (or a different user logging in on it) replaces the old keys
+	query := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (endpoint) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			p256dh = EXCLUDED.p256dh,
+			auth = EXCLUDED.auth
+		RETURNING id, user_id, endpoint, p256dh, auth, created_at
+	`
+
+	var subscription types.PushSubscription
+	err := r.db.conn().QueryRow(ctx, query, userID, endpoint, p256dh, auth).Scan(
+		&subscription.ID,
+		&subscription.UserID,
+		&subscription.Endpoint,
+		&subscription.P256dh,
+		&subscription.Auth,
+		&subscription.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save push subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
+// GetPushSubscriptions retrieves a user's push subscriptions
+func (r *ReminderRepository) GetPushSubscriptions(ctx context.Context, userID string) ([]types.PushSubscription, error) {
+	query := `
+		SELECT id, user_id, endpoint, p256dh, auth, created_at
+		FROM push_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []types.PushSubscription
+	for rows.Next() {
+		var subscription types.PushSubscription
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.UserID,
+			&subscription.Endpoint,
+			&subscription.P256dh,
+			&subscription.Auth,
+			&subscription.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan push subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// DeletePushSubscription removes one of a user's push subscriptions
+func (r *ReminderRepository) DeletePushSubscription(ctx context.Context, userID, endpoint string) error {
+	result, err := r.db.conn().Exec(ctx, `
+		DELETE FROM push_subscriptions WHERE user_id = $1 AND endpoint = $2
+	`, userID, endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperror.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// DeletePushSubscriptionsByEndpoint removes subscriptions the push service reported as expired
+func (r *ReminderRepository) DeletePushSubscriptionsByEndpoint(ctx context.Context, endpoints []string) error {
+	_, err := r.db.conn().Exec(ctx, `
+		DELETE FROM push_subscriptions WHERE endpoint = ANY($1)
+	`, endpoints)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired push subscriptions: %w", err)
+	}
+
+	return nil
+}
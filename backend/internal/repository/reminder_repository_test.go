@@ -0,0 +1,144 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestReminderRepositorySettings(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewReminderRepository(db)
+	users := repository.NewUserRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+	carol := pgtest.User(t, db, "carol")
+
+	if settings, err := repo.GetReminderSettings(ctx, alice.ID); err != nil || settings != nil {
+		t.Fatalf("GetReminderSettings before saving = %+v, %v, want nil", settings, err)
+	}
+
+	quietStart, quietEnd := "23:00", "07:00"
+	saved, err := repo.UpsertReminderSettings(ctx, &types.ReminderSettings{
+		UserID:          alice.ID,
+		Enabled:         true,
+		RemindAt:        "21:30",
+		Timezone:        "Asia/Tokyo",
+		Channels:        []string{"web_push"},
+		QuietHoursStart: &quietStart,
+		QuietHoursEnd:   &quietEnd,
+	})
+	if err != nil {
+		t.Fatalf("UpsertReminderSettings: %v", err)
+	}
+	if saved.RemindAt != "21:30" || saved.QuietHoursStart == nil || *saved.QuietHoursStart != "23:00" || len(saved.Channels) != 1 {
+		t.Errorf("saved settings = %+v", saved)
+	}
+
+	// Quiet hours must be set together
+	_, err = repo.UpsertReminderSettings(ctx, &types.ReminderSettings{
+		UserID: bob.ID, Enabled: true, RemindAt: "21:00", Timezone: "Asia/Tokyo", Channels: []string{}, QuietHoursStart: &quietStart,
+	})
+	if err == nil {
+		t.Errorf("UpsertReminderSettings accepted quiet hours without an end")
+	}
+
+	for _, user := range []*types.User{bob, carol} {
+		_, err := repo.UpsertReminderSettings(ctx, &types.ReminderSettings{
+			UserID: user.ID, Enabled: user == carol, RemindAt: "21:00", Timezone: "Asia/Tokyo", Channels: []string{},
+		})
+		if err != nil {
+			t.Fatalf("UpsertReminderSettings: %v", err)
+		}
+	}
+	if err := users.DeactivateUser(ctx, carol.ID); err != nil {
+		t.Fatalf("DeactivateUser: %v", err)
+	}
+
+	// Bob turned reminders off and Carol is no longer active
+	enabled, err := repo.GetEnabledReminderSettings(ctx)
+	if err != nil {
+		t.Fatalf("GetEnabledReminderSettings: %v", err)
+	}
+	if len(enabled) != 1 || enabled[0].UserID != alice.ID {
+		t.Errorf("enabled settings = %+v, want only alice", enabled)
+	}
+}
+
+func TestReminderRepositoryClaimReminder(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewReminderRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	_, err := repo.UpsertReminderSettings(ctx, &types.ReminderSettings{
+		UserID: user.ID, Enabled: true, RemindAt: "21:00", Timezone: "Asia/Tokyo", Channels: []string{},
+	})
+	if err != nil {
+		t.Fatalf("UpsertReminderSettings: %v", err)
+	}
+
+	if claimed, err := repo.ClaimReminder(ctx, user.ID, "2024-03-10"); err != nil || !claimed {
+		t.Errorf("ClaimReminder = %v, %v, want true", claimed, err)
+	}
+	if claimed, err := repo.ClaimReminder(ctx, user.ID, "2024-03-10"); err != nil || claimed {
+		t.Errorf("second ClaimReminder on the same day = %v, %v, want false", claimed, err)
+	}
+	if claimed, err := repo.ClaimReminder(ctx, user.ID, "2024-03-11"); err != nil || !claimed {
+		t.Errorf("ClaimReminder on the next day = %v, %v, want true", claimed, err)
+	}
+
+	settings, err := repo.GetReminderSettings(ctx, user.ID)
+	if err != nil || settings.LastRemindedOn == nil || *settings.LastRemindedOn != "2024-03-11" {
+		t.Errorf("last reminded on = %+v, %v, want 2024-03-11", settings, err)
+	}
+}
+
+func TestReminderRepositoryPushSubscriptions(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewReminderRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+
+	const endpoint = "https://push.example.com/send/abc"
+	if _, err := repo.SavePushSubscription(ctx, alice.ID, endpoint, "key1", "auth1"); err != nil {
+		t.Fatalf("SavePushSubscription: %v", err)
+	}
+	if _, err := repo.SavePushSubscription(ctx, alice.ID, "https://push.example.com/send/def", "key2", "auth2"); err != nil {
+		t.Fatalf("SavePushSubscription: %v", err)
+	}
+
+	// The same browser subscribing for another user moves the subscription
+	moved, err := repo.SavePushSubscription(ctx, bob.ID, endpoint, "key3", "auth3")
+	if err != nil {
+		t.Fatalf("SavePushSubscription: %v", err)
+	}
+	if moved.UserID != bob.ID || moved.P256dh != "key3" {
+		t.Errorf("re-subscribed = %+v, want bob's keys", moved)
+	}
+
+	subscriptions, err := repo.GetPushSubscriptions(ctx, alice.ID)
+	if err != nil || len(subscriptions) != 1 {
+		t.Fatalf("alice's subscriptions = %+v, %v, want 1", subscriptions, err)
+	}
+
+	if err := repo.DeletePushSubscription(ctx, alice.ID, endpoint); !errors.Is(err, apperror.ErrSubscriptionNotFound) {
+		t.Errorf("DeletePushSubscription of bob's endpoint error = %v, want push subscription not found", err)
+	}
+	if err := repo.DeletePushSubscription(ctx, alice.ID, subscriptions[0].Endpoint); err != nil {
+		t.Errorf("DeletePushSubscription: %v", err)
+	}
+
+	if err := repo.DeletePushSubscriptionsByEndpoint(ctx, []string{endpoint}); err != nil {
+		t.Fatalf("DeletePushSubscriptionsByEndpoint: %v", err)
+	}
+	if subscriptions, err := repo.GetPushSubscriptions(ctx, bob.ID); err != nil || len(subscriptions) != 0 {
+		t.Errorf("bob's subscriptions after expiry = %+v, %v, want none", subscriptions, err)
+	}
+}
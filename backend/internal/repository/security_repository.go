@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// SecurityRepository handles login failure tracking and the security event log
+type SecurityRepository struct {
+	db *Database
+}
+
+// NewSecurityRepository creates a new security repository
+func NewSecurityRepository(db *Database) *SecurityRepository {
+	return &SecurityRepository{db: db}
+}
+
+// GetLoginState retrieves a user's failed login count and lockout
+func (r *SecurityRepository) GetLoginState(ctx context.Context, userID string) (*types.LoginState, error) {
+	query := `SELECT failed_login_count, locked_until FROM users WHERE id = $1`
+
+	var state types.LoginState
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(&state.FailedLoginCount, &state.LockedUntil)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// IncrementFailedLogins counts a failed login and returns the failures since the last successful one
+func (r *SecurityRepository) IncrementFailedLogins(ctx context.Context, userID string) (int, error) {
+	query := `
+		UPDATE users
+		SET failed_login_count = failed_login_count + 1
+		WHERE id = $1
+		RETURNING failed_login_count
+	`
+
+	var count int
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(&count)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, apperror.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("failed to increment failed logins: %w", err)
+	}
+
+	return count, nil
+}
+
+// LockUser refuses the user's logins until the given time
+func (r *SecurityRepository) LockUser(ctx context.Context, userID string, until time.Time) error {
+	_, err := r.db.conn().Exec(ctx, `UPDATE users SET locked_until = $1 WHERE id = $2`, until, userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	return nil
+}
+
+// ResetFailedLogins clears a user's failed login count and lockout
+func (r *SecurityRepository) ResetFailedLogins(ctx context.Context, userID string) error {
+	query := `
+		UPDATE users
+		SET failed_login_count = 0, locked_until = NULL
+		WHERE id = $1
+	`
+
+	_, err := r.db.conn().Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSecurityEvent records a security event
+func (r *SecurityRepository) CreateSecurityEvent(ctx context.Context, event *types.SecurityEvent) error {
+	query := `
+		INSERT INTO security_events (user_id, event_type, reason, username, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	err := r.db.conn().QueryRow(ctx, query,
+		event.UserID, event.EventType, event.Reason, event.Username, event.IPAddress, event.UserAgent,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create security event: %w", err)
+	}
+
+	return nil
+}
+
+// CountFailedLoginsByIP counts the failed logins from an IP address since a time, and returns the
+// time of the oldest of them (nil if there are none). Attempts refused before checking the password
+// or code (locked accounts, throttled IPs) are not counted.
+func (r *SecurityRepository) CountFailedLoginsByIP(ctx context.Context, ipAddress string, since time.Time) (int, *time.Time, error) {
+	query := `
+		SELECT COUNT(*), MIN(created_at)
+		FROM security_events
+		WHERE event_type = 'login_failed' AND ip_address = $1 AND created_at >= $2
+		  AND reason IN ('unknown_user', 'invalid_password', 'invalid_mfa_code')
+	`
+
+	var count int
+	var oldest *time.Time
+	err := r.db.conn().QueryRow(ctx, query, ipAddress, since).Scan(&count, &oldest)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count failed logins: %w", err)
+	}
+
+	return count, oldest, nil
+}
+
+// CountUnknownUserLogins counts the failed logins with a username that has no account since a time,
+// and returns the time of the latest of them (nil if there are none)
+func (r *SecurityRepository) CountUnknownUserLogins(ctx context.Context, username string, since time.Time) (int, *time.Time, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM security_events
+		WHERE event_type = 'login_failed' AND reason = 'unknown_user' AND username = $1 AND created_at >= $2
+	`
+
+	var count int
+	var latest *time.Time
+	err := r.db.conn().QueryRow(ctx, query, username, since).Scan(&count, &latest)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count unknown user logins: %w", err)
+	}
+
+	return count, latest, nil
+}
+
+// GetSecurityEvents retrieves a user's most recent security events
+func (r *SecurityRepository) GetSecurityEvents(ctx context.Context, userID string, limit int) ([]types.SecurityEvent, error) {
+	query := `
+		SELECT id, user_id, event_type, reason, username, ip_address, user_agent, created_at
+		FROM security_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []types.SecurityEvent{}
+	for rows.Next() {
+		var event types.SecurityEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.EventType,
+			&event.Reason,
+			&event.Username,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan security event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
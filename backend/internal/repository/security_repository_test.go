@@ -0,0 +1,116 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestSecurityRepositoryLoginState(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSecurityRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+
+	state, err := repo.GetLoginState(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetLoginState: %v", err)
+	}
+	if state.FailedLoginCount != 0 || state.LockedUntil != nil {
+		t.Errorf("new user login state = %+v, want no failures", state)
+	}
+
+	for want := 1; want <= 2; want++ {
+		if count, err := repo.IncrementFailedLogins(ctx, alice.ID); err != nil || count != want {
+			t.Fatalf("IncrementFailedLogins = %d, %v, want %d", count, err, want)
+		}
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	if err := repo.LockUser(ctx, alice.ID, until); err != nil {
+		t.Fatalf("LockUser: %v", err)
+	}
+	state, err = repo.GetLoginState(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetLoginState: %v", err)
+	}
+	if state.FailedLoginCount != 2 || state.LockedUntil == nil || !state.LockedUntil.Equal(until) {
+		t.Errorf("locked login state = %+v, want 2 failures locked until %v", state, until)
+	}
+
+	if err := repo.ResetFailedLogins(ctx, alice.ID); err != nil {
+		t.Fatalf("ResetFailedLogins: %v", err)
+	}
+	if state, err := repo.GetLoginState(ctx, alice.ID); err != nil || state.FailedLoginCount != 0 || state.LockedUntil != nil {
+		t.Errorf("reset login state = %+v, %v, want no failures", state, err)
+	}
+
+	if _, err := repo.GetLoginState(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, apperror.ErrUserNotFound) {
+		t.Errorf("GetLoginState of an unknown user error = %v, want user not found", err)
+	}
+}
+
+func TestSecurityRepositoryEvents(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSecurityRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+
+	ip, otherIP, agent, mallory := "192.0.2.1", "192.0.2.2", "test-agent", "mallory"
+	reason := func(reason string) *string { return &reason }
+	events := []*types.SecurityEvent{
+		{UserID: &alice.ID, EventType: types.SecurityEventLoginFailed, Reason: reason(types.LoginFailureInvalidPassword), IPAddress: &ip},
+		{EventType: types.SecurityEventLoginFailed, Reason: reason(types.LoginFailureUnknownUser), Username: &mallory, IPAddress: &ip},
+		{UserID: &alice.ID, EventType: types.SecurityEventLoginFailed, Reason: reason(types.LoginFailureLocked), IPAddress: &ip},
+		{UserID: &bob.ID, EventType: types.SecurityEventLoginFailed, Reason: reason(types.LoginFailureInvalidPassword), IPAddress: &otherIP},
+		{UserID: &alice.ID, EventType: types.SecurityEventLoginSucceeded, IPAddress: &ip, UserAgent: &agent},
+	}
+	for _, event := range events {
+		if err := repo.CreateSecurityEvent(ctx, event); err != nil {
+			t.Fatalf("CreateSecurityEvent: %v", err)
+		}
+		if event.ID == "" || event.CreatedAt.IsZero() {
+			t.Errorf("created event = %+v, want an ID and a timestamp", event)
+		}
+	}
+
+	// Attempts refused before checking the password are not counted
+	count, oldest, err := repo.CountFailedLoginsByIP(ctx, ip, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CountFailedLoginsByIP: %v", err)
+	}
+	if count != 2 || oldest == nil || !oldest.Equal(events[0].CreatedAt) {
+		t.Errorf("CountFailedLoginsByIP = %d, %v, want 2 since the first event", count, oldest)
+	}
+	if count, oldest, err := repo.CountFailedLoginsByIP(ctx, ip, time.Now().Add(time.Hour)); err != nil || count != 0 || oldest != nil {
+		t.Errorf("CountFailedLoginsByIP in the future = %d, %v, %v, want none", count, oldest, err)
+	}
+
+	count, latest, err := repo.CountUnknownUserLogins(ctx, mallory, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CountUnknownUserLogins: %v", err)
+	}
+	if count != 1 || latest == nil || !latest.Equal(events[1].CreatedAt) {
+		t.Errorf("CountUnknownUserLogins = %d, %v, want 1 at the second event", count, latest)
+	}
+	if count, latest, err := repo.CountUnknownUserLogins(ctx, "alice", time.Now().Add(-time.Hour)); err != nil || count != 0 || latest != nil {
+		t.Errorf("CountUnknownUserLogins for an account = %d, %v, %v, want none", count, latest, err)
+	}
+
+	got, err := repo.GetSecurityEvents(ctx, alice.ID, 10)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+	if len(got) != 3 || got[0].EventType != types.SecurityEventLoginSucceeded || got[0].UserAgent == nil || *got[0].UserAgent != agent {
+		t.Errorf("GetSecurityEvents = %+v, want alice's 3 events, newest first", got)
+	}
+	if got, err := repo.GetSecurityEvents(ctx, alice.ID, 1); err != nil || len(got) != 1 {
+		t.Errorf("GetSecurityEvents with limit 1 = %d events, %v", len(got), err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
 )
@@ -31,7 +32,7 @@ func (r *SessionRepository) GetTodaySession(ctx context.Context, userID string)
 	`
 
 	var session types.ChatSession
-	row := r.db.Pool.QueryRow(ctx, query, userID, today)
+	row := r.db.conn().QueryRow(ctx, query, userID, today)
 
 	err := row.Scan(
 		&session.ID,
@@ -61,7 +62,7 @@ func (r *SessionRepository) CreateSession(ctx context.Context, userID, date stri
 	`
 
 	var session types.ChatSession
-	row := r.db.Pool.QueryRow(ctx, query, userID, date, types.SessionStatusActive)
+	row := r.db.conn().QueryRow(ctx, query, userID, date, types.SessionStatusActive)
 
 	err := row.Scan(
 		&session.ID,
@@ -73,6 +74,9 @@ func (r *SessionRepository) CreateSession(ctx context.Context, userID, date stri
 		&session.CompletedAt,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, apperror.ErrSessionExists.Wrap(err)
+		}
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
@@ -88,7 +92,7 @@ func (r *SessionRepository) GetSessionByID(ctx context.Context, sessionID string
 	`
 
 	var session types.ChatSession
-	row := r.db.Pool.QueryRow(ctx, query, sessionID)
+	row := r.db.conn().QueryRow(ctx, query, sessionID)
 
 	err := row.Scan(
 		&session.ID,
@@ -101,7 +105,7 @@ func (r *SessionRepository) GetSessionByID(ctx context.Context, sessionID string
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("session not found")
+			return nil, apperror.ErrSessionNotFound
 		}
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
@@ -117,7 +121,7 @@ func (r *SessionRepository) CompleteSession(ctx context.Context, sessionID strin
 		WHERE id = $3
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query, types.SessionStatusCompleted, timeutil.NowJST(), sessionID)
+	_, err := r.db.conn().Exec(ctx, query, types.SessionStatusCompleted, timeutil.NowJST(), sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to complete session: %w", err)
 	}
@@ -125,39 +129,20 @@ func (r *SessionRepository) CompleteSession(ctx context.Context, sessionID strin
 	return nil
 }
 
-// GetUserSessions retrieves sessions for a user with pagination
-func (r *SessionRepository) GetUserSessions(ctx context.Context, userID string, limit, offset int, year, month *int) ([]types.SessionSummary, int, error) {
-	// Build base query
-	whereClause := "WHERE user_id = $1"
-	args := []interface{}{userID}
-	argIndex := 2
-
-	// Add date filters if provided
-	if year != nil {
-		whereClause += fmt.Sprintf(" AND EXTRACT(YEAR FROM session_date) = $%d", argIndex)
-		args = append(args, *year)
-		argIndex++
-	}
-	if month != nil {
-		whereClause += fmt.Sprintf(" AND EXTRACT(MONTH FROM session_date) = $%d", argIndex)
-		args = append(args, *month)
-		argIndex++
+// GetUserSessions retrieves a page of a user's sessions following the cursor.
+// It returns the cursor of the next page, or nil on the last page.
+func (r *SessionRepository) GetUserSessions(ctx context.Context, userID, sort string, filter types.SessionFilter, after *types.PageCursor, limit int) ([]types.SessionSummary, *types.PageCursor, error) {
+	key, ok := sessionSortKeys[sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported session sort %q", sort)
 	}
 
-	// Count total sessions
-	countQuery := fmt.Sprintf(`
-		SELECT COUNT(*)
-		FROM chat_sessions
-		%s
-	`, whereClause)
-
-	var total int
-	err := r.db.Pool.QueryRow(ctx, countQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count sessions: %w", err)
-	}
+	where := &whereBuilder{}
+	where.where("cs.user_id = " + where.arg(userID))
+	where.filter(filter)
+	where.after(key, "cs.id", after)
 
-	// Get sessions with pagination
+	// Fetch one extra row to know whether there is a next page
 	query := fmt.Sprintf(`
 		SELECT 
 			cs.id,
@@ -165,26 +150,22 @@ func (r *SessionRepository) GetUserSessions(ctx context.Context, userID string,
 			cs.status,
 			cs.created_at,
 			cs.updated_at,
-			COUNT(m.id) as message_count,
-			CASE WHEN a.id IS NOT NULL THEN true ELSE false END as has_analysis
+			(SELECT COUNT(*) FROM messages m WHERE m.session_id = cs.id) as message_count,
+			a.id IS NOT NULL as has_analysis
 		FROM chat_sessions cs
-		LEFT JOIN messages m ON cs.id = m.session_id
 		LEFT JOIN analyses a ON cs.id = a.session_id
 		%s
-		GROUP BY cs.id, cs.session_date, cs.status, cs.created_at, cs.updated_at, a.id
-		ORDER BY cs.session_date DESC
-		LIMIT $%d OFFSET $%d
-	`, whereClause, argIndex, argIndex+1)
-
-	args = append(args, limit, offset)
+		%s
+		LIMIT %s
+	`, where, key.orderBy("cs.id"), where.arg(limit+1))
 
-	rows, err := r.db.Pool.Query(ctx, query, args...)
+	rows, err := r.db.conn().Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get sessions: %w", err)
+		return nil, nil, fmt.Errorf("failed to get sessions: %w", err)
 	}
 	defer rows.Close()
 
-	var sessions []types.SessionSummary
+	sessions := []types.SessionSummary{}
 	for rows.Next() {
 		var session types.SessionSummary
 		err := rows.Scan(
@@ -197,12 +178,41 @@ func (r *SessionRepository) GetUserSessions(ctx context.Context, userID string,
 			&session.HasAnalysis,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan session: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan session: %w", err)
 		}
 		sessions = append(sessions, session)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
 
-	return sessions, total, nil
+	if len(sessions) <= limit {
+		return sessions, nil, nil
+	}
+	sessions = sessions[:limit]
+	last := sessions[limit-1]
+	return sessions, &types.PageCursor{Sort: sort, Value: sessionCursorValue(sort, last), ID: last.ID}, nil
+}
+
+// CountUserSessions counts a user's sessions matching the filter
+func (r *SessionRepository) CountUserSessions(ctx context.Context, userID string, filter types.SessionFilter) (int, error) {
+	where := &whereBuilder{}
+	where.where("cs.user_id = " + where.arg(userID))
+	where.filter(filter)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM chat_sessions cs
+		LEFT JOIN analyses a ON cs.id = a.session_id
+		%s
+	`, where)
+
+	var total int
+	if err := r.db.conn().QueryRow(ctx, query, where.args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	return total, nil
 }
 
 // GetCalendarData retrieves calendar data for a specific month
@@ -226,7 +236,7 @@ func (r *SessionRepository) GetCalendarData(ctx context.Context, userID string,
 		ORDER BY cs.session_date
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, userID, year, month)
+	rows, err := r.db.conn().Query(ctx, query, userID, year, month)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get calendar data: %w", err)
 	}
@@ -266,7 +276,7 @@ func (r *SessionRepository) CheckSessionOwnership(ctx context.Context, sessionID
 	`
 
 	var count int
-	err := r.db.Pool.QueryRow(ctx, query, sessionID, userID).Scan(&count)
+	err := r.db.conn().QueryRow(ctx, query, sessionID, userID).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("failed to check session ownership: %w", err)
 	}
@@ -274,8 +284,61 @@ func (r *SessionRepository) CheckSessionOwnership(ctx context.Context, sessionID
 	return count > 0, nil
 }
 
+// HasUserMessagesSince checks whether the user has written anything since the given time
+func (r *SessionRepository) HasUserMessagesSince(ctx context.Context, userID string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM messages m
+			JOIN chat_sessions cs ON m.session_id = cs.id
+			WHERE cs.user_id = $1 AND m.sender = $2 AND m.created_at >= $3
+		)
+	`
+
+	var exists bool
+	err := r.db.conn().QueryRow(ctx, query, userID, types.SenderUser, since).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session messages: %w", err)
+	}
+
+	return exists, nil
+}
+
+// CountSessionsAwaitingAnalysis counts sessions without an analysis that are either completed
+// or active with at least minMessages messages (i.e. the next batch would analyze them)
+func (r *SessionRepository) CountSessionsAwaitingAnalysis(ctx context.Context, minMessages int) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM chat_sessions cs
+		WHERE NOT EXISTS (SELECT 1 FROM analyses a WHERE a.session_id = cs.id)
+		  AND (
+		      cs.status = $1
+		      OR (SELECT COUNT(*) FROM messages m WHERE m.session_id = cs.id) >= $2
+		  )
+	`
+
+	var count int
+	err := r.db.conn().QueryRow(ctx, query, types.SessionStatusCompleted, minMessages).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions awaiting analysis: %w", err)
+	}
+
+	return count, nil
+}
+
 // GetActiveSessionsWithMinMessages retrieves active sessions with at least minMessages messages
 func (r *SessionRepository) GetActiveSessionsWithMinMessages(ctx context.Context, minMessages int) ([]types.SessionForBatch, error) {
+	return r.getUnanalyzedSessions(ctx, types.SessionStatusActive, minMessages)
+}
+
+// GetUnanalyzedCompletedSessions retrieves completed sessions with at least minMessages messages and no analysis,
+// e.g. because the analysis was deferred while the user was over their AI quota
+func (r *SessionRepository) GetUnanalyzedCompletedSessions(ctx context.Context, minMessages int) ([]types.SessionForBatch, error) {
+	return r.getUnanalyzedSessions(ctx, types.SessionStatusCompleted, minMessages)
+}
+
+// getUnanalyzedSessions retrieves sessions in the given status with at least minMessages messages and no analysis
+func (r *SessionRepository) getUnanalyzedSessions(ctx context.Context, status string, minMessages int) ([]types.SessionForBatch, error) {
 	query := `
 		SELECT 
 			cs.id,
@@ -295,9 +358,9 @@ func (r *SessionRepository) GetActiveSessionsWithMinMessages(ctx context.Context
 		ORDER BY cs.session_date DESC
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, types.SessionStatusActive, minMessages)
+	rows, err := r.db.conn().Query(ctx, query, status, minMessages)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get active sessions: %w", err)
+		return nil, fmt.Errorf("failed to get %s sessions: %w", status, err)
 	}
 	defer rows.Close()
 
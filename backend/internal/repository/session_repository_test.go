@@ -0,0 +1,258 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+func TestSessionRepositoryCreateAndGet(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	if session, err := repo.GetTodaySession(ctx, user.ID); err != nil || session != nil {
+		t.Fatalf("GetTodaySession before creating = %+v, %v, want nil", session, err)
+	}
+
+	today, err := repo.CreateSession(ctx, user.ID, timeutil.TodayJST())
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if today.Status != types.SessionStatusActive || today.CompletedAt != nil {
+		t.Errorf("created session = %+v, want active", today)
+	}
+	if _, err := repo.CreateSession(ctx, user.ID, timeutil.TodayJST()); err == nil {
+		t.Errorf("CreateSession accepted a second session on the same day")
+	}
+
+	found, err := repo.GetTodaySession(ctx, user.ID)
+	if err != nil || found == nil || found.ID != today.ID {
+		t.Fatalf("GetTodaySession = %+v, %v, want %s", found, err, today.ID)
+	}
+
+	byID, err := repo.GetSessionByID(ctx, today.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID: %v", err)
+	}
+	if got := timeutil.FormatJST(byID.SessionDate, "2006-01-02"); got != timeutil.TodayJST() {
+		t.Errorf("session date = %s, want %s", got, timeutil.TodayJST())
+	}
+
+	if _, err := repo.GetSessionByID(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, apperror.ErrSessionNotFound) {
+		t.Errorf("GetSessionByID(unknown) error = %v, want session not found", err)
+	}
+}
+
+func TestSessionRepositoryCompleteAndOwnership(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+	session := pgtest.Session(t, db, alice.ID, "2024-03-10")
+
+	if err := repo.CompleteSession(ctx, session.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	completed, err := repo.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID: %v", err)
+	}
+	if completed.Status != types.SessionStatusCompleted || completed.CompletedAt == nil {
+		t.Errorf("session = %+v, want completed", completed)
+	}
+
+	if owned, err := repo.CheckSessionOwnership(ctx, session.ID, alice.ID); err != nil || !owned {
+		t.Errorf("CheckSessionOwnership(owner) = %v, %v, want true", owned, err)
+	}
+	if owned, err := repo.CheckSessionOwnership(ctx, session.ID, bob.ID); err != nil || owned {
+		t.Errorf("CheckSessionOwnership(other user) = %v, %v, want false", owned, err)
+	}
+}
+
+func TestSessionRepositoryGetUserSessions(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	other := pgtest.User(t, db, "bob")
+
+	march := pgtest.Session(t, db, user.ID, "2024-03-10")
+	pgtest.Messages(t, db, march.ID, "こんにちは", "こんにちは！", "今日は晴れ")
+	pgtest.Analysis(t, db, march.ID, 60)
+	pgtest.Session(t, db, user.ID, "2024-03-20")
+	pgtest.Session(t, db, user.ID, "2024-04-05")
+	pgtest.Session(t, db, other.ID, "2024-03-15")
+
+	sessions, next, err := repo.GetUserSessions(ctx, user.ID, types.SortDateDesc, types.SessionFilter{}, nil, 2)
+	if err != nil {
+		t.Fatalf("GetUserSessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Date != "2024-04-05" || sessions[1].Date != "2024-03-20" || next == nil {
+		t.Errorf("first page = %+v, want the two newest sessions and a cursor", sessions)
+	}
+
+	sessions, next, err = repo.GetUserSessions(ctx, user.ID, types.SortDateDesc, types.SessionFilter{}, next, 2)
+	if err != nil {
+		t.Fatalf("GetUserSessions (second page): %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != march.ID || next != nil {
+		t.Fatalf("second page = %+v, want the oldest session and no cursor", sessions)
+	}
+	if sessions[0].MessageCount != 3 || !sessions[0].HasAnalysis {
+		t.Errorf("session summary = %+v, want 3 messages and an analysis", sessions[0])
+	}
+
+	// A session created in between does not shift the next page
+	pgtest.Session(t, db, user.ID, "2024-05-01")
+	first, next, err := repo.GetUserSessions(ctx, user.ID, types.SortDateAsc, types.SessionFilter{}, nil, 1)
+	if err != nil || len(first) != 1 || first[0].ID != march.ID {
+		t.Fatalf("oldest first = %+v, %v", first, err)
+	}
+	pgtest.Session(t, db, user.ID, "2024-01-01")
+	sessions, _, err = repo.GetUserSessions(ctx, user.ID, types.SortDateAsc, types.SessionFilter{}, next, 1)
+	if err != nil || len(sessions) != 1 || sessions[0].Date != "2024-03-20" {
+		t.Errorf("page after 03-10 = %+v, %v, want 03-20", sessions, err)
+	}
+
+	year, month := 2024, 3
+	march2024 := types.SessionFilter{Year: &year, Month: &month}
+	sessions, _, err = repo.GetUserSessions(ctx, user.ID, types.SortUpdatedDesc, march2024, nil, 10)
+	if err != nil {
+		t.Fatalf("GetUserSessions (March): %v", err)
+	}
+	if total, err := repo.CountUserSessions(ctx, user.ID, march2024); err != nil || total != 2 || len(sessions) != 2 {
+		t.Errorf("March sessions = %d of %d, %v, want 2 of 2", len(sessions), total, err)
+	}
+
+	hasAnalysis, from, to := false, "2024-03-15", "2024-04-30"
+	sessions, _, err = repo.GetUserSessions(ctx, user.ID, types.SortDateDesc, types.SessionFilter{HasAnalysis: &hasAnalysis, DateFrom: &from, DateTo: &to}, nil, 10)
+	if err != nil || len(sessions) != 2 || sessions[0].Date != "2024-04-05" {
+		t.Errorf("unanalyzed sessions from 03-15 to 04-30 = %+v, %v, want 04-05 and 03-20", sessions, err)
+	}
+
+	minTension := 50
+	sessions, _, err = repo.GetUserSessions(ctx, user.ID, types.SortDateDesc, types.SessionFilter{MinTension: &minTension}, nil, 10)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != march.ID {
+		t.Errorf("sessions with tension >= 50 = %+v, %v, want 03-10", sessions, err)
+	}
+}
+
+func TestSessionRepositoryGetCalendarData(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	analyzed := pgtest.Session(t, db, user.ID, "2024-03-01")
+	pgtest.Messages(t, db, analyzed.ID, "おはよう", "おはよう！")
+	pgtest.Analysis(t, db, analyzed.ID, 72)
+	pgtest.Session(t, db, user.ID, "2024-03-31")
+	pgtest.Session(t, db, user.ID, "2024-04-01")
+
+	days, err := repo.GetCalendarData(ctx, user.ID, 2024, 3)
+	if err != nil {
+		t.Fatalf("GetCalendarData: %v", err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("got %d days, want the two sessions in March: %+v", len(days), days)
+	}
+
+	first, last := days[0], days[1]
+	if first.Date != "2024-03-01" || !first.HasSession || first.TensionScore == nil || *first.TensionScore != 72 {
+		t.Errorf("first day = %+v, want 2024-03-01 with score 72", first)
+	}
+	if first.MessageCount == nil || *first.MessageCount != 2 {
+		t.Errorf("first day message count = %v, want 2", first.MessageCount)
+	}
+	if last.Date != "2024-03-31" || last.TensionScore != nil || last.MessageCount == nil || *last.MessageCount != 0 {
+		t.Errorf("last day = %+v, want 2024-03-31 without score or messages", last)
+	}
+}
+
+func TestSessionRepositoryHasUserMessagesSince(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	messageRepo := repository.NewMessageRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	session := pgtest.Session(t, db, user.ID, "2024-03-10")
+	before := time.Now().Add(-time.Minute)
+
+	if _, err := messageRepo.CreateMessage(ctx, session.ID, types.SenderAI, "今日はどうだった？", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if has, err := repo.HasUserMessagesSince(ctx, user.ID, before); err != nil || has {
+		t.Errorf("HasUserMessagesSince with only the greeting = %v, %v, want false", has, err)
+	}
+
+	if _, err := messageRepo.CreateMessage(ctx, session.ID, types.SenderUser, "楽しかった", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if has, err := repo.HasUserMessagesSince(ctx, user.ID, before); err != nil || !has {
+		t.Errorf("HasUserMessagesSince = %v, %v, want true", has, err)
+	}
+	if has, err := repo.HasUserMessagesSince(ctx, user.ID, time.Now().Add(time.Minute)); err != nil || has {
+		t.Errorf("HasUserMessagesSince(later) = %v, %v, want false", has, err)
+	}
+}
+
+func TestSessionRepositoryBatchQueries(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	// Active with enough messages: picked up by the batch
+	busy := pgtest.Session(t, db, user.ID, "2024-03-01")
+	pgtest.Messages(t, db, busy.ID, "1", "2", "3")
+
+	// Active below the threshold: left alone
+	quiet := pgtest.Session(t, db, user.ID, "2024-03-02")
+	pgtest.Messages(t, db, quiet.ID, "1")
+
+	// Completed without an analysis: deferred analysis
+	deferred := pgtest.Session(t, db, user.ID, "2024-03-03")
+	pgtest.Messages(t, db, deferred.ID, "1", "2", "3")
+	if err := repo.CompleteSession(ctx, deferred.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	// Already analyzed: done
+	analyzed := pgtest.Session(t, db, user.ID, "2024-03-04")
+	pgtest.Messages(t, db, analyzed.ID, "1", "2", "3")
+	pgtest.Analysis(t, db, analyzed.ID, 50)
+
+	active, err := repo.GetActiveSessionsWithMinMessages(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetActiveSessionsWithMinMessages: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != busy.ID || active[0].UserID != user.ID || active[0].MessageCount != 3 {
+		t.Errorf("active sessions = %+v, want only %s", active, busy.ID)
+	}
+
+	completed, err := repo.GetUnanalyzedCompletedSessions(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetUnanalyzedCompletedSessions: %v", err)
+	}
+	if len(completed) != 1 || completed[0].ID != deferred.ID {
+		t.Errorf("completed sessions = %+v, want only %s", completed, deferred.ID)
+	}
+
+	count, err := repo.CountSessionsAwaitingAnalysis(ctx, 3)
+	if err != nil {
+		t.Fatalf("CountSessionsAwaitingAnalysis: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("sessions awaiting analysis = %d, want 2", count)
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// Repos is the set of repositories bound to one unit of work
+type Repos struct {
+	Users     UserStore
+	Sessions  SessionStore
+	Messages  MessageStore
+	Analyses  AnalysisStore
+	Entities  EntityStore
+	Alerts    AlertStore
+	Reminders ReminderStore
+	Webhooks  WebhookStore
+	Usage     UsageStore
+}
+
+// TxManager runs multi-step writes as a unit of work
+type TxManager interface {
+	// WithTx calls fn with repositories that share a transaction. The writes made through them are
+	// committed if fn returns nil and rolled back otherwise.
+	WithTx(ctx context.Context, fn func(tx Repos) error) error
+}
+
+// PgTxManager is a TxManager backed by a Postgres transaction
+type PgTxManager struct {
+	db *Database
+}
+
+var _ TxManager = (*PgTxManager)(nil)
+
+// NewTxManager creates a new transaction manager
+func NewTxManager(db *Database) *PgTxManager {
+	return &PgTxManager{db: db}
+}
+
+// WithTx implements TxManager. Nested calls run in a savepoint of the outer transaction.
+func (m *PgTxManager) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	tx, err := m.db.conn().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(NewRepos(&Database{Pool: m.db.Pool, tx: tx})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// NewRepos creates every repository on the same database
+func NewRepos(db *Database) Repos {
+	return Repos{
+		Users:     NewUserRepository(db),
+		Sessions:  NewSessionRepository(db),
+		Messages:  NewMessageRepository(db),
+		Analyses:  NewAnalysisRepository(db),
+		Entities:  NewEntityRepository(db),
+		Alerts:    NewAlertRepository(db),
+		Reminders: NewReminderRepository(db),
+		Webhooks:  NewWebhookRepository(db),
+		Usage:     NewUsageRepository(db),
+	}
+}
@@ -0,0 +1,92 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestTxManagerCommitsAndRollsBack(t *testing.T) {
+	db := pgtest.New(t)
+	txManager := repository.NewTxManager(db)
+	sessions := repository.NewSessionRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	var committed *types.ChatSession
+	err := txManager.WithTx(ctx, func(tx repository.Repos) error {
+		session, err := tx.Sessions.CreateSession(ctx, user.ID, "2024-03-10")
+		if err != nil {
+			return err
+		}
+		committed = session
+		_, err = tx.Messages.CreateMessage(ctx, session.ID, types.SenderAI, "こんばんは", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if count, err := repository.NewMessageRepository(db).GetMessageCount(ctx, committed.ID); err != nil || count != 1 {
+		t.Errorf("committed messages = %d, %v, want 1", count, err)
+	}
+
+	errRollback := errors.New("rollback")
+	var rolledBack *types.ChatSession
+	err = txManager.WithTx(ctx, func(tx repository.Repos) error {
+		session, err := tx.Sessions.CreateSession(ctx, user.ID, "2024-03-11")
+		if err != nil {
+			return err
+		}
+		rolledBack = session
+
+		// Reads inside the unit of work see its own writes
+		if _, err := tx.Sessions.GetSessionByID(ctx, session.ID); err != nil {
+			t.Errorf("GetSessionByID inside the transaction: %v", err)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx error = %v, want the error returned by fn", err)
+	}
+	if _, err := sessions.GetSessionByID(ctx, rolledBack.ID); !errors.Is(err, apperror.ErrSessionNotFound) {
+		t.Errorf("rolled back session is visible: %v", err)
+	}
+}
+
+func TestTxManagerNestedWritesUseSavepoints(t *testing.T) {
+	db := pgtest.New(t)
+	txManager := repository.NewTxManager(db)
+	entities := repository.NewEntityRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	tanaka, err := entities.CreateEntity(ctx, user.ID, "person", "田中", "田中")
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	if _, err := entities.CreateEntity(ctx, user.ID, "person", "鈴木", "鈴木"); err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+
+	// RenameEntity runs its own transaction, which becomes a savepoint inside the unit of work.
+	// Its failure must not abort the outer transaction.
+	err = txManager.WithTx(ctx, func(tx repository.Repos) error {
+		if err := tx.Entities.RenameEntity(ctx, user.ID, tanaka.ID, "鈴木", "鈴木"); err == nil {
+			t.Errorf("RenameEntity to a name in use succeeded")
+		}
+		return tx.Entities.RenameEntity(ctx, user.ID, tanaka.ID, "田中太郎", "田中太郎")
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	summary, err := entities.GetEntitySummary(ctx, user.ID, tanaka.ID)
+	if err != nil || summary.Name != "田中太郎" {
+		t.Errorf("entity = %+v, %v, want it renamed to 田中太郎", summary, err)
+	}
+}
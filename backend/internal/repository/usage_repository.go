@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// UsageRepository handles AI token usage and quota data operations
+type UsageRepository struct {
+	db *Database
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(db *Database) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// CreateUsage records the tokens used by one Gemini call
+func (r *UsageRepository) CreateUsage(ctx context.Context, usage *types.AIUsage) error {
+	query := `
+		INSERT INTO ai_usage (user_id, session_id, operation, model, prompt_tokens, output_tokens, thoughts_tokens)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.conn().Exec(ctx, query,
+		usage.UserID,
+		usage.SessionID,
+		usage.Operation,
+		usage.Model,
+		usage.PromptTokens,
+		usage.OutputTokens,
+		usage.ThoughtsTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create ai usage: %w", err)
+	}
+
+	return nil
+}
+
+// SumUserTokens returns the total tokens a user has used since the given time
+func (r *UsageRepository) SumUserTokens(ctx context.Context, userID string, since time.Time) (int64, error) {
+	query := `
+		SELECT COALESCE(SUM(prompt_tokens + output_tokens + thoughts_tokens), 0)
+		FROM ai_usage
+		WHERE user_id = $1 AND created_at >= $2
+	`
+
+	var total int64
+	err := r.db.conn().QueryRow(ctx, query, userID, since).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum ai usage: %w", err)
+	}
+
+	return total, nil
+}
+
+// GetUserUsageByOperation returns a user's token usage in [from, to) grouped by operation
+func (r *UsageRepository) GetUserUsageByOperation(ctx context.Context, userID string, from, to time.Time) ([]types.AIOperationUsage, error) {
+	query := `
+		SELECT operation, COUNT(*),
+		       COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(thoughts_tokens), 0)
+		FROM ai_usage
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY operation
+		ORDER BY operation
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ai usage: %w", err)
+	}
+	defer rows.Close()
+
+	operations := []types.AIOperationUsage{}
+	for rows.Next() {
+		var usage types.AIOperationUsage
+		err := rows.Scan(
+			&usage.Operation,
+			&usage.Calls,
+			&usage.PromptTokens,
+			&usage.OutputTokens,
+			&usage.ThoughtsTokens,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ai usage: %w", err)
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.OutputTokens + usage.ThoughtsTokens
+		operations = append(operations, usage)
+	}
+
+	return operations, rows.Err()
+}
+
+// GetUsageReport returns every user's token usage in [from, to) grouped by operation, heaviest users first.
+// Calls not attributed to a user are only counted in the totals.
+func (r *UsageRepository) GetUsageReport(ctx context.Context, from, to time.Time) ([]types.AIUserUsage, types.AIUsageTotals, error) {
+	query := `
+		SELECT u.user_id, COALESCE(users.username, ''), u.operation, COUNT(*),
+		       COALESCE(SUM(u.prompt_tokens), 0), COALESCE(SUM(u.output_tokens), 0), COALESCE(SUM(u.thoughts_tokens), 0)
+		FROM ai_usage u
+		LEFT JOIN users ON users.id = u.user_id
+		WHERE u.created_at >= $1 AND u.created_at < $2
+		GROUP BY u.user_id, users.username, u.operation
+		ORDER BY u.user_id, u.operation
+	`
+
+	var totals types.AIUsageTotals
+	rows, err := r.db.conn().Query(ctx, query, from, to)
+	if err != nil {
+		return nil, totals, fmt.Errorf("failed to get ai usage report: %w", err)
+	}
+	defer rows.Close()
+
+	users := []types.AIUserUsage{}
+	indexByUser := make(map[string]int)
+	for rows.Next() {
+		var userID *string
+		var username string
+		var usage types.AIOperationUsage
+		err := rows.Scan(
+			&userID,
+			&username,
+			&usage.Operation,
+			&usage.Calls,
+			&usage.PromptTokens,
+			&usage.OutputTokens,
+			&usage.ThoughtsTokens,
+		)
+		if err != nil {
+			return nil, totals, fmt.Errorf("failed to scan ai usage report: %w", err)
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.OutputTokens + usage.ThoughtsTokens
+		addUsageTotals(&totals, &usage.AIUsageTotals)
+
+		if userID == nil {
+			continue
+		}
+		i, ok := indexByUser[*userID]
+		if !ok {
+			i = len(users)
+			indexByUser[*userID] = i
+			users = append(users, types.AIUserUsage{UserID: *userID, Username: username, Operations: []types.AIOperationUsage{}})
+		}
+		addUsageTotals(&users[i].AIUsageTotals, &usage.AIUsageTotals)
+		users[i].Operations = append(users[i].Operations, usage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, totals, fmt.Errorf("failed to get ai usage report: %w", err)
+	}
+
+	sortUsersByTokens(users)
+	return users, totals, nil
+}
+
+// GetQuota retrieves a user's quota overrides, or nil if the defaults apply
+func (r *UsageRepository) GetQuota(ctx context.Context, userID string) (*types.AIQuota, error) {
+	query := `
+		SELECT user_id, daily_tokens, monthly_tokens, updated_at
+		FROM ai_quotas
+		WHERE user_id = $1
+	`
+
+	var quota types.AIQuota
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(
+		&quota.UserID,
+		&quota.DailyTokens,
+		&quota.MonthlyTokens,
+		&quota.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Defaults apply
+		}
+		return nil, fmt.Errorf("failed to get ai quota: %w", err)
+	}
+
+	return &quota, nil
+}
+
+// UpsertQuota creates or replaces a user's quota overrides
+func (r *UsageRepository) UpsertQuota(ctx context.Context, userID string, dailyTokens, monthlyTokens *int64) (*types.AIQuota, error) {
+	query := `
+		INSERT INTO ai_quotas (user_id, daily_tokens, monthly_tokens)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			daily_tokens = EXCLUDED.daily_tokens,
+			monthly_tokens = EXCLUDED.monthly_tokens
+		RETURNING user_id, daily_tokens, monthly_tokens, updated_at
+	`
+
+	var quota types.AIQuota
+	err := r.db.conn().QueryRow(ctx, query, userID, dailyTokens, monthlyTokens).Scan(
+		&quota.UserID,
+		&quota.DailyTokens,
+		&quota.MonthlyTokens,
+		&quota.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert ai quota: %w", err)
+	}
+
+	return &quota, nil
+}
+
+// addUsageTotals adds usage to totals
+func addUsageTotals(totals, usage *types.AIUsageTotals) {
+	totals.Calls += usage.Calls
+	totals.PromptTokens += usage.PromptTokens
+	totals.OutputTokens += usage.OutputTokens
+	totals.ThoughtsTokens += usage.ThoughtsTokens
+	totals.TotalTokens += usage.TotalTokens
+}
+
+// sortUsersByTokens orders the report by total tokens, descending
+func sortUsersByTokens(users []types.AIUserUsage) {
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].TotalTokens > users[j].TotalTokens
+	})
+}
@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestUsageRepositoryRecordsAndReports(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUsageRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+	session := pgtest.Session(t, db, alice.ID, "2024-03-10")
+
+	for _, usage := range []types.AIUsage{
+		{UserID: &alice.ID, SessionID: &session.ID, Operation: "GenerateResponse", Model: "gemini", PromptTokens: 100, OutputTokens: 20, ThoughtsTokens: 5},
+		{UserID: &alice.ID, SessionID: &session.ID, Operation: "GenerateResponse", Model: "gemini", PromptTokens: 200, OutputTokens: 30},
+		{UserID: &alice.ID, Operation: "AnalyzeSession", Model: "gemini", PromptTokens: 1000, OutputTokens: 100},
+		{UserID: &bob.ID, Operation: "GenerateResponse", Model: "gemini", PromptTokens: 10, OutputTokens: 5},
+		{Operation: "AnnotateMessage", Model: "gemini", PromptTokens: 7},
+	} {
+		if err := repo.CreateUsage(ctx, &usage); err != nil {
+			t.Fatalf("CreateUsage: %v", err)
+		}
+	}
+
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+
+	if total, err := repo.SumUserTokens(ctx, alice.ID, from); err != nil || total != 1455 {
+		t.Errorf("SumUserTokens = %d, %v, want 1455", total, err)
+	}
+	if total, err := repo.SumUserTokens(ctx, alice.ID, to); err != nil || total != 0 {
+		t.Errorf("SumUserTokens since the future = %d, %v, want 0", total, err)
+	}
+
+	operations, err := repo.GetUserUsageByOperation(ctx, alice.ID, from, to)
+	if err != nil {
+		t.Fatalf("GetUserUsageByOperation: %v", err)
+	}
+	if len(operations) != 2 || operations[0].Operation != "AnalyzeSession" || operations[1].Calls != 2 || operations[1].TotalTokens != 355 {
+		t.Errorf("operations = %+v, want AnalyzeSession then 2 GenerateResponse calls with 355 tokens", operations)
+	}
+
+	users, totals, err := repo.GetUsageReport(ctx, from, to)
+	if err != nil {
+		t.Fatalf("GetUsageReport: %v", err)
+	}
+	if len(users) != 2 || users[0].UserID != alice.ID || users[0].Username != "alice" || users[0].TotalTokens != 1455 || len(users[0].Operations) != 2 {
+		t.Errorf("report users = %+v, want alice first with 1455 tokens", users)
+	}
+	// The call without a user only counts towards the totals
+	if totals.Calls != 5 || totals.TotalTokens != 1477 {
+		t.Errorf("totals = %+v, want 5 calls and 1477 tokens", totals)
+	}
+}
+
+func TestUsageRepositoryQuota(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUsageRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	if quota, err := repo.GetQuota(ctx, user.ID); err != nil || quota != nil {
+		t.Fatalf("GetQuota before setting = %+v, %v, want nil", quota, err)
+	}
+
+	daily := int64(5000)
+	if _, err := repo.UpsertQuota(ctx, user.ID, &daily, nil); err != nil {
+		t.Fatalf("UpsertQuota: %v", err)
+	}
+	monthly := int64(100000)
+	if _, err := repo.UpsertQuota(ctx, user.ID, nil, &monthly); err != nil {
+		t.Fatalf("UpsertQuota (replace): %v", err)
+	}
+
+	quota, err := repo.GetQuota(ctx, user.ID)
+	if err != nil || quota == nil {
+		t.Fatalf("GetQuota = %+v, %v", quota, err)
+	}
+	if quota.DailyTokens != nil || quota.MonthlyTokens == nil || *quota.MonthlyTokens != monthly {
+		t.Errorf("quota = %+v, want only the monthly override", quota)
+	}
+
+	negative := int64(-1)
+	if _, err := repo.UpsertQuota(ctx, user.ID, &negative, nil); err == nil {
+		t.Errorf("UpsertQuota accepted a negative quota")
+	}
+}
@@ -2,9 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
 	"golang.org/x/crypto/bcrypt"
@@ -23,9 +28,9 @@ func NewUserRepository(db *Database) *UserRepository {
 // CreateUser creates a new user
 func (r *UserRepository) CreateUser(ctx context.Context, req *types.RegisterRequest) (*types.User, error) {
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, err
 	}
 
 	query := `
@@ -35,7 +40,7 @@ func (r *UserRepository) CreateUser(ctx context.Context, req *types.RegisterRequ
 	`
 
 	var user types.User
-	row := r.db.Pool.QueryRow(ctx, query, req.Username, req.Email, string(hashedPassword))
+	row := r.db.conn().QueryRow(ctx, query, req.Username, req.Email, hashedPassword)
 
 	err = row.Scan(
 		&user.ID,
@@ -48,6 +53,9 @@ func (r *UserRepository) CreateUser(ctx context.Context, req *types.RegisterRequ
 		&user.Timezone,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, apperror.ErrUserExists.Wrap(err)
+		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
@@ -64,7 +72,7 @@ func (r *UserRepository) GetUserByUsername(ctx context.Context, username string)
 	`
 
 	var user types.User
-	row := r.db.Pool.QueryRow(ctx, query, username)
+	row := r.db.conn().QueryRow(ctx, query, username)
 
 	err := row.Scan(
 		&user.ID,
@@ -79,7 +87,7 @@ func (r *UserRepository) GetUserByUsername(ctx context.Context, username string)
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, apperror.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -97,7 +105,39 @@ func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*types
 	`
 
 	var user types.User
-	row := r.db.Pool.QueryRow(ctx, query, userID)
+	row := r.db.conn().QueryRow(ctx, query, userID)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.LastLoginAt,
+		&user.IsActive,
+		&user.Timezone,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves an active user by email address
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	query := `
+		SELECT id, username, email, created_at, updated_at,
+		       last_login_at, is_active, timezone
+		FROM users
+		WHERE email = $1 AND is_active = true
+	`
+
+	var user types.User
+	row := r.db.conn().QueryRow(ctx, query, email)
 
 	err := row.Scan(
 		&user.ID,
@@ -111,7 +151,7 @@ func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*types
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, apperror.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -119,6 +159,22 @@ func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*types
 	return &user, nil
 }
 
+// IsAdmin reports whether the user may access admin endpoints
+func (r *UserRepository) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	query := `SELECT is_admin FROM users WHERE id = $1 AND is_active = true`
+
+	var isAdmin bool
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(&isAdmin)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check admin: %w", err)
+	}
+
+	return isAdmin, nil
+}
+
 // UpdateLastLogin updates the last login timestamp
 func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID string) error {
 	query := `
@@ -127,7 +183,7 @@ func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID string) err
 		WHERE id = $2
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query, timeutil.NowJST(), userID)
+	_, err := r.db.conn().Exec(ctx, query, timeutil.NowJST(), userID)
 	if err != nil {
 		return fmt.Errorf("failed to update last login: %w", err)
 	}
@@ -135,9 +191,14 @@ func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID string) err
 	return nil
 }
 
-// ValidatePassword validates a user's password
+// ValidatePassword validates a user's password. Unknown usernames are checked against a dummy hash
+// so that they take as long as a wrong password.
 func (r *UserRepository) ValidatePassword(ctx context.Context, username, password string) (*types.User, error) {
 	user, err := r.GetUserByUsername(ctx, username)
+	if errors.Is(err, apperror.ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, apperror.ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -145,12 +206,52 @@ func (r *UserRepository) ValidatePassword(ctx context.Context, username, passwor
 	// Compare password with hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return nil, fmt.Errorf("invalid password")
+		return nil, apperror.ErrInvalidCredentials
 	}
 
 	return user, nil
 }
 
+// UpdatePassword sets a user's password; tokens issued before the change stop being accepted
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = $2, mfa_challenge = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND is_active = true
+	`
+
+	tag, err := r.db.conn().Exec(ctx, query, hashedPassword, timeutil.NowJST(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetPasswordChangedAt returns when an active user's password last changed (nil if never)
+func (r *UserRepository) GetPasswordChangedAt(ctx context.Context, userID string) (*time.Time, error) {
+	query := `SELECT password_changed_at FROM users WHERE id = $1 AND is_active = true`
+
+	var changedAt *time.Time
+	err := r.db.conn().QueryRow(ctx, query, userID).Scan(&changedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get password change time: %w", err)
+	}
+
+	return changedAt, nil
+}
+
 // UpdateUser updates user information
 func (r *UserRepository) UpdateUser(ctx context.Context, userID string, updates map[string]interface{}) error {
 	if len(updates) == 0 {
@@ -172,11 +273,11 @@ func (r *UserRepository) UpdateUser(ctx context.Context, userID string, updates
 		UPDATE users 
 		SET %s, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $%d
-	`, fmt.Sprintf("%s", setParts), argIndex)
+	`, strings.Join(setParts, ", "), argIndex)
 
 	args = append(args, userID)
 
-	_, err := r.db.Pool.Exec(ctx, query, args...)
+	_, err := r.db.conn().Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -192,10 +293,25 @@ func (r *UserRepository) DeactivateUser(ctx context.Context, userID string) erro
 		WHERE id = $1
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query, userID)
+	_, err := r.db.conn().Exec(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to deactivate user: %w", err)
 	}
 
 	return nil
 }
+
+// dummyPasswordHash is compared with the passwords given for unknown usernames
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("kasaneha-unknown-user"), bcrypt.DefaultCost)
+	return hash
+})
+
+// hashPassword hashes a password for the password_hash column
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,126 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestUserRepositoryCreateAndGet(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	email := "alice@example.com"
+	user, err := repo.CreateUser(ctx, &types.RegisterRequest{Username: "alice", Email: &email, Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.ID == "" || !user.IsActive || user.Email == nil || *user.Email != email {
+		t.Errorf("created user = %+v", user)
+	}
+
+	if _, err := repo.CreateUser(ctx, &types.RegisterRequest{Username: "alice", Password: "password123"}); err == nil {
+		t.Errorf("CreateUser accepted a duplicate username")
+	}
+
+	byName, err := repo.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if byName.ID != user.ID || byName.PasswordHash == "" || byName.PasswordHash == "password123" {
+		t.Errorf("user by username = %+v, want the created user with a hashed password", byName)
+	}
+
+	byID, err := repo.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if byID.Username != "alice" {
+		t.Errorf("username = %q, want alice", byID.Username)
+	}
+
+	if _, err := repo.GetUserByUsername(ctx, "nobody"); !errors.Is(err, apperror.ErrUserNotFound) {
+		t.Errorf("GetUserByUsername(nobody) error = %v, want user not found", err)
+	}
+}
+
+func TestUserRepositoryValidatePassword(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUserRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	validated, err := repo.ValidatePassword(ctx, "alice", pgtest.Password)
+	if err != nil {
+		t.Fatalf("ValidatePassword: %v", err)
+	}
+	if validated.ID != user.ID {
+		t.Errorf("validated user %s, want %s", validated.ID, user.ID)
+	}
+
+	if _, err := repo.ValidatePassword(ctx, "alice", "wrong-password"); !errors.Is(err, apperror.ErrInvalidCredentials) {
+		t.Errorf("ValidatePassword with a wrong password error = %v, want invalid password", err)
+	}
+}
+
+func TestUserRepositoryUpdates(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUserRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	if err := repo.UpdateLastLogin(ctx, user.ID); err != nil {
+		t.Fatalf("UpdateLastLogin: %v", err)
+	}
+	if err := repo.UpdateUser(ctx, user.ID, map[string]interface{}{"timezone": "Asia/Tokyo", "email": "alice@example.com"}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	updated, err := repo.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if updated.LastLoginAt == nil {
+		t.Errorf("last_login_at was not set")
+	}
+	if updated.Timezone != "Asia/Tokyo" || updated.Email == nil || *updated.Email != "alice@example.com" {
+		t.Errorf("updated user = %+v", updated)
+	}
+
+	if isAdmin, err := repo.IsAdmin(ctx, user.ID); err != nil || isAdmin {
+		t.Errorf("IsAdmin = %v, %v, want false", isAdmin, err)
+	}
+	if err := repo.UpdateUser(ctx, user.ID, map[string]interface{}{"is_admin": true}); err != nil {
+		t.Fatalf("UpdateUser(is_admin): %v", err)
+	}
+	if isAdmin, err := repo.IsAdmin(ctx, user.ID); err != nil || !isAdmin {
+		t.Errorf("IsAdmin = %v, %v, want true", isAdmin, err)
+	}
+}
+
+func TestUserRepositoryDeactivateUser(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewUserRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	if err := repo.DeactivateUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeactivateUser: %v", err)
+	}
+
+	if _, err := repo.GetUserByID(ctx, user.ID); !errors.Is(err, apperror.ErrUserNotFound) {
+		t.Errorf("GetUserByID error = %v, want user not found", err)
+	}
+	if _, err := repo.ValidatePassword(ctx, "alice", pgtest.Password); err == nil {
+		t.Errorf("a deactivated user could log in")
+	}
+	if isAdmin, err := repo.IsAdmin(ctx, user.ID); err != nil || isAdmin {
+		t.Errorf("IsAdmin = %v, %v, want false", isAdmin, err)
+	}
+}
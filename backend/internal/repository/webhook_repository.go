@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// WebhookRepository handles webhook and webhook delivery data operations
+type WebhookRepository struct {
+	db *Database
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *Database) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// webhookColumns selects a webhook without its secret
+const webhookColumns = `id, user_id, url, events, description, is_active, created_at, updated_at`
+
+func scanWebhook(row pgx.Row) (*types.Webhook, error) {
+	var webhook types.Webhook
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Events,
+		&webhook.Description,
+		&webhook.IsActive,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// webhookDeliveryColumns selects a delivery log entry
+const webhookDeliveryColumns = `
+	id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	response_status, last_error, delivered_at, created_at
+`
+
+func scanWebhookDelivery(row pgx.Row) (*types.WebhookDelivery, error) {
+	var delivery types.WebhookDelivery
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// CreateWebhook registers a new webhook for a user
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, userID, url, secret string, events []string, description *string) (*types.Webhook, error) {
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + webhookColumns
+
+	webhook, err := scanWebhook(r.db.conn().QueryRow(ctx, query, userID, url, secret, events, description))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooks retrieves a user's webhooks
+func (r *WebhookRepository) GetWebhooks(ctx context.Context, userID string) ([]types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY created_at ASC`
+
+	rows, err := r.db.conn().Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []types.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, nil
+}
+
+// CountWebhooks counts a user's webhooks
+func (r *WebhookRepository) CountWebhooks(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.conn().QueryRow(ctx, `SELECT COUNT(*) FROM webhooks WHERE user_id = $1`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count webhooks: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetWebhook retrieves one of a user's webhooks
+func (r *WebhookRepository) GetWebhook(ctx context.Context, userID, webhookID string) (*types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	webhook, err := scanWebhook(r.db.conn().QueryRow(ctx, query, webhookID, userID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Webhook not found
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// UpdateWebhook saves the URL, events, description and active flag of a webhook
+func (r *WebhookRepository) UpdateWebhook(ctx context.Context, webhook *types.Webhook) (*types.Webhook, error) {
+	query := `
+		UPDATE webhooks
+		SET url = $3, events = $4, description = $5, is_active = $6
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + webhookColumns
+
+	updated, err := scanWebhook(r.db.conn().QueryRow(ctx, query,
+		webhook.ID,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Events,
+		webhook.Description,
+		webhook.IsActive,
+	))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apperror.ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	result, err := r.db.conn().Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperror.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// GetWebhookIDsForEvent retrieves the IDs of a user's active webhooks subscribed to an event type
+func (r *WebhookRepository) GetWebhookIDsForEvent(ctx context.Context, userID, eventType string) ([]string, error) {
+	query := `
+		SELECT id
+		FROM webhooks
+		WHERE user_id = $1
+		  AND is_active = true
+		  AND $2 = ANY(events)
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, userID, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks for event: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// CreateDelivery queues an event for delivery to a webhook
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, webhookID, eventID, eventType string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := r.db.conn().Exec(ctx, query, webhookID, eventID, eventType, payload); err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDueDeliveries takes up to limit pending deliveries whose next attempt is due and counts the attempt.
+// Claimed deliveries are pushed back by lease so that a crashed worker's deliveries are retried later
+// and concurrent workers never send the same delivery twice.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]types.WebhookDeliveryTask, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1,
+		    next_attempt_at = NOW() + $2::float8 * INTERVAL '1 second'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+		  AND d.id IN (
+		      SELECT dd.id
+		      FROM webhook_deliveries dd
+		      JOIN webhooks ww ON ww.id = dd.webhook_id
+		      WHERE dd.status = 'pending'
+		        AND dd.next_attempt_at <= NOW()
+		        AND ww.is_active = true
+		      ORDER BY dd.next_attempt_at ASC
+		      LIMIT $1
+		      FOR UPDATE OF dd SKIP LOCKED
+		  )
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []types.WebhookDeliveryTask
+	for rows.Next() {
+		var task types.WebhookDeliveryTask
+		err := rows.Scan(
+			&task.Delivery.ID,
+			&task.Delivery.WebhookID,
+			&task.Delivery.EventID,
+			&task.Delivery.EventType,
+			&task.Delivery.Payload,
+			&task.Delivery.Attempts,
+			&task.Delivery.CreatedAt,
+			&task.URL,
+			&task.Secret,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		task.Delivery.Status = types.WebhookDeliveryPending
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// MarkDeliverySucceeded records a successful delivery attempt
+func (r *WebhookRepository) MarkDeliverySucceeded(ctx context.Context, deliveryID string, responseStatus int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded',
+		    response_status = $2,
+		    last_error = NULL,
+		    next_attempt_at = NULL,
+		    delivered_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.conn().Exec(ctx, query, deliveryID, responseStatus); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDeliveryFailed records a failed delivery attempt. A nil nextAttemptAt gives up on the delivery.
+func (r *WebhookRepository) MarkDeliveryFailed(ctx context.Context, deliveryID string, responseStatus *int, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = CASE WHEN $4::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    response_status = $2,
+		    last_error = $3,
+		    next_attempt_at = $4
+		WHERE id = $1
+	`
+
+	if _, err := r.db.conn().Exec(ctx, query, deliveryID, responseStatus, lastError, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries retrieves the most recent deliveries of a webhook
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookID string, status string, limit int) ([]types.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		  AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.db.conn().Query(ctx, query, webhookID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, nil
+}
+
+// RetryDelivery puts a finished delivery of a user's webhook back in the queue for immediate delivery
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, userID, webhookID, deliveryID string) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1
+		  AND webhook_id = $2
+		  AND webhook_id IN (SELECT id FROM webhooks WHERE user_id = $3)
+	`
+
+	result, err := r.db.conn().Exec(ctx, query, deliveryID, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperror.ErrDeliveryNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/testutil/pgtest"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+const testEventID = "11111111-1111-1111-1111-111111111111"
+
+func TestWebhookRepositoryCRUD(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewWebhookRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+
+	description := "日記の連携"
+	webhook, err := repo.CreateWebhook(ctx, alice.ID, "https://hooks.example.com/a", "secret", []string{types.WebhookEventSessionCompleted}, &description)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if !webhook.IsActive || webhook.Secret != "" || len(webhook.Events) != 1 {
+		t.Errorf("created webhook = %+v, want an active webhook without its secret", webhook)
+	}
+
+	if count, err := repo.CountWebhooks(ctx, alice.ID); err != nil || count != 1 {
+		t.Errorf("CountWebhooks = %d, %v, want 1", count, err)
+	}
+	if webhooks, err := repo.GetWebhooks(ctx, alice.ID); err != nil || len(webhooks) != 1 || webhooks[0].ID != webhook.ID {
+		t.Errorf("GetWebhooks = %+v, %v", webhooks, err)
+	}
+	if found, err := repo.GetWebhook(ctx, bob.ID, webhook.ID); err != nil || found != nil {
+		t.Errorf("GetWebhook by another user = %+v, %v, want nil", found, err)
+	}
+
+	webhook.URL = "https://hooks.example.com/b"
+	webhook.IsActive = false
+	updated, err := repo.UpdateWebhook(ctx, webhook)
+	if err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	if updated.URL != "https://hooks.example.com/b" || updated.IsActive {
+		t.Errorf("updated webhook = %+v", updated)
+	}
+
+	other := *webhook
+	other.UserID = bob.ID
+	if _, err := repo.UpdateWebhook(ctx, &other); !errors.Is(err, apperror.ErrWebhookNotFound) {
+		t.Errorf("UpdateWebhook by another user error = %v, want webhook not found", err)
+	}
+
+	if err := repo.DeleteWebhook(ctx, bob.ID, webhook.ID); !errors.Is(err, apperror.ErrWebhookNotFound) {
+		t.Errorf("DeleteWebhook by another user error = %v, want webhook not found", err)
+	}
+	if err := repo.DeleteWebhook(ctx, alice.ID, webhook.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if found, err := repo.GetWebhook(ctx, alice.ID, webhook.ID); err != nil || found != nil {
+		t.Errorf("GetWebhook after delete = %+v, %v, want nil", found, err)
+	}
+}
+
+func TestWebhookRepositoryGetWebhookIDsForEvent(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewWebhookRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+
+	subscribed := createWebhook(t, repo, user.ID, types.WebhookEventSessionCompleted, types.WebhookEventAnalysisCreated)
+	createWebhook(t, repo, user.ID, types.WebhookEventAnalysisCreated)
+	inactive := createWebhook(t, repo, user.ID, types.WebhookEventSessionCompleted)
+	inactive.IsActive = false
+	if _, err := repo.UpdateWebhook(ctx, inactive); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+
+	ids, err := repo.GetWebhookIDsForEvent(ctx, user.ID, types.WebhookEventSessionCompleted)
+	if err != nil {
+		t.Fatalf("GetWebhookIDsForEvent: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != subscribed.ID {
+		t.Errorf("webhooks for session.completed = %v, want only %s", ids, subscribed.ID)
+	}
+}
+
+func TestWebhookRepositoryDeliveryQueue(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewWebhookRepository(db)
+	ctx := context.Background()
+	user := pgtest.User(t, db, "alice")
+	webhook := createWebhook(t, repo, user.ID, types.WebhookEventSessionCompleted)
+
+	if err := repo.CreateDelivery(ctx, webhook.ID, testEventID, types.WebhookEventSessionCompleted, []byte(`{"ok": true}`)); err != nil {
+		t.Fatalf("CreateDelivery: %v", err)
+	}
+
+	tasks, err := repo.ClaimDueDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDueDeliveries: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].URL != webhook.URL || tasks[0].Secret != "secret" || tasks[0].Delivery.Attempts != 1 {
+		t.Fatalf("claimed tasks = %+v, want the delivery with its webhook URL and secret", tasks)
+	}
+	deliveryID := tasks[0].Delivery.ID
+
+	// The lease keeps other workers from claiming it again
+	if again, err := repo.ClaimDueDeliveries(ctx, 10, time.Minute); err != nil || len(again) != 0 {
+		t.Errorf("leased delivery was claimed again: %+v, %v", again, err)
+	}
+
+	// A failure with a next attempt in the past makes it due again
+	status := 500
+	retryAt := time.Now().Add(-time.Second)
+	if err := repo.MarkDeliveryFailed(ctx, deliveryID, &status, "unexpected status 500", &retryAt); err != nil {
+		t.Fatalf("MarkDeliveryFailed: %v", err)
+	}
+	tasks, err = repo.ClaimDueDeliveries(ctx, 10, time.Minute)
+	if err != nil || len(tasks) != 1 || tasks[0].Delivery.Attempts != 2 {
+		t.Fatalf("claimed after failure = %+v, %v, want the second attempt", tasks, err)
+	}
+
+	if err := repo.MarkDeliverySucceeded(ctx, deliveryID, 200); err != nil {
+		t.Fatalf("MarkDeliverySucceeded: %v", err)
+	}
+	deliveries, err := repo.GetDeliveries(ctx, webhook.ID, types.WebhookDeliverySucceeded, 10)
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].DeliveredAt == nil || deliveries[0].LastError != nil || *deliveries[0].ResponseStatus != 200 {
+		t.Errorf("succeeded deliveries = %+v", deliveries)
+	}
+	if pending, err := repo.GetDeliveries(ctx, webhook.ID, types.WebhookDeliveryPending, 10); err != nil || len(pending) != 0 {
+		t.Errorf("pending deliveries = %+v, %v, want none", pending, err)
+	}
+}
+
+func TestWebhookRepositoryGiveUpAndRetryDelivery(t *testing.T) {
+	db := pgtest.New(t)
+	repo := repository.NewWebhookRepository(db)
+	ctx := context.Background()
+	alice := pgtest.User(t, db, "alice")
+	bob := pgtest.User(t, db, "bob")
+	webhook := createWebhook(t, repo, alice.ID, types.WebhookEventSessionCompleted)
+
+	if err := repo.CreateDelivery(ctx, webhook.ID, testEventID, types.WebhookEventSessionCompleted, []byte(`{}`)); err != nil {
+		t.Fatalf("CreateDelivery: %v", err)
+	}
+	tasks, err := repo.ClaimDueDeliveries(ctx, 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("ClaimDueDeliveries = %+v, %v", tasks, err)
+	}
+	deliveryID := tasks[0].Delivery.ID
+
+	if err := repo.MarkDeliveryFailed(ctx, deliveryID, nil, "connection refused", nil); err != nil {
+		t.Fatalf("MarkDeliveryFailed: %v", err)
+	}
+	failed, err := repo.GetDeliveries(ctx, webhook.ID, types.WebhookDeliveryFailed, 10)
+	if err != nil || len(failed) != 1 || failed[0].LastError == nil || *failed[0].LastError != "connection refused" {
+		t.Fatalf("failed deliveries = %+v, %v", failed, err)
+	}
+
+	if err := repo.RetryDelivery(ctx, bob.ID, webhook.ID, deliveryID); !errors.Is(err, apperror.ErrDeliveryNotFound) {
+		t.Errorf("RetryDelivery by another user error = %v, want webhook delivery not found", err)
+	}
+	if err := repo.RetryDelivery(ctx, alice.ID, webhook.ID, deliveryID); err != nil {
+		t.Fatalf("RetryDelivery: %v", err)
+	}
+	tasks, err = repo.ClaimDueDeliveries(ctx, 10, time.Minute)
+	if err != nil || len(tasks) != 1 || tasks[0].Delivery.Attempts != 1 {
+		t.Errorf("claimed after retry = %+v, %v, want a fresh first attempt", tasks, err)
+	}
+}
+
+// createWebhook registers an active webhook for the events
+func createWebhook(t *testing.T, repo *repository.WebhookRepository, userID string, events ...string) *types.Webhook {
+	t.Helper()
+
+	webhook, err := repo.CreateWebhook(context.Background(), userID, "https://hooks.example.com/"+events[0], "secret", events, nil)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return webhook
+}
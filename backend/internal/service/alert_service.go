@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/alert"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// AlertService evaluates mood alert rules and manages notifications
+type AlertService struct {
+	alertRepo       repository.AlertStore
+	analysisService *AnalysisService
+	engine          *alert.Engine
+	webhookService  *WebhookService
+	logger          *slog.Logger
+}
+
+// Alert evaluation settings
+const (
+	// alertHistoryDays is how much score history the rules see
+	alertHistoryDays = 30
+	// alertCooldown suppresses repeated alerts of the same type
+	alertCooldown = 3 * 24 * time.Hour
+	// chatAcknowledgementWindow is how long an alert may still be acknowledged in the next first message
+	chatAcknowledgementWindow = 3 * 24 * time.Hour
+)
+
+// NewAlertService creates a new alert service
+func NewAlertService(
+	alertRepo repository.AlertStore,
+	analysisService *AnalysisService,
+	engine *alert.Engine,
+	logger *slog.Logger,
+) *AlertService {
+	return &AlertService{
+		alertRepo:       alertRepo,
+		analysisService: analysisService,
+		engine:          engine,
+		logger:          logger,
+	}
+}
+
+// SetWebhookService sets the webhook service notified of triggered alerts
+func (s *AlertService) SetWebhookService(webhookService *WebhookService) {
+	s.webhookService = webhookService
+}
+
+// EvaluateUser runs the alert rules for a user and creates notifications for new alerts
+func (s *AlertService) EvaluateUser(ctx context.Context, userID string) ([]types.Notification, error) {
+	settings, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, nil
+	}
+
+	scoresResponse, err := s.analysisService.GetTensionScores(ctx, userID, alertHistoryDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tension scores: %w", err)
+	}
+
+	// Scores are returned newest first; rules expect oldest first
+	scores := make([]types.TensionScoreData, len(scoresResponse.Scores))
+	for i, score := range scoresResponse.Scores {
+		scores[len(scores)-1-i] = score
+	}
+
+	now := timeutil.NowJST()
+	alerts := s.engine.Evaluate(alert.Input{
+		Scores:   scores,
+		Settings: settings,
+		Today:    now,
+	})
+
+	var notifications []types.Notification
+	for _, a := range alerts {
+		exists, err := s.alertRepo.HasRecentNotification(ctx, userID, a.Type, a.Key, now.Add(-alertCooldown))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"key":       a.Key,
+			"chat_hint": a.ChatHint,
+		}
+		for k, v := range a.Data {
+			data[k] = v
+		}
+
+		notification, err := s.alertRepo.CreateNotification(ctx, userID, a.Type, a.Title, a.Body, data)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, *notification)
+
+		if s.webhookService != nil {
+			if err := s.webhookService.Emit(ctx, userID, types.WebhookEventAlertTriggered, notification); err != nil {
+				s.logger.ErrorContext(ctx, "Failed to emit webhook", slog.String("event", types.WebhookEventAlertTriggered), logging.Err(err))
+			}
+		}
+	}
+
+	return notifications, nil
+}
+
+// EvaluateAllUsers runs the alert rules for every user who has not opted out, e.g. to catch missed days
+func (s *AlertService) EvaluateAllUsers(ctx context.Context) (int, error) {
+	userIDs, err := s.alertRepo.GetAlertUserIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	errorCount := 0
+	for _, userID := range userIDs {
+		userCtx := logging.WithUserID(ctx, userID)
+		notifications, err := s.EvaluateUser(userCtx, userID)
+		if err != nil {
+			s.logger.ErrorContext(userCtx, "Failed to evaluate alerts", logging.Err(err))
+			errorCount++
+			continue
+		}
+		created += len(notifications)
+	}
+
+	if errorCount > 0 {
+		return created, fmt.Errorf("alert evaluation completed with %d errors out of %d users", errorCount, len(userIDs))
+	}
+
+	return created, nil
+}
+
+// ChatAcknowledgement is a recent alert to acknowledge gently in the first message of the day
+type ChatAcknowledgement struct {
+	NotificationID string
+	// Hint tells the AI what to acknowledge
+	Hint string
+}
+
+// GetChatAcknowledgement returns a recent alert to acknowledge in the first message of the day. It
+// returns nil when there is nothing to acknowledge or the user disabled it. The alert is only marked
+// as acknowledged together with the saved greeting (see ChatService.GetTodaySession), so that a
+// greeting that fails does not use it up.
+func (s *AlertService) GetChatAcknowledgement(ctx context.Context, userID string) (*ChatAcknowledgement, error) {
+	settings, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled || !settings.AcknowledgeInChat {
+		return nil, nil
+	}
+
+	notification, err := s.alertRepo.GetChatAcknowledgement(ctx, userID, timeutil.NowJST().Add(-chatAcknowledgementWindow))
+	if err != nil {
+		return nil, err
+	}
+	if notification == nil {
+		return nil, nil
+	}
+
+	var data struct {
+		ChatHint string `json:"chat_hint"`
+	}
+	if err := json.Unmarshal(notification.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse notification data: %w", err)
+	}
+
+	return &ChatAcknowledgement{NotificationID: notification.ID, Hint: data.ChatHint}, nil
+}
+
+// GetSettings retrieves a user's alert settings, falling back to the defaults
+func (s *AlertService) GetSettings(ctx context.Context, userID string) (*types.AlertSettings, error) {
+	settings, err := s.alertRepo.GetAlertSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		return alert.DefaultSettings(userID), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update to a user's alert settings
+func (s *AlertService) UpdateSettings(ctx context.Context, userID string, req *types.UpdateAlertSettingsRequest) (*types.AlertSettings, error) {
+	settings, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.DeclineDays != nil {
+		settings.DeclineDays = *req.DeclineDays
+	}
+	if req.DeclineMinDrop != nil {
+		settings.DeclineMinDrop = *req.DeclineMinDrop
+	}
+	if req.SuddenDropPoints != nil {
+		settings.SuddenDropPoints = *req.SuddenDropPoints
+	}
+	if req.MissedDays != nil {
+		settings.MissedDays = *req.MissedDays
+	}
+	if req.LowScoreThreshold != nil {
+		settings.LowScoreThreshold = *req.LowScoreThreshold
+	}
+	if req.AcknowledgeInChat != nil {
+		settings.AcknowledgeInChat = *req.AcknowledgeInChat
+	}
+
+	if settings.DeclineDays < 2 || settings.DeclineDays > 14 ||
+		settings.DeclineMinDrop < 0 || settings.DeclineMinDrop > 100 ||
+		settings.SuddenDropPoints < 5 || settings.SuddenDropPoints > 100 ||
+		settings.MissedDays < 1 || settings.MissedDays > 30 ||
+		settings.LowScoreThreshold < 0 || settings.LowScoreThreshold > 100 {
+		return nil, apperror.ErrInvalidAlertSettings
+	}
+
+	return s.alertRepo.UpsertAlertSettings(ctx, settings)
+}
+
+// GetNotifications retrieves a user's notifications
+func (s *AlertService) GetNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) (*types.NotificationsResponse, error) {
+	notifications, err := s.alertRepo.GetNotifications(ctx, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadCount, err := s.alertRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.NotificationsResponse{
+		Notifications: notifications,
+		UnreadCount:   unreadCount,
+	}, nil
+}
+
+// MarkNotificationRead marks a user's notification as read
+func (s *AlertService) MarkNotificationRead(ctx context.Context, userID, notificationID string) error {
+	return s.alertRepo.MarkNotificationRead(ctx, userID, notificationID)
+}
@@ -3,44 +3,102 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/metrics"
 	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
 	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/stats"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // AnalysisService handles analysis-related business logic
 type AnalysisService struct {
-	analysisRepo *repository.AnalysisRepository
-	sessionRepo  *repository.SessionRepository
-	messageRepo  *repository.MessageRepository
-	userRepo     *repository.UserRepository
-	aiClient     *ai.Client
+	txManager      repository.TxManager
+	analysisRepo   repository.AnalysisStore
+	sessionRepo    repository.SessionStore
+	messageRepo    repository.MessageStore
+	userRepo       repository.UserStore
+	aiClient       *ai.Client
+	taxonomy       *ai.EmotionTaxonomy
+	entityService  *EntityService
+	alertService   *AlertService
+	webhookService *WebhookService
+	usageService   *UsageService
+	logger         *slog.Logger
 }
 
+const (
+	// analysisStepAttempts is how many times an analysis step runs when Gemini's output cannot be used
+	analysisStepAttempts = 2
+	// analysisStepCalls caps the Gemini calls of one analysis step. The step's attempts, the client's
+	// repair prompts and its retries would otherwise multiply to 2 × 2 × (AI_MAX_RETRIES+1) calls.
+	analysisStepCalls = 4
+)
+
 // NewAnalysisService creates a new analysis service
 func NewAnalysisService(
-	analysisRepo *repository.AnalysisRepository,
-	sessionRepo *repository.SessionRepository,
-	messageRepo *repository.MessageRepository,
-	userRepo *repository.UserRepository,
+	txManager repository.TxManager,
+	analysisRepo repository.AnalysisStore,
+	sessionRepo repository.SessionStore,
+	messageRepo repository.MessageStore,
+	userRepo repository.UserStore,
 	aiClient *ai.Client,
+	taxonomy *ai.EmotionTaxonomy,
+	logger *slog.Logger,
 ) *AnalysisService {
 	return &AnalysisService{
+		txManager:    txManager,
 		analysisRepo: analysisRepo,
 		sessionRepo:  sessionRepo,
 		messageRepo:  messageRepo,
 		userRepo:     userRepo,
 		aiClient:     aiClient,
+		taxonomy:     taxonomy,
+		logger:       logger,
 	}
 }
 
+// SetEntityService sets the entity service used to extract mentioned entities after analysis
+func (s *AnalysisService) SetEntityService(entityService *EntityService) {
+	s.entityService = entityService
+}
+
+// SetAlertService sets the alert service whose rules are evaluated after each analysis
+func (s *AnalysisService) SetAlertService(alertService *AlertService) {
+	s.alertService = alertService
+}
+
+// SetWebhookService sets the webhook service notified of analysis events
+func (s *AnalysisService) SetWebhookService(webhookService *WebhookService) {
+	s.webhookService = webhookService
+}
+
+// SetUsageService sets the usage service whose quotas defer analyses once exceeded
+func (s *AnalysisService) SetUsageService(usageService *UsageService) {
+	s.usageService = usageService
+}
+
 // AnalyzeSession performs comprehensive analysis of a chat session
 func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID string) (*types.Analysis, error) {
-	fmt.Printf("DEBUG: Starting analysis for sessionID: %s\n", sessionID)
+	return s.analyzeSession(ctx, userID, sessionID, false)
+}
+
+// analyzeSession analyzes a session and, if complete is set, completes it together with saving the analysis
+func (s *AnalysisService) analyzeSession(ctx context.Context, userID, sessionID string, complete bool) (*types.Analysis, error) {
+	ctx, span := tracing.Start(ctx, "AnalysisService.AnalyzeSession", trace.WithAttributes(tracing.SessionIDKey.String(sessionID)))
+	defer span.End()
 
 	// Verify session ownership
 	isOwner, err := s.sessionRepo.CheckSessionOwnership(ctx, sessionID, userID)
@@ -48,7 +106,7 @@ func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID
 		return nil, fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return nil, fmt.Errorf("session not found or access denied")
+		return nil, apperror.ErrSessionNotFound
 	}
 
 	// Check if analysis already exists
@@ -57,32 +115,55 @@ func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID
 		return nil, fmt.Errorf("failed to check existing analysis: %w", err)
 	}
 	if existingAnalysis != nil {
-		fmt.Printf("DEBUG: Returning existing analysis for sessionID: %s\n", sessionID)
+		s.logger.DebugContext(ctx, "Analysis already exists", slog.String("session_id", sessionID))
+		if complete {
+			if err := s.sessionRepo.CompleteSession(ctx, sessionID); err != nil {
+				return nil, fmt.Errorf("failed to complete session: %w", err)
+			}
+		}
 		return existingAnalysis, nil // Return existing analysis
 	}
 
+	// Over quota: leave the session for a later batch run instead of spending more tokens
+	if s.usageService != nil && s.usageService.QuotaExceeded(ctx, userID) {
+		return nil, apperror.ErrAIQuotaExceeded
+	}
+	ctx = ai.WithUsageScope(ctx, userID, sessionID)
+
 	// Get session information
 	_, err = s.sessionRepo.GetSessionByID(ctx, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	// Get conversation log
-	conversationLog, err := s.messageRepo.GetConversationLog(ctx, sessionID)
+	// Get session messages
+	messages, err := s.messageRepo.GetSessionMessages(ctx, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation log: %w", err)
 	}
 
-	if conversationLog == "" {
-		return nil, fmt.Errorf("no messages found for analysis")
+	if len(messages) == 0 {
+		return nil, apperror.ErrNoMessages
+	}
+
+	// Keep message IDs so that emotions can point to their evidence
+	conversation := make([]ai.Message, 0, len(messages))
+	plainConversation := make([]ai.Message, 0, len(messages))
+	for _, msg := range messages {
+		conversation = append(conversation, ai.Message{ID: msg.ID, Content: msg.Content, Sender: msg.Sender})
+		plainConversation = append(plainConversation, ai.Message{Content: msg.Content, Sender: msg.Sender})
 	}
+	conversationLog := ai.FormatConversationLog(plainConversation)
 
 	// Perform emotion analysis
-	fmt.Printf("DEBUG: Starting emotion analysis\n")
-	emotionAnalysis, err := s.aiClient.AnalyzeEmotion(ctx, conversationLog)
+	var emotionAnalysis *ai.EmotionAnalysis
+	err = s.runAnalysisStep(ctx, "AnalyzeEmotion", func(ctx context.Context) error {
+		var stepErr error
+		emotionAnalysis, stepErr = s.aiClient.AnalyzeEmotion(ctx, conversation, s.taxonomy)
+		return stepErr
+	})
 	if err != nil {
-		fmt.Printf("DEBUG: Emotion analysis failed: %v\n", err)
-		return nil, fmt.Errorf("failed to analyze emotion: %w", err)
+		return nil, classifyAIError(fmt.Errorf("failed to analyze emotion: %w", err))
 	}
 
 	// Get historical data for tension score calculation
@@ -92,17 +173,20 @@ func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID
 	}
 
 	// Calculate tension score
-	fmt.Printf("DEBUG: Starting tension score calculation\n")
-	tensionScoreAnalysis, err := s.aiClient.CalculateTensionScore(ctx, emotionAnalysis, historicalData)
+	var tensionScoreAnalysis *ai.TensionScoreAnalysis
+	err = s.runAnalysisStep(ctx, "CalculateTensionScore", func(ctx context.Context) error {
+		var stepErr error
+		tensionScoreAnalysis, stepErr = s.aiClient.CalculateTensionScore(ctx, emotionAnalysis, historicalData)
+		return stepErr
+	})
 	if err != nil {
-		fmt.Printf("DEBUG: Tension score calculation failed: %v\n", err)
-		return nil, fmt.Errorf("failed to calculate tension score: %w", err)
+		return nil, classifyAIError(fmt.Errorf("failed to calculate tension score: %w", err))
 	}
 
 	// Generate summary and insights
 	summary, behavioralInsights, err := s.generateAnalysisSummary(ctx, emotionAnalysis, tensionScoreAnalysis, conversationLog)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate summary: %w", err)
+		return nil, classifyAIError(fmt.Errorf("failed to generate summary: %w", err))
 	}
 
 	// Prepare analysis data
@@ -115,8 +199,11 @@ func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID
 
 	// Convert emotion data to JSON
 	emotionalStateJSON, err := json.Marshal(map[string]interface{}{
+		"taxonomy":        emotionAnalysis.Taxonomy,
 		"primary_emotion": emotionAnalysis.PrimaryEmotion,
 		"emotions":        emotionAnalysis.Emotions,
+		"details":         emotionAnalysis.Details,
+		"trajectory":      emotionAnalysis.Trajectory,
 		"confidence":      emotionAnalysis.Confidence,
 		"explanation":     emotionAnalysis.Explanation,
 	})
@@ -153,13 +240,46 @@ func (s *AnalysisService) AnalyzeSession(ctx context.Context, userID, sessionID
 	analysis.RawAnalysisData = rawDataJSON
 
 	// Save analysis to database
-	savedAnalysis, err := s.analysisRepo.CreateAnalysis(ctx, analysis)
+	var savedAnalysis *types.Analysis
+	err = s.txManager.WithTx(ctx, func(tx repository.Repos) error {
+		savedAnalysis, err = tx.Analyses.CreateAnalysis(ctx, analysis)
+		if err != nil {
+			return fmt.Errorf("failed to save analysis: %w", err)
+		}
+		if complete {
+			if err := tx.Sessions.CompleteSession(ctx, sessionID); err != nil {
+				return fmt.Errorf("failed to complete session: %w", err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to save analysis: %v\n", err)
-		return nil, fmt.Errorf("failed to save analysis: %w", err)
+		return nil, err
+	}
+
+	// Raw model output stays internal
+	webhookAnalysis := *savedAnalysis
+	webhookAnalysis.RawAnalysisData = nil
+	s.emitWebhook(ctx, userID, types.WebhookEventAnalysisCreated, webhookAnalysis)
+
+	// Extract mentioned entities; a failure here must not discard the saved analysis
+	if s.entityService != nil {
+		if err := s.entityService.ExtractSessionEntities(ctx, userID, sessionID, conversation); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to extract entities", slog.String("session_id", sessionID), logging.Err(err))
+		}
 	}
 
-	fmt.Printf("DEBUG: Analysis completed successfully for sessionID: %s, tensionScore: %d\n", sessionID, tensionScoreAnalysis.TensionScore)
+	// Check the new score against the mood alert rules
+	if s.alertService != nil {
+		if _, err := s.alertService.EvaluateUser(ctx, userID); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to evaluate alerts", slog.String("session_id", sessionID), logging.Err(err))
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Analysis completed",
+		slog.String("session_id", sessionID),
+		slog.Int("tension_score", savedAnalysis.TensionScore),
+	)
 	return savedAnalysis, nil
 }
 
@@ -171,7 +291,7 @@ func (s *AnalysisService) GetSessionAnalysis(ctx context.Context, userID, sessio
 		return nil, fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return nil, fmt.Errorf("session not found or access denied")
+		return nil, apperror.ErrSessionNotFound
 	}
 
 	analysis, err := s.analysisRepo.GetAnalysisBySessionID(ctx, sessionID)
@@ -187,6 +307,33 @@ func (s *AnalysisService) GetSessionAnalysis(ctx context.Context, userID, sessio
 	return analysis, nil
 }
 
+// GetUserAnalyses retrieves a page of analysis history for a user
+func (s *AnalysisService) GetUserAnalyses(ctx context.Context, userID string, query types.ListQuery) (*types.AnalysesResponse, error) {
+	after, err := prepareListQuery(&query, analysisSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	analyses, next, err := s.analysisRepo.GetAnalysesByUserID(ctx, userID, query.Sort, query.SessionFilter, after, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user analyses: %w", err)
+	}
+
+	var total *int
+	if query.IncludeTotal {
+		count, err := s.analysisRepo.CountAnalyses(ctx, userID, query.SessionFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count user analyses: %w", err)
+		}
+		total = &count
+	}
+
+	return &types.AnalysesResponse{
+		Analyses:   analyses,
+		Pagination: newPagination(query.Limit, next, total),
+	}, nil
+}
+
 // GetTensionScores retrieves tension scores for a user
 func (s *AnalysisService) GetTensionScores(ctx context.Context, userID string, days int) (*types.TensionScoresResponse, error) {
 	endDate := timeutil.NowJST()
@@ -204,12 +351,341 @@ func (s *AnalysisService) GetTensionScores(ctx context.Context, userID string, d
 		return nil, fmt.Errorf("failed to get tension statistics: %w", err)
 	}
 
+	analyzeTensionSeries(scores, statistics)
+
 	return &types.TensionScoresResponse{
 		Scores:     scores,
 		Statistics: *statistics,
 	}, nil
 }
 
+// Time-series settings for analyzeTensionSeries
+const (
+	// rollingAverageDays is the trailing window of the rolling average, in calendar days
+	rollingAverageDays = 7
+	// trendMinSampleSize is the minimum number of scores needed to fit a trend
+	trendMinSampleSize = 7
+	// trendConfidence is the confidence level of the slope interval
+	trendConfidence = 0.95
+	// seasonalityMinSampleSize is the minimum number of scores per weekday to estimate its effect
+	seasonalityMinSampleSize = 2
+	// seasonalityMinWeeks is the minimum span of data, in weeks, before weekday effects are estimated
+	seasonalityMinWeeks = 2
+	// anomalyZThreshold is the absolute z-score above which a day is flagged as unusual
+	anomalyZThreshold = 2.0
+)
+
+// analyzeTensionSeries fills rolling averages, the regression trend, weekly seasonality and anomaly flags.
+// The trend is "improving" or "declining" only when the slope's confidence interval excludes zero.
+func analyzeTensionSeries(scores []types.TensionScoreData, statistics *types.TensionStatistics) {
+	statistics.Trend = "stable"
+
+	// Scores come newest first; work on them oldest first with their calendar dates
+	type point struct {
+		index int
+		date  time.Time
+		score float64
+	}
+	var points []point
+	for i := len(scores) - 1; i >= 0; i-- {
+		date, err := time.Parse("2006-01-02", scores[i].Date)
+		if err != nil {
+			continue
+		}
+		points = append(points, point{index: i, date: date, score: float64(scores[i].TensionScore)})
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.score
+	}
+	statistics.StdDev = stats.StdDev(values)
+
+	// Trailing rolling average over calendar days, so gaps shrink the window instead of stretching it
+	for i, p := range points {
+		windowStart := p.date.AddDate(0, 0, -(rollingAverageDays - 1))
+		var window []float64
+		for j := i; j >= 0 && !points[j].date.Before(windowStart); j-- {
+			window = append(window, points[j].score)
+		}
+		average := stats.Mean(window)
+		scores[p.index].RollingAverage = &average
+	}
+
+	// Linear trend in points per day
+	first := points[0].date
+	days := make([]float64, len(points))
+	for i, p := range points {
+		days[i] = p.date.Sub(first).Hours() / 24
+	}
+
+	var regression *stats.Regression
+	if len(points) >= trendMinSampleSize {
+		if fit, ok := stats.LinearRegression(days, values); ok {
+			regression = &fit
+			low, high := fit.SlopeConfidenceInterval(trendConfidence)
+			statistics.Regression = &types.TensionRegression{
+				Slope:          fit.Slope,
+				ConfidenceLow:  low,
+				ConfidenceHigh: high,
+				Confidence:     trendConfidence,
+				PValue:         fit.SlopePValue(),
+				RSquared:       fit.RSquared,
+			}
+			if low > 0 {
+				statistics.Trend = "improving"
+			} else if high < 0 {
+				statistics.Trend = "declining"
+			}
+		}
+	}
+
+	// Residuals after removing the trend (or the mean when there is no trend)
+	residuals := make([]float64, len(points))
+	mean := stats.Mean(values)
+	for i, p := range points {
+		if regression != nil {
+			residuals[i] = p.score - regression.Predict(days[i])
+		} else {
+			residuals[i] = p.score - mean
+		}
+	}
+
+	// Weekly seasonality: the mean residual per weekday
+	span := points[len(points)-1].date.Sub(first).Hours() / 24
+	if span >= float64(seasonalityMinWeeks*7) {
+		byWeekday := make(map[time.Weekday][]float64)
+		for i, p := range points {
+			byWeekday[p.date.Weekday()] = append(byWeekday[p.date.Weekday()], residuals[i])
+		}
+
+		effects := make(map[time.Weekday]float64)
+		for weekday, weekdayResiduals := range byWeekday {
+			if len(weekdayResiduals) >= seasonalityMinSampleSize {
+				effects[weekday] = stats.Mean(weekdayResiduals)
+			}
+		}
+
+		if len(effects) > 0 {
+			statistics.WeeklySeasonality = make(map[string]float64)
+			for weekday, effect := range effects {
+				statistics.WeeklySeasonality[strings.ToLower(weekday.String())] = effect
+			}
+			for i, p := range points {
+				residuals[i] -= effects[p.date.Weekday()]
+			}
+		}
+	}
+
+	// Anomalies: days whose remaining deviation is unusually large
+	if len(points) < trendMinSampleSize {
+		return
+	}
+	for i, z := range stats.ZScores(residuals) {
+		z := z
+		scores[points[i].index].ZScore = &z
+		if math.Abs(z) >= anomalyZThreshold {
+			scores[points[i].index].Anomaly = true
+			statistics.AnomalyCount++
+		}
+	}
+}
+
+// Correlation settings for GetTensionCorrelations
+const (
+	// correlationMinSampleSize is the minimum number of days both with and without a factor
+	correlationMinSampleSize = 5
+	// correlationSignificanceLevel is the false discovery rate used to flag significant factors
+	correlationSignificanceLevel = 0.05
+)
+
+var topicLabels = map[string]string{
+	"work":    "仕事",
+	"study":   "勉強",
+	"family":  "家族",
+	"friends": "友人",
+	"love":    "恋愛",
+	"health":  "健康",
+	"sleep":   "睡眠",
+	"food":    "食事",
+	"hobby":   "趣味",
+	"money":   "お金",
+	"weather": "天気",
+}
+
+var weekdayLabels = map[string]string{
+	"sunday":    "日",
+	"monday":    "月",
+	"tuesday":   "火",
+	"wednesday": "水",
+	"thursday":  "木",
+	"friday":    "金",
+	"saturday":  "土",
+}
+
+// GetTensionCorrelations compares tension scores on days with each keyword, topic, entity and weekday against days without it
+func (s *AnalysisService) GetTensionCorrelations(ctx context.Context, userID string, days int) (*types.TensionCorrelationsResponse, error) {
+	endDate := timeutil.NowJST()
+	startDate := endDate.AddDate(0, 0, -days)
+
+	samples, err := s.analysisRepo.GetTensionFactorSamples(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tension factor samples: %w", err)
+	}
+
+	type factor struct {
+		kind string
+		name string
+	}
+
+	// Record the days on which each factor was present
+	present := make(map[factor]map[int]bool)
+	add := func(f factor, day int) {
+		if f.name == "" {
+			return
+		}
+		if present[f] == nil {
+			present[f] = make(map[int]bool)
+		}
+		present[f][day] = true
+	}
+
+	for i, sample := range samples {
+		for _, keyword := range sample.Keywords {
+			add(factor{types.FactorKindKeyword, strings.ToLower(strings.TrimSpace(keyword))}, i)
+		}
+		for _, topic := range sample.Topics {
+			add(factor{types.FactorKindTopic, topic}, i)
+		}
+		for _, entity := range sample.Entities {
+			add(factor{types.FactorKindEntity, entity}, i)
+		}
+		if date, err := time.Parse("2006-01-02", sample.Date); err == nil {
+			add(factor{types.FactorKindWeekday, strings.ToLower(date.Weekday().String())}, i)
+		}
+	}
+
+	correlations := []types.TensionCorrelation{}
+	for f, presentDays := range present {
+		if len(presentDays) < correlationMinSampleSize || len(samples)-len(presentDays) < correlationMinSampleSize {
+			continue
+		}
+
+		var with, without []float64
+		for i, sample := range samples {
+			if presentDays[i] {
+				with = append(with, float64(sample.TensionScore))
+			} else {
+				without = append(without, float64(sample.TensionScore))
+			}
+		}
+
+		result, ok := stats.WelchTTest(with, without)
+		if !ok {
+			continue
+		}
+
+		name := f.name
+		if f.kind == types.FactorKindEntity {
+			// Entities are keyed as "kind:name"; only the name is shown
+			if _, entityName, found := strings.Cut(name, ":"); found {
+				name = entityName
+			}
+		}
+
+		correlations = append(correlations, types.TensionCorrelation{
+			Kind:        f.kind,
+			Factor:      name,
+			DaysWith:    len(with),
+			DaysWithout: len(without),
+			MeanWith:    stats.Mean(with),
+			MeanWithout: stats.Mean(without),
+			Difference:  stats.Mean(with) - stats.Mean(without),
+			PValue:      result.PValue,
+		})
+	}
+
+	// Many factors are tested at once, so control the false discovery rate across all of them
+	pValues := make([]float64, len(correlations))
+	for i, correlation := range correlations {
+		pValues[i] = correlation.PValue
+	}
+	for i, adjusted := range stats.BenjaminiHochberg(pValues) {
+		correlations[i].AdjustedP = adjusted
+		correlations[i].Significant = adjusted < correlationSignificanceLevel
+		if correlations[i].Significant {
+			correlations[i].Message = correlationMessage(correlations[i])
+		}
+	}
+
+	sort.Slice(correlations, func(i, j int) bool {
+		if correlations[i].Significant != correlations[j].Significant {
+			return correlations[i].Significant
+		}
+		return math.Abs(correlations[i].Difference) > math.Abs(correlations[j].Difference)
+	})
+
+	return &types.TensionCorrelationsResponse{
+		Days:          days,
+		SampleSize:    len(samples),
+		MinSampleSize: correlationMinSampleSize,
+		Correlations:  correlations,
+	}, nil
+}
+
+// GetEmotionTrend retrieves per-session emotion scores and trajectories for charting
+func (s *AnalysisService) GetEmotionTrend(ctx context.Context, userID string, days int) (*types.EmotionTrendResponse, error) {
+	endDate := timeutil.NowJST()
+	startDate := endDate.AddDate(0, 0, -days)
+
+	records, err := s.analysisRepo.GetEmotionalStates(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get emotional states: %w", err)
+	}
+
+	emotions := make([]string, 0, len(s.taxonomy.Emotions))
+	for _, e := range s.taxonomy.Emotions {
+		emotions = append(emotions, e.Name)
+	}
+
+	points := []types.EmotionTrendPoint{}
+	for _, record := range records {
+		var state types.EmotionalState
+		if err := json.Unmarshal(record.EmotionalState, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse emotional state: %w", err)
+		}
+
+		// Analyses created before taxonomies were configurable use the Ekman emotions
+		if state.Taxonomy == "" {
+			state.Taxonomy = ai.TaxonomyEkman
+		}
+		if state.Taxonomy != s.taxonomy.Name {
+			continue // Scores from a different taxonomy cannot be charted together
+		}
+
+		point := types.EmotionTrendPoint{
+			Date:           record.Date,
+			SessionID:      record.SessionID,
+			PrimaryEmotion: state.PrimaryEmotion,
+			Emotions:       state.Emotions,
+		}
+		if state.Trajectory != nil {
+			point.Start = state.Trajectory.Start
+			point.End = state.Trajectory.End
+		}
+		points = append(points, point)
+	}
+
+	return &types.EmotionTrendResponse{
+		Taxonomy: s.taxonomy.Name,
+		Emotions: emotions,
+		Points:   points,
+	}, nil
+}
+
 // GetCalendarData retrieves calendar data for a specific month
 func (s *AnalysisService) GetCalendarData(ctx context.Context, userID string, year, month int) (*types.CalendarResponse, error) {
 	calendarDays, err := s.sessionRepo.GetCalendarData(ctx, userID, year, month)
@@ -252,13 +728,20 @@ func (s *AnalysisService) GetCalendarData(ctx context.Context, userID string, ye
 // TriggerAnalysisForCompletedSession automatically analyzes a session when it's completed
 func (s *AnalysisService) TriggerAnalysisForCompletedSession(ctx context.Context, userID, sessionID string) error {
 	// This can be called asynchronously after session completion
+	analysisCtx, span := tracing.Detach(ctx, "AnalysisService.TriggerAnalysis")
+	analysisCtx = logging.WithUserID(analysisCtx, userID)
 	go func() {
-		analysisCtx := context.Background()
+		defer span.End()
+		defer metrics.AnalysisStarted()()
+
 		_, err := s.AnalyzeSession(analysisCtx, userID, sessionID)
+		if errors.Is(err, apperror.ErrAIQuotaExceeded) {
+			s.logger.InfoContext(analysisCtx, "Analysis deferred until the AI quota resets", slog.String("session_id", sessionID))
+			return
+		}
 		if err != nil {
 			// Log error but don't fail the main flow
-			// In production, this would go to proper logging system
-			fmt.Printf("Failed to analyze session %s: %v\n", sessionID, err)
+			s.logger.ErrorContext(analysisCtx, "Failed to analyze session", slog.String("session_id", sessionID), logging.Err(err))
 		}
 	}()
 
@@ -267,7 +750,10 @@ func (s *AnalysisService) TriggerAnalysisForCompletedSession(ctx context.Context
 
 // BatchAnalyzeActiveSessions automatically analyzes active sessions with minimum message count
 func (s *AnalysisService) BatchAnalyzeActiveSessions(ctx context.Context, minMessages int) error {
-	fmt.Printf("Starting batch analysis for active sessions with at least %d messages\n", minMessages)
+	ctx, span := tracing.Start(ctx, "AnalysisService.BatchAnalyzeActiveSessions")
+	defer span.End()
+
+	s.logger.InfoContext(ctx, "Starting batch analysis", slog.Int("min_messages", minMessages))
 
 	// Get active sessions that need analysis
 	sessions, err := s.sessionRepo.GetActiveSessionsWithMinMessages(ctx, minMessages)
@@ -275,49 +761,77 @@ func (s *AnalysisService) BatchAnalyzeActiveSessions(ctx context.Context, minMes
 		return fmt.Errorf("failed to get active sessions: %w", err)
 	}
 
+	// Pick up completed sessions whose analysis was deferred
+	deferred, err := s.sessionRepo.GetUnanalyzedCompletedSessions(ctx, minMessages)
+	if err != nil {
+		return fmt.Errorf("failed to get unanalyzed completed sessions: %w", err)
+	}
+	sessions = append(sessions, deferred...)
+
 	if len(sessions) == 0 {
-		fmt.Println("No active sessions found for batch analysis")
+		s.logger.InfoContext(ctx, "No sessions found for batch analysis")
 		return nil
 	}
 
-	fmt.Printf("Found %d active sessions to analyze\n", len(sessions))
+	s.logger.InfoContext(ctx, "Found sessions to analyze",
+		slog.Int("active", len(sessions)-len(deferred)),
+		slog.Int("deferred", len(deferred)),
+	)
 
 	// Analyze each session
 	successCount := 0
 	errorCount := 0
+	deferredCount := 0
 
 	for _, session := range sessions {
-		fmt.Printf("Analyzing session %s for user %s (messages: %d)\n",
-			session.ID, session.UserID, session.MessageCount)
-
-		analysis, err := s.AnalyzeSession(ctx, session.UserID, session.ID)
+		sessionCtx := logging.WithUserID(ctx, session.UserID)
+		s.logger.InfoContext(sessionCtx, "Analyzing session",
+			slog.String("session_id", session.ID),
+			slog.Int("messages", session.MessageCount),
+		)
+
+		// Active sessions are completed together with saving their analysis (or if analysis already existed);
+		// sessions picked up after a deferred analysis are already completed
+		complete := session.Status == types.SessionStatusActive
+		analysis, err := s.analyzeSession(sessionCtx, session.UserID, session.ID, complete)
+		if errors.Is(err, apperror.ErrAIQuotaExceeded) {
+			s.logger.InfoContext(sessionCtx, "Analysis deferred until the AI quota resets", slog.String("session_id", session.ID))
+			deferredCount++
+			continue
+		}
+		metrics.RecordBatchSession(err)
 		if err != nil {
-			fmt.Printf("Failed to analyze session %s: %v\n", session.ID, err)
+			s.logger.ErrorContext(sessionCtx, "Failed to analyze session", slog.String("session_id", session.ID), logging.Err(err))
 			errorCount++
 			continue
 		}
 
-		// Complete the session after successful analysis (or if analysis already existed)
-		err = s.sessionRepo.CompleteSession(ctx, session.ID)
-		if err != nil {
-			fmt.Printf("Warning: Failed to complete session %s after analysis: %v\n", session.ID, err)
-			// Continue processing - analysis was successful, status update is not critical
-		} else {
-			fmt.Printf("Session %s marked as completed\n", session.ID)
+		if complete {
+			s.logger.DebugContext(sessionCtx, "Session marked as completed", slog.String("session_id", session.ID))
+			if s.webhookService != nil {
+				if completed, err := s.sessionRepo.GetSessionByID(sessionCtx, session.ID); err == nil {
+					s.emitWebhook(sessionCtx, session.UserID, types.WebhookEventSessionCompleted, completed)
+				}
+			}
 		}
 
 		successCount++
 		if analysis != nil {
-			fmt.Printf("Successfully processed session %s (tension score: %d)\n", session.ID, analysis.TensionScore)
-		} else {
-			fmt.Printf("Successfully processed session %s\n", session.ID)
+			s.logger.InfoContext(sessionCtx, "Processed session",
+				slog.String("session_id", session.ID),
+				slog.Int("tension_score", analysis.TensionScore),
+			)
 		}
 
 		// Add a small delay between analyses to avoid overwhelming the AI service
 		time.Sleep(1 * time.Second)
 	}
 
-	fmt.Printf("Batch analysis completed: %d successful, %d errors\n", successCount, errorCount)
+	s.logger.InfoContext(ctx, "Batch analysis completed",
+		slog.Int("succeeded", successCount),
+		slog.Int("failed", errorCount),
+		slog.Int("deferred", deferredCount),
+	)
 
 	if errorCount > 0 {
 		return fmt.Errorf("batch analysis completed with %d errors out of %d sessions", errorCount, len(sessions))
@@ -328,6 +842,34 @@ func (s *AnalysisService) BatchAnalyzeActiveSessions(ctx context.Context, minMes
 
 // Helper methods
 
+// runAnalysisStep runs an AI analysis step, repeating it when Gemini answered with output that could not be used.
+// Other failures are returned at once: the AI client has already retried unavailability, and the batch picks the session up later.
+// All the step's Gemini calls, made with the context run is given, share a budget of analysisStepCalls.
+func (s *AnalysisService) runAnalysisStep(ctx context.Context, step string, run func(ctx context.Context) error) error {
+	ctx = ai.WithCallBudget(ctx, analysisStepCalls)
+	for attempt := 1; ; attempt++ {
+		err := run(ctx)
+		if err == nil || !ai.IsOutputError(err) || attempt >= analysisStepAttempts || !ai.HasCallBudget(ctx) {
+			return err
+		}
+		s.logger.WarnContext(ctx, "Repeating analysis step after unusable AI output",
+			slog.String("step", step),
+			slog.Int("attempt", attempt),
+			logging.Err(err),
+		)
+	}
+}
+
+// emitWebhook queues a webhook event; failures are logged and never affect the analysis
+func (s *AnalysisService) emitWebhook(ctx context.Context, userID, eventType string, data interface{}) {
+	if s.webhookService == nil {
+		return
+	}
+	if err := s.webhookService.Emit(ctx, userID, eventType, data); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to emit webhook", slog.String("event", eventType), logging.Err(err))
+	}
+}
+
 // getHistoricalDataForUser retrieves historical analysis data for tension score context
 func (s *AnalysisService) getHistoricalDataForUser(ctx context.Context, userID string, days int) (string, error) {
 	endDate := timeutil.NowJST()
@@ -383,11 +925,18 @@ func (s *AnalysisService) analyzeConversationPatterns(conversationLog string) ma
 }
 
 func (s *AnalysisService) analyzeEmotionalProgression(emotionAnalysis *ai.EmotionAnalysis) map[string]interface{} {
-	return map[string]interface{}{
+	progression := map[string]interface{}{
 		"primary_emotion":   emotionAnalysis.PrimaryEmotion,
 		"confidence_level":  emotionAnalysis.Confidence,
 		"emotional_balance": s.calculateEmotionalBalance(emotionAnalysis.Emotions),
 	}
+
+	if emotionAnalysis.Trajectory != nil {
+		progression["start_balance"] = s.calculateEmotionalBalance(emotionAnalysis.Trajectory.Start)
+		progression["end_balance"] = s.calculateEmotionalBalance(emotionAnalysis.Trajectory.End)
+	}
+
+	return progression
 }
 
 func (s *AnalysisService) generateRecommendations(tensionScore int, primaryEmotion string) []string {
@@ -408,7 +957,7 @@ func (s *AnalysisService) generateRecommendations(tensionScore int, primaryEmoti
 		recommendations = append(recommendations, "友人や家族との時間を大切にしましょう")
 	case "anger":
 		recommendations = append(recommendations, "深呼吸やストレッチで気持ちを落ち着けましょう")
-	case "happiness":
+	case "happiness", "joy":
 		recommendations = append(recommendations, "今の気持ちを大切にして過ごしましょう")
 	}
 
@@ -433,8 +982,7 @@ func (s *AnalysisService) analyzeCommunicationStyle(conversationLog string) stri
 }
 
 func (s *AnalysisService) calculateEmotionalBalance(emotions map[string]float64) string {
-	positiveEmotions := emotions["happiness"] + emotions["surprise"]
-	negativeEmotions := emotions["sadness"] + emotions["anger"] + emotions["fear"]
+	positiveEmotions, negativeEmotions := s.taxonomy.Polarity(emotions)
 
 	if positiveEmotions > negativeEmotions*1.5 {
 		return "ポジティブ"
@@ -444,6 +992,27 @@ func (s *AnalysisService) calculateEmotionalBalance(emotions map[string]float64)
 	return "バランス"
 }
 
+// correlationMessage describes a significant correlation in a user-facing sentence
+func correlationMessage(correlation types.TensionCorrelation) string {
+	var subject string
+	switch correlation.Kind {
+	case types.FactorKindKeyword:
+		subject = fmt.Sprintf("「%s」が話題に出た日", correlation.Factor)
+	case types.FactorKindTopic:
+		label, ok := topicLabels[correlation.Factor]
+		if !ok {
+			label = correlation.Factor
+		}
+		subject = fmt.Sprintf("%sの話をした日", label)
+	case types.FactorKindEntity:
+		subject = fmt.Sprintf("「%s」について話した日", correlation.Factor)
+	case types.FactorKindWeekday:
+		subject = weekdayLabels[correlation.Factor] + "曜日"
+	}
+
+	return fmt.Sprintf("%sはテンションが平均%+.0f点です", subject, correlation.Difference)
+}
+
 func (s *AnalysisService) getDaysInMonth(year, month int) int {
 	// Return the number of days in the given month
 	t := time.Date(year, time.Month(month+1), 0, 0, 0, 0, 0, timeutil.JST)
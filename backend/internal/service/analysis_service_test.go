@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"google.golang.org/genai"
+)
+
+func TestAnalyzeSessionStoresAnalysis(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+	env.send(t, userID, session.ID,
+		"朝から会議続きで疲れたし、締め切りが不安",
+		"でも帰りに好きな本屋に寄れて嬉しかった",
+	)
+
+	analysis, err := env.analysis.AnalyzeSession(ctx, userID, session.ID)
+	if err != nil {
+		t.Fatalf("AnalyzeSession: %v", err)
+	}
+	if analysis.SessionID != session.ID {
+		t.Errorf("session_id = %s, want %s", analysis.SessionID, session.ID)
+	}
+	if analysis.TensionScore < 0 || analysis.TensionScore > 100 {
+		t.Errorf("tension score = %d, want 0-100", analysis.TensionScore)
+	}
+	if analysis.Summary == "" {
+		t.Errorf("summary is empty")
+	}
+	var emotionalState map[string]interface{}
+	if err := json.Unmarshal(analysis.EmotionalState, &emotionalState); err != nil || len(emotionalState) == 0 {
+		t.Errorf("emotional_state = %s, want a JSON object", analysis.EmotionalState)
+	}
+
+	// A second run returns the stored analysis instead of analyzing again
+	again, err := env.analysis.AnalyzeSession(ctx, userID, session.ID)
+	if err != nil {
+		t.Fatalf("AnalyzeSession (second run): %v", err)
+	}
+	if again.ID != analysis.ID {
+		t.Errorf("second run returned analysis %s, want %s", again.ID, analysis.ID)
+	}
+
+	scores, err := env.analysis.GetTensionScores(ctx, userID, 7)
+	if err != nil {
+		t.Fatalf("GetTensionScores: %v", err)
+	}
+	if len(scores.Scores) != 1 || scores.Scores[0].TensionScore != analysis.TensionScore {
+		t.Errorf("tension scores = %+v, want the analyzed session's score %d", scores.Scores, analysis.TensionScore)
+	}
+	// One score is too few to fit a trend
+	if scores.Statistics.Trend != "stable" || scores.Statistics.Regression != nil {
+		t.Errorf("trend = %q, regression %+v, want stable without a fit", scores.Statistics.Trend, scores.Statistics.Regression)
+	}
+}
+
+// flakyEmotionProvider fails every emotion analysis call, alternately as unavailable and with malformed
+// output, and passes other calls to the fake provider
+type flakyEmotionProvider struct {
+	ai.Provider
+	emotionCalls int
+}
+
+func (p *flakyEmotionProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	if config == nil || config.ResponseSchema == nil || config.ResponseSchema.Properties["primary_emotion"] == nil {
+		return p.Provider.GenerateContent(ctx, model, contents, config)
+	}
+
+	p.emotionCalls++
+	if p.emotionCalls%2 == 1 {
+		return nil, genai.APIError{Code: http.StatusServiceUnavailable, Message: "unavailable"}
+	}
+	return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content: &genai.Content{Parts: []*genai.Part{{Text: `{"primary_emotion": `}}, Role: "model"},
+	}}}, nil
+}
+
+func TestAnalyzeSessionCapsGeminiCallsPerStep(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+	env.send(t, userID, session.ID, "今日は少し疲れた")
+
+	// Each structured call succeeds on its retry with malformed output, so every layer repeats:
+	// without a cap the step would make 2 attempts × 2 prompts × 2 calls
+	provider := &flakyEmotionProvider{Provider: ai.NewFakeProvider()}
+	client := ai.NewClientWithProvider(provider, ai.FakeProviderModel, ai.Options{
+		MaxRetries:       2,
+		RetryBaseDelay:   time.Nanosecond,
+		RetryMaxDelay:    time.Nanosecond,
+		BreakerThreshold: 100,
+	}, logging.Discard())
+	taxonomy, err := ai.LookupEmotionTaxonomy("")
+	if err != nil {
+		t.Fatalf("LookupEmotionTaxonomy: %v", err)
+	}
+	analysis := NewAnalysisService(env.tx, env.analyses, env.sessions, env.messages, env.users, client, taxonomy, logging.Discard())
+
+	if _, err := analysis.AnalyzeSession(ctx, userID, session.ID); !errors.Is(err, apperror.ErrAIInvalidOutput) {
+		t.Fatalf("AnalyzeSession error = %v, want invalid AI output", err)
+	}
+	if provider.emotionCalls != analysisStepCalls {
+		t.Errorf("emotion analysis calls = %d, want the cap of %d", provider.emotionCalls, analysisStepCalls)
+	}
+}
+
+func TestGetUserAnalysesSortsAndFilters(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	for date, score := range map[string]int{"2024-03-10": 30, "2024-03-11": 80, "2024-03-12": 55} {
+		session, err := env.chat.CreateSessionForDate(ctx, userID, date)
+		if err != nil {
+			t.Fatalf("CreateSessionForDate: %v", err)
+		}
+		_, err = env.analyses.CreateAnalysis(ctx, &types.Analysis{
+			SessionID:          session.ID,
+			Summary:            "要約",
+			EmotionalState:     json.RawMessage(`{"primary_emotion": "joy"}`),
+			BehavioralInsights: json.RawMessage(`{}`),
+			TensionScore:       score,
+			Keywords:           json.RawMessage(`["仕事"]`),
+		})
+		if err != nil {
+			t.Fatalf("CreateAnalysis: %v", err)
+		}
+	}
+
+	first, err := env.analysis.GetUserAnalyses(ctx, userID, types.ListQuery{Sort: types.SortTensionDesc, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetUserAnalyses: %v", err)
+	}
+	if len(first.Analyses) != 2 || first.Analyses[0].SessionDate != "2024-03-11" || first.Analyses[1].TensionScore != 55 || !first.Pagination.HasMore {
+		t.Fatalf("first page = %+v", first)
+	}
+	second, err := env.analysis.GetUserAnalyses(ctx, userID, types.ListQuery{Sort: types.SortTensionDesc, Cursor: *first.Pagination.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetUserAnalyses (second page): %v", err)
+	}
+	if len(second.Analyses) != 1 || second.Analyses[0].TensionScore != 30 || second.Pagination.HasMore {
+		t.Errorf("second page = %+v, want the lowest score only", second)
+	}
+
+	maxTension, keyword := 60, "仕事"
+	filtered, err := env.analysis.GetUserAnalyses(ctx, userID, types.ListQuery{
+		SessionFilter: types.SessionFilter{MaxTension: &maxTension, Keyword: &keyword},
+		Limit:         10,
+		IncludeTotal:  true,
+	})
+	if err != nil {
+		t.Fatalf("GetUserAnalyses (filtered): %v", err)
+	}
+	if len(filtered.Analyses) != 2 || filtered.Analyses[0].SessionDate != "2024-03-12" || *filtered.Pagination.Total != 2 {
+		t.Errorf("analyses with tension <= 60 = %+v, want 03-12 and 03-10", filtered)
+	}
+
+	tooHigh := 101
+	if _, err := env.analysis.GetUserAnalyses(ctx, userID, types.ListQuery{SessionFilter: types.SessionFilter{MinTension: &tooHigh}, Limit: 10}); !errors.Is(err, apperror.ErrInvalidFilter) {
+		t.Errorf("GetUserAnalyses error = %v, want invalid filter", err)
+	}
+}
+
+func TestAnalyzeSessionRejectsOtherUsersSession(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.startSession(t, env.createUser(t, "alice"))
+	otherID := env.createUser(t, "bob")
+
+	_, err := env.analysis.AnalyzeSession(context.Background(), otherID, session.ID)
+	if !errors.Is(err, apperror.ErrSessionNotFound) {
+		t.Errorf("AnalyzeSession error = %v, want access denied", err)
+	}
+}
+
+func TestAnalyzeSessionWithoutMessages(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+
+	session, err := env.chat.CreateSessionForDate(ctx, userID, "2024-01-15")
+	if err != nil {
+		t.Fatalf("CreateSessionForDate: %v", err)
+	}
+
+	_, err = env.analysis.AnalyzeSession(ctx, userID, session.ID)
+	if !errors.Is(err, apperror.ErrNoMessages) {
+		t.Errorf("AnalyzeSession error = %v, want no messages found", err)
+	}
+}
+
+func TestBatchAnalyzeActiveSessions(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	aliceID := env.createUser(t, "alice")
+	busy := env.startSession(t, aliceID)
+	env.send(t, aliceID, busy.ID, "散歩して気分が晴れた", "夕飯もおいしかった")
+
+	bobID := env.createUser(t, "bob")
+	quiet := env.startSession(t, bobID)
+
+	if err := env.analysis.BatchAnalyzeActiveSessions(ctx, 3); err != nil {
+		t.Fatalf("BatchAnalyzeActiveSessions: %v", err)
+	}
+
+	if analysis, err := env.analyses.GetAnalysisBySessionID(ctx, busy.ID); err != nil || analysis == nil {
+		t.Errorf("session with enough messages was not analyzed: %v", err)
+	}
+	if session, err := env.sessions.GetSessionByID(ctx, busy.ID); err != nil || session.Status != types.SessionStatusCompleted {
+		t.Errorf("analyzed session was not completed: %+v, %v", session, err)
+	}
+
+	if analysis, err := env.analyses.GetAnalysisBySessionID(ctx, quiet.ID); err != nil || analysis != nil {
+		t.Errorf("session below the message threshold was analyzed: %+v, %v", analysis, err)
+	}
+	if session, err := env.sessions.GetSessionByID(ctx, quiet.ID); err != nil || session.Status != types.SessionStatusActive {
+		t.Errorf("session below the message threshold changed: %+v, %v", session, err)
+	}
+}
+
+func TestBatchAnalyzeRollsBackAnalysisWhenSessionIsNotCompleted(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+	env.send(t, userID, session.ID, "散歩して気分が晴れた", "夕飯もおいしかった")
+	env.tx.wrap = func(tx repository.Repos) repository.Repos {
+		tx.Sessions = failingSessions{tx.Sessions}
+		return tx
+	}
+
+	if err := env.analysis.BatchAnalyzeActiveSessions(ctx, 3); err == nil {
+		t.Fatalf("BatchAnalyzeActiveSessions succeeded although the session could not be completed")
+	}
+	if analysis, err := env.analyses.GetAnalysisBySessionID(ctx, session.ID); err != nil || analysis != nil {
+		t.Errorf("analysis of a session that stayed active was kept: %+v, %v", analysis, err)
+	}
+	if stored, err := env.sessions.GetSessionByID(ctx, session.ID); err != nil || stored.Status != types.SessionStatusActive {
+		t.Errorf("session = %+v, %v, want it still active", stored, err)
+	}
+}
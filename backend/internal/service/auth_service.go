@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+const (
+	// loginFreeAttempts consecutive failed logins are allowed before each further failure delays the next attempt
+	loginFreeAttempts = 3
+	// loginBaseDelay is the delay after the first failure past the free attempts; it doubles with each failure
+	loginBaseDelay = time.Second
+	// unknownUserWindow is how long failed logins with a username that has no account count towards
+	// its delays and lockout, in place of an account's failures since its last login
+	unknownUserWindow = 24 * time.Hour
+)
+
+// LoginPolicy sets how failed logins are throttled
+type LoginPolicy struct {
+	// LockoutThreshold consecutive failures lock the account for LockoutDuration; 0 disables lockout
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// IPMaxFailures failed logins from one IP address within IPWindow refuse its logins; 0 disables the limit
+	IPMaxFailures int
+	IPWindow      time.Duration
+	// PasswordResetTTL is how long a password reset link stays valid
+	PasswordResetTTL time.Duration
+}
+
+// ClientInfo identifies where a request came from, for the security event log
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// LoginResult is a login whose password was right; when MFARequired is set the login is completed
+// by CompleteMFALogin with a TOTP or recovery code and MFAChallenge
+type LoginResult struct {
+	User         *types.User
+	MFARequired  bool
+	MFAChallenge string
+}
+
+// AuthService handles logins with failed-attempt throttling, lockout and two-factor authentication,
+// and the security event log
+type AuthService struct {
+	userRepo     repository.UserStore
+	securityRepo repository.SecurityStore
+	mfaRepo      repository.MFAStore
+	resetRepo    repository.PasswordResetStore
+	policy       LoginPolicy
+	logger       *slog.Logger
+	now          func() time.Time
+
+	// mailer sends password reset links to appURL; without it resets are unavailable
+	mailer notify.Notifier
+	appURL string
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(
+	userRepo repository.UserStore,
+	securityRepo repository.SecurityStore,
+	mfaRepo repository.MFAStore,
+	resetRepo repository.PasswordResetStore,
+	policy LoginPolicy,
+	logger *slog.Logger,
+) *AuthService {
+	return &AuthService{
+		userRepo:     userRepo,
+		securityRepo: securityRepo,
+		mfaRepo:      mfaRepo,
+		resetRepo:    resetRepo,
+		policy:       policy,
+		logger:       logger,
+		now:          timeutil.NowJST,
+	}
+}
+
+// SetMailer sets the email notifier that sends password reset links to the app at appURL
+func (s *AuthService) SetMailer(mailer notify.Notifier, appURL string) {
+	s.mailer = mailer
+	s.appURL = appURL
+}
+
+// Login checks a user's password. Failed logins delay the next attempt progressively and lock the
+// account after LockoutThreshold failures; too many failures from one IP address refuse its logins.
+// For users with two-factor authentication the login is not complete until CompleteMFALogin.
+func (s *AuthService) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error) {
+	now := s.now()
+
+	user, err := s.userRepo.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, apperror.ErrUserNotFound) {
+		return nil, err
+	}
+
+	state, err := s.admitLogin(ctx, user, username, client, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown usernames are checked against a dummy password too, so that they fail as slowly as a
+	// wrong password; one registered since the lookup above fails as well
+	_, err = s.userRepo.ValidatePassword(ctx, username, password)
+	if err == nil && user == nil {
+		err = apperror.ErrInvalidCredentials
+	}
+	if err != nil {
+		if !errors.Is(err, apperror.ErrInvalidCredentials) {
+			return nil, err
+		}
+		if user == nil {
+			s.recordFailure(ctx, nil, username, types.LoginFailureUnknownUser, client)
+			_, failure := s.refusal(state.FailedLoginCount+1, apperror.ErrInvalidCredentials)
+			return nil, failure
+		}
+		return nil, s.countFailedLogin(ctx, user, types.LoginFailureInvalidPassword, client, now)
+	}
+
+	mfa, err := s.mfaRepo.GetMFAState(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		challenge, err := s.startMFAChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, MFARequired: true, MFAChallenge: challenge}, nil
+	}
+
+	if err := s.completeLogin(ctx, user, state, nil, client); err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user}, nil
+}
+
+// CompleteMFALogin completes the login of a user whose password was right with a TOTP or recovery
+// code. Wrong codes count as failed logins. The challenge from Login works until a login with it
+// succeeds, the password changes or the user starts another login.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, userID, challenge, code string, client ClientInfo) (*types.User, error) {
+	now := s.now()
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, apperror.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := s.checkMFAChallenge(ctx, user.ID, challenge); err != nil {
+		return nil, err
+	}
+
+	state, err := s.admitLogin(ctx, user, user.Username, client, now)
+	if err != nil {
+		return nil, err
+	}
+
+	usedRecoveryCode, err := s.checkSecondFactor(ctx, user.ID, code, now)
+	if err != nil {
+		if errors.Is(err, apperror.ErrInvalidMFACode) {
+			return nil, s.countFailedLogin(ctx, user, types.LoginFailureInvalidMFACode, client, now)
+		}
+		return nil, err
+	}
+
+	// Only one of concurrent requests with the same challenge gets through
+	finished, err := s.mfaRepo.FinishMFAChallenge(ctx, user.ID, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !finished {
+		return nil, apperror.ErrUnauthorized
+	}
+
+	var method *string
+	if usedRecoveryCode {
+		recoveryCode := types.LoginMethodRecoveryCode
+		method = &recoveryCode
+	}
+	if err := s.completeLogin(ctx, user, state, method, client); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// admitLogin refuses logins from throttled IP addresses and for locked accounts, and returns the
+// login state of user otherwise. Unknown usernames (a nil user) are throttled and locked like
+// accounts, with the same errors, so that the responses do not tell which usernames exist.
+func (s *AuthService) admitLogin(ctx context.Context, user *types.User, username string, client ClientInfo, now time.Time) (*types.LoginState, error) {
+	if s.policy.IPMaxFailures > 0 && client.IPAddress != "" {
+		failures, oldest, err := s.securityRepo.CountFailedLoginsByIP(ctx, client.IPAddress, now.Add(-s.policy.IPWindow))
+		if err != nil {
+			return nil, err
+		}
+		if failures >= s.policy.IPMaxFailures {
+			s.recordFailure(ctx, user, username, types.LoginFailureIPThrottled, client)
+			return nil, apperror.ErrLoginThrottled.WithRetryAfter(oldest.Add(s.policy.IPWindow).Sub(now))
+		}
+	}
+
+	var state *types.LoginState
+	var err error
+	if user == nil {
+		state, err = s.unknownUserState(ctx, username, now)
+	} else {
+		state, err = s.securityRepo.GetLoginState(ctx, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.LockedUntil != nil && state.LockedUntil.After(now) {
+		s.recordFailure(ctx, user, username, types.LoginFailureLocked, client)
+		return nil, apperror.ErrLoginThrottled.WithRetryAfter(state.LockedUntil.Sub(now))
+	}
+
+	return state, nil
+}
+
+// unknownUserState stands in for the login state of a username that has no account, from its
+// failed logins within unknownUserWindow
+func (s *AuthService) unknownUserState(ctx context.Context, username string, now time.Time) (*types.LoginState, error) {
+	failures, latest, err := s.securityRepo.CountUnknownUserLogins(ctx, username, now.Add(-unknownUserWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &types.LoginState{FailedLoginCount: failures}
+	if lockFor, _ := s.refusal(failures, apperror.ErrInvalidCredentials); latest != nil && lockFor > 0 {
+		lockedUntil := latest.Add(lockFor)
+		state.LockedUntil = &lockedUntil
+	}
+	return state, nil
+}
+
+// completeLogin clears the failed logins of user and records the login; method is the reason
+// recorded with it, if any
+func (s *AuthService) completeLogin(ctx context.Context, user *types.User, state *types.LoginState, method *string, client ClientInfo) error {
+	if state.FailedLoginCount > 0 || state.LockedUntil != nil {
+		if err := s.securityRepo.ResetFailedLogins(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.userRepo.UpdateLastLogin(ctx, user.ID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to update last login", logging.Err(err))
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventLoginSucceeded, Reason: method}, user.Username, client)
+
+	return nil
+}
+
+// countFailedLogin records a wrong password or code for user and delays or locks out the next attempt
+func (s *AuthService) countFailedLogin(ctx context.Context, user *types.User, reason string, client ClientInfo, now time.Time) error {
+	failures, err := s.securityRepo.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	s.recordFailure(ctx, user, user.Username, reason, client)
+
+	invalid := apperror.ErrInvalidCredentials
+	if reason == types.LoginFailureInvalidMFACode {
+		invalid = apperror.ErrInvalidMFACode
+	}
+	lockFor, failure := s.refusal(failures, invalid)
+	if lockFor > 0 {
+		if err := s.securityRepo.LockUser(ctx, user.ID, now.Add(lockFor)); err != nil {
+			return err
+		}
+	}
+	if s.locksOut(failures) {
+		s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventAccountLocked}, user.Username, client)
+		s.logger.WarnContext(ctx, "Account locked after failed logins", slog.String("user_id", user.ID), slog.Int("failures", failures))
+	}
+	return failure
+}
+
+// refusal returns how long logins are refused after a number of consecutive failures, and the
+// error for the last of them: invalid with any delay, or the throttled error once the account is
+// locked. A lockout has no error of its own, which would confirm that the account exists.
+func (s *AuthService) refusal(failures int, invalid *apperror.Error) (time.Duration, error) {
+	if s.locksOut(failures) {
+		return s.policy.LockoutDuration, apperror.ErrLoginThrottled.WithRetryAfter(s.policy.LockoutDuration)
+	}
+	if delay := s.loginDelay(failures); delay > 0 {
+		return delay, invalid.WithRetryAfter(delay)
+	}
+	return 0, invalid
+}
+
+// UnlockUser lifts a user's lockout and clears their failed logins
+func (s *AuthService) UnlockUser(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.securityRepo.ResetFailedLogins(ctx, user.ID); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventAccountUnlocked}, user.Username, ClientInfo{})
+
+	return nil
+}
+
+// GetSecurityEvents returns a user's most recent logins, failed logins and lockouts
+func (s *AuthService) GetSecurityEvents(ctx context.Context, userID string, limit int) (*types.SecurityEventsResponse, error) {
+	events, err := s.securityRepo.GetSecurityEvents(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.SecurityEventsResponse{Events: events}, nil
+}
+
+// recordFailure records a failed login; user is nil for unknown usernames
+func (s *AuthService) recordFailure(ctx context.Context, user *types.User, username, reason string, client ClientInfo) {
+	event := &types.SecurityEvent{EventType: types.SecurityEventLoginFailed, Reason: &reason}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	s.recordEvent(ctx, event, username, client)
+}
+
+// recordEvent stores a security event from client. Failures are logged so that the log never
+// breaks a login; the failed login count is kept separately.
+func (s *AuthService) recordEvent(ctx context.Context, event *types.SecurityEvent, username string, client ClientInfo) {
+	event.Username = &username
+	if client.IPAddress != "" {
+		event.IPAddress = &client.IPAddress
+	}
+	if client.UserAgent != "" {
+		event.UserAgent = &client.UserAgent
+	}
+
+	if err := s.securityRepo.CreateSecurityEvent(ctx, event); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record security event", slog.String("event_type", event.EventType), logging.Err(err))
+	}
+}
+
+// locksOut reports whether a number of consecutive failures locks the account
+func (s *AuthService) locksOut(failures int) bool {
+	return s.policy.LockoutThreshold > 0 && failures >= s.policy.LockoutThreshold
+}
+
+// loginDelay is how long the next login is refused after a number of consecutive failures
+func (s *AuthService) loginDelay(failures int) time.Duration {
+	if failures <= loginFreeAttempts {
+		return 0
+	}
+	delay := loginBaseDelay << min(failures-loginFreeAttempts-1, 20)
+	if s.policy.LockoutDuration > 0 && delay > s.policy.LockoutDuration {
+		return s.policy.LockoutDuration
+	}
+	return delay
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/repository/memory"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// authTestEnv wires the auth service to in-memory repositories on a clock the test advances
+type authTestEnv struct {
+	auth   *AuthService
+	users  *memory.UserRepository
+	mailer *fakeMailer
+	alice  *types.User
+	now    time.Time
+}
+
+func newAuthTestEnv(t *testing.T, policy LoginPolicy) *authTestEnv {
+	t.Helper()
+
+	store := memory.NewStore()
+	env := &authTestEnv{
+		users:  memory.NewUserRepository(store),
+		mailer: &fakeMailer{},
+		now:    time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC),
+	}
+	store.Now = func() time.Time { return env.now }
+	env.auth = NewAuthService(env.users, memory.NewSecurityRepository(store), memory.NewMFARepository(store), memory.NewPasswordResetRepository(store), policy, logging.Discard())
+	env.auth.now = store.Now
+	env.auth.SetMailer(env.mailer, "https://kasaneha.example.com/")
+
+	email := "alice@example.com"
+
+	alice, err := env.users.CreateUser(context.Background(), &types.RegisterRequest{Username: "alice", Password: "password", Email: &email})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	env.alice = alice
+	return env
+}
+
+// login logs alice in from client
+func (e *authTestEnv) login(password string, client ClientInfo) (*types.User, error) {
+	result, err := e.auth.Login(context.Background(), "alice", password, client)
+	if err != nil {
+		return nil, err
+	}
+	return result.User, nil
+}
+
+// wantLoginError checks that a login failed with want and the given Retry-After
+func wantLoginError(t *testing.T, err error, want *apperror.Error, retryAfter time.Duration) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Fatalf("Login error = %v, want %s", err, want.Code)
+	}
+	if appErr, _ := apperror.As(err); appErr.RetryAfter != retryAfter {
+		t.Errorf("%s RetryAfter = %v, want %v", want.Code, appErr.RetryAfter, retryAfter)
+	}
+}
+
+var testClient = ClientInfo{IPAddress: "192.0.2.1", UserAgent: "test-agent"}
+
+func TestLoginDelaysAndLocksOutFailedLogins(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 5, LockoutDuration: 15 * time.Minute})
+
+	// The first failures are not delayed
+	for i := 0; i < loginFreeAttempts; i++ {
+		_, err := env.login("wrong", testClient)
+		wantLoginError(t, err, apperror.ErrInvalidCredentials, 0)
+	}
+
+	// Further failures delay the next attempt, doubling each time
+	_, err := env.login("wrong", testClient)
+	wantLoginError(t, err, apperror.ErrInvalidCredentials, time.Second)
+	_, err = env.login("password", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, time.Second)
+
+	env.now = env.now.Add(time.Second)
+	_, err = env.login("wrong", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, 15*time.Minute)
+
+	// Even the right password is refused while the account is locked
+	env.now = env.now.Add(10 * time.Minute)
+	_, err = env.login("password", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, 5*time.Minute)
+
+	env.now = env.now.Add(5 * time.Minute)
+	if _, err := env.login("password", testClient); err != nil {
+		t.Fatalf("Login after the lockout: %v", err)
+	}
+
+	// A successful login starts the count over
+	_, err = env.login("wrong", testClient)
+	wantLoginError(t, err, apperror.ErrInvalidCredentials, 0)
+}
+
+func TestLoginTreatsUnknownUsernamesLikeAccounts(t *testing.T) {
+	type response struct {
+		code       string
+		retryAfter time.Duration
+	}
+	// responses runs the same failed logins against username and returns the errors
+	responses := func(username string) []response {
+		env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 5, LockoutDuration: 15 * time.Minute})
+		var got []response
+		for _, wait := range []time.Duration{0, 0, 0, 0, 0, time.Second, 10 * time.Minute, 5 * time.Minute, 15 * time.Minute} {
+			env.now = env.now.Add(wait)
+			_, err := env.auth.Login(context.Background(), username, "wrong", testClient)
+			appErr, ok := apperror.As(err)
+			if !ok {
+				t.Fatalf("Login as %s error = %v, want an app error", username, err)
+			}
+			got = append(got, response{appErr.Code, appErr.RetryAfter})
+		}
+		return got
+	}
+
+	account, unknown := responses("alice"), responses("bob")
+	for i := range account {
+		if account[i] != unknown[i] {
+			t.Errorf("login %d: account got %+v, unknown username got %+v", i, account[i], unknown[i])
+		}
+	}
+	if last := account[len(account)-1]; last.code != apperror.ErrLoginThrottled.Code {
+		t.Errorf("last login got %+v, want a lockout", last)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 1, LockoutDuration: time.Hour})
+	ctx := context.Background()
+
+	_, err := env.login("wrong", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, time.Hour)
+
+	user, err := env.users.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if err := env.auth.UnlockUser(ctx, user.ID); err != nil {
+		t.Fatalf("UnlockUser: %v", err)
+	}
+	if _, err := env.login("password", testClient); err != nil {
+		t.Errorf("Login after unlocking: %v", err)
+	}
+
+	if err := env.auth.UnlockUser(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, apperror.ErrUserNotFound) {
+		t.Errorf("UnlockUser of an unknown user error = %v, want user not found", err)
+	}
+}
+
+func TestLoginThrottlesFailuresFromOneIP(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{IPMaxFailures: 3, IPWindow: 10 * time.Minute})
+	ctx := context.Background()
+
+	// Failures for unknown usernames count against the IP too
+	for _, username := range []string{"bob", "carol", "dave"} {
+		_, err := env.auth.Login(ctx, username, "password", testClient)
+		wantLoginError(t, err, apperror.ErrInvalidCredentials, 0)
+		env.now = env.now.Add(time.Minute)
+	}
+
+	_, err := env.login("password", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, 7*time.Minute)
+
+	if _, err := env.login("password", ClientInfo{IPAddress: "192.0.2.2"}); err != nil {
+		t.Errorf("Login from another IP: %v", err)
+	}
+
+	// The window slides past the oldest failure
+	env.now = env.now.Add(8 * time.Minute)
+	if _, err := env.login("password", testClient); err != nil {
+		t.Errorf("Login after the window: %v", err)
+	}
+}
+
+func TestGetSecurityEvents(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 2, LockoutDuration: time.Minute})
+	ctx := context.Background()
+
+	env.login("wrong", testClient)
+	env.now = env.now.Add(time.Second)
+	env.login("wrong", testClient)
+	env.now = env.now.Add(time.Minute)
+	user, err := env.login("password", ClientInfo{IPAddress: "192.0.2.2", UserAgent: "phone"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	env.auth.Login(ctx, "mallory", "password", testClient)
+
+	response, err := env.auth.GetSecurityEvents(ctx, user.ID, 10)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+
+	want := []struct {
+		eventType string
+		reason    string
+		ipAddress string
+	}{
+		{types.SecurityEventLoginSucceeded, "", "192.0.2.2"},
+		{types.SecurityEventAccountLocked, "", "192.0.2.1"},
+		{types.SecurityEventLoginFailed, types.LoginFailureInvalidPassword, "192.0.2.1"},
+		{types.SecurityEventLoginFailed, types.LoginFailureInvalidPassword, "192.0.2.1"},
+	}
+	if len(response.Events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(response.Events), len(want), response.Events)
+	}
+	for i, event := range response.Events {
+		reason := ""
+		if event.Reason != nil {
+			reason = *event.Reason
+		}
+		if event.EventType != want[i].eventType || reason != want[i].reason || event.IPAddress == nil || *event.IPAddress != want[i].ipAddress {
+			t.Errorf("event %d = %s %q from %v, want %s %q from %s", i, event.EventType, reason, event.IPAddress, want[i].eventType, want[i].reason, want[i].ipAddress)
+		}
+	}
+	if agent := response.Events[0].UserAgent; agent == nil || *agent != "phone" {
+		t.Errorf("user agent = %v, want phone", agent)
+	}
+
+	if response, err := env.auth.GetSecurityEvents(ctx, user.ID, 1); err != nil || len(response.Events) != 1 {
+		t.Errorf("GetSecurityEvents with limit 1 = %+v, %v, want 1 event", response, err)
+	}
+}
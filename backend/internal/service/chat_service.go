@@ -2,36 +2,66 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/annotator"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
 	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/tracing"
 	"github.com/trasta298/kasaneha/backend/internal/types"
 	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ChatService handles chat-related business logic
 type ChatService struct {
-	sessionRepo     *repository.SessionRepository
-	messageRepo     *repository.MessageRepository
-	userRepo        *repository.UserRepository
+	txManager       repository.TxManager
+	sessionRepo     repository.SessionStore
+	messageRepo     repository.MessageStore
+	userRepo        repository.UserStore
 	aiClient        *ai.Client
+	annotator       annotator.Annotator
 	analysisService *AnalysisService
+	alertService    *AlertService
+	webhookService  *WebhookService
+	usageService    *UsageService
+	logger          *slog.Logger
 }
 
+// annotationTimeout bounds the background annotation of a single message
+const annotationTimeout = 30 * time.Second
+
+// Messages used when Gemini is unavailable
+const (
+	fallbackFirstMessage = "こんにちは！今日はどんな一日でしたか？よかったら、気になったことをひとつ聞かせてください😊"
+	fallbackReply        = "ごめんなさい、今うまくお返事できませんでした。少し時間をおいて、もう一度試してみてください🙏"
+)
+
 // NewChatService creates a new chat service
 func NewChatService(
-	sessionRepo *repository.SessionRepository,
-	messageRepo *repository.MessageRepository,
-	userRepo *repository.UserRepository,
+	txManager repository.TxManager,
+	sessionRepo repository.SessionStore,
+	messageRepo repository.MessageStore,
+	userRepo repository.UserStore,
 	aiClient *ai.Client,
+	messageAnnotator annotator.Annotator,
+	logger *slog.Logger,
 ) *ChatService {
 	return &ChatService{
+		txManager:       txManager,
 		sessionRepo:     sessionRepo,
 		messageRepo:     messageRepo,
 		userRepo:        userRepo,
 		aiClient:        aiClient,
+		annotator:       messageAnnotator,
 		analysisService: nil, // Will be set after initialization
+		logger:          logger,
 	}
 }
 
@@ -40,8 +70,26 @@ func (s *ChatService) SetAnalysisService(analysisService *AnalysisService) {
 	s.analysisService = analysisService
 }
 
+// SetUsageService sets the usage service whose quotas shorten replies once exceeded
+func (s *ChatService) SetUsageService(usageService *UsageService) {
+	s.usageService = usageService
+}
+
+// SetAlertService sets the alert service used to acknowledge recent mood alerts in the first message
+func (s *ChatService) SetAlertService(alertService *AlertService) {
+	s.alertService = alertService
+}
+
+// SetWebhookService sets the webhook service notified of session events
+func (s *ChatService) SetWebhookService(webhookService *WebhookService) {
+	s.webhookService = webhookService
+}
+
 // GetTodaySession retrieves or creates today's session for a user
 func (s *ChatService) GetTodaySession(ctx context.Context, userID string) (*types.ChatSession, *types.Message, error) {
+	ctx, span := tracing.Start(ctx, "ChatService.GetTodaySession")
+	defer span.End()
+
 	// Check if today's session already exists
 	session, err := s.sessionRepo.GetTodaySession(ctx, userID)
 	if err != nil {
@@ -53,14 +101,8 @@ func (s *ChatService) GetTodaySession(ctx context.Context, userID string) (*type
 		return session, nil, nil
 	}
 
-	// No session exists, create a new one
+	// No session exists: generate the greeting first, so that the session and its greeting are created together
 	today := timeutil.TodayJST()
-	session, err = s.sessionRepo.CreateSession(ctx, userID, today)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create session: %w", err)
-	}
-
-	// Generate initial AI message
 	user, err := s.userRepo.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get user: %w", err)
@@ -69,36 +111,89 @@ func (s *ChatService) GetTodaySession(ctx context.Context, userID string) (*type
 	// Determine time of day
 	timeOfDay := s.getTimeOfDay()
 
-	// Generate first message from AI
-	aiResponse, err := s.aiClient.GenerateFirstMessage(ctx, user.Username, today, timeOfDay)
+	// Gently acknowledge a recent mood alert, if any; the greeting must not fail because of it
+	var acknowledgement *ChatAcknowledgement
+	var hint string
+	if s.alertService != nil {
+		acknowledgement, err = s.alertService.GetChatAcknowledgement(ctx, userID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to get alert acknowledgement", logging.Err(err))
+		}
+		if acknowledgement != nil {
+			hint = acknowledgement.Hint
+		}
+	}
+
+	// Generate first message from AI; the session must open even if Gemini is unavailable.
+	// The session does not exist yet, so the usage is attributed to the user only.
+	content := fallbackFirstMessage
+	var metadata map[string]interface{}
+	aiResponse, err := s.aiClient.GenerateFirstMessage(ai.WithUsageScope(ctx, userID, ""), user.Username, today, timeOfDay, hint)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate first message: %w", err)
+		s.logger.WarnContext(ctx, "Failed to generate first message, using the fallback greeting", logging.Err(err))
+		metadata = map[string]interface{}{types.MessageMetadataFallback: true}
+	} else {
+		content = aiResponse.Content
 	}
 
-	// Save the initial AI message
-	initialMessage, err := s.messageRepo.CreateMessage(
-		ctx,
-		session.ID,
-		types.SenderAI,
-		aiResponse.Content,
-		nil,
-	)
+	// Create the session with its initial AI message
+	var initialMessage *types.Message
+	err = s.txManager.WithTx(ctx, func(tx repository.Repos) error {
+		session, err = tx.Sessions.CreateSession(ctx, userID, today)
+		if err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+
+		initialMessage, err = tx.Messages.CreateMessage(
+			ctx,
+			session.ID,
+			types.SenderAI,
+			content,
+			metadata,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save initial message: %w", err)
+		}
+
+		// The alert is used up only if this greeting is saved
+		if acknowledgement != nil {
+			if err := tx.Alerts.MarkAcknowledgedInChat(ctx, acknowledgement.NotificationID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, apperror.ErrSessionExists) {
+		// A concurrent first load created the session while the greeting was generated
+		session, err = s.sessionRepo.GetTodaySession(ctx, userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get today's session: %w", err)
+		}
+		if session == nil {
+			return nil, nil, apperror.ErrSessionExists
+		}
+		return session, nil, nil
+	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to save initial message: %w", err)
+		return nil, nil, err
 	}
+	s.emitWebhook(ctx, userID, types.WebhookEventSessionCreated, session)
 
 	return session, initialMessage, nil
 }
 
 // SendMessage sends a user message and generates AI response
 func (s *ChatService) SendMessage(ctx context.Context, userID, sessionID, content string) (*types.SendMessageResponse, error) {
+	ctx, span := tracing.Start(ctx, "ChatService.SendMessage", trace.WithAttributes(tracing.SessionIDKey.String(sessionID)))
+	defer span.End()
+
 	// Verify session ownership
 	isOwner, err := s.sessionRepo.CheckSessionOwnership(ctx, sessionID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return nil, fmt.Errorf("session not found or access denied")
+		return nil, apperror.ErrSessionNotFound
 	}
 
 	// Get session to check status
@@ -108,7 +203,7 @@ func (s *ChatService) SendMessage(ctx context.Context, userID, sessionID, conten
 	}
 
 	if session.Status != types.SessionStatusActive {
-		return nil, fmt.Errorf("session is not active")
+		return nil, apperror.ErrSessionInactive
 	}
 
 	// Save user message
@@ -123,8 +218,110 @@ func (s *ChatService) SendMessage(ctx context.Context, userID, sessionID, conten
 		return nil, fmt.Errorf("failed to save user message: %w", err)
 	}
 
+	// Annotate the message in the background so that it does not delay the reply
+	s.annotateMessageAsync(ctx, userMessage.ID, content)
+
+	aiResponse, err := s.generateReply(ctx, userID, session, userMessage)
+	if err != nil {
+		// The user message is already saved: mark it so that the client can retry the reply,
+		// and answer with a fallback instead of failing the request
+		s.logger.WarnContext(ctx, "Failed to generate AI response, replying with the fallback", logging.Err(err))
+		return s.fallbackResponse(ctx, userMessage), nil
+	}
+
+	// Save AI response
+	aiMessage, err := s.messageRepo.CreateMessage(
+		ctx,
+		sessionID,
+		types.SenderAI,
+		aiResponse.Content,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save AI message: %w", err)
+	}
+
+	return &types.SendMessageResponse{
+		UserMessage: *userMessage,
+		AIResponse:  *aiMessage,
+	}, nil
+}
+
+// RetryReply generates the AI reply to a user message whose reply failed.
+// Only the latest message of an active session can be retried.
+func (s *ChatService) RetryReply(ctx context.Context, userID, sessionID, messageID string) (*types.SendMessageResponse, error) {
+	ctx, span := tracing.Start(ctx, "ChatService.RetryReply", trace.WithAttributes(tracing.SessionIDKey.String(sessionID)))
+	defer span.End()
+
+	// Verify session ownership
+	isOwner, err := s.sessionRepo.CheckSessionOwnership(ctx, sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session ownership: %w", err)
+	}
+	if !isOwner {
+		return nil, apperror.ErrSessionNotFound
+	}
+
+	session, err := s.sessionRepo.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session.Status != types.SessionStatusActive {
+		return nil, apperror.ErrSessionInactive
+	}
+
+	latest, err := s.messageRepo.GetLatestMessages(ctx, sessionID, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest message: %w", err)
+	}
+	if len(latest) == 0 || latest[0].ID != messageID || latest[0].Sender != types.SenderUser {
+		return nil, apperror.ErrMessageNotRetryable
+	}
+	userMessage := &latest[0]
+
+	// Clearing the mark claims the retry, so that concurrent retries do not reply twice
+	claimed, err := s.messageRepo.ClearMessageMetadataKey(ctx, messageID, types.MessageMetadataReplyFailed)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, apperror.ErrMessageNotRetryable
+	}
+
+	aiResponse, err := s.generateReply(ctx, userID, session, userMessage)
+	if err != nil {
+		s.markReplyFailed(ctx, messageID)
+		return nil, classifyAIError(err)
+	}
+
+	aiMessage, err := s.messageRepo.CreateMessage(
+		ctx,
+		sessionID,
+		types.SenderAI,
+		aiResponse.Content,
+		nil,
+	)
+	if err != nil {
+		s.markReplyFailed(ctx, messageID)
+		return nil, fmt.Errorf("failed to save AI message: %w", err)
+	}
+
+	// Return the user message without the mark
+	if updated, err := s.messageRepo.GetMessageByID(ctx, messageID); err == nil {
+		userMessage = updated
+	}
+
+	return &types.SendMessageResponse{
+		UserMessage: *userMessage,
+		AIResponse:  *aiMessage,
+	}, nil
+}
+
+// generateReply asks Gemini to reply to userMessage, the latest message of the session
+func (s *ChatService) generateReply(ctx context.Context, userID string, session *types.ChatSession, userMessage *types.Message) (*ai.ConversationResponse, error) {
 	// Get recent conversation history for context
-	recentMessages, err := s.messageRepo.GetLatestMessages(ctx, sessionID, 10)
+	recentMessages, err := s.messageRepo.GetLatestMessages(ctx, session.ID, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation history: %w", err)
 	}
@@ -133,7 +330,7 @@ func (s *ChatService) SendMessage(ctx context.Context, userID, sessionID, conten
 	var conversationHistory []ai.Message
 	for _, msg := range recentMessages {
 		if msg.ID == userMessage.ID {
-			continue // Skip the message we just added
+			continue // Skip the message being replied to
 		}
 		conversationHistory = append(conversationHistory, ai.Message{
 			Content: msg.Content,
@@ -149,34 +346,58 @@ func (s *ChatService) SendMessage(ctx context.Context, userID, sessionID, conten
 
 	// Generate AI response
 	aiRequest := ai.ConversationRequest{
-		UserMessage:         content,
+		UserMessage:         userMessage.Content,
 		ConversationHistory: conversationHistory,
 		Date:                timeutil.FormatJST(session.SessionDate, "2006-01-02"),
 		TimeOfDay:           s.getTimeOfDay(),
 		UserName:            user.Username,
 	}
 
+	// Keep chatting after the quota is used up, but with shorter replies
+	if s.usageService != nil && s.usageService.QuotaExceeded(ctx, userID) {
+		aiRequest.Brief = true
+	}
+
+	ctx = ai.WithUsageScope(ctx, userID, session.ID)
 	aiResponse, err := s.aiClient.GenerateResponse(ctx, aiRequest)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate AI response: %w", err)
 	}
 
-	// Save AI response
-	aiMessage, err := s.messageRepo.CreateMessage(
-		ctx,
-		sessionID,
-		types.SenderAI,
-		aiResponse.Content,
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to save AI message: %w", err)
+	return aiResponse, nil
+}
+
+// fallbackResponse marks userMessage as unanswered and pairs it with an unsaved fallback reply
+func (s *ChatService) fallbackResponse(ctx context.Context, userMessage *types.Message) *types.SendMessageResponse {
+	s.markReplyFailed(ctx, userMessage.ID)
+	if metadata, err := json.Marshal(map[string]interface{}{types.MessageMetadataReplyFailed: true}); err == nil {
+		userMessage.Metadata = metadata
 	}
 
+	fallbackMetadata, _ := json.Marshal(map[string]interface{}{types.MessageMetadataFallback: true})
 	return &types.SendMessageResponse{
 		UserMessage: *userMessage,
-		AIResponse:  *aiMessage,
-	}, nil
+		AIResponse: types.Message{
+			ID:        "fallback-" + userMessage.ID,
+			SessionID: userMessage.SessionID,
+			Sender:    types.SenderAI,
+			Content:   fallbackReply,
+			CreatedAt: timeutil.NowJST(),
+			Metadata:  fallbackMetadata,
+		},
+		ReplyFailed: true,
+	}
+}
+
+// markReplyFailed marks a user message as waiting for a retried reply.
+// It runs even if the request was cancelled, since the message is already saved.
+func (s *ChatService) markReplyFailed(ctx context.Context, messageID string) {
+	err := s.messageRepo.MergeMessageMetadata(context.WithoutCancel(ctx), messageID, map[string]interface{}{
+		types.MessageMetadataReplyFailed: true,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to mark message as unanswered", slog.String("message_id", messageID), logging.Err(err))
+	}
 }
 
 // GetSessionMessages retrieves all messages for a session
@@ -187,7 +408,7 @@ func (s *ChatService) GetSessionMessages(ctx context.Context, userID, sessionID
 		return nil, nil, fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return nil, nil, fmt.Errorf("session not found or access denied")
+		return nil, nil, apperror.ErrSessionNotFound
 	}
 
 	// Get session info
@@ -205,15 +426,63 @@ func (s *ChatService) GetSessionMessages(ctx context.Context, userID, sessionID
 	return messages, session, nil
 }
 
+// GetSessionMoodCurve returns the sentiment of each annotated user message in a session
+func (s *ChatService) GetSessionMoodCurve(ctx context.Context, userID, sessionID string) (*types.MoodCurveResponse, error) {
+	// Verify session ownership
+	isOwner, err := s.sessionRepo.CheckSessionOwnership(ctx, sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session ownership: %w", err)
+	}
+	if !isOwner {
+		return nil, apperror.ErrSessionNotFound
+	}
+
+	messages, err := s.messageRepo.GetSessionMessages(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	points := []types.MoodPoint{}
+	for _, msg := range messages {
+		if msg.Sender != types.SenderUser || len(msg.Metadata) == 0 {
+			continue
+		}
+
+		var metadata struct {
+			Annotation *types.MessageAnnotation `json:"annotation"`
+		}
+		if err := json.Unmarshal(msg.Metadata, &metadata); err != nil || metadata.Annotation == nil {
+			continue // Not annotated yet
+		}
+
+		points = append(points, types.MoodPoint{
+			MessageID:      msg.ID,
+			SequenceNumber: msg.SequenceNumber,
+			CreatedAt:      msg.CreatedAt,
+			Score:          metadata.Annotation.Sentiment.Score,
+			Label:          metadata.Annotation.Sentiment.Label,
+			Topics:         metadata.Annotation.Topics,
+		})
+	}
+
+	return &types.MoodCurveResponse{
+		SessionID: sessionID,
+		Points:    points,
+	}, nil
+}
+
 // CompleteSession marks a session as completed
 func (s *ChatService) CompleteSession(ctx context.Context, userID, sessionID string) error {
+	ctx, span := tracing.Start(ctx, "ChatService.CompleteSession", trace.WithAttributes(tracing.SessionIDKey.String(sessionID)))
+	defer span.End()
+
 	// Verify session ownership
 	isOwner, err := s.sessionRepo.CheckSessionOwnership(ctx, sessionID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return fmt.Errorf("session not found or access denied")
+		return apperror.ErrSessionNotFound
 	}
 
 	// Get session to check status
@@ -223,7 +492,7 @@ func (s *ChatService) CompleteSession(ctx context.Context, userID, sessionID str
 	}
 
 	if session.Status != types.SessionStatusActive {
-		return fmt.Errorf("session is already completed")
+		return apperror.ErrSessionCompleted
 	}
 
 	// Complete the session
@@ -232,33 +501,48 @@ func (s *ChatService) CompleteSession(ctx context.Context, userID, sessionID str
 		return fmt.Errorf("failed to complete session: %w", err)
 	}
 
+	if s.webhookService != nil {
+		if completed, err := s.sessionRepo.GetSessionByID(ctx, sessionID); err == nil {
+			s.emitWebhook(ctx, userID, types.WebhookEventSessionCompleted, completed)
+		}
+	}
+
 	// Trigger analysis in the background if analysis service is available
 	if s.analysisService != nil {
 		err = s.analysisService.TriggerAnalysisForCompletedSession(ctx, userID, sessionID)
 		if err != nil {
 			// Log error but don't fail the main flow
-			// In production, this would go to proper logging system
-			fmt.Printf("Failed to trigger analysis for session %s: %v\n", sessionID, err)
+			s.logger.ErrorContext(ctx, "Failed to trigger analysis", slog.String("session_id", sessionID), logging.Err(err))
 		}
 	}
 
 	return nil
 }
 
-// GetUserSessions retrieves session history for a user
-func (s *ChatService) GetUserSessions(ctx context.Context, userID string, limit, offset int, year, month *int) (*types.SessionsResponse, error) {
-	sessions, total, err := s.sessionRepo.GetUserSessions(ctx, userID, limit, offset, year, month)
+// GetUserSessions retrieves a page of session history for a user
+func (s *ChatService) GetUserSessions(ctx context.Context, userID string, query types.ListQuery) (*types.SessionsResponse, error) {
+	after, err := prepareListQuery(&query, sessionSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, next, err := s.sessionRepo.GetUserSessions(ctx, userID, query.Sort, query.SessionFilter, after, query.Limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user sessions: %w", err)
 	}
 
+	var total *int
+	if query.IncludeTotal {
+		count, err := s.sessionRepo.CountUserSessions(ctx, userID, query.SessionFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count user sessions: %w", err)
+		}
+		total = &count
+	}
+
 	return &types.SessionsResponse{
-		Sessions: sessions,
-		Pagination: types.Pagination{
-			Total:  total,
-			Limit:  limit,
-			Offset: offset,
-		},
+		Sessions:   sessions,
+		Pagination: newPagination(query.Limit, next, total),
 	}, nil
 }
 
@@ -269,10 +553,50 @@ func (s *ChatService) CreateSessionForDate(ctx context.Context, userID, date str
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
+	s.emitWebhook(ctx, userID, types.WebhookEventSessionCreated, session)
 
 	return session, nil
 }
 
+// emitWebhook queues a webhook event; failures are logged and never affect the chat
+func (s *ChatService) emitWebhook(ctx context.Context, userID, eventType string, data interface{}) {
+	if s.webhookService == nil {
+		return
+	}
+	if err := s.webhookService.Emit(ctx, userID, eventType, data); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to emit webhook", slog.String("event", eventType), logging.Err(err))
+	}
+}
+
+// annotateMessageAsync annotates a user message in the background and stores the result in its metadata
+func (s *ChatService) annotateMessageAsync(parent context.Context, messageID, content string) {
+	if s.annotator == nil {
+		return
+	}
+
+	ctx, span := tracing.Detach(parent, "ChatService.annotateMessage")
+	ctx = logging.WithUserID(ctx, logging.UserID(parent))
+	go func() {
+		defer span.End()
+
+		ctx, cancel := context.WithTimeout(ctx, annotationTimeout)
+		defer cancel()
+
+		annotation, err := s.annotator.Annotate(ctx, content)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to annotate message", slog.String("message_id", messageID), logging.Err(err))
+			return
+		}
+
+		err = s.messageRepo.MergeMessageMetadata(ctx, messageID, map[string]interface{}{
+			types.MessageMetadataAnnotation: annotation,
+		})
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to save annotation", slog.String("message_id", messageID), logging.Err(err))
+		}
+	}()
+}
+
 // getTimeOfDay determines the time of day for greeting personalization
 func (s *ChatService) getTimeOfDay() string {
 	hour := timeutil.NowJST().Hour()
@@ -296,7 +620,7 @@ func (s *ChatService) GetSessionStats(ctx context.Context, userID, sessionID str
 		return nil, fmt.Errorf("failed to check session ownership: %w", err)
 	}
 	if !isOwner {
-		return nil, fmt.Errorf("session not found or access denied")
+		return nil, apperror.ErrSessionNotFound
 	}
 
 	// Get message count
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/alert"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/repository/memory"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"google.golang.org/genai"
+)
+
+func TestGetTodaySessionCreatesSessionWithGreeting(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+
+	session, greeting, err := env.chat.GetTodaySession(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTodaySession: %v", err)
+	}
+	if session.Status != types.SessionStatusActive {
+		t.Errorf("status = %q, want %q", session.Status, types.SessionStatusActive)
+	}
+	if greeting == nil || greeting.Sender != types.SenderAI || greeting.Content == "" {
+		t.Fatalf("greeting = %+v, want an AI message", greeting)
+	}
+	if hasMetadataKey(greeting, types.MessageMetadataFallback) {
+		t.Errorf("greeting is marked as a fallback")
+	}
+
+	again, greeting, err := env.chat.GetTodaySession(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTodaySession (second call): %v", err)
+	}
+	if again.ID != session.ID {
+		t.Errorf("second call returned session %s, want %s", again.ID, session.ID)
+	}
+	if greeting != nil {
+		t.Errorf("second call returned a greeting: %+v", greeting)
+	}
+}
+
+func TestGetTodaySessionConcurrentFirstLoads(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+
+	alerts := memory.NewAlertRepository(env.store)
+	env.chat.SetAlertService(NewAlertService(alerts, env.analysis, alert.NewEngine(), env.chat.logger))
+	notification, err := alerts.CreateNotification(ctx, userID, "alert.low_score", "低め", "低い日が続いています", map[string]interface{}{"chat_hint": "低い日が続いています。"})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+
+	// Both loads find no session and generate a greeting before either saves one
+	const loads = 2
+	barrier := &barrierProvider{Provider: env.provider.Provider}
+	barrier.arrived.Add(loads)
+	env.provider.Provider = barrier
+
+	type result struct {
+		session  *types.ChatSession
+		greeting *types.Message
+		err      error
+	}
+	results := make(chan result, loads)
+	for i := 0; i < loads; i++ {
+		go func() {
+			session, greeting, err := env.chat.GetTodaySession(ctx, userID)
+			results <- result{session, greeting, err}
+		}()
+	}
+
+	var sessionIDs []string
+	greetings := 0
+	for i := 0; i < loads; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("GetTodaySession: %v", r.err)
+		}
+		sessionIDs = append(sessionIDs, r.session.ID)
+		if r.greeting != nil {
+			greetings++
+		}
+	}
+	if sessionIDs[0] != sessionIDs[1] {
+		t.Errorf("loads returned sessions %v, want the same one", sessionIDs)
+	}
+	if greetings != 1 {
+		t.Errorf("got %d greetings, want 1", greetings)
+	}
+
+	// The alert was used by the saved greeting
+	if pending, err := alerts.GetChatAcknowledgement(ctx, userID, notification.CreatedAt); err != nil || pending != nil {
+		t.Errorf("alert left unacknowledged: %+v, %v", pending, err)
+	}
+}
+
+func TestGetTodaySessionKeepsAcknowledgementWhenGreetingIsNotSaved(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+
+	alerts := memory.NewAlertRepository(env.store)
+	env.chat.SetAlertService(NewAlertService(alerts, env.analysis, alert.NewEngine(), env.chat.logger))
+	notification, err := alerts.CreateNotification(ctx, userID, "alert.low_score", "低め", "低い日が続いています", map[string]interface{}{"chat_hint": "低い日が続いています。"})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+
+	env.tx.wrap = func(tx repository.Repos) repository.Repos {
+		tx.Messages = failingMessages{tx.Messages}
+		return tx
+	}
+	if _, _, err := env.chat.GetTodaySession(ctx, userID); !errors.Is(err, errInjected) {
+		t.Fatalf("GetTodaySession error = %v, want the injected failure", err)
+	}
+	if pending, err := alerts.GetChatAcknowledgement(ctx, userID, notification.CreatedAt); err != nil || pending == nil {
+		t.Fatalf("alert was used up by a greeting that was not saved: %+v, %v", pending, err)
+	}
+
+	env.tx.wrap = nil
+	if _, _, err := env.chat.GetTodaySession(ctx, userID); err != nil {
+		t.Fatalf("GetTodaySession: %v", err)
+	}
+	if pending, err := alerts.GetChatAcknowledgement(ctx, userID, notification.CreatedAt); err != nil || pending != nil {
+		t.Errorf("alert left unacknowledged: %+v, %v", pending, err)
+	}
+}
+
+// barrierProvider holds each call until arrived is done, so that concurrent callers overlap
+type barrierProvider struct {
+	ai.Provider
+	arrived sync.WaitGroup
+}
+
+// GenerateContent implements ai.Provider
+func (p *barrierProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	p.arrived.Done()
+	p.arrived.Wait()
+	return p.Provider.GenerateContent(ctx, model, contents, config)
+}
+
+func TestGetTodaySessionFallsBackWhenAIUnavailable(t *testing.T) {
+	env := newTestEnv(t)
+	userID := env.createUser(t, "alice")
+	env.provider.setUnavailable(true)
+
+	_, greeting, err := env.chat.GetTodaySession(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetTodaySession: %v", err)
+	}
+	if greeting == nil || greeting.Content != fallbackFirstMessage {
+		t.Fatalf("greeting = %+v, want the fallback greeting", greeting)
+	}
+	if !hasMetadataKey(greeting, types.MessageMetadataFallback) {
+		t.Errorf("fallback greeting is not marked in metadata: %s", greeting.Metadata)
+	}
+}
+
+func TestGetTodaySessionRollsBackWhenGreetingIsNotSaved(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	env.tx.wrap = func(tx repository.Repos) repository.Repos {
+		tx.Messages = failingMessages{tx.Messages}
+		return tx
+	}
+
+	if _, _, err := env.chat.GetTodaySession(ctx, userID); !errors.Is(err, errInjected) {
+		t.Fatalf("GetTodaySession error = %v, want the injected failure", err)
+	}
+	if session, err := env.sessions.GetTodaySession(ctx, userID); err != nil || session != nil {
+		t.Fatalf("session without a greeting was left behind: %+v, %v", session, err)
+	}
+
+	// The next visit starts over with a session and its greeting
+	env.tx.wrap = nil
+	session, greeting, err := env.chat.GetTodaySession(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTodaySession: %v", err)
+	}
+	if greeting == nil || greeting.SessionID != session.ID {
+		t.Errorf("greeting = %+v, want a message in session %s", greeting, session.ID)
+	}
+}
+
+func TestSendMessageSavesMessagesInOrder(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+
+	response, err := env.chat.SendMessage(ctx, userID, session.ID, "今日は友達とカフェに行って楽しかった")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if response.ReplyFailed {
+		t.Fatalf("reply failed")
+	}
+	if response.UserMessage.Sender != types.SenderUser || response.AIResponse.Sender != types.SenderAI {
+		t.Errorf("senders = %q, %q", response.UserMessage.Sender, response.AIResponse.Sender)
+	}
+	if response.AIResponse.SequenceNumber <= response.UserMessage.SequenceNumber {
+		t.Errorf("AI reply sequence %d is not after user message %d", response.AIResponse.SequenceNumber, response.UserMessage.SequenceNumber)
+	}
+
+	messages, _, err := env.chat.GetSessionMessages(ctx, userID, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionMessages: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want greeting, user message and reply", len(messages))
+	}
+	for i := 1; i < len(messages); i++ {
+		if messages[i].SequenceNumber <= messages[i-1].SequenceNumber {
+			t.Errorf("messages are not ordered by sequence number: %d then %d", messages[i-1].SequenceNumber, messages[i].SequenceNumber)
+		}
+	}
+}
+
+func TestSendMessageRejectsOtherUsersSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	session := env.startSession(t, env.createUser(t, "alice"))
+	otherID := env.createUser(t, "bob")
+
+	_, err := env.chat.SendMessage(ctx, otherID, session.ID, "こんにちは")
+	if !errors.Is(err, apperror.ErrSessionNotFound) {
+		t.Errorf("SendMessage error = %v, want access denied", err)
+	}
+	if _, _, err := env.chat.GetSessionMessages(ctx, otherID, session.ID); err == nil {
+		t.Errorf("GetSessionMessages succeeded for another user's session")
+	}
+}
+
+func TestSendMessageFallbackAndRetryReply(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+
+	env.provider.setUnavailable(true)
+	response, err := env.chat.SendMessage(ctx, userID, session.ID, "少し疲れた一日だった")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if !response.ReplyFailed {
+		t.Fatalf("ReplyFailed = false while the AI is unavailable")
+	}
+	saved, err := env.messages.GetMessageByID(ctx, response.UserMessage.ID)
+	if err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if !hasMetadataKey(saved, types.MessageMetadataReplyFailed) {
+		t.Errorf("user message is not marked as reply failed: %s", saved.Metadata)
+	}
+
+	// The failed reply is not saved, so the user message stays the latest one
+	if _, err := env.chat.RetryReply(ctx, userID, session.ID, response.UserMessage.ID); err == nil {
+		t.Fatalf("RetryReply succeeded while the AI is unavailable")
+	}
+
+	env.provider.setUnavailable(false)
+	retried, err := env.chat.RetryReply(ctx, userID, session.ID, response.UserMessage.ID)
+	if err != nil {
+		t.Fatalf("RetryReply: %v", err)
+	}
+	if retried.AIResponse.Sender != types.SenderAI || retried.AIResponse.Content == "" {
+		t.Errorf("retried reply = %+v", retried.AIResponse)
+	}
+	if hasMetadataKey(&retried.UserMessage, types.MessageMetadataReplyFailed) {
+		t.Errorf("user message is still marked as reply failed after the retry")
+	}
+
+	_, err = env.chat.RetryReply(ctx, userID, session.ID, response.UserMessage.ID)
+	if !errors.Is(err, apperror.ErrMessageNotRetryable) {
+		t.Errorf("second RetryReply error = %v, want message cannot be retried", err)
+	}
+}
+
+func TestCompleteSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	session := env.startSession(t, userID)
+	env.send(t, userID, session.ID, "仕事が忙しくて不安だったけど、夜は家族と話せてほっとした")
+
+	if err := env.chat.CompleteSession(ctx, userID, session.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	completed, err := env.sessions.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID: %v", err)
+	}
+	if completed.Status != types.SessionStatusCompleted || completed.CompletedAt == nil {
+		t.Errorf("session = %+v, want completed", completed)
+	}
+
+	if err := env.chat.CompleteSession(ctx, userID, session.ID); !errors.Is(err, apperror.ErrSessionCompleted) {
+		t.Errorf("second CompleteSession error = %v, want already completed", err)
+	}
+	if _, err := env.chat.SendMessage(ctx, userID, session.ID, "まだ話したい"); !errors.Is(err, apperror.ErrSessionInactive) {
+		t.Errorf("SendMessage error = %v, want session is not active", err)
+	}
+
+	// Completion analyzes the session in the background
+	analysis := waitForAnalysis(t, env, session.ID)
+	if analysis.TensionScore < 0 || analysis.TensionScore > 100 {
+		t.Errorf("tension score = %d, want 0-100", analysis.TensionScore)
+	}
+}
+
+func TestGetUserSessionsPagesWithCursors(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := env.createUser(t, "alice")
+	for _, date := range []string{"2024-03-10", "2024-03-11", "2024-03-12", "2024-04-01"} {
+		if _, err := env.chat.CreateSessionForDate(ctx, userID, date); err != nil {
+			t.Fatalf("CreateSessionForDate: %v", err)
+		}
+	}
+
+	var dates []string
+	query := types.ListQuery{Limit: 3, IncludeTotal: true}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination does not terminate")
+		}
+		response, err := env.chat.GetUserSessions(ctx, userID, query)
+		if err != nil {
+			t.Fatalf("GetUserSessions: %v", err)
+		}
+		if response.Pagination.Total == nil || *response.Pagination.Total != 4 {
+			t.Errorf("total = %v, want 4", response.Pagination.Total)
+		}
+		for _, session := range response.Sessions {
+			dates = append(dates, session.Date)
+		}
+		if response.Pagination.NextCursor == nil {
+			break
+		}
+		query.Cursor = *response.Pagination.NextCursor
+	}
+	if len(dates) != 4 || dates[0] != "2024-04-01" || dates[3] != "2024-03-10" {
+		t.Errorf("dates = %v, want all four newest first", dates)
+	}
+
+	from, to := "2024-03-11", "2024-03-31"
+	response, err := env.chat.GetUserSessions(ctx, userID, types.ListQuery{
+		SessionFilter: types.SessionFilter{DateFrom: &from, DateTo: &to},
+		Sort:          types.SortDateAsc,
+		Limit:         10,
+	})
+	if err != nil {
+		t.Fatalf("GetUserSessions (date range): %v", err)
+	}
+	if len(response.Sessions) != 2 || response.Sessions[0].Date != "2024-03-11" || response.Pagination.Total != nil {
+		t.Errorf("sessions from 03-11 to 03-31 = %+v", response)
+	}
+
+	for _, tt := range []struct {
+		query types.ListQuery
+		want  error
+	}{
+		{types.ListQuery{Sort: types.SortTensionDesc, Limit: 10}, apperror.ErrInvalidSort},
+		{types.ListQuery{Sort: types.SortDateAsc, Cursor: query.Cursor, Limit: 10}, apperror.ErrInvalidCursor},
+		{types.ListQuery{SessionFilter: types.SessionFilter{DateFrom: &to, DateTo: &from}, Limit: 10}, apperror.ErrInvalidDateRange},
+	} {
+		if _, err := env.chat.GetUserSessions(ctx, userID, tt.query); !errors.Is(err, tt.want) {
+			t.Errorf("GetUserSessions error = %v, want %v", err, tt.want)
+		}
+	}
+}
+
+// waitForAnalysis polls for the analysis of a session until it is stored
+func waitForAnalysis(t *testing.T, env *testEnv, sessionID string) *types.Analysis {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		analysis, err := env.analyses.GetAnalysisBySessionID(context.Background(), sessionID)
+		if err != nil {
+			t.Fatalf("GetAnalysisBySessionID: %v", err)
+		}
+		if analysis != nil {
+			return analysis
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("session %s was not analyzed", sessionID)
+	return nil
+}
+
+// hasMetadataKey reports whether a message's metadata contains the key
+func hasMetadataKey(message *types.Message, key string) bool {
+	var metadata map[string]interface{}
+	if len(message.Metadata) == 0 || json.Unmarshal(message.Metadata, &metadata) != nil {
+		return false
+	}
+	_, ok := metadata[key]
+	return ok
+}
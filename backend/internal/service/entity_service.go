@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EntityService handles extraction and management of the people, places, activities and projects users mention
+type EntityService struct {
+	entityRepo repository.EntityStore
+	aiClient   *ai.Client
+}
+
+// NewEntityService creates a new entity service
+func NewEntityService(
+	entityRepo repository.EntityStore,
+	aiClient *ai.Client,
+) *EntityService {
+	return &EntityService{
+		entityRepo: entityRepo,
+		aiClient:   aiClient,
+	}
+}
+
+// entityKinds lists the entity kinds that can be stored
+var entityKinds = map[string]bool{
+	types.EntityTypePerson:   true,
+	types.EntityTypePlace:    true,
+	types.EntityTypeActivity: true,
+	types.EntityTypeProject:  true,
+}
+
+// honorifics are stripped when normalizing people's names so that 田中さん and 田中 resolve to the same person
+var honorifics = []string{"さん", "くん", "君", "ちゃん", "様", "さま", "先生", "先輩"}
+
+// maxEntityNameLength matches the entities.name column size
+const maxEntityNameLength = 100
+
+// ExtractSessionEntities extracts entities from a session's conversation and records their mentions
+func (s *EntityService) ExtractSessionEntities(ctx context.Context, userID, sessionID string, conversation []ai.Message) error {
+	extraction, err := s.aiClient.ExtractEntities(ai.WithUsageScope(ctx, userID, sessionID), conversation)
+	if err != nil {
+		return fmt.Errorf("failed to extract entities: %w", err)
+	}
+
+	for _, extracted := range extraction.Entities {
+		if !entityKinds[extracted.Kind] {
+			continue
+		}
+
+		name := strings.TrimSpace(extracted.Name)
+		alias := normalizeEntityName(extracted.Kind, name)
+		if alias == "" || len([]rune(name)) > maxEntityNameLength {
+			continue
+		}
+
+		entity, err := s.entityRepo.FindEntityByAlias(ctx, userID, extracted.Kind, alias)
+		if err != nil {
+			return err
+		}
+		if entity == nil {
+			entity, err = s.entityRepo.CreateEntity(ctx, userID, extracted.Kind, name, alias)
+			if err != nil {
+				return err
+			}
+		}
+
+		mentions := extracted.Mentions
+		if mentions < 1 {
+			mentions = 1
+		}
+		if err := s.entityRepo.RecordMention(ctx, entity.ID, sessionID, mentions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetEntities retrieves a user's most frequently mentioned entities
+func (s *EntityService) GetEntities(ctx context.Context, userID string, kind *string, limit int) (*types.EntitiesResponse, error) {
+	if kind != nil && !entityKinds[*kind] {
+		return nil, apperror.ErrInvalidEntityKind
+	}
+
+	entities, err := s.entityRepo.GetEntities(ctx, userID, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entities: %w", err)
+	}
+	if entities == nil {
+		entities = []types.EntitySummary{}
+	}
+
+	return &types.EntitiesResponse{Entities: entities}, nil
+}
+
+// GetEntityDetail retrieves an entity with the days it was mentioned and their tension scores
+func (s *EntityService) GetEntityDetail(ctx context.Context, userID, entityID string) (*types.EntityDetailResponse, error) {
+	entity, err := s.entityRepo.GetEntitySummary(ctx, userID, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := s.entityRepo.GetEntityAliases(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entity aliases: %w", err)
+	}
+
+	days, err := s.entityRepo.GetEntityDays(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entity days: %w", err)
+	}
+
+	return &types.EntityDetailResponse{
+		Entity:  *entity,
+		Aliases: aliases,
+		Days:    days,
+	}, nil
+}
+
+// RenameEntity changes an entity's display name; the new name also resolves to the entity from now on
+func (s *EntityService) RenameEntity(ctx context.Context, userID, entityID, name string) (*types.EntityDetailResponse, error) {
+	entity, err := s.entityRepo.GetEntitySummary(ctx, userID, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	alias := normalizeEntityName(entity.Kind, name)
+	if alias == "" || len([]rune(name)) > maxEntityNameLength {
+		return nil, apperror.ErrInvalidEntityName
+	}
+
+	if err := s.entityRepo.RenameEntity(ctx, userID, entityID, name, alias); err != nil {
+		return nil, err
+	}
+
+	return s.GetEntityDetail(ctx, userID, entityID)
+}
+
+// MergeEntities merges the source entities into the target entity
+func (s *EntityService) MergeEntities(ctx context.Context, userID, targetID string, sourceIDs []string) (*types.EntityDetailResponse, error) {
+	if len(sourceIDs) == 0 {
+		return nil, apperror.ErrInvalidMerge
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range sourceIDs {
+		if id == targetID || seen[id] {
+			return nil, apperror.ErrInvalidMerge
+		}
+		seen[id] = true
+	}
+
+	if err := s.entityRepo.MergeEntities(ctx, userID, targetID, sourceIDs); err != nil {
+		return nil, err
+	}
+
+	return s.GetEntityDetail(ctx, userID, targetID)
+}
+
+// normalizeEntityName folds width and case and collapses whitespace. Honorifics are only stripped from
+// people's names; elsewhere a trailing 様 or 先生 is part of the name.
+func normalizeEntityName(kind, name string) string {
+	normalized := strings.ToLower(norm.NFKC.String(name))
+	normalized = strings.Join(strings.Fields(normalized), " ")
+	if kind != types.EntityTypePerson {
+		return normalized
+	}
+	for _, honorific := range honorifics {
+		if trimmed := strings.TrimSuffix(normalized, honorific); trimmed != "" {
+			normalized = trimmed
+		}
+	}
+	return strings.TrimSpace(normalized)
+}
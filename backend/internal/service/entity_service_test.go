@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+func TestNormalizeEntityName(t *testing.T) {
+	tests := []struct {
+		kind string
+		name string
+		want string
+	}{
+		{types.EntityTypePerson, "田中さん", "田中"},
+		{types.EntityTypePerson, "田中", "田中"},
+		{types.EntityTypePerson, "山田先生", "山田"},
+		{types.EntityTypePerson, "ゆいちゃん", "ゆい"},
+		{types.EntityTypePerson, "Ｔａｎａｋａ　さん", "tanaka"},
+		// A bare honorific is a name of its own
+		{types.EntityTypePerson, "先生", "先生"},
+		{types.EntityTypePerson, "  Alice   Smith ", "alice smith"},
+		{types.EntityTypePlace, "喫茶 ひだまり様", "喫茶 ひだまり様"},
+		{types.EntityTypePlace, "ＣＡＦＥ　さくら", "cafe さくら"},
+		{types.EntityTypeActivity, "お茶さん", "お茶さん"},
+		{types.EntityTypeProject, "卒論くん", "卒論くん"},
+		{types.EntityTypePlace, "   ", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeEntityName(tt.kind, tt.name); got != tt.want {
+			t.Errorf("normalizeEntityName(%s, %q) = %q, want %q", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
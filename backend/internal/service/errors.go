@@ -0,0 +1,17 @@
+package service
+
+import (
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+)
+
+// classifyAIError turns AI provider failures into errors the client can act on; other errors are returned as is
+func classifyAIError(err error) error {
+	switch {
+	case ai.IsUnavailable(err):
+		return apperror.ErrAIUnavailable.Wrap(err)
+	case ai.IsOutputError(err):
+		return apperror.ErrAIInvalidOutput.Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"slices"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/pagination"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+var (
+	sessionSorts  = []string{types.SortDateDesc, types.SortDateAsc, types.SortUpdatedDesc, types.SortUpdatedAsc}
+	analysisSorts = []string{types.SortDateDesc, types.SortDateAsc, types.SortTensionDesc, types.SortTensionAsc}
+)
+
+// prepareListQuery validates a listing query against the sorts it supports and decodes its cursor.
+// The sort defaults to the first supported one.
+func prepareListQuery(query *types.ListQuery, sorts []string) (*types.PageCursor, error) {
+	if query.Sort == "" {
+		query.Sort = sorts[0]
+	}
+	if !slices.Contains(sorts, query.Sort) {
+		return nil, apperror.ErrInvalidSort
+	}
+
+	filter := query.SessionFilter
+	for _, date := range []*string{filter.DateFrom, filter.DateTo} {
+		if date == nil {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *date); err != nil {
+			return nil, apperror.ErrInvalidDateRange
+		}
+	}
+	if filter.DateFrom != nil && filter.DateTo != nil && *filter.DateFrom > *filter.DateTo {
+		return nil, apperror.ErrInvalidDateRange
+	}
+
+	if filter.Status != nil && *filter.Status != types.SessionStatusActive && *filter.Status != types.SessionStatusCompleted {
+		return nil, apperror.ErrInvalidFilter
+	}
+	for _, score := range []*int{filter.MinTension, filter.MaxTension} {
+		if score != nil && (*score < 0 || *score > 100) {
+			return nil, apperror.ErrInvalidFilter
+		}
+	}
+	if filter.MinTension != nil && filter.MaxTension != nil && *filter.MinTension > *filter.MaxTension {
+		return nil, apperror.ErrInvalidFilter
+	}
+
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	cursor, err := pagination.Decode(query.Cursor, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// newPagination builds the pagination information of a page
+func newPagination(limit int, next *types.PageCursor, total *int) types.Pagination {
+	result := types.Pagination{Limit: limit, HasMore: next != nil, Total: total}
+	if next != nil {
+		cursor := pagination.Encode(*next)
+		result.NextCursor = &cursor
+	}
+	return result
+}
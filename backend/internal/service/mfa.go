@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+const (
+	// totpIssuer is the account issuer shown by authenticator apps
+	totpIssuer = "Kasaneha"
+	// totpPeriod is the length of a TOTP time step in seconds
+	totpPeriod = 30
+	// totpSkew time steps before and after the current one are accepted, for clock drift
+	totpSkew = 1
+	// recoveryCodeCount recovery codes are generated at a time
+	recoveryCodeCount = 10
+)
+
+// GetMFAStatus returns whether a user has two-factor authentication enabled
+func (s *AuthService) GetMFAStatus(ctx context.Context, userID string) (*types.MFAStatus, error) {
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.EnabledAt == nil {
+		return &types.MFAStatus{}, nil
+	}
+
+	remaining, err := s.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.MFAStatus{Enabled: true, EnabledAt: state.EnabledAt, RecoveryCodesRemaining: remaining}, nil
+}
+
+// EnrollMFA creates a TOTP secret for the user's authenticator app. Two-factor authentication is
+// enabled once ConfirmMFA verifies a code from it.
+func (s *AuthService) EnrollMFA(ctx context.Context, userID string) (*types.MFAEnrollment, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	if err := s.mfaRepo.SetTOTPSecret(ctx, userID, key.Secret()); err != nil {
+		return nil, err
+	}
+
+	return &types.MFAEnrollment{Secret: key.Secret(), OTPAuthURL: key.URL()}, nil
+}
+
+// ConfirmMFA enables two-factor authentication with a code from the enrolled secret and returns
+// the recovery codes
+func (s *AuthService) ConfirmMFA(ctx context.Context, userID, code string, client ClientInfo) (*types.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.EnabledAt != nil {
+		return nil, apperror.ErrMFAAlreadyEnabled
+	}
+	if state.Secret == nil {
+		return nil, apperror.ErrMFANotEnrolled
+	}
+
+	counter, ok := matchTOTP(*state.Secret, code, s.now())
+	if !ok {
+		return nil, apperror.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.EnableMFA(ctx, userID, counter, hashes); err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventMFAEnabled}, user.Username, client)
+
+	return &types.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns off two-factor authentication after checking a TOTP or recovery code
+func (s *AuthService) DisableMFA(ctx context.Context, userID, code string, client ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.checkSecondFactor(ctx, userID, code, s.now()); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.DisableMFA(ctx, userID); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventMFADisabled}, user.Username, client)
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a TOTP or recovery code
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code string, client ClientInfo) (*types.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.checkSecondFactor(ctx, userID, code, s.now()); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventRecoveryCodes}, user.Username, client)
+
+	return &types.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// checkSecondFactor accepts a TOTP code that has not been used before or an unused recovery code,
+// and reports whether it was a recovery code
+func (s *AuthService) checkSecondFactor(ctx context.Context, userID, code string, now time.Time) (bool, error) {
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if state.EnabledAt == nil || state.Secret == nil {
+		return false, apperror.ErrMFANotEnabled
+	}
+
+	if counter, ok := matchTOTP(*state.Secret, code, now); ok {
+		// Claiming the time step makes each code single-use, even for concurrent requests
+		claimed, err := s.mfaRepo.ClaimTOTPCounter(ctx, userID, counter)
+		if err != nil {
+			return false, err
+		}
+		if !claimed {
+			return false, apperror.ErrInvalidMFACode
+		}
+		return false, nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	if !used {
+		return false, apperror.ErrInvalidMFACode
+	}
+	return true, nil
+}
+
+// startMFAChallenge records a new pending second login step for the user and returns its ID
+func (s *AuthService) startMFAChallenge(ctx context.Context, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate MFA challenge: %w", err)
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := s.mfaRepo.StartMFAChallenge(ctx, userID, challenge); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// checkMFAChallenge refuses a second login step whose challenge is not the user's pending one
+func (s *AuthService) checkMFAChallenge(ctx context.Context, userID, challenge string) error {
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if state.Challenge == nil || subtle.ConstantTimeCompare([]byte(*state.Challenge), []byte(challenge)) != 1 {
+		return apperror.ErrUnauthorized
+	}
+	return nil
+}
+
+// matchTOTP checks a code against the time steps around now and returns the matching time step
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != otp.DigitsSix.Length() {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(counter), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as XXXXX-XXXXX, and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code as stored, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// enableMFA enrolls alice and confirms the secret, returning it with the recovery codes
+func (e *authTestEnv) enableMFA(t *testing.T) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := e.auth.EnrollMFA(ctx, e.alice.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA: %v", err)
+	}
+	response, err := e.auth.ConfirmMFA(ctx, e.alice.ID, e.totpCode(t, enrollment.Secret), testClient)
+	if err != nil {
+		t.Fatalf("ConfirmMFA: %v", err)
+	}
+	return enrollment.Secret, response.RecoveryCodes
+}
+
+// mfaChallenge logs alice in with her password and returns the challenge of the second step
+func (e *authTestEnv) mfaChallenge(t *testing.T) string {
+	t.Helper()
+
+	result, err := e.auth.Login(context.Background(), "alice", "password", testClient)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !result.MFARequired || result.MFAChallenge == "" {
+		t.Fatalf("Login = %+v, want a second factor challenge", result)
+	}
+	return result.MFAChallenge
+}
+
+// totpCode returns the current code of secret
+func (e *authTestEnv) totpCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := totp.GenerateCode(secret, e.now)
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	return code
+}
+
+func TestEnrollAndConfirmMFA(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{})
+	ctx := context.Background()
+
+	if _, err := env.auth.ConfirmMFA(ctx, env.alice.ID, "123456", testClient); !errors.Is(err, apperror.ErrMFANotEnrolled) {
+		t.Errorf("ConfirmMFA before enrolling error = %v, want not enrolled", err)
+	}
+
+	enrollment, err := env.auth.EnrollMFA(ctx, env.alice.ID)
+	if err != nil {
+		t.Fatalf("EnrollMFA: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.OTPAuthURL, "otpauth://totp/Kasaneha:alice?") || !strings.Contains(enrollment.OTPAuthURL, "secret="+enrollment.Secret) {
+		t.Errorf("otpauth URL = %q, want a TOTP URI with the secret", enrollment.OTPAuthURL)
+	}
+
+	// Enrolling is not enough for logins to need a code
+	if status, err := env.auth.GetMFAStatus(ctx, env.alice.ID); err != nil || status.Enabled {
+		t.Errorf("status before confirming = %+v, %v, want disabled", status, err)
+	}
+
+	if _, err := env.auth.ConfirmMFA(ctx, env.alice.ID, "000000", testClient); !errors.Is(err, apperror.ErrInvalidMFACode) {
+		t.Errorf("ConfirmMFA with a wrong code error = %v, want invalid code", err)
+	}
+	response, err := env.auth.ConfirmMFA(ctx, env.alice.ID, env.totpCode(t, enrollment.Secret), testClient)
+	if err != nil {
+		t.Fatalf("ConfirmMFA: %v", err)
+	}
+	if len(response.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(response.RecoveryCodes), recoveryCodeCount)
+	}
+
+	status, err := env.auth.GetMFAStatus(ctx, env.alice.ID)
+	if err != nil {
+		t.Fatalf("GetMFAStatus: %v", err)
+	}
+	if !status.Enabled || status.EnabledAt == nil || status.RecoveryCodesRemaining != recoveryCodeCount {
+		t.Errorf("status = %+v, want enabled with %d recovery codes", status, recoveryCodeCount)
+	}
+
+	if _, err := env.auth.EnrollMFA(ctx, env.alice.ID); !errors.Is(err, apperror.ErrMFAAlreadyEnabled) {
+		t.Errorf("EnrollMFA when enabled error = %v, want already enabled", err)
+	}
+}
+
+func TestMFALogin(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{})
+	ctx := context.Background()
+	secret, recoveryCodes := env.enableMFA(t)
+	challenge := env.mfaChallenge(t)
+
+	// The code used to confirm the secret cannot complete a login
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, env.totpCode(t, secret), testClient); !errors.Is(err, apperror.ErrInvalidMFACode) {
+		t.Errorf("CompleteMFALogin with a used code error = %v, want invalid code", err)
+	}
+
+	env.now = env.now.Add(totpPeriod * time.Second)
+	code := env.totpCode(t, secret)
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, code, testClient); err != nil {
+		t.Fatalf("CompleteMFALogin: %v", err)
+	}
+
+	// The challenge is used up, even with a fresh code
+	env.now = env.now.Add(totpPeriod * time.Second)
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, env.totpCode(t, secret), testClient); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("CompleteMFALogin replaying a challenge error = %v, want unauthorized", err)
+	}
+
+	challenge = env.mfaChallenge(t)
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, code, testClient); !errors.Is(err, apperror.ErrInvalidMFACode) {
+		t.Errorf("CompleteMFALogin replaying a code error = %v, want invalid code", err)
+	}
+
+	// Recovery codes work once, ignoring case and dashes
+	recoveryCode := strings.ToLower(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, recoveryCode, testClient); err != nil {
+		t.Fatalf("CompleteMFALogin with a recovery code: %v", err)
+	}
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, env.mfaChallenge(t), recoveryCodes[0], testClient); !errors.Is(err, apperror.ErrInvalidMFACode) {
+		t.Errorf("CompleteMFALogin reusing a recovery code error = %v, want invalid code", err)
+	}
+
+	if status, err := env.auth.GetMFAStatus(ctx, env.alice.ID); err != nil || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("status = %+v, %v, want %d recovery codes left", status, err, recoveryCodeCount-1)
+	}
+
+	response, err := env.auth.GetSecurityEvents(ctx, env.alice.ID, 3)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+	if event := response.Events[1]; event.EventType != types.SecurityEventLoginSucceeded || event.Reason == nil || *event.Reason != types.LoginMethodRecoveryCode {
+		t.Errorf("recovery code login event = %+v, want a login with reason %s", event, types.LoginMethodRecoveryCode)
+	}
+}
+
+func TestMFALoginFailuresLockOut(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 2, LockoutDuration: time.Hour})
+	ctx := context.Background()
+	secret, _ := env.enableMFA(t)
+	challenge := env.mfaChallenge(t)
+	env.now = env.now.Add(totpPeriod * time.Second)
+
+	_, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, "000000", testClient)
+	wantLoginError(t, err, apperror.ErrInvalidMFACode, 0)
+	_, err = env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, "000000", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, time.Hour)
+
+	// Even the right code is refused while the account is locked
+	_, err = env.auth.CompleteMFALogin(ctx, env.alice.ID, challenge, env.totpCode(t, secret), testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, time.Hour)
+}
+
+func TestMFAChallengeEndsWithPasswordChange(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{PasswordResetTTL: time.Hour})
+	ctx := context.Background()
+	secret, _ := env.enableMFA(t)
+	env.now = env.now.Add(totpPeriod * time.Second)
+
+	// Only the latest challenge is pending
+	first := env.mfaChallenge(t)
+	second := env.mfaChallenge(t)
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, first, env.totpCode(t, secret), testClient); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("CompleteMFALogin with a replaced challenge error = %v, want unauthorized", err)
+	}
+
+	if err := env.auth.ChangePassword(ctx, env.alice.ID, "password", "new-password", testClient); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, second, env.totpCode(t, secret), testClient); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("CompleteMFALogin after a password change error = %v, want unauthorized", err)
+	}
+
+	// A reset drops the pending challenge too
+	result, err := env.auth.Login(ctx, "alice", "new-password", testClient)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := env.auth.RequestPasswordReset(ctx, "alice@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if err := env.auth.ResetPassword(ctx, env.resetToken(t), "other-password", testClient); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, err := env.auth.CompleteMFALogin(ctx, env.alice.ID, result.MFAChallenge, env.totpCode(t, secret), testClient); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("CompleteMFALogin after a password reset error = %v, want unauthorized", err)
+	}
+}
+
+func TestDisableMFAAndRegenerateRecoveryCodes(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{})
+	ctx := context.Background()
+	_, recoveryCodes := env.enableMFA(t)
+
+	response, err := env.auth.RegenerateRecoveryCodes(ctx, env.alice.ID, recoveryCodes[0], testClient)
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+
+	// The old codes are replaced
+	if err := env.auth.DisableMFA(ctx, env.alice.ID, recoveryCodes[1], testClient); !errors.Is(err, apperror.ErrInvalidMFACode) {
+		t.Errorf("DisableMFA with an old recovery code error = %v, want invalid code", err)
+	}
+	if err := env.auth.DisableMFA(ctx, env.alice.ID, response.RecoveryCodes[0], testClient); err != nil {
+		t.Fatalf("DisableMFA: %v", err)
+	}
+
+	if result, err := env.auth.Login(ctx, "alice", "password", testClient); err != nil || result.MFARequired {
+		t.Errorf("Login after disabling = %+v, %v, want a complete login", result, err)
+	}
+	if err := env.auth.DisableMFA(ctx, env.alice.ID, response.RecoveryCodes[1], testClient); !errors.Is(err, apperror.ErrMFANotEnabled) {
+		t.Errorf("DisableMFA when disabled error = %v, want not enabled", err)
+	}
+}
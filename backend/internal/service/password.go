@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ChangePassword sets a new password after checking the current one. Tokens issued before the
+// change stop working.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string, client ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// A wrong password is not reported as 401, which clients take as the session having ended
+	if _, err := s.userRepo.ValidatePassword(ctx, user.Username, currentPassword); err != nil {
+		if errors.Is(err, apperror.ErrInvalidCredentials) {
+			return apperror.ErrWrongPassword
+		}
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventPasswordChanged}, user.Username, client)
+
+	return nil
+}
+
+// RequestPasswordReset emails a single-use reset link to the user with the given address. Unknown
+// addresses are not reported, so that the response does not reveal which addresses are registered.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string, client ClientInfo) error {
+	if s.mailer == nil {
+		return apperror.ErrResetUnavailable
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		return err
+	}
+	if err := s.resetRepo.CreateResetToken(ctx, user.ID, hashResetToken(token), s.now().Add(s.policy.PasswordResetTTL)); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventResetRequested}, user.Username, client)
+
+	msg := notify.Message{
+		Title: "パスワードの再設定",
+		Body: fmt.Sprintf("%sさん、パスワードの再設定が依頼されました。\n%d分以内に次のリンクから新しいパスワードを設定してください。心当たりがない場合はこのメールを無視してください。",
+			user.Username, int(s.policy.PasswordResetTTL.Minutes())),
+		URL: strings.TrimRight(s.appURL, "/") + "/reset-password?token=" + url.QueryEscape(token),
+	}
+	recipient := notify.Recipient{UserID: user.ID, Username: user.Username, Email: *user.Email}
+	if err := s.mailer.Send(ctx, recipient, msg); err != nil {
+		// Reported like an unknown address; the user can ask again
+		s.logger.ErrorContext(ctx, "Failed to send password reset email", logging.Err(err))
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset email. It also lifts any lockout, and
+// tokens issued before the reset stop working.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string, client ClientInfo) error {
+	userID, err := s.resetRepo.ResetPassword(ctx, hashResetToken(token), newPassword, s.now())
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.recordEvent(ctx, &types.SecurityEvent{UserID: &user.ID, EventType: types.SecurityEventPasswordReset}, user.Username, client)
+
+	return nil
+}
+
+// generateResetToken returns a new random reset token, safe to use in URLs
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashResetToken hashes a reset token as stored
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
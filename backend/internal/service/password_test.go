@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// fakeMailer records the emails it is asked to send
+type fakeMailer struct {
+	sent []notify.Message
+	to   []notify.Recipient
+}
+
+func (m *fakeMailer) Channel() string { return notify.ChannelEmail }
+
+func (m *fakeMailer) Send(ctx context.Context, to notify.Recipient, msg notify.Message) error {
+	m.sent = append(m.sent, msg)
+	m.to = append(m.to, to)
+	return nil
+}
+
+// resetToken returns the token in the link of the last email sent
+func (e *authTestEnv) resetToken(t *testing.T) string {
+	t.Helper()
+
+	if len(e.mailer.sent) == 0 {
+		t.Fatal("no reset email was sent")
+	}
+	link, err := url.Parse(e.mailer.sent[len(e.mailer.sent)-1].URL)
+	if err != nil {
+		t.Fatalf("parse reset link: %v", err)
+	}
+	if link.Host != "kasaneha.example.com" || link.Path != "/reset-password" {
+		t.Errorf("reset link = %s, want the app's /reset-password page", link)
+	}
+	return link.Query().Get("token")
+}
+
+func TestChangePassword(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{})
+	ctx := context.Background()
+
+	if err := env.auth.ChangePassword(ctx, env.alice.ID, "wrong", "new-password", testClient); !errors.Is(err, apperror.ErrWrongPassword) {
+		t.Errorf("ChangePassword with a wrong password error = %v, want wrong password", err)
+	}
+	if changedAt, err := env.users.GetPasswordChangedAt(ctx, env.alice.ID); err != nil || changedAt != nil {
+		t.Errorf("password changed at = %v, %v, want never", changedAt, err)
+	}
+
+	if err := env.auth.ChangePassword(ctx, env.alice.ID, "password", "new-password", testClient); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if changedAt, err := env.users.GetPasswordChangedAt(ctx, env.alice.ID); err != nil || changedAt == nil || !changedAt.Equal(env.now) {
+		t.Errorf("password changed at = %v, %v, want %v", changedAt, err, env.now)
+	}
+
+	if _, err := env.login("password", testClient); !errors.Is(err, apperror.ErrInvalidCredentials) {
+		t.Errorf("Login with the old password error = %v, want invalid credentials", err)
+	}
+	if _, err := env.login("new-password", testClient); err != nil {
+		t.Errorf("Login with the new password: %v", err)
+	}
+
+	response, err := env.auth.GetSecurityEvents(ctx, env.alice.ID, 3)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+	if event := response.Events[2]; event.EventType != types.SecurityEventPasswordChanged {
+		t.Errorf("event = %s, want %s", event.EventType, types.SecurityEventPasswordChanged)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{LockoutThreshold: 1, LockoutDuration: time.Hour, PasswordResetTTL: time.Hour})
+	ctx := context.Background()
+
+	// Unknown addresses are not reported
+	if err := env.auth.RequestPasswordReset(ctx, "bob@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset for an unknown address: %v", err)
+	}
+	if len(env.mailer.sent) != 0 {
+		t.Fatalf("sent %d emails for an unknown address, want none", len(env.mailer.sent))
+	}
+
+	if err := env.auth.RequestPasswordReset(ctx, "alice@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if to := env.mailer.to[0]; to.UserID != env.alice.ID || to.Email != "alice@example.com" {
+		t.Errorf("reset email sent to %+v, want alice", to)
+	}
+	first := env.resetToken(t)
+
+	// A newer link replaces the first
+	if err := env.auth.RequestPasswordReset(ctx, "alice@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	second := env.resetToken(t)
+	if err := env.auth.ResetPassword(ctx, first, "new-password", testClient); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with a replaced token error = %v, want invalid token", err)
+	}
+
+	// Resetting lifts the lockout
+	_, err := env.login("wrong", testClient)
+	wantLoginError(t, err, apperror.ErrLoginThrottled, time.Hour)
+
+	if err := env.auth.ResetPassword(ctx, second, "new-password", testClient); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := env.auth.ResetPassword(ctx, second, "other-password", testClient); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword reusing a token error = %v, want invalid token", err)
+	}
+	if _, err := env.login("new-password", testClient); err != nil {
+		t.Errorf("Login with the new password: %v", err)
+	}
+	if changedAt, err := env.users.GetPasswordChangedAt(ctx, env.alice.ID); err != nil || changedAt == nil {
+		t.Errorf("password changed at = %v, %v, want the reset time", changedAt, err)
+	}
+
+	response, err := env.auth.GetSecurityEvents(ctx, env.alice.ID, 2)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+	if event := response.Events[1]; event.EventType != types.SecurityEventPasswordReset {
+		t.Errorf("event = %s, want %s", event.EventType, types.SecurityEventPasswordReset)
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{PasswordResetTTL: time.Hour})
+	ctx := context.Background()
+
+	if err := env.auth.RequestPasswordReset(ctx, "alice@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := env.resetToken(t)
+
+	env.now = env.now.Add(time.Hour)
+	if err := env.auth.ResetPassword(ctx, token, "new-password", testClient); !errors.Is(err, apperror.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with an expired token error = %v, want invalid token", err)
+	}
+	if _, err := env.login("password", testClient); err != nil {
+		t.Errorf("Login with the old password: %v", err)
+	}
+}
+
+func TestPasswordResetWithoutMailer(t *testing.T) {
+	env := newAuthTestEnv(t, LoginPolicy{PasswordResetTTL: time.Hour})
+	env.auth.SetMailer(nil, "")
+
+	if err := env.auth.RequestPasswordReset(context.Background(), "alice@example.com", testClient); !errors.Is(err, apperror.ErrResetUnavailable) {
+		t.Errorf("RequestPasswordReset without a mailer error = %v, want unavailable", err)
+	}
+}
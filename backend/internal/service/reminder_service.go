@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// ReminderService schedules daily journaling reminders and delivers them through the configured notifiers
+type ReminderService struct {
+	reminderRepo   repository.ReminderStore
+	sessionRepo    repository.SessionStore
+	userRepo       repository.UserStore
+	notifiers      *notify.Registry
+	vapidPublicKey string
+	appURL         string
+	logger         *slog.Logger
+}
+
+// Reminder defaults for users who have not configured reminders
+const (
+	defaultRemindAt         = "21:00"
+	defaultReminderTimezone = "Asia/Tokyo"
+	// reminderSendTimeout bounds delivering a single user's reminder on all channels
+	reminderSendTimeout = 30 * time.Second
+)
+
+// NewReminderService creates a new reminder service
+func NewReminderService(
+	reminderRepo repository.ReminderStore,
+	sessionRepo repository.SessionStore,
+	userRepo repository.UserStore,
+	notifiers *notify.Registry,
+	vapidPublicKey string,
+	appURL string,
+	logger *slog.Logger,
+) *ReminderService {
+	return &ReminderService{
+		reminderRepo:   reminderRepo,
+		sessionRepo:    sessionRepo,
+		userRepo:       userRepo,
+		notifiers:      notifiers,
+		vapidPublicKey: vapidPublicKey,
+		appURL:         appURL,
+		logger:         logger,
+	}
+}
+
+// GetSettings retrieves a user's reminder settings along with the channels the server supports
+func (s *ReminderService) GetSettings(ctx context.Context, userID string) (*types.ReminderSettingsResponse, error) {
+	settings, err := s.reminderRepo.GetReminderSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		settings = &types.ReminderSettings{
+			UserID:   userID,
+			Enabled:  false,
+			RemindAt: defaultRemindAt,
+			Timezone: defaultReminderTimezone,
+			Channels: []string{},
+		}
+	}
+
+	return s.settingsResponse(settings), nil
+}
+
+// UpdateSettings applies a partial update to a user's reminder settings
+func (s *ReminderService) UpdateSettings(ctx context.Context, userID string, req *types.UpdateReminderSettingsRequest) (*types.ReminderSettingsResponse, error) {
+	current, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	settings := current.Settings
+	settings.UserID = userID
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.RemindAt != nil {
+		if _, err := time.Parse("15:04", *req.RemindAt); err != nil {
+			return nil, apperror.ErrInvalidRemindAt
+		}
+		settings.RemindAt = *req.RemindAt
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			return nil, apperror.ErrInvalidTimezone
+		}
+		settings.Timezone = *req.Timezone
+	}
+	if req.Channels != nil {
+		seen := make(map[string]bool)
+		channels := []string{}
+		for _, channel := range *req.Channels {
+			if _, ok := s.notifiers.Get(channel); !ok {
+				return nil, apperror.ErrUnsupportedChannel
+			}
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+		settings.Channels = channels
+	}
+	if req.WebhookURL != nil {
+		settings.WebhookURL = emptyToNil(*req.WebhookURL)
+	}
+	if req.QuietHoursStart != nil {
+		settings.QuietHoursStart = emptyToNil(*req.QuietHoursStart)
+	}
+	if req.QuietHoursEnd != nil {
+		settings.QuietHoursEnd = emptyToNil(*req.QuietHoursEnd)
+	}
+
+	if settings.WebhookURL != nil && !netguard.CheckURL(*settings.WebhookURL) {
+		return nil, apperror.ErrInvalidWebhookURL
+	}
+	for _, channel := range settings.Channels {
+		if channel == notify.ChannelWebhook && settings.WebhookURL == nil {
+			return nil, apperror.ErrInvalidWebhookURL
+		}
+	}
+	if (settings.QuietHoursStart == nil) != (settings.QuietHoursEnd == nil) {
+		return nil, apperror.ErrInvalidQuietHours
+	}
+	for _, value := range []*string{settings.QuietHoursStart, settings.QuietHoursEnd} {
+		if value == nil {
+			continue
+		}
+		if _, err := time.Parse("15:04", *value); err != nil {
+			return nil, apperror.ErrInvalidQuietHours
+		}
+	}
+
+	saved, err := s.reminderRepo.UpsertReminderSettings(ctx, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.settingsResponse(saved), nil
+}
+
+// SubscribePush registers a browser for Web Push reminders
+func (s *ReminderService) SubscribePush(ctx context.Context, userID string, req *types.PushSubscriptionRequest) (*types.PushSubscription, error) {
+	if _, ok := s.notifiers.Get(notify.ChannelPush); !ok {
+		return nil, apperror.ErrUnsupportedChannel
+	}
+
+	// The scheduler posts to the endpoint, so it must not point into the server's network
+	if !netguard.CheckURL(req.Endpoint) || req.Keys.P256dh == "" || req.Keys.Auth == "" {
+		return nil, apperror.ErrInvalidSubscription
+	}
+
+	return s.reminderRepo.SavePushSubscription(ctx, userID, req.Endpoint, req.Keys.P256dh, req.Keys.Auth)
+}
+
+// UnsubscribePush removes a browser's Web Push subscription
+func (s *ReminderService) UnsubscribePush(ctx context.Context, userID, endpoint string) error {
+	return s.reminderRepo.DeletePushSubscription(ctx, userID, endpoint)
+}
+
+// RunScheduler checks for due reminders every interval until ctx is cancelled
+func (s *ReminderService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.SendDueReminders(ctx, now); err != nil {
+				s.logger.ErrorContext(ctx, "Failed to send reminders", logging.Err(err))
+			}
+		}
+	}
+}
+
+// SendDueReminders sends the reminders whose local time has passed today and returns how many were sent
+func (s *ReminderService) SendDueReminders(ctx context.Context, now time.Time) (int, error) {
+	settingsList, err := s.reminderRepo.GetEnabledReminderSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, settings := range settingsList {
+		location, err := time.LoadLocation(settings.Timezone)
+		if err != nil {
+			continue
+		}
+		local := now.In(location)
+		localDate := local.Format("2006-01-02")
+
+		if !isReminderDue(local, &settings) {
+			continue
+		}
+
+		// Quiet hours postpone the reminder until they end, as long as it is still the same day
+		if inQuietHours(local, settings.QuietHoursStart, settings.QuietHoursEnd) {
+			continue
+		}
+
+		userCtx := logging.WithUserID(ctx, settings.UserID)
+
+		// Nothing to remind about if the user already wrote today. Sessions are dated in JST, so the
+		// user's local day is checked by message time instead.
+		startOfDay := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+		hasMessages, err := s.sessionRepo.HasUserMessagesSince(userCtx, settings.UserID, startOfDay)
+		if err != nil {
+			s.logger.ErrorContext(userCtx, "Failed to check today's session", logging.Err(err))
+			continue
+		}
+
+		claimed, err := s.reminderRepo.ClaimReminder(userCtx, settings.UserID, localDate)
+		if err != nil {
+			s.logger.ErrorContext(userCtx, "Failed to claim reminder", logging.Err(err))
+			continue
+		}
+		if !claimed || hasMessages {
+			continue
+		}
+
+		if err := s.sendReminder(userCtx, &settings); err != nil {
+			s.logger.WarnContext(userCtx, "Failed to send reminder", logging.Err(err))
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// sendReminder delivers a reminder on each of the user's channels; it fails only if no channel succeeded
+func (s *ReminderService) sendReminder(ctx context.Context, settings *types.ReminderSettings) error {
+	ctx, cancel := context.WithTimeout(ctx, reminderSendTimeout)
+	defer cancel()
+
+	user, err := s.userRepo.GetUserByID(ctx, settings.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	recipient := notify.Recipient{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+	if user.Email != nil {
+		recipient.Email = *user.Email
+	}
+	if settings.WebhookURL != nil {
+		recipient.WebhookURL = *settings.WebhookURL
+	}
+
+	subscriptions, err := s.reminderRepo.GetPushSubscriptions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		recipient.PushSubscriptions = append(recipient.PushSubscriptions, notify.PushSubscription{
+			Endpoint: subscription.Endpoint,
+			P256dh:   subscription.P256dh,
+			Auth:     subscription.Auth,
+		})
+	}
+
+	msg := notify.Message{
+		Title: "今日の日記を書きませんか？",
+		Body:  fmt.Sprintf("%sさん、今日はどんな一日でしたか？かさねとお話ししましょう📝", user.Username),
+		URL:   s.appURL,
+	}
+
+	delivered := 0
+	var lastErr error
+	for _, channel := range settings.Channels {
+		notifier, ok := s.notifiers.Get(channel)
+		if !ok {
+			continue
+		}
+
+		err := notifier.Send(ctx, recipient, msg)
+		var expired *notify.ExpiredSubscriptionsError
+		switch {
+		case err == nil:
+			delivered++
+		case errors.Is(err, notify.ErrNoAddress):
+			// The user enabled a channel without an address (e.g. no email); nothing to do
+		case errors.As(err, &expired):
+			if err := s.reminderRepo.DeletePushSubscriptionsByEndpoint(ctx, expired.Endpoints); err != nil {
+				s.logger.ErrorContext(ctx, "Failed to remove expired push subscriptions", logging.Err(err))
+			}
+			if len(expired.Endpoints) < len(recipient.PushSubscriptions) {
+				delivered++
+			}
+		default:
+			lastErr = fmt.Errorf("%s: %w", channel, err)
+		}
+	}
+
+	if delivered == 0 && lastErr != nil {
+		return lastErr
+	}
+
+	return nil
+}
+
+func (s *ReminderService) settingsResponse(settings *types.ReminderSettings) *types.ReminderSettingsResponse {
+	response := &types.ReminderSettingsResponse{
+		Settings:          *settings,
+		AvailableChannels: s.notifiers.Channels(),
+	}
+	if _, ok := s.notifiers.Get(notify.ChannelPush); ok {
+		response.VAPIDPublicKey = s.vapidPublicKey
+	}
+	return response
+}
+
+// isReminderDue reports whether today's reminder time has passed and it has not been handled yet
+func isReminderDue(local time.Time, settings *types.ReminderSettings) bool {
+	remindAt, err := time.Parse("15:04", settings.RemindAt)
+	if err != nil {
+		return false
+	}
+
+	localDate := local.Format("2006-01-02")
+	if settings.LastRemindedOn != nil && *settings.LastRemindedOn >= localDate {
+		return false
+	}
+
+	minutes := local.Hour()*60 + local.Minute()
+	return minutes >= remindAt.Hour()*60+remindAt.Minute()
+}
+
+// inQuietHours reports whether local falls within [start, end), which may wrap past midnight
+func inQuietHours(local time.Time, start, end *string) bool {
+	if start == nil || end == nil {
+		return false
+	}
+
+	startTime, err1 := time.Parse("15:04", *start)
+	endTime, err2 := time.Parse("15:04", *end)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	minutes := local.Hour()*60 + local.Minute()
+	startMinutes := startTime.Hour()*60 + startTime.Minute()
+	endMinutes := endTime.Hour()*60 + endTime.Minute()
+
+	if startMinutes <= endMinutes {
+		return minutes >= startMinutes && minutes < endMinutes
+	}
+	return minutes >= startMinutes || minutes < endMinutes
+}
+
+func emptyToNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
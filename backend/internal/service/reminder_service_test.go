@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/notify"
+	"github.com/trasta298/kasaneha/backend/internal/repository/memory"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+func TestIsReminderDue(t *testing.T) {
+	yesterday, today := "2026-03-09", "2026-03-10"
+	tests := []struct {
+		name           string
+		local          string
+		remindAt       string
+		lastRemindedOn *string
+		want           bool
+	}{
+		{"before the reminder time", "20:59", "21:00", nil, false},
+		{"at the reminder time", "21:00", "21:00", nil, true},
+		{"later in the evening", "23:30", "21:00", &yesterday, true},
+		{"already reminded today", "21:30", "21:00", &today, false},
+		{"early morning reminder", "07:05", "07:00", &yesterday, true},
+		{"malformed reminder time", "21:30", "9pm", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, err := time.Parse("2006-01-02 15:04", today+" "+tt.local)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			settings := &types.ReminderSettings{RemindAt: tt.remindAt, LastRemindedOn: tt.lastRemindedOn}
+			if got := isReminderDue(local, settings); got != tt.want {
+				t.Errorf("isReminderDue(%s) = %v, want %v", tt.local, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		local      string
+		start, end string
+		want       bool
+	}{
+		{"inside a daytime range", "13:00", "12:00", "14:00", true},
+		{"at the start", "12:00", "12:00", "14:00", true},
+		{"at the end", "14:00", "12:00", "14:00", false},
+		{"outside a daytime range", "21:00", "12:00", "14:00", false},
+		{"before midnight in a wrapping range", "23:30", "22:00", "07:00", true},
+		{"after midnight in a wrapping range", "06:59", "22:00", "07:00", true},
+		{"outside a wrapping range", "07:00", "22:00", "07:00", false},
+		{"empty range", "10:00", "10:00", "10:00", false},
+		{"malformed range", "10:00", "late", "07:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, err := time.Parse("15:04", tt.local)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := inQuietHours(local, &tt.start, &tt.end); got != tt.want {
+				t.Errorf("inQuietHours(%s, %s-%s) = %v, want %v", tt.local, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+
+	if inQuietHours(time.Now(), nil, nil) {
+		t.Error("inQuietHours without quiet hours = true")
+	}
+}
+
+func TestUpdateReminderSettingsRejectsInternalWebhookURLs(t *testing.T) {
+	store := memory.NewStore()
+	reminders := NewReminderService(
+		memory.NewReminderRepository(store),
+		memory.NewSessionRepository(store),
+		memory.NewUserRepository(store),
+		notify.NewRegistry(notify.NewWebhookNotifier()),
+		"",
+		"https://kasaneha.example.com",
+		logging.Discard(),
+	)
+	ctx := context.Background()
+	channels := []string{notify.ChannelWebhook}
+
+	for _, url := range []string{"http://hooks.example.com/remind", "https://127.0.0.1/remind", "https://[::1]/remind", "https://169.254.169.254/latest", "https://192.168.1.10/remind"} {
+		_, err := reminders.UpdateSettings(ctx, "user-1", &types.UpdateReminderSettingsRequest{Channels: &channels, WebhookURL: &url})
+		if !errors.Is(err, apperror.ErrInvalidWebhookURL) {
+			t.Errorf("UpdateSettings(%s) error = %v, want invalid webhook URL", url, err)
+		}
+	}
+
+	url := "https://hooks.example.com/remind"
+	response, err := reminders.UpdateSettings(ctx, "user-1", &types.UpdateReminderSettingsRequest{Channels: &channels, WebhookURL: &url})
+	if err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if response.Settings.WebhookURL == nil || *response.Settings.WebhookURL != url {
+		t.Errorf("webhook URL = %v, want %s", response.Settings.WebhookURL, url)
+	}
+}
+
+func TestSubscribePushRejectsInternalEndpoints(t *testing.T) {
+	store := memory.NewStore()
+	reminders := NewReminderService(
+		memory.NewReminderRepository(store),
+		memory.NewSessionRepository(store),
+		memory.NewUserRepository(store),
+		notify.NewRegistry(notify.NewWebPushNotifier(notify.WebPushConfig{})),
+		"",
+		"https://kasaneha.example.com",
+		logging.Discard(),
+	)
+	ctx := context.Background()
+	request := func(endpoint string) *types.PushSubscriptionRequest {
+		req := &types.PushSubscriptionRequest{Endpoint: endpoint}
+		req.Keys.P256dh, req.Keys.Auth = "p256dh", "auth"
+		return req
+	}
+
+	for _, endpoint := range []string{"http://push.example.com/send", "https://127.0.0.1/send", "https://10.0.0.5/send", "https://169.254.169.254/latest", "https://[fd00::1]/send", "https://localhost/send"} {
+		if _, err := reminders.SubscribePush(ctx, "user-1", request(endpoint)); !errors.Is(err, apperror.ErrInvalidSubscription) {
+			t.Errorf("SubscribePush(%s) error = %v, want invalid subscription", endpoint, err)
+		}
+	}
+
+	subscription, err := reminders.SubscribePush(ctx, "user-1", request("https://fcm.googleapis.com/fcm/send/abc"))
+	if err != nil {
+		t.Fatalf("SubscribePush: %v", err)
+	}
+	if subscription.Endpoint != "https://fcm.googleapis.com/fcm/send/abc" {
+		t.Errorf("endpoint = %s, want the push service's", subscription.Endpoint)
+	}
+}
+
+func TestSendDueRemindersUsesTheUsersLocalDay(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("LoadLocation: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		wroteAt     time.Time
+		remindAt    string
+		checkedAt   time.Time
+		wantSending bool
+	}{
+		// 09:00 in New York is 23:00 JST; by the evening reminder it is the next day in JST
+		{"wrote this morning", time.Date(2026, 3, 10, 9, 0, 0, 0, newYork), "21:00", time.Date(2026, 3, 10, 21, 30, 0, 0, newYork), false},
+		// 22:30 the evening before is already the reminder's day in JST
+		{"wrote last night", time.Date(2026, 3, 9, 22, 30, 0, 0, newYork), "07:00", time.Date(2026, 3, 10, 7, 5, 0, 0, newYork), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.NewStore()
+			mailer := &fakeMailer{}
+			users := memory.NewUserRepository(store)
+			sessions := memory.NewSessionRepository(store)
+			reminderRepo := memory.NewReminderRepository(store)
+			reminders := NewReminderService(reminderRepo, sessions, users, notify.NewRegistry(mailer), "", "https://kasaneha.example.com", logging.Discard())
+
+			user, err := users.CreateUser(ctx, &types.RegisterRequest{Username: "alice", Password: "password"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			store.Now = func() time.Time { return tt.wroteAt }
+			session, err := sessions.CreateSession(ctx, user.ID, tt.wroteAt.In(timeutil.JST).Format("2006-01-02"))
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if _, err := memory.NewMessageRepository(store).CreateMessage(ctx, session.ID, types.SenderUser, "楽しかった", nil); err != nil {
+				t.Fatalf("CreateMessage: %v", err)
+			}
+
+			_, err = reminderRepo.UpsertReminderSettings(ctx, &types.ReminderSettings{
+				UserID:   user.ID,
+				Enabled:  true,
+				RemindAt: tt.remindAt,
+				Timezone: "America/New_York",
+				Channels: []string{notify.ChannelEmail},
+			})
+			if err != nil {
+				t.Fatalf("UpsertReminderSettings: %v", err)
+			}
+
+			sent, err := reminders.SendDueReminders(ctx, tt.checkedAt)
+			if err != nil {
+				t.Fatalf("SendDueReminders: %v", err)
+			}
+			if got := sent == 1 && len(mailer.sent) == 1; got != tt.wantSending {
+				t.Errorf("sent %d reminders, want reminding = %v", sent, tt.wantSending)
+			}
+		})
+	}
+}
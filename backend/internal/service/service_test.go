@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/repository/memory"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"google.golang.org/genai"
+)
+
+// testEnv wires the chat and analysis services to in-memory repositories and the fake AI provider
+type testEnv struct {
+	store    *memory.Store
+	users    *memory.UserRepository
+	sessions *memory.SessionRepository
+	messages *memory.MessageRepository
+	analyses *memory.AnalysisRepository
+	provider *switchableProvider
+	tx       *faultyTxManager
+	chat     *ChatService
+	analysis *AnalysisService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.NewStore()
+	env := &testEnv{
+		store:    store,
+		users:    memory.NewUserRepository(store),
+		sessions: memory.NewSessionRepository(store),
+		messages: memory.NewMessageRepository(store),
+		analyses: memory.NewAnalysisRepository(store),
+		provider: &switchableProvider{Provider: ai.NewFakeProvider()},
+	}
+
+	taxonomy, err := ai.LookupEmotionTaxonomy("")
+	if err != nil {
+		t.Fatalf("LookupEmotionTaxonomy: %v", err)
+	}
+
+	aiClient := ai.NewClientWithProvider(env.provider, ai.FakeProviderModel, ai.Options{}, logger)
+	env.tx = &faultyTxManager{TxManager: memory.NewTxManager(store)}
+	env.chat = NewChatService(env.tx, env.sessions, env.messages, env.users, aiClient, nil, logger)
+	env.analysis = NewAnalysisService(env.tx, env.analyses, env.sessions, env.messages, env.users, aiClient, taxonomy, logger)
+	env.chat.SetAnalysisService(env.analysis)
+
+	return env
+}
+
+// createUser registers a user and returns its ID
+func (e *testEnv) createUser(t *testing.T, username string) string {
+	t.Helper()
+
+	user, err := e.users.CreateUser(context.Background(), &types.RegisterRequest{Username: username, Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+// startSession opens today's session for the user
+func (e *testEnv) startSession(t *testing.T, userID string) *types.ChatSession {
+	t.Helper()
+
+	session, _, err := e.chat.GetTodaySession(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetTodaySession: %v", err)
+	}
+	return session
+}
+
+// send posts user messages to a session and fails the test if a reply could not be generated
+func (e *testEnv) send(t *testing.T, userID, sessionID string, contents ...string) {
+	t.Helper()
+
+	for _, content := range contents {
+		response, err := e.chat.SendMessage(context.Background(), userID, sessionID, content)
+		if err != nil {
+			t.Fatalf("SendMessage(%q): %v", content, err)
+		}
+		if response.ReplyFailed {
+			t.Fatalf("SendMessage(%q): reply failed", content)
+		}
+	}
+}
+
+// switchableProvider passes calls to the fake provider until it is told to fail like an unavailable Gemini
+type switchableProvider struct {
+	ai.Provider
+	mu          sync.Mutex
+	unavailable bool
+}
+
+func (p *switchableProvider) setUnavailable(unavailable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unavailable = unavailable
+}
+
+// GenerateContent implements ai.Provider
+func (p *switchableProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	p.mu.Lock()
+	unavailable := p.unavailable
+	p.mu.Unlock()
+
+	if unavailable {
+		return nil, genai.APIError{Code: http.StatusServiceUnavailable, Message: "unavailable"}
+	}
+	return p.Provider.GenerateContent(ctx, model, contents, config)
+}
+
+// errInjected is returned by repositories a test made fail
+var errInjected = errors.New("injected failure")
+
+// faultyTxManager lets a test replace the repositories of units of work
+type faultyTxManager struct {
+	repository.TxManager
+	wrap func(tx repository.Repos) repository.Repos
+}
+
+// WithTx implements repository.TxManager
+func (m *faultyTxManager) WithTx(ctx context.Context, fn func(tx repository.Repos) error) error {
+	return m.TxManager.WithTx(ctx, func(tx repository.Repos) error {
+		if m.wrap != nil {
+			tx = m.wrap(tx)
+		}
+		return fn(tx)
+	})
+}
+
+// failingMessages fails to create messages
+type failingMessages struct {
+	repository.MessageStore
+}
+
+func (failingMessages) CreateMessage(ctx context.Context, sessionID, sender, content string, metadata map[string]interface{}) (*types.Message, error) {
+	return nil, errInjected
+}
+
+// failingSessions fails to complete sessions
+type failingSessions struct {
+	repository.SessionStore
+}
+
+func (failingSessions) CompleteSession(ctx context.Context, sessionID string) error {
+	return errInjected
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/ai"
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// UsageService records AI token usage and enforces per-user token quotas
+type UsageService struct {
+	usageRepo repository.UsageStore
+	userRepo  repository.UserStore
+	// dailyLimit and monthlyLimit are the default quotas in tokens; 0 means unlimited
+	dailyLimit   int64
+	monthlyLimit int64
+	logger       *slog.Logger
+}
+
+// usageReportMaxDays bounds the date range of the admin usage report
+const usageReportMaxDays = 366
+
+// NewUsageService creates a new usage service
+func NewUsageService(
+	usageRepo repository.UsageStore,
+	userRepo repository.UserStore,
+	dailyLimit int64,
+	monthlyLimit int64,
+	logger *slog.Logger,
+) *UsageService {
+	return &UsageService{
+		usageRepo:    usageRepo,
+		userRepo:     userRepo,
+		dailyLimit:   dailyLimit,
+		monthlyLimit: monthlyLimit,
+		logger:       logger,
+	}
+}
+
+// RecordUsage stores the token usage of a Gemini call; it implements ai.UsageRecorder.
+// Failures are logged so that accounting never breaks the call itself.
+func (s *UsageService) RecordUsage(ctx context.Context, usage ai.Usage) {
+	record := &types.AIUsage{
+		Operation:      usage.Operation,
+		Model:          usage.Model,
+		PromptTokens:   usage.PromptTokens,
+		OutputTokens:   usage.OutputTokens,
+		ThoughtsTokens: usage.ThoughtsTokens,
+	}
+	if usage.UserID != "" {
+		record.UserID = &usage.UserID
+	}
+	if usage.SessionID != "" {
+		record.SessionID = &usage.SessionID
+	}
+
+	if err := s.usageRepo.CreateUsage(ctx, record); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record AI usage", slog.String("operation", usage.Operation), logging.Err(err))
+	}
+}
+
+// GetQuotaStatus returns a user's token usage for today and this month (JST) against their quotas
+func (s *UsageService) GetQuotaStatus(ctx context.Context, userID string) (*types.AIQuotaStatus, error) {
+	status := &types.AIQuotaStatus{
+		DailyLimit:   s.dailyLimit,
+		MonthlyLimit: s.monthlyLimit,
+	}
+
+	quota, err := s.usageRepo.GetQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		if quota.DailyTokens != nil {
+			status.DailyLimit = *quota.DailyTokens
+		}
+		if quota.MonthlyTokens != nil {
+			status.MonthlyLimit = *quota.MonthlyTokens
+		}
+	}
+
+	now := timeutil.NowJST()
+	status.DailyUsed, err = s.usageRepo.SumUserTokens(ctx, userID, timeutil.BeginningOfDayJST(now))
+	if err != nil {
+		return nil, err
+	}
+	status.MonthlyUsed, err = s.usageRepo.SumUserTokens(ctx, userID, timeutil.BeginningOfMonthJST(now))
+	if err != nil {
+		return nil, err
+	}
+
+	status.Exceeded = (status.DailyLimit > 0 && status.DailyUsed >= status.DailyLimit) ||
+		(status.MonthlyLimit > 0 && status.MonthlyUsed >= status.MonthlyLimit)
+
+	return status, nil
+}
+
+// QuotaExceeded reports whether the user has used up their daily or monthly quota.
+// If usage cannot be checked the user is given the benefit of the doubt.
+func (s *UsageService) QuotaExceeded(ctx context.Context, userID string) bool {
+	status, err := s.GetQuotaStatus(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to check AI quota", logging.Err(err))
+		return false
+	}
+	return status.Exceeded
+}
+
+// GetUserUsage returns a user's token usage for the current month (JST) by operation
+func (s *UsageService) GetUserUsage(ctx context.Context, userID string) (*types.AIUsageResponse, error) {
+	quota, err := s.GetQuotaStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	monthStart := timeutil.BeginningOfMonthJST(timeutil.NowJST())
+	operations, err := s.usageRepo.GetUserUsageByOperation(ctx, userID, monthStart, monthStart.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.AIUsageResponse{
+		Month:      monthStart.Format("2006-01"),
+		Quota:      *quota,
+		Operations: operations,
+	}, nil
+}
+
+// GetUsageReport returns every user's token usage between two JST dates (inclusive)
+func (s *UsageService) GetUsageReport(ctx context.Context, from, to string) (*types.AIUsageReportResponse, error) {
+	fromDate, err := timeutil.ParseDateInJST("2006-01-02", from)
+	if err != nil {
+		return nil, apperror.ErrInvalidDateRange
+	}
+	toDate, err := timeutil.ParseDateInJST("2006-01-02", to)
+	if err != nil {
+		return nil, apperror.ErrInvalidDateRange
+	}
+	if toDate.Before(fromDate) {
+		return nil, apperror.ErrInvalidDateRange
+	}
+	if toDate.Sub(fromDate) > usageReportMaxDays*24*time.Hour {
+		return nil, apperror.ErrInvalidDateRange.WithDetails([]types.FieldError{
+			{Field: "to", In: "query", Message: fmt.Sprintf("must be at most %d days after from", usageReportMaxDays)},
+		})
+	}
+
+	users, totals, err := s.usageRepo.GetUsageReport(ctx, fromDate, toDate.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.AIUsageReportResponse{
+		From:   from,
+		To:     to,
+		Totals: totals,
+		Users:  users,
+	}, nil
+}
+
+// UpdateQuota overrides a user's token quotas; nil values restore the server defaults
+func (s *UsageService) UpdateQuota(ctx context.Context, userID string, req *types.UpdateAIQuotaRequest) (*types.AIQuota, error) {
+	if (req.DailyTokens != nil && *req.DailyTokens < 0) || (req.MonthlyTokens != nil && *req.MonthlyTokens < 0) {
+		return nil, apperror.ErrInvalidQuota
+	}
+
+	// Make sure the user exists so that a typo does not create a dangling override
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.usageRepo.UpsertQuota(ctx, userID, req.DailyTokens, req.MonthlyTokens)
+}
+
+// IsAdmin reports whether the user may access admin endpoints
+func (s *UsageService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	return s.userRepo.IsAdmin(ctx, userID)
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/trasta298/kasaneha/backend/internal/apperror"
+	"github.com/trasta298/kasaneha/backend/internal/logging"
+	"github.com/trasta298/kasaneha/backend/internal/netguard"
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+	"github.com/trasta298/kasaneha/backend/pkg/timeutil"
+)
+
+// WebhookService manages user webhooks and delivers signed events to them
+type WebhookService struct {
+	webhookRepo repository.WebhookStore
+	client      *http.Client
+	logger      *slog.Logger
+	// wake nudges the delivery worker when new events are queued
+	wake chan struct{}
+}
+
+// Webhook delivery settings
+const (
+	// maxWebhooksPerUser limits how many webhooks a user can register
+	maxWebhooksPerUser = 10
+	// webhookRequestTimeout bounds a single delivery attempt
+	webhookRequestTimeout = 10 * time.Second
+	// webhookMaxAttempts is how many times a delivery is tried before it is marked as failed
+	webhookMaxAttempts = 8
+	// webhookRetryBase is the delay before the first retry; it doubles with every attempt
+	webhookRetryBase = 30 * time.Second
+	// webhookRetryMax caps the delay between attempts
+	webhookRetryMax = time.Hour
+	// webhookClaimLease is how long a claimed delivery is hidden from other workers
+	webhookClaimLease = 2 * time.Minute
+	// webhookBatchSize is how many deliveries the worker sends per poll
+	webhookBatchSize = 20
+	// webhookDrainLimit is how much of a receiver's response is read before the connection is reused
+	webhookDrainLimit = 4096
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookSignatureHeader = "X-Kasaneha-Signature"
+	WebhookEventHeader     = "X-Kasaneha-Event"
+	WebhookDeliveryHeader  = "X-Kasaneha-Delivery"
+)
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(webhookRepo repository.WebhookStore, logger *slog.Logger) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		client:      netguard.NewClient(webhookRequestTimeout),
+		logger:      logger,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// CreateWebhook registers a webhook and returns it with its signing secret
+func (s *WebhookService) CreateWebhook(ctx context.Context, userID string, req *types.CreateWebhookRequest) (*types.Webhook, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.webhookRepo.CountWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooksPerUser {
+		return nil, apperror.ErrWebhookLimitReached
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.webhookRepo.CreateWebhook(ctx, userID, req.URL, secret, events, req.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret is shown once; receivers need it to verify signatures
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// GetWebhooks retrieves a user's webhooks
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID string) (*types.WebhooksResponse, error) {
+	webhooks, err := s.webhookRepo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebhooksResponse{Webhooks: webhooks}, nil
+}
+
+// UpdateWebhook applies a partial update to a webhook
+func (s *WebhookService) UpdateWebhook(ctx context.Context, userID, webhookID string, req *types.UpdateWebhookRequest) (*types.Webhook, error) {
+	webhook, err := s.webhookRepo.GetWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, apperror.ErrWebhookNotFound
+	}
+
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		webhook.URL = *req.URL
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(*req.Events)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = events
+	}
+	if req.Description != nil {
+		webhook.Description = emptyToNil(*req.Description)
+	}
+	if req.IsActive != nil {
+		webhook.IsActive = *req.IsActive
+	}
+
+	return s.webhookRepo.UpdateWebhook(ctx, webhook)
+}
+
+// DeleteWebhook removes a webhook
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	return s.webhookRepo.DeleteWebhook(ctx, userID, webhookID)
+}
+
+// GetDeliveries retrieves the delivery log of a user's webhook
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID, status string, limit int) (*types.WebhookDeliveriesResponse, error) {
+	webhook, err := s.webhookRepo.GetWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, apperror.ErrWebhookNotFound
+	}
+
+	switch status {
+	case "", types.WebhookDeliveryPending, types.WebhookDeliverySucceeded, types.WebhookDeliveryFailed:
+	default:
+		return nil, apperror.ErrInvalidDeliveryStatus
+	}
+
+	deliveries, err := s.webhookRepo.GetDeliveries(ctx, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebhookDeliveriesResponse{Deliveries: deliveries}, nil
+}
+
+// RedeliverDelivery queues a logged delivery to be sent again right away
+func (s *WebhookService) RedeliverDelivery(ctx context.Context, userID, webhookID, deliveryID string) error {
+	if err := s.webhookRepo.RetryDelivery(ctx, userID, webhookID, deliveryID); err != nil {
+		return err
+	}
+
+	s.notifyWorker()
+	return nil
+}
+
+// Emit queues an event for every active webhook of the user subscribed to it.
+// Delivery happens in the background, so callers only need to log the returned error.
+func (s *WebhookService) Emit(ctx context.Context, userID, eventType string, data interface{}) error {
+	webhookIDs, err := s.webhookRepo.GetWebhookIDsForEvent(ctx, userID, eventType)
+	if err != nil {
+		return err
+	}
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	eventID, err := newEventID()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(types.WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: timeutil.NowJST(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	for _, webhookID := range webhookIDs {
+		if err := s.webhookRepo.CreateDelivery(ctx, webhookID, eventID, eventType, payload); err != nil {
+			return err
+		}
+	}
+
+	s.notifyWorker()
+	return nil
+}
+
+// RunDeliveryWorker sends due deliveries every interval, or as soon as new events are queued, until ctx is cancelled
+func (s *WebhookService) RunDeliveryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		if _, err := s.DeliverDue(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to deliver webhooks", logging.Err(err))
+		}
+	}
+}
+
+// DeliverDue sends the deliveries whose next attempt is due and returns how many succeeded
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	succeeded := 0
+	for {
+		tasks, err := s.webhookRepo.ClaimDueDeliveries(ctx, webhookBatchSize, webhookClaimLease)
+		if err != nil {
+			return succeeded, err
+		}
+
+		for _, task := range tasks {
+			if s.deliver(ctx, &task) {
+				succeeded++
+			}
+		}
+
+		if len(tasks) < webhookBatchSize {
+			return succeeded, nil
+		}
+	}
+}
+
+// deliver makes one delivery attempt and records the outcome, scheduling a retry on failure
+func (s *WebhookService) deliver(ctx context.Context, task *types.WebhookDeliveryTask) bool {
+	delivery := &task.Delivery
+	statusCode, sendErr := s.send(ctx, task)
+
+	if sendErr == nil {
+		if err := s.webhookRepo.MarkDeliverySucceeded(ctx, delivery.ID, statusCode); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to record webhook delivery", slog.String("delivery_id", delivery.ID), logging.Err(err))
+		}
+		return true
+	}
+
+	var responseStatus *int
+	if statusCode != 0 {
+		responseStatus = &statusCode
+	}
+
+	var nextAttemptAt *time.Time
+	if delivery.Attempts < webhookMaxAttempts {
+		next := time.Now().Add(webhookRetryDelay(delivery.Attempts))
+		nextAttemptAt = &next
+	} else {
+		s.logger.WarnContext(ctx, "Webhook delivery failed permanently",
+			slog.String("delivery_id", delivery.ID),
+			slog.Int("attempts", delivery.Attempts),
+			logging.Err(sendErr),
+		)
+	}
+
+	if err := s.webhookRepo.MarkDeliveryFailed(ctx, delivery.ID, responseStatus, sendErr.Error(), nextAttemptAt); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record webhook delivery", slog.String("delivery_id", delivery.ID), logging.Err(err))
+	}
+	return false
+}
+
+// send posts the signed payload and returns the response status. The response body is not kept,
+// so that receivers' responses are never shown to users.
+func (s *WebhookService) send(ctx context.Context, task *types.WebhookDeliveryTask) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(task.Delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Kasaneha-Webhook/1.0")
+	req.Header.Set(WebhookEventHeader, task.Delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, task.Delivery.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(task.Secret, timestamp, task.Delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Draining lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookDrainLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookService) notifyWorker() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SignWebhookPayload computes the signature header value for a payload: "t=<unix time>,v1=<hex HMAC-SHA256>".
+// The HMAC is taken over "<unix time>.<payload>" with the webhook's secret, so receivers can reject replays.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay returns the delay after the given number of failed attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookRetryMax {
+			return webhookRetryMax
+		}
+	}
+	return delay
+}
+
+// validateWebhookURL requires an https URL that does not point at an internal address; names are
+// checked again when deliveries connect
+func validateWebhookURL(rawURL string) error {
+	if !netguard.CheckURL(rawURL) {
+		return apperror.ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// normalizeWebhookEvents validates event types and removes duplicates
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, apperror.ErrUnsupportedEvent
+	}
+
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, event := range events {
+		supported := false
+		for _, eventType := range types.WebhookEventTypes {
+			if event == eventType {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, apperror.ErrUnsupportedEvent
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+
+	return normalized, nil
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// newEventID returns a random UUID (version 4) identifying an event across its deliveries
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate event id: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,76 @@
+package pgtest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/trasta298/kasaneha/backend/internal/repository"
+	"github.com/trasta298/kasaneha/backend/internal/types"
+)
+
+// Password is the password of users created by User
+const Password = "password123"
+
+// User creates an active user with the given username and Password
+func User(t testing.TB, db *repository.Database, username string) *types.User {
+	t.Helper()
+
+	user, err := repository.NewUserRepository(db).CreateUser(context.Background(), &types.RegisterRequest{
+		Username: username,
+		Password: Password,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+// Session creates an active session for the user on the given date (YYYY-MM-DD)
+func Session(t testing.TB, db *repository.Database, userID, date string) *types.ChatSession {
+	t.Helper()
+
+	session, err := repository.NewSessionRepository(db).CreateSession(context.Background(), userID, date)
+	if err != nil {
+		t.Fatalf("failed to create session on %s: %v", date, err)
+	}
+	return session
+}
+
+// Messages adds messages to a session, alternating between the user and the AI starting with the user
+func Messages(t testing.TB, db *repository.Database, sessionID string, contents ...string) []types.Message {
+	t.Helper()
+
+	messageRepo := repository.NewMessageRepository(db)
+	messages := make([]types.Message, 0, len(contents))
+	for i, content := range contents {
+		sender := types.SenderUser
+		if i%2 == 1 {
+			sender = types.SenderAI
+		}
+		message, err := messageRepo.CreateMessage(context.Background(), sessionID, sender, content, nil)
+		if err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+		messages = append(messages, *message)
+	}
+	return messages
+}
+
+// Analysis stores an analysis of a session with the given tension score
+func Analysis(t testing.TB, db *repository.Database, sessionID string, tensionScore int) *types.Analysis {
+	t.Helper()
+
+	analysis, err := repository.NewAnalysisRepository(db).CreateAnalysis(context.Background(), &types.Analysis{
+		SessionID:          sessionID,
+		Summary:            "穏やかな一日",
+		EmotionalState:     json.RawMessage(`{"primary_emotion": "joy", "emotions": {"joy": 0.6, "anxiety": 0.2}}`),
+		BehavioralInsights: json.RawMessage(`{}`),
+		TensionScore:       tensionScore,
+		Keywords:           json.RawMessage(`["散歩", "カフェ"]`),
+	})
+	if err != nil {
+		t.Fatalf("failed to create analysis: %v", err)
+	}
+	return analysis
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer creates a client span for every pgx query; set it as the pool's ConnConfig.Tracer.
+// Only the SQL text is recorded, never the arguments, since they contain diary content.
+type QueryTracer struct{}
+
+// NewQueryTracer creates a new pgx query tracer
+func NewQueryTracer() *QueryTracer {
+	return &QueryTracer{}
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := sqlOperation(data.SQL)
+	ctx, _ = Start(ctx, "postgresql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+	if conn != nil {
+		config := conn.Config()
+		trace.SpanFromContext(ctx).SetAttributes(
+			semconv.DBNamespace(config.Database),
+			semconv.ServerAddress(config.Host),
+			semconv.ServerPort(int(config.Port)),
+		)
+	}
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	// "no rows" is an expected outcome for lookups, not a failure
+	if data.Err != nil && data.Err != pgx.ErrNoRows {
+		RecordError(span, data.Err)
+		return
+	}
+	span.SetAttributes(rowsAffectedKey.Int64(data.CommandTag.RowsAffected()))
+}
+
+// sqlOperation returns the leading keyword of a statement, e.g. SELECT or INSERT
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -68,19 +68,110 @@ type UserStatistics struct {
 
 // EmotionalState represents the emotional analysis result
 type EmotionalState struct {
+	Taxonomy       string             `json:"taxonomy,omitempty"`
 	PrimaryEmotion string             `json:"primary_emotion"`
 	Emotions       map[string]float64 `json:"emotions"`
+	Details        []EmotionDetail    `json:"details,omitempty"`
+	Trajectory     *EmotionTrajectory `json:"trajectory,omitempty"`
 	Confidence     float64            `json:"confidence"`
+	Explanation    string             `json:"explanation,omitempty"`
+}
+
+// EmotionDetail represents the intensity of an emotion and the messages it was inferred from
+type EmotionDetail struct {
+	Emotion   string            `json:"emotion"`
+	Intensity float64           `json:"intensity"`
+	Evidence  []EmotionEvidence `json:"evidence"`
+}
+
+// EmotionEvidence references a message supporting an emotion
+type EmotionEvidence struct {
+	MessageID string `json:"message_id"`
+	Quote     string `json:"quote"`
+}
+
+// EmotionTrajectory represents emotion scores at the start and end of a session
+type EmotionTrajectory struct {
+	Start map[string]float64 `json:"start"`
+	End   map[string]float64 `json:"end"`
+}
+
+// EmotionalStateRecord represents a stored emotional state with its session date
+type EmotionalStateRecord struct {
+	Date           string          `json:"date"`
+	SessionID      string          `json:"session_id"`
+	EmotionalState json.RawMessage `json:"emotional_state"`
+}
+
+// TensionFactorSample represents one analyzed day and the factors present on it
+type TensionFactorSample struct {
+	Date         string   `json:"date"`
+	SessionID    string   `json:"session_id"`
+	TensionScore int      `json:"tension_score"`
+	Keywords     []string `json:"keywords"`
+	Topics       []string `json:"topics"`
+	Entities     []string `json:"entities"` // "kind:name"
 }
 
 // TensionScoreData represents tension score information
 type TensionScoreData struct {
-	Date          string `json:"date"`
-	TensionScore  int    `json:"tension_score"`
-	RelativeScore int    `json:"relative_score"`
-	SessionID     string `json:"session_id"`
+	Date           string   `json:"date"`
+	TensionScore   int      `json:"tension_score"`
+	RelativeScore  int      `json:"relative_score"`
+	SessionID      string   `json:"session_id"`
+	RollingAverage *float64 `json:"rolling_average,omitempty"` // trailing 7-day average
+	ZScore         *float64 `json:"z_score,omitempty"`         // deviation from trend and weekday pattern
+	Anomaly        bool     `json:"anomaly"`
+}
+
+// MessageAnnotation represents the classifier output stored under a message's metadata
+type MessageAnnotation struct {
+	Sentiment   Sentiment     `json:"sentiment"`
+	Topics      []string      `json:"topics"`
+	Entities    []NamedEntity `json:"entities"`
+	Annotator   string        `json:"annotator"`
+	AnnotatedAt time.Time     `json:"annotated_at"`
+}
+
+// Sentiment represents the sentiment of a message
+type Sentiment struct {
+	Score float64 `json:"score"` // -1 (negative) to 1 (positive)
+	Label string  `json:"label"`
+}
+
+// NamedEntity represents a named entity mentioned in a message
+type NamedEntity struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Constants for named entity types
+const (
+	EntityTypePerson   = "person"
+	EntityTypePlace    = "place"
+	EntityTypeActivity = "activity"
+	EntityTypeProject  = "project"
+)
+
+// Entity represents a person, place, activity or project mentioned in a user's sessions
+type Entity struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// MessageMetadataAnnotation is the metadata key message annotations are stored under
+const MessageMetadataAnnotation = "annotation"
+
+// MessageMetadataReplyFailed marks a user message whose AI reply could not be generated; the reply can be retried
+const MessageMetadataReplyFailed = "reply_failed"
+
+// MessageMetadataFallback marks an AI message written without Gemini because it was unavailable
+const MessageMetadataFallback = "fallback"
+
 // Constants for message senders
 const (
 	SenderUser = "user"
@@ -93,19 +184,301 @@ const (
 	SessionStatusCompleted = "completed"
 )
 
+// Constants for webhook event types
+const (
+	WebhookEventSessionCreated   = "session.created"
+	WebhookEventSessionCompleted = "session.completed"
+	WebhookEventAnalysisCreated  = "analysis.created"
+	WebhookEventAlertTriggered   = "alert.triggered"
+)
+
+// WebhookEventTypes lists the events a webhook can subscribe to
+var WebhookEventTypes = []string{
+	WebhookEventSessionCreated,
+	WebhookEventSessionCompleted,
+	WebhookEventAnalysisCreated,
+	WebhookEventAlertTriggered,
+}
+
+// Constants for webhook delivery status
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Constants for security event types
+const (
+	SecurityEventLoginSucceeded  = "login_succeeded"
+	SecurityEventLoginFailed     = "login_failed"
+	SecurityEventAccountLocked   = "account_locked"
+	SecurityEventAccountUnlocked = "account_unlocked"
+	SecurityEventMFAEnabled      = "mfa_enabled"
+	SecurityEventMFADisabled     = "mfa_disabled"
+	SecurityEventRecoveryCodes   = "recovery_codes_regenerated"
+	SecurityEventPasswordChanged = "password_changed"
+	SecurityEventResetRequested  = "password_reset_requested"
+	SecurityEventPasswordReset   = "password_reset"
+)
+
+// Constants for why a login failed
+const (
+	LoginFailureUnknownUser     = "unknown_user"
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureLocked          = "locked"
+	LoginFailureIPThrottled     = "ip_throttled"
+	LoginFailureInvalidMFACode  = "invalid_mfa_code"
+)
+
+// LoginMethodRecoveryCode is the reason of a successful login completed with a recovery code
+const LoginMethodRecoveryCode = "recovery_code"
+
 // API Request/Response types
 
+// AlertSettings represents a user's mood alert thresholds
+type AlertSettings struct {
+	UserID            string    `json:"-" db:"user_id"`
+	Enabled           bool      `json:"enabled" db:"enabled"`
+	DeclineDays       int       `json:"decline_days" db:"decline_days"`               // consecutive daily decreases
+	DeclineMinDrop    int       `json:"decline_min_drop" db:"decline_min_drop"`       // total points dropped over the decline
+	SuddenDropPoints  int       `json:"sudden_drop_points" db:"sudden_drop_points"`   // drop below the trailing average
+	MissedDays        int       `json:"missed_days" db:"missed_days"`                 // days without a session after a low day
+	LowScoreThreshold int       `json:"low_score_threshold" db:"low_score_threshold"` // scores at or below this are low
+	AcknowledgeInChat bool      `json:"acknowledge_in_chat" db:"acknowledge_in_chat"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Notification represents a message for the user, such as a mood alert
+type Notification struct {
+	ID                   string          `json:"id" db:"id"`
+	UserID               string          `json:"user_id" db:"user_id"`
+	Type                 string          `json:"type" db:"type"`
+	Title                string          `json:"title" db:"title"`
+	Body                 string          `json:"body" db:"body"`
+	Data                 json.RawMessage `json:"data,omitempty" db:"data"`
+	ReadAt               *time.Time      `json:"read_at,omitempty" db:"read_at"`
+	AcknowledgedInChatAt *time.Time      `json:"acknowledged_in_chat_at,omitempty" db:"acknowledged_in_chat_at"`
+	CreatedAt            time.Time       `json:"created_at" db:"created_at"`
+}
+
+// ReminderSettings represents when and how a user is reminded to journal
+type ReminderSettings struct {
+	UserID          string    `json:"-" db:"user_id"`
+	Enabled         bool      `json:"enabled" db:"enabled"`
+	RemindAt        string    `json:"remind_at" db:"remind_at"` // HH:MM in Timezone
+	Timezone        string    `json:"timezone" db:"timezone"`
+	Channels        []string  `json:"channels" db:"channels"`
+	WebhookURL      *string   `json:"webhook_url,omitempty" db:"webhook_url"`
+	QuietHoursStart *string   `json:"quiet_hours_start,omitempty" db:"quiet_hours_start"` // HH:MM
+	QuietHoursEnd   *string   `json:"quiet_hours_end,omitempty" db:"quiet_hours_end"`     // HH:MM
+	LastRemindedOn  *string   `json:"last_reminded_on,omitempty" db:"last_reminded_on"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PushSubscription represents a browser subscribed to Web Push notifications
+type PushSubscription struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Endpoint  string    `json:"endpoint" db:"endpoint"`
+	P256dh    string    `json:"-" db:"p256dh"`
+	Auth      string    `json:"-" db:"auth"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Webhook represents a user-registered endpoint that receives diary events
+type Webhook struct {
+	ID          string    `json:"id" db:"id"`
+	UserID      string    `json:"-" db:"user_id"`
+	URL         string    `json:"url" db:"url"`
+	Secret      string    `json:"secret,omitempty" db:"secret"` // Only returned when the webhook is created
+	Events      []string  `json:"events" db:"events"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	IsActive    bool      `json:"is_active" db:"is_active"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookDelivery represents one event sent (or being retried) to a webhook
+type WebhookDelivery struct {
+	ID             string          `json:"id" db:"id"`
+	WebhookID      string          `json:"webhook_id" db:"webhook_id"`
+	EventID        string          `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status,omitempty" db:"response_status"`
+	LastError      *string         `json:"last_error,omitempty" db:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// WebhookEvent is the JSON body posted to webhooks
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDeliveryTask represents a claimed delivery along with where and how to send it
+type WebhookDeliveryTask struct {
+	Delivery WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+// AIUsage represents the tokens used by one Gemini call
+type AIUsage struct {
+	ID             string    `json:"id" db:"id"`
+	UserID         *string   `json:"user_id,omitempty" db:"user_id"`
+	SessionID      *string   `json:"session_id,omitempty" db:"session_id"`
+	Operation      string    `json:"operation" db:"operation"` // ai.Client method, e.g. GenerateResponse
+	Model          string    `json:"model" db:"model"`
+	PromptTokens   int       `json:"prompt_tokens" db:"prompt_tokens"`
+	OutputTokens   int       `json:"output_tokens" db:"output_tokens"`
+	ThoughtsTokens int       `json:"thoughts_tokens" db:"thoughts_tokens"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// AIUsageTotals sums the token usage of several Gemini calls
+type AIUsageTotals struct {
+	Calls          int   `json:"calls"`
+	PromptTokens   int64 `json:"prompt_tokens"`
+	OutputTokens   int64 `json:"output_tokens"`
+	ThoughtsTokens int64 `json:"thoughts_tokens"`
+	TotalTokens    int64 `json:"total_tokens"`
+}
+
+// AIOperationUsage represents the token usage of one ai.Client operation
+type AIOperationUsage struct {
+	Operation string `json:"operation"`
+	AIUsageTotals
+}
+
+// AIUserUsage represents a user's token usage in the admin report
+type AIUserUsage struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	AIUsageTotals
+	Operations []AIOperationUsage `json:"operations"`
+}
+
+// AIQuota represents a user's token quota overrides; nil keeps the server default
+type AIQuota struct {
+	UserID        string    `json:"user_id" db:"user_id"`
+	DailyTokens   *int64    `json:"daily_tokens" db:"daily_tokens"`
+	MonthlyTokens *int64    `json:"monthly_tokens" db:"monthly_tokens"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// AIQuotaStatus represents how much of their token quota a user has used; a limit of 0 means unlimited
+type AIQuotaStatus struct {
+	DailyLimit   int64 `json:"daily_limit"`
+	DailyUsed    int64 `json:"daily_used"`
+	MonthlyLimit int64 `json:"monthly_limit"`
+	MonthlyUsed  int64 `json:"monthly_used"`
+	Exceeded     bool  `json:"exceeded"`
+}
+
+// LoginState represents a user's recent failed logins and how long logins are refused
+type LoginState struct {
+	FailedLoginCount int        `json:"failed_login_count" db:"failed_login_count"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+}
+
+// SecurityEvent represents a login, failed login or lockout recorded for a user
+type SecurityEvent struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    *string   `json:"-" db:"user_id"`
+	EventType string    `json:"event_type" db:"event_type"`
+	Reason    *string   `json:"reason,omitempty" db:"reason"`
+	Username  *string   `json:"-" db:"username"`
+	IPAddress *string   `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent *string   `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SecurityEventsResponse represents a user's recent security events
+type SecurityEventsResponse struct {
+	Events []SecurityEvent `json:"events"`
+}
+
+// MFAState represents a user's TOTP secret and whether two-factor authentication is enabled
+type MFAState struct {
+	// Secret is set on enrollment; it is only used for logins once EnabledAt is set
+	Secret      *string    `db:"totp_secret"`
+	EnabledAt   *time.Time `db:"totp_enabled_at"`
+	LastCounter *int64     `db:"totp_last_counter"`
+	// Challenge identifies the pending second step of a login, if any
+	Challenge *string `db:"mfa_challenge"`
+}
+
+// MFAStatus represents whether a user has two-factor authentication enabled
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment represents a new TOTP secret for the user's authenticator app
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// MFACodeRequest represents a request confirmed with a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse represents newly generated recovery codes; they are shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFALoginRequest represents the second login step
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFAChallengeResponse represents a login that needs a TOTP or recovery code to complete
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
 // LoginRequest represents login request body
 type LoginRequest struct {
-	Username string `json:"username" validate:"required,min=3"`
-	Password string `json:"password" validate:"required,min=6"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest represents a password change by a logged in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest represents a request for a password reset email
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetConfirmRequest represents a new password set with a token from a reset email
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
 }
 
 // RegisterRequest represents registration request body
 type RegisterRequest struct {
-	Username string  `json:"username" validate:"required,min=3"`
-	Password string  `json:"password" validate:"required,min=6"`
-	Email    *string `json:"email,omitempty" validate:"omitempty,email"`
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Email    *string `json:"email,omitempty"`
 }
 
 // LoginResponse represents login response
@@ -116,7 +489,7 @@ type LoginResponse struct {
 
 // CreateSessionRequest represents session creation request
 type CreateSessionRequest struct {
-	Date string `json:"date" validate:"required"`
+	Date string `json:"date"`
 }
 
 // CreateSessionResponse represents session creation response
@@ -127,13 +500,15 @@ type CreateSessionResponse struct {
 
 // SendMessageRequest represents message sending request
 type SendMessageRequest struct {
-	Content string `json:"content" validate:"required,max=2000"`
+	Content string `json:"content"`
 }
 
 // SendMessageResponse represents message sending response
 type SendMessageResponse struct {
 	UserMessage Message `json:"user_message"`
 	AIResponse  Message `json:"ai_response"`
+	// ReplyFailed means AIResponse is an unsaved fallback and the reply can be retried
+	ReplyFailed bool `json:"reply_failed,omitempty"`
 }
 
 // SessionsResponse represents sessions list response
@@ -165,11 +540,67 @@ type SessionForBatch struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-// Pagination represents pagination information
+// Pagination represents keyset pagination information
 type Pagination struct {
-	Total  int `json:"total"`
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+	Limit int `json:"limit"`
+	// NextCursor fetches the following page; it is null on the last page
+	NextCursor *string `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+	// Total is only counted when the request asks for it with include_total=true
+	Total *int `json:"total,omitempty"`
+}
+
+// Sort orders for session and analysis listings; a leading "-" means descending
+const (
+	SortDateAsc     = "date"
+	SortDateDesc    = "-date"
+	SortUpdatedAsc  = "updated_at"
+	SortUpdatedDesc = "-updated_at"
+	SortTensionAsc  = "tension_score"
+	SortTensionDesc = "-tension_score"
+)
+
+// PageCursor is the position of the last item of a page in a keyset listing
+type PageCursor struct {
+	Sort string `json:"s"`
+	// Value is the sort key of the last item, e.g. its date or tension score
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// SessionFilter narrows session and analysis listings; nil fields do not filter
+type SessionFilter struct {
+	DateFrom    *string // YYYY-MM-DD, inclusive
+	DateTo      *string // YYYY-MM-DD, inclusive
+	Year        *int
+	Month       *int
+	Status      *string
+	HasAnalysis *bool
+	MinTension  *int
+	MaxTension  *int
+	Emotion     *string // primary emotion of the analysis
+	Keyword     *string
+}
+
+// ListQuery is a filtered, sorted page request
+type ListQuery struct {
+	SessionFilter
+	Sort         string
+	Cursor       string
+	Limit        int
+	IncludeTotal bool
+}
+
+// AnalysesResponse represents analysis history response
+type AnalysesResponse struct {
+	Analyses   []AnalysisHistoryItem `json:"analyses"`
+	Pagination Pagination            `json:"pagination"`
+}
+
+// AnalysisHistoryItem represents an analysis with the date of its session
+type AnalysisHistoryItem struct {
+	Analysis
+	SessionDate string `json:"session_date"`
 }
 
 // AnalysisResponse represents analysis data response
@@ -185,10 +616,220 @@ type TensionScoresResponse struct {
 
 // TensionStatistics represents tension score statistics
 type TensionStatistics struct {
-	Average float64 `json:"average"`
-	Min     int     `json:"min"`
-	Max     int     `json:"max"`
-	Trend   string  `json:"trend"`
+	Average           float64            `json:"average"`
+	Min               int                `json:"min"`
+	Max               int                `json:"max"`
+	StdDev            float64            `json:"std_dev"`
+	Trend             string             `json:"trend"`
+	Regression        *TensionRegression `json:"regression,omitempty"`
+	WeeklySeasonality map[string]float64 `json:"weekly_seasonality,omitempty"` // weekday: mean deviation from average
+	AnomalyCount      int                `json:"anomaly_count"`
+}
+
+// TensionRegression represents a linear trend fitted to tension scores over time
+type TensionRegression struct {
+	Slope          float64 `json:"slope"` // points per day
+	ConfidenceLow  float64 `json:"confidence_low"`
+	ConfidenceHigh float64 `json:"confidence_high"`
+	Confidence     float64 `json:"confidence"`
+	PValue         float64 `json:"p_value"`
+	RSquared       float64 `json:"r_squared"`
+}
+
+// Tension correlation factor kinds
+const (
+	FactorKindKeyword = "keyword"
+	FactorKindTopic   = "topic"
+	FactorKindEntity  = "entity"
+	FactorKindWeekday = "weekday"
+)
+
+// TensionCorrelationsResponse represents how factors relate to tension scores
+type TensionCorrelationsResponse struct {
+	Days          int                  `json:"days"`
+	SampleSize    int                  `json:"sample_size"`
+	MinSampleSize int                  `json:"min_sample_size"`
+	Correlations  []TensionCorrelation `json:"correlations"`
+}
+
+// TensionCorrelation compares tension scores on days with a factor against days without it
+type TensionCorrelation struct {
+	Kind        string  `json:"kind"`
+	Factor      string  `json:"factor"`
+	DaysWith    int     `json:"days_with"`
+	DaysWithout int     `json:"days_without"`
+	MeanWith    float64 `json:"mean_with"`
+	MeanWithout float64 `json:"mean_without"`
+	Difference  float64 `json:"difference"`
+	PValue      float64 `json:"p_value"`
+	AdjustedP   float64 `json:"adjusted_p_value"` // Benjamini-Hochberg
+	Significant bool    `json:"significant"`
+	Message     string  `json:"message,omitempty"`
+}
+
+// EmotionTrendResponse represents emotion scores over time for charting
+type EmotionTrendResponse struct {
+	Taxonomy string              `json:"taxonomy"`
+	Emotions []string            `json:"emotions"`
+	Points   []EmotionTrendPoint `json:"points"`
+}
+
+// EmotionTrendPoint represents a single session's emotions in an emotion trend
+type EmotionTrendPoint struct {
+	Date           string             `json:"date"`
+	SessionID      string             `json:"session_id"`
+	PrimaryEmotion string             `json:"primary_emotion"`
+	Emotions       map[string]float64 `json:"emotions"`
+	Start          map[string]float64 `json:"start,omitempty"`
+	End            map[string]float64 `json:"end,omitempty"`
+}
+
+// MoodCurveResponse represents per-message sentiment over the course of a session
+type MoodCurveResponse struct {
+	SessionID string      `json:"session_id"`
+	Points    []MoodPoint `json:"points"`
+}
+
+// MoodPoint represents the sentiment of a single user message
+type MoodPoint struct {
+	MessageID      string    `json:"message_id"`
+	SequenceNumber int       `json:"sequence_number"`
+	CreatedAt      time.Time `json:"created_at"`
+	Score          float64   `json:"score"`
+	Label          string    `json:"label"`
+	Topics         []string  `json:"topics"`
+}
+
+// EntitySummary represents an entity with aggregated mention statistics
+type EntitySummary struct {
+	ID                  string   `json:"id"`
+	Kind                string   `json:"kind"`
+	Name                string   `json:"name"`
+	DayCount            int      `json:"day_count"`
+	MentionCount        int      `json:"mention_count"`
+	AverageTensionScore *float64 `json:"average_tension_score,omitempty"`
+	LastMentionedOn     *string  `json:"last_mentioned_on,omitempty"`
+}
+
+// EntitiesResponse represents entity list response
+type EntitiesResponse struct {
+	Entities []EntitySummary `json:"entities"`
+}
+
+// EntityDay represents a day on which an entity was mentioned
+type EntityDay struct {
+	Date         string `json:"date"`
+	SessionID    string `json:"session_id"`
+	MentionCount int    `json:"mention_count"`
+	TensionScore *int   `json:"tension_score,omitempty"`
+}
+
+// EntityDetailResponse represents a single entity with the days it was mentioned
+type EntityDetailResponse struct {
+	Entity  EntitySummary `json:"entity"`
+	Aliases []string      `json:"aliases"`
+	Days    []EntityDay   `json:"days"`
+}
+
+// RenameEntityRequest represents entity rename request
+type RenameEntityRequest struct {
+	Name string `json:"name"`
+}
+
+// MergeEntitiesRequest represents a request to merge entities into another
+type MergeEntitiesRequest struct {
+	SourceIDs []string `json:"source_ids"`
+}
+
+// UpdateAlertSettingsRequest represents a partial update of alert settings
+type UpdateAlertSettingsRequest struct {
+	Enabled           *bool `json:"enabled,omitempty"`
+	DeclineDays       *int  `json:"decline_days,omitempty"`
+	DeclineMinDrop    *int  `json:"decline_min_drop,omitempty"`
+	SuddenDropPoints  *int  `json:"sudden_drop_points,omitempty"`
+	MissedDays        *int  `json:"missed_days,omitempty"`
+	LowScoreThreshold *int  `json:"low_score_threshold,omitempty"`
+	AcknowledgeInChat *bool `json:"acknowledge_in_chat,omitempty"`
+}
+
+// NotificationsResponse represents a user's notifications
+type NotificationsResponse struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int            `json:"unread_count"`
+}
+
+// ReminderSettingsResponse represents reminder settings with the channels the server can deliver on
+type ReminderSettingsResponse struct {
+	Settings          ReminderSettings `json:"settings"`
+	AvailableChannels []string         `json:"available_channels"`
+	VAPIDPublicKey    string           `json:"vapid_public_key,omitempty"`
+}
+
+// UpdateReminderSettingsRequest represents a partial update of reminder settings.
+// An empty string clears webhook_url or the quiet hours.
+type UpdateReminderSettingsRequest struct {
+	Enabled         *bool     `json:"enabled,omitempty"`
+	RemindAt        *string   `json:"remind_at,omitempty"`
+	Timezone        *string   `json:"timezone,omitempty"`
+	Channels        *[]string `json:"channels,omitempty"`
+	WebhookURL      *string   `json:"webhook_url,omitempty"`
+	QuietHoursStart *string   `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   *string   `json:"quiet_hours_end,omitempty"`
+}
+
+// PushSubscriptionRequest represents a browser PushSubscription as serialized by toJSON()
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// CreateWebhookRequest represents a webhook registration request
+type CreateWebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description,omitempty"`
+}
+
+// UpdateWebhookRequest represents a partial update of a webhook
+type UpdateWebhookRequest struct {
+	URL         *string   `json:"url,omitempty"`
+	Events      *[]string `json:"events,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	IsActive    *bool     `json:"is_active,omitempty"`
+}
+
+// WebhooksResponse represents a user's webhooks
+type WebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// WebhookDeliveriesResponse represents the delivery log of a webhook
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// AIUsageResponse represents a user's own token usage for the current month
+type AIUsageResponse struct {
+	Month      string             `json:"month"` // YYYY-MM (JST)
+	Quota      AIQuotaStatus      `json:"quota"`
+	Operations []AIOperationUsage `json:"operations"`
+}
+
+// AIUsageReportResponse represents the admin usage report for a date range
+type AIUsageReportResponse struct {
+	From   string        `json:"from"` // YYYY-MM-DD (JST), inclusive
+	To     string        `json:"to"`   // YYYY-MM-DD (JST), inclusive
+	Totals AIUsageTotals `json:"totals"`
+	Users  []AIUserUsage `json:"users"`
+}
+
+// UpdateAIQuotaRequest represents a request to override a user's token quotas; null restores the default
+type UpdateAIQuotaRequest struct {
+	DailyTokens   *int64 `json:"daily_tokens"`
+	MonthlyTokens *int64 `json:"monthly_tokens"`
 }
 
 // CalendarResponse represents calendar data response
@@ -223,3 +864,10 @@ type ErrorDetail struct {
 	Message string      `json:"message"`
 	Details interface{} `json:"details,omitempty"`
 }
+
+// FieldError describes an invalid field in the details of a VALIDATION_ERROR
+type FieldError struct {
+	Field   string `json:"field"` // parameter name or dotted body path; empty for the whole body
+	In      string `json:"in"`    // path, query, header or body
+	Message string `json:"message"`
+}
@@ -0,0 +1,11 @@
+-- Rollback entity tables
+
+DROP TRIGGER IF EXISTS update_entities_updated_at ON entities;
+
+DROP INDEX IF EXISTS idx_entity_mentions_session_id;
+DROP INDEX IF EXISTS idx_entity_aliases_entity_id;
+DROP INDEX IF EXISTS idx_entities_user_kind;
+
+DROP TABLE IF EXISTS entity_mentions;
+DROP TABLE IF EXISTS entity_aliases;
+DROP TABLE IF EXISTS entities;
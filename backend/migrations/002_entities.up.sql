@@ -0,0 +1,41 @@
+-- People, places, activities and projects mentioned in chat sessions
+
+-- Entities table (one row per real-world entity per user)
+CREATE TABLE entities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('person', 'place', 'activity', 'project')),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Entity aliases table (normalized names that resolve to an entity)
+CREATE TABLE entity_aliases (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    alias VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- An alias resolves to a single entity per user and kind
+    UNIQUE(user_id, kind, alias)
+);
+
+-- Entity mentions table (which sessions mention an entity)
+CREATE TABLE entity_mentions (
+    entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    mention_count INTEGER NOT NULL DEFAULT 1 CHECK (mention_count > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (entity_id, session_id)
+);
+
+CREATE INDEX idx_entities_user_kind ON entities(user_id, kind);
+CREATE INDEX idx_entity_aliases_entity_id ON entity_aliases(entity_id);
+CREATE INDEX idx_entity_mentions_session_id ON entity_mentions(session_id);
+
+CREATE TRIGGER update_entities_updated_at BEFORE UPDATE ON entities
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,9 @@
+-- Rollback alert settings and notifications
+
+DROP TRIGGER IF EXISTS update_alert_settings_updated_at ON alert_settings;
+
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS idx_notifications_user_created;
+
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS alert_settings;
@@ -0,0 +1,34 @@
+-- Mood alert settings and user notifications
+
+-- Alert settings table (absent row means defaults)
+CREATE TABLE alert_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    decline_days INTEGER NOT NULL DEFAULT 3 CHECK (decline_days BETWEEN 2 AND 14),
+    decline_min_drop INTEGER NOT NULL DEFAULT 15 CHECK (decline_min_drop BETWEEN 0 AND 100),
+    sudden_drop_points INTEGER NOT NULL DEFAULT 25 CHECK (sudden_drop_points BETWEEN 5 AND 100),
+    missed_days INTEGER NOT NULL DEFAULT 2 CHECK (missed_days BETWEEN 1 AND 30),
+    low_score_threshold INTEGER NOT NULL DEFAULT 35 CHECK (low_score_threshold BETWEEN 0 AND 100),
+    acknowledge_in_chat BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notifications table
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB DEFAULT '{}'::jsonb,
+    read_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_in_chat_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_user_created ON notifications(user_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+CREATE TRIGGER update_alert_settings_updated_at BEFORE UPDATE ON alert_settings
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,9 @@
+-- Rollback reminder settings and push subscriptions
+
+DROP TRIGGER IF EXISTS update_reminder_settings_updated_at ON reminder_settings;
+
+DROP INDEX IF EXISTS idx_push_subscriptions_user_id;
+DROP INDEX IF EXISTS idx_reminder_settings_enabled;
+
+DROP TABLE IF EXISTS push_subscriptions;
+DROP TABLE IF EXISTS reminder_settings;
@@ -0,0 +1,35 @@
+-- Journaling reminder settings and Web Push subscriptions
+
+-- Reminder settings table (absent row means reminders are off)
+CREATE TABLE reminder_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    remind_at TIME NOT NULL DEFAULT '21:00',
+    timezone VARCHAR(50) NOT NULL DEFAULT 'Asia/Tokyo',
+    channels TEXT[] NOT NULL DEFAULT '{}',
+    webhook_url TEXT,
+    quiet_hours_start TIME,
+    quiet_hours_end TIME,
+    last_reminded_on DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- Quiet hours are either both set or both unset
+    CONSTRAINT reminder_settings_quiet_hours_check CHECK ((quiet_hours_start IS NULL) = (quiet_hours_end IS NULL))
+);
+
+-- Push subscriptions table (one row per browser)
+CREATE TABLE push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh VARCHAR(255) NOT NULL,
+    auth VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_reminder_settings_enabled ON reminder_settings(user_id) WHERE enabled = true;
+CREATE INDEX idx_push_subscriptions_user_id ON push_subscriptions(user_id);
+
+CREATE TRIGGER update_reminder_settings_updated_at BEFORE UPDATE ON reminder_settings
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,11 @@
+-- Rollback AI usage accounting
+
+DROP TRIGGER IF EXISTS update_ai_quotas_updated_at ON ai_quotas;
+
+DROP INDEX IF EXISTS idx_ai_usage_created;
+DROP INDEX IF EXISTS idx_ai_usage_user_created;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+
+DROP TABLE IF EXISTS ai_quotas;
+DROP TABLE IF EXISTS ai_usage;
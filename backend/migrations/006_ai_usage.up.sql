@@ -0,0 +1,30 @@
+-- Gemini token usage per call, per-user quota overrides and admin users
+
+-- AI usage table (one row per Gemini call)
+CREATE TABLE ai_usage (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID REFERENCES chat_sessions(id) ON DELETE SET NULL,
+    operation VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    thoughts_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- AI quotas table (overrides the server-wide defaults; NULL keeps the default)
+CREATE TABLE ai_quotas (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    daily_tokens BIGINT CHECK (daily_tokens >= 0),
+    monthly_tokens BIGINT CHECK (monthly_tokens >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_ai_usage_user_created ON ai_usage(user_id, created_at);
+CREATE INDEX idx_ai_usage_created ON ai_usage(created_at);
+
+CREATE TRIGGER update_ai_quotas_updated_at BEFORE UPDATE ON ai_quotas
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,10 @@
+-- Rollback login security
+
+DROP INDEX IF EXISTS idx_security_events_unknown_user;
+DROP INDEX IF EXISTS idx_security_events_failed_ip;
+DROP INDEX IF EXISTS idx_security_events_user_created;
+
+DROP TABLE IF EXISTS security_events;
+
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_count;
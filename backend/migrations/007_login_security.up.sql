@@ -0,0 +1,23 @@
+-- Login failure tracking, temporary lockout and the security event log
+
+ALTER TABLE users
+    ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMP WITH TIME ZONE;
+
+-- Security events table (logins, failed attempts, lockouts); user_id is NULL for unknown usernames
+CREATE TABLE security_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL CHECK (event_type IN ('login_succeeded', 'login_failed', 'account_locked', 'account_unlocked')),
+    reason VARCHAR(50),
+    username VARCHAR(50),
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_security_events_user_created ON security_events(user_id, created_at DESC);
+CREATE INDEX idx_security_events_failed_ip ON security_events(ip_address, created_at) WHERE event_type = 'login_failed';
+-- Failed logins with unknown usernames are counted per username to throttle them like accounts
+CREATE INDEX idx_security_events_unknown_user ON security_events(username, created_at)
+    WHERE event_type = 'login_failed' AND reason = 'unknown_user';
@@ -0,0 +1,13 @@
+-- Rollback TOTP two-factor authentication
+
+DELETE FROM security_events WHERE event_type IN ('mfa_enabled', 'mfa_disabled', 'recovery_codes_regenerated');
+ALTER TABLE security_events DROP CONSTRAINT security_events_event_type_check;
+ALTER TABLE security_events ADD CONSTRAINT security_events_event_type_check
+    CHECK (event_type IN ('login_succeeded', 'login_failed', 'account_locked', 'account_unlocked'));
+
+DROP TABLE IF EXISTS mfa_recovery_codes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_challenge;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_counter;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,24 @@
+-- TOTP two-factor authentication and recovery codes
+
+-- totp_secret is set on enrollment and takes effect once totp_enabled_at is set;
+-- totp_last_counter is the last accepted time step, so that a code cannot be used twice;
+-- mfa_challenge identifies the pending second login step, so that its token works only once
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN totp_last_counter BIGINT,
+    ADD COLUMN mfa_challenge VARCHAR(64);
+
+-- Recovery codes table (SHA-256 of each single-use code)
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+ALTER TABLE security_events DROP CONSTRAINT security_events_event_type_check;
+ALTER TABLE security_events ADD CONSTRAINT security_events_event_type_check
+    CHECK (event_type IN ('login_succeeded', 'login_failed', 'account_locked', 'account_unlocked', 'mfa_enabled', 'mfa_disabled', 'recovery_codes_regenerated'));
@@ -0,0 +1,10 @@
+-- Rollback password changes and resets
+
+DELETE FROM security_events WHERE event_type IN ('password_changed', 'password_reset_requested', 'password_reset');
+ALTER TABLE security_events DROP CONSTRAINT security_events_event_type_check;
+ALTER TABLE security_events ADD CONSTRAINT security_events_event_type_check
+    CHECK (event_type IN ('login_succeeded', 'login_failed', 'account_locked', 'account_unlocked', 'mfa_enabled', 'mfa_disabled', 'recovery_codes_regenerated'));
+
+DROP TABLE IF EXISTS password_reset_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
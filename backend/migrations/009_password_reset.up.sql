@@ -0,0 +1,21 @@
+-- Password changes and email-based password resets
+
+-- Tokens carry the password_changed_at of their password and are rejected once it changes, so
+-- that changing or resetting the password signs out every other session
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- Password reset tokens table (SHA-256 of each single-use token)
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+ALTER TABLE security_events DROP CONSTRAINT security_events_event_type_check;
+ALTER TABLE security_events ADD CONSTRAINT security_events_event_type_check
+    CHECK (event_type IN ('login_succeeded', 'login_failed', 'account_locked', 'account_unlocked', 'mfa_enabled', 'mfa_disabled', 'recovery_codes_regenerated', 'password_changed', 'password_reset_requested', 'password_reset'));
@@ -0,0 +1,124 @@
+// Package migrations embeds the SQL schema migrations and applies them in order.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.up.sql
+var files embed.FS
+
+// baselineVersion is the schema created before applied migrations were tracked
+const baselineVersion = "001_initial_schema"
+
+// advisoryLockID serializes migrations between API server instances starting at the same time
+const advisoryLockID = 7362519
+
+// Up applies every embedded migration that has not been applied yet and returns the applied versions
+func Up(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", advisoryLockID); err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockID)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	applied := make(map[string]bool)
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	// Databases created before migrations were tracked already have the initial schema
+	if len(applied) == 0 {
+		var exists bool
+		err := conn.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT FROM information_schema.tables
+				WHERE table_schema = current_schema()
+				AND table_name = 'users'
+			)
+		`).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if users table exists: %w", err)
+		}
+		if exists {
+			if _, err := conn.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", baselineVersion); err != nil {
+				return nil, fmt.Errorf("failed to record baseline migration: %w", err)
+			}
+			applied[baselineVersion] = true
+		}
+	}
+
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	var newlyApplied []string
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".up.sql")
+		if applied[version] {
+			continue
+		}
+
+		sql, err := files.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit migration %s: %w", version, err)
+		}
+
+		newlyApplied = append(newlyApplied, version)
+	}
+
+	return newlyApplied, nil
+}
@@ -0,0 +1,302 @@
+// Package stats provides the small set of statistical routines used for score analytics.
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Mean returns the arithmetic mean of xs, or 0 when xs is empty
+func Mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// Variance returns the unbiased sample variance of xs, or 0 when it has fewer than two values
+func Variance(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	mean := Mean(xs)
+	var sum float64
+	for _, x := range xs {
+		sum += (x - mean) * (x - mean)
+	}
+	return sum / float64(len(xs)-1)
+}
+
+// StdDev returns the sample standard deviation of xs
+func StdDev(xs []float64) float64 {
+	return math.Sqrt(Variance(xs))
+}
+
+// TTestResult holds the outcome of a two-sample t-test
+type TTestResult struct {
+	T      float64
+	DF     float64
+	PValue float64 // two-tailed
+}
+
+// WelchTTest compares the means of two samples without assuming equal variances.
+// Both samples need at least two values; ok is false otherwise.
+func WelchTTest(a, b []float64) (result TTestResult, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return TTestResult{}, false
+	}
+
+	na, nb := float64(len(a)), float64(len(b))
+	va, vb := Variance(a)/na, Variance(b)/nb
+	diff := Mean(a) - Mean(b)
+
+	if va+vb == 0 {
+		// Both samples are constant: any difference is certain, no difference is not evidence
+		if diff == 0 {
+			return TTestResult{T: 0, DF: na + nb - 2, PValue: 1}, true
+		}
+		return TTestResult{T: math.Copysign(math.Inf(1), diff), DF: na + nb - 2, PValue: 0}, true
+	}
+
+	t := diff / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+
+	return TTestResult{T: t, DF: df, PValue: StudentTTwoTailed(t, df)}, true
+}
+
+// StudentTTwoTailed returns P(|T| >= |t|) for Student's t distribution with df degrees of freedom
+func StudentTTwoTailed(t, df float64) float64 {
+	if math.IsInf(t, 0) {
+		return 0
+	}
+	return RegularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// StudentTQuantile returns the value q for which P(T <= q) = p
+func StudentTQuantile(p, df float64) float64 {
+	if p <= 0 || p >= 1 {
+		return math.NaN()
+	}
+	if p == 0.5 {
+		return 0
+	}
+
+	// The two-tailed probability decreases monotonically in |q|, so bisect on it
+	tail := 2 * math.Min(p, 1-p)
+	lo, hi := 0.0, 1.0
+	for StudentTTwoTailed(hi, df) > tail {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if StudentTTwoTailed(mid, df) > tail {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	q := (lo + hi) / 2
+	if p < 0.5 {
+		return -q
+	}
+	return q
+}
+
+// Regression holds an ordinary least squares fit of y = Intercept + Slope*x
+type Regression struct {
+	Slope       float64
+	Intercept   float64
+	SlopeStdErr float64
+	RSquared    float64
+	N           int
+}
+
+// LinearRegression fits a straight line through the points (xs[i], ys[i]).
+// It needs at least three points with distinct x values; ok is false otherwise.
+func LinearRegression(xs, ys []float64) (result Regression, ok bool) {
+	n := len(xs)
+	if n != len(ys) || n < 3 {
+		return Regression{}, false
+	}
+
+	meanX, meanY := Mean(xs), Mean(ys)
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return Regression{}, false
+	}
+
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+
+	var sse float64
+	for i := range xs {
+		residual := ys[i] - (intercept + slope*xs[i])
+		sse += residual * residual
+	}
+
+	rSquared := 1.0
+	if syy > 0 {
+		rSquared = 1 - sse/syy
+	}
+
+	return Regression{
+		Slope:       slope,
+		Intercept:   intercept,
+		SlopeStdErr: math.Sqrt(sse / float64(n-2) / sxx),
+		RSquared:    rSquared,
+		N:           n,
+	}, true
+}
+
+// Predict returns the fitted value at x
+func (r Regression) Predict(x float64) float64 {
+	return r.Intercept + r.Slope*x
+}
+
+// SlopeConfidenceInterval returns the two-sided confidence interval of the slope at the given level (e.g. 0.95)
+func (r Regression) SlopeConfidenceInterval(level float64) (low, high float64) {
+	margin := StudentTQuantile(1-(1-level)/2, float64(r.N-2)) * r.SlopeStdErr
+	return r.Slope - margin, r.Slope + margin
+}
+
+// SlopePValue returns the two-tailed p-value for the hypothesis that the slope is zero
+func (r Regression) SlopePValue() float64 {
+	if r.SlopeStdErr == 0 {
+		if r.Slope == 0 {
+			return 1
+		}
+		return 0
+	}
+	return StudentTTwoTailed(r.Slope/r.SlopeStdErr, float64(r.N-2))
+}
+
+// ZScores standardizes xs against their own mean and sample standard deviation.
+// All scores are 0 when xs has no spread.
+func ZScores(xs []float64) []float64 {
+	scores := make([]float64, len(xs))
+	mean, sd := Mean(xs), StdDev(xs)
+	if sd == 0 {
+		return scores
+	}
+	for i, x := range xs {
+		scores[i] = (x - mean) / sd
+	}
+	return scores
+}
+
+// BenjaminiHochberg adjusts p-values for multiple comparisons, controlling the false discovery rate.
+// The adjusted values are returned in the same order as pValues.
+func BenjaminiHochberg(pValues []float64) []float64 {
+	n := len(pValues)
+	adjusted := make([]float64, n)
+	if n == 0 {
+		return adjusted
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return pValues[order[i]] < pValues[order[j]]
+	})
+
+	// Walk from the largest p-value down so the adjusted values stay monotonic
+	min := 1.0
+	for rank := n; rank >= 1; rank-- {
+		i := order[rank-1]
+		value := pValues[i] * float64(n) / float64(rank)
+		if value < min {
+			min = value
+		}
+		adjusted[i] = min
+	}
+
+	return adjusted
+}
+
+// RegularizedIncompleteBeta computes I_x(a, b) using a continued fraction expansion
+func RegularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly only below the mean; use symmetry above it
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction for the incomplete beta function (Lentz's method)
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
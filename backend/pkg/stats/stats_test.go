@@ -0,0 +1,225 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether got is within tolerance of want
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestRegularizedIncompleteBeta(t *testing.T) {
+	// Integer parameters have closed forms as binomial tail probabilities:
+	// I_x(a, b) = P(Binomial(a+b-1, x) >= a)
+	tests := []struct {
+		x, a, b float64
+		want    float64
+	}{
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+		{0.3, 1, 1, 0.3},
+		{0.2, 3, 1, 0.008},
+		{0.2, 1, 3, 0.488},
+		{0.4, 2, 3, 0.5248},
+		{0.9, 2, 3, 0.9963}, // above the mean, through the symmetry
+		{0.7, 8, 3, 0.3827827864},
+		{0.3, 10, 20, 0.36400408107194426},
+		{0.5, 5, 5, 0.5},
+		{0.5, 50, 50, 0.5},
+	}
+	for _, tt := range tests {
+		if got := RegularizedIncompleteBeta(tt.x, tt.a, tt.b); !near(got, tt.want, 1e-12) {
+			t.Errorf("I_%v(%v, %v) = %.15g, want %.15g", tt.x, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStudentTTwoTailed(t *testing.T) {
+	tests := []struct {
+		t, df float64
+		want  float64
+	}{
+		{0, 5, 1},
+		{math.Inf(1), 5, 0},
+		// df = 1 is the Cauchy distribution: 1 - 2/pi atan|t|
+		{1, 1, 0.5},
+		{-3, 1, 1 - 2/math.Pi*math.Atan(3)},
+		// df = 2: 1 - |t|/sqrt(2+t^2)
+		{1.5, 2, 1 - 1.5/math.Sqrt(2+1.5*1.5)},
+		// Critical values from t tables
+		{2.228138851986273, 10, 0.05},
+		{2.0859634472658644, 20, 0.05},
+		{2.749995653567, 30, 0.01},
+	}
+	for _, tt := range tests {
+		if got := StudentTTwoTailed(tt.t, tt.df); !near(got, tt.want, 1e-9) {
+			t.Errorf("StudentTTwoTailed(%v, %v) = %.12g, want %.12g", tt.t, tt.df, got, tt.want)
+		}
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	tests := []struct {
+		p, df float64
+		want  float64
+	}{
+		{0.5, 10, 0},
+		{0.975, 1, 12.706204736174707},
+		{0.025, 1, -12.706204736174707},
+		{0.9, 1, math.Tan(math.Pi * 0.4)},
+		{0.8, 2, 0.6 / math.Sqrt(2*0.8*0.2)},
+		{0.975, 3, 3.182446305284263},
+		{0.975, 4, 2.7764451051977987},
+		{0.95, 5, 2.015048372669157},
+		{0.975, 10, 2.228138851986273},
+		{0.005, 30, -2.749995653567},
+		{0.975, 1e6, 1.959966},
+	}
+	for _, tt := range tests {
+		if got := StudentTQuantile(tt.p, tt.df); !near(got, tt.want, 1e-6*math.Max(1, math.Abs(tt.want))) {
+			t.Errorf("StudentTQuantile(%v, %v) = %.12g, want %.12g", tt.p, tt.df, got, tt.want)
+		}
+	}
+
+	for _, p := range []float64{0, 1, -0.1, 1.1} {
+		if got := StudentTQuantile(p, 10); !math.IsNaN(got) {
+			t.Errorf("StudentTQuantile(%v, 10) = %v, want NaN", p, got)
+		}
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      []float64
+		wantT     float64
+		wantDF    float64
+		wantP     float64
+		tolerance float64
+	}{
+		{
+			name:   "equal sizes",
+			a:      []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4},
+			b:      []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4},
+			wantT:  -2.45535639828601,
+			wantDF: 24.98852929023142,
+			wantP:  0.021378001462882712,
+		},
+		{
+			name:   "unequal sizes and variances",
+			a:      []float64{19.8, 20.4, 19.6, 17.8, 18.5, 18.9, 18.3, 18.9, 19.5, 22.0},
+			b:      []float64{28.2, 26.6, 20.1, 23.3, 25.2, 22.1, 17.7, 27.6, 20.6, 13.7, 23.2, 17.5, 20.6, 18.0, 23.9, 21.6, 24.3, 20.4, 23.9, 13.3},
+			wantT:  -2.2255120399698485,
+			wantDF: 24.524634944257343,
+			wantP:  0.03548453083000147,
+		},
+		{
+			name:   "identical constant samples",
+			a:      []float64{3, 3, 3},
+			b:      []float64{3, 3},
+			wantT:  0,
+			wantDF: 3,
+			wantP:  1,
+		},
+		{
+			name:   "different constant samples",
+			a:      []float64{4, 4, 4},
+			b:      []float64{3, 3},
+			wantT:  math.Inf(1),
+			wantDF: 3,
+			wantP:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := WelchTTest(tt.a, tt.b)
+			if !ok {
+				t.Fatal("WelchTTest refused the samples")
+			}
+			if !(result.T == tt.wantT || near(result.T, tt.wantT, 1e-9)) || !near(result.DF, tt.wantDF, 1e-9) || !near(result.PValue, tt.wantP, 1e-9) {
+				t.Errorf("WelchTTest = %+v, want t %v, df %v, p %v", result, tt.wantT, tt.wantDF, tt.wantP)
+			}
+		})
+	}
+
+	if _, ok := WelchTTest([]float64{1}, []float64{1, 2}); ok {
+		t.Error("WelchTTest accepted a sample of one value")
+	}
+}
+
+func TestBenjaminiHochberg(t *testing.T) {
+	tests := []struct {
+		name    string
+		pValues []float64
+		want    []float64
+	}{
+		{"empty", nil, []float64{}},
+		{"single", []float64{0.03}, []float64{0.03}},
+		{"all equal after adjustment", []float64{0.01, 0.02, 0.03, 0.04, 0.05}, []float64{0.05, 0.05, 0.05, 0.05, 0.05}},
+		// Sorted: 0.005*4/1 = 0.02, 0.03*4/2 = 0.06, 0.04*4/3 = 0.0533, 0.5*4/4 = 0.5; the second is lowered
+		// to the third to stay monotonic
+		{"unsorted", []float64{0.5, 0.04, 0.005, 0.03}, []float64{0.5, 0.04 * 4 / 3, 0.02, 0.04 * 4 / 3}},
+		{"ties", []float64{0.02, 0.02, 0.9}, []float64{0.03, 0.03, 0.9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BenjaminiHochberg(tt.pValues)
+			if len(got) != len(tt.want) {
+				t.Fatalf("BenjaminiHochberg = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !near(got[i], tt.want[i], 1e-12) {
+					t.Errorf("BenjaminiHochberg = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLinearRegression(t *testing.T) {
+	// Sxx = 10, Sxy = 6, Syy = 6, SSE = 2.4
+	fit, ok := LinearRegression([]float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5})
+	if !ok {
+		t.Fatal("LinearRegression refused the points")
+	}
+
+	low, high := fit.SlopeConfidenceInterval(0.95)
+	checks := []struct {
+		name      string
+		got, want float64
+	}{
+		{"slope", fit.Slope, 0.6},
+		{"intercept", fit.Intercept, 2.2},
+		{"R²", fit.RSquared, 0.6},
+		{"slope standard error", fit.SlopeStdErr, math.Sqrt(0.08)},
+		{"prediction", fit.Predict(6), 5.8},
+		{"slope p-value", fit.SlopePValue(), 0.12402706265757679},
+		// t(0.975, 3) * standard error
+		{"95% interval low", low, 0.6 - 0.9001317452914304},
+		{"95% interval high", high, 0.6 + 0.9001317452914304},
+	}
+	for _, check := range checks {
+		if !near(check.got, check.want, 1e-9) {
+			t.Errorf("%s = %.12g, want %.12g", check.name, check.got, check.want)
+		}
+	}
+
+	// A perfect fit is certain
+	perfect, ok := LinearRegression([]float64{0, 1, 2}, []float64{1, 3, 5})
+	if !ok || perfect.Slope != 2 || perfect.RSquared != 1 || perfect.SlopePValue() != 0 {
+		t.Errorf("perfect fit = %+v, p %v, want slope 2, R² 1, p 0", perfect, perfect.SlopePValue())
+	}
+
+	for _, points := range [][2][]float64{
+		{{1, 2}, {1, 2}},
+		{{2, 2, 2}, {1, 2, 3}},
+		{{1, 2, 3}, {1, 2}},
+	} {
+		if _, ok := LinearRegression(points[0], points[1]); ok {
+			t.Errorf("LinearRegression(%v, %v) succeeded, want refused", points[0], points[1])
+		}
+	}
+}
@@ -56,3 +56,9 @@ func EndOfDayJST(t time.Time) time.Time {
 	jst := t.In(JST)
 	return time.Date(jst.Year(), jst.Month(), jst.Day(), 23, 59, 59, 999999999, JST)
 }
+
+// BeginningOfMonthJST returns the beginning of the month (the 1st, 00:00:00) for the given time in JST
+func BeginningOfMonthJST(t time.Time) time.Time {
+	jst := t.In(JST)
+	return time.Date(jst.Year(), jst.Month(), 1, 0, 0, 0, 0, JST)
+}
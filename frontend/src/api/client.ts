@@ -158,13 +158,17 @@ class ApiClient {
 
   async getUserSessions(params?: {
     limit?: number;
-    offset?: number;
+    cursor?: string;
+    sort?: 'date' | '-date' | 'updated_at' | '-updated_at';
+    includeTotal?: boolean;
     year?: number;
     month?: number;
   }): Promise<SessionsResponse> {
     const searchParams = new URLSearchParams();
     if (params?.limit) searchParams.set('limit', params.limit.toString());
-    if (params?.offset) searchParams.set('offset', params.offset.toString());
+    if (params?.cursor) searchParams.set('cursor', params.cursor);
+    if (params?.sort) searchParams.set('sort', params.sort);
+    if (params?.includeTotal) searchParams.set('include_total', 'true');
     if (params?.year) searchParams.set('year', params.year.toString());
     if (params?.month) searchParams.set('month', params.month.toString());
 
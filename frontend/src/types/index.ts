@@ -154,13 +154,16 @@ export interface SessionSummary {
   updated_at: string;
 }
 
+export interface Pagination {
+  limit: number;
+  next_cursor: string | null;
+  has_more: boolean;
+  total?: number;
+}
+
 export interface SessionsResponse {
   sessions: SessionSummary[];
-  pagination: {
-    total: number;
-    limit: number;
-    offset: number;
-  };
+  pagination: Pagination;
 }
 
 // Error types